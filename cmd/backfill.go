@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dualwrite"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/adjacency-lists-with-gsi-for-reverse-lookup"
+)
+
+// Backfill copies the graph from the configured strategy into the secondary
+// one of a dual-write migration. Run it once dual writes are on. The
+// configured strategy has to be the adjacency lists one, the only strategy
+// that scans the whole graph; other strategies are copied by area with
+// export and import.
+//
+//	graph backfill [--segments 4] [--checkpoint backfill.ckpt] [--batch 25] [--rate 500]
+func Backfill(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	segments := fs.Int("segments", 4, "parallel scan segments of the source")
+	checkpoint := fs.String("checkpoint", "", "checkpoint file to resume the backfill")
+	batch := fs.Int("batch", 25, "edges per write batch")
+	rate := fs.Float64("rate", 0, "max edges written per second, 0 for unlimited")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.DualWriteMode == "" {
+		return errors.New("backfill needs dual_write_mode and secondary_graph_strategy")
+	}
+	db, err := dynamodb.NewDatabase(cfg.LocalDynamoEndpoint, cfg.AwsConfig)
+	if err != nil {
+		return err
+	}
+
+	opts := cfg.StrategyOptions()
+	source, ok := cfg.Strategy.New(db.Client, opts).(graphExporter)
+	if !ok {
+		return fmt.Errorf("strategy %q cannot export the whole graph, copy it by area with export and import", cfg.Strategy.Name)
+	}
+	backfillOpts := dualwrite.BackfillOptions{
+		BatchSize: *batch,
+		Rate:      *rate,
+		Export:    adjacency_lists_with_gsi_for_reverse_lookup.ExportOptions{TotalSegments: *segments},
+		MinTTL:    cfg.EdgeRules.MinTTL,
+	}
+	if *checkpoint != "" {
+		backfillOpts.Export.Checkpoints = adjacency_lists_with_gsi_for_reverse_lookup.NewFileCheckpointStore(*checkpoint)
+	}
+
+	stats, err := dualwrite.Backfill(ctx, source, cfg.SecondaryStrategy.New(db.Client, opts), backfillOpts)
+	slog.InfoContext(ctx, "backfill",
+		"from", cfg.Strategy.Name,
+		"to", cfg.SecondaryStrategy.Name,
+		"read", stats.Read,
+		"expired", stats.Expired,
+		"written", stats.Written,
+	)
+	if err != nil {
+		return fmt.Errorf("backfill: %w", err)
+	}
+	return nil
+}
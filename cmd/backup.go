@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/backup"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/adjacency-lists-with-gsi-for-reverse-lookup"
+)
+
+// Backup writes the graph table as gzip-compressed DynamoDB JSON in the
+// layout of the DynamoDB export to S3.
+//
+//	graph backup --dir ./backups [--table name] [--segments 4]
+func Backup(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	dir := fs.String("dir", ".", "directory to write AWSDynamoDB/{exportId} into")
+	table := fs.String("table", adjacency_lists_with_gsi_for_reverse_lookup.TableName, "table to back up")
+	segments := fs.Int("segments", 4, "parallel scan segments, one data file each")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	db, err := dynamodb.NewDatabase(cfg.LocalDynamoEndpoint, cfg.AwsConfig)
+	if err != nil {
+		return err
+	}
+
+	exportDir, err := backup.Backup(ctx, db.Client, backup.BackupOptions{
+		Table:    *table,
+		Dir:      *dir,
+		Segments: *segments,
+	})
+	if err != nil {
+		return fmt.Errorf("backup %s: %w", *table, err)
+	}
+	slog.InfoContext(ctx, "backup written", "table", *table, "dir", exportDir)
+	return nil
+}
+
+// Restore reads a backup written by Backup, or a DynamoDB export to S3
+// copied locally, back through BatchWriteItem. Restored edges bypass the
+// edge counters, run reconcile-counters after restoring a graph table.
+//
+//	graph restore --dir ./backups/AWSDynamoDB/{exportId} [--table-map old=new] [--migrate]
+func Restore(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	dir := fs.String("dir", "", "export directory with manifest-summary.json")
+	tableMap := fs.String("table-map", "", "comma separated old=new table names")
+	migrate := fs.Bool("migrate", false, "create the tables before restoring")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	tables, err := backup.ParseTableMap(*tableMap)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	db, err := dynamodb.NewDatabase(cfg.LocalDynamoEndpoint, cfg.AwsConfig)
+	if err != nil {
+		return err
+	}
+	if *migrate {
+		db.AreaShards = cfg.AreaShards
+		db.Strategies = cfg.StrategyNames()
+		if err = db.Migrate(ctx); err != nil {
+			return err
+		}
+	}
+
+	stats, err := backup.Restore(ctx, db.Client, backup.RestoreOptions{
+		Dir:      *dir,
+		TableMap: tables,
+	})
+	slog.InfoContext(ctx, "restore",
+		"table", stats.Table,
+		"expected", stats.Expected,
+		"read", stats.Read,
+		"written", stats.Written,
+	)
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	return nil
+}
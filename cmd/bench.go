@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/bench"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+)
+
+// Bench runs the same scripted workloads against every registered storage
+// strategy on DynamoDB Local and compares consumed capacity, latency,
+// item sizes and the projected monthly on-demand cost.
+//
+// Every strategy gets fresh tables that are dropped after its run, so the
+// command refuses to run without a local endpoint.
+//
+//	graph bench [--strategies a,b] [--runs-per-second 1] [--format table|json] [--out file]
+func Bench(ctx context.Context, args []string) error {
+	cfg := bench.DefaultConfig()
+	pricing := bench.DefaultPricing()
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.IntVar(&cfg.Demands, "demands", cfg.Demands, "number of demands")
+	fs.IntVar(&cfg.Supplies, "supplies", cfg.Supplies, "number of supplies")
+	fs.IntVar(&cfg.Areas, "areas", cfg.Areas, "number of areas")
+	fs.IntVar(&cfg.EdgesPerDemand, "edges-per-demand", cfg.EdgesPerDemand, "edges of every demand in the upsert storm")
+	fs.IntVar(&cfg.BatchSize, "batch", cfg.BatchSize, "edges per write call")
+	fs.IntVar(&cfg.Ticks, "ticks", cfg.Ticks, "reads of every area in the area ticks")
+	fs.Uint64Var(&cfg.Seed, "seed", cfg.Seed, "random seed")
+	fs.Float64Var(&pricing.PerMillionReads, "read-price", pricing.PerMillionReads, "dollars per million read request units")
+	fs.Float64Var(&pricing.PerMillionWrites, "write-price", pricing.PerMillionWrites, "dollars per million write request units")
+	fs.Float64Var(&pricing.PerGBMonthStorage, "storage-price", pricing.PerGBMonthStorage, "dollars per GB-month of storage")
+	runsPerSecond := fs.Float64("runs-per-second", 1, "how often every workload repeats in the monthly projection")
+	strategies := fs.String("strategies", "", "comma separated strategies, all registered by default")
+	format := fs.String("format", "table", "output format: table or json")
+	out := fs.String("out", "", "output file, stdout by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	appCfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	if !isLocalEndpoint(appCfg.LocalDynamoEndpoint) {
+		return fmt.Errorf("bench creates and drops tables, local_dynamodb_endpoint %q is not DynamoDB Local",
+			appCfg.LocalDynamoEndpoint)
+	}
+
+	names := dynamodb.Strategies()
+	if *strategies != "" {
+		names = strings.Split(*strategies, ",")
+	}
+	report := bench.Report{Config: cfg, Pricing: pricing, RunsPerSecond: *runsPerSecond}
+	for _, name := range names {
+		result, err := benchStrategy(ctx, appCfg, name, cfg, pricing, *runsPerSecond)
+		if err != nil {
+			return fmt.Errorf("bench %s: %w", name, err)
+		}
+		report.Strategies = append(report.Strategies, result)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	return report.WriteTable(w)
+}
+
+// isLocalEndpoint tells whether the endpoint is DynamoDB Local: on this
+// machine or the dynamodb-local service of compose.yaml.
+func isLocalEndpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return false
+	}
+	switch host := u.Hostname(); host {
+	case "localhost", "dynamodb-local":
+		return true
+	default:
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	}
+}
+
+// benchStrategy runs the workloads on fresh tables of one strategy. A
+// failed workload ends the run of the strategy but not of the bench: the
+// error goes into the result.
+func benchStrategy(
+	ctx context.Context,
+	appCfg *Config,
+	name string,
+	cfg bench.Config,
+	pricing bench.Pricing,
+	runsPerSecond float64,
+) (bench.StrategyResult, error) {
+	result := bench.StrategyResult{Strategy: name}
+	strategy, err := dynamodb.LookupStrategy(name)
+	if err != nil {
+		return result, err
+	}
+
+	// Миграции и замер размеров идут через клиент без счётчика
+	db, err := dynamodb.NewDatabase(appCfg.LocalDynamoEndpoint, appCfg.AwsConfig)
+	if err != nil {
+		return result, err
+	}
+	db.AreaShards = appCfg.AreaShards
+	db.Strategies = []string{name}
+	if err = db.Migrate(ctx); err != nil {
+		return result, err
+	}
+	// Общие таблицы, например история рёбер, остаются
+	defer db.RollbackStrategies(context.WithoutCancel(ctx))
+
+	opts := appCfg.StrategyOptions()
+	for _, workload := range bench.Workloads(cfg) {
+		meter := dynamodb.NewCapacityMeter()
+		awsCfg := appCfg.AwsConfig
+		meter.AddTo(&awsCfg)
+		metered, err := dynamodb.NewDatabase(appCfg.LocalDynamoEndpoint, awsCfg)
+		if err != nil {
+			return result, err
+		}
+
+		rec, runErr := workload.Run(ctx, strategy.New(metered.Client, opts))
+		wr := bench.WorkloadResult{
+			Workload: workload.Name,
+			Calls:    rec.Calls(),
+			Errors:   rec.Errors(),
+			Items:    rec.Items(),
+			Latency:  rec.Latency(),
+		}
+		for _, usage := range meter.Usage() {
+			wr.RCU += usage.RCU
+			wr.WCU += usage.WCU
+		}
+		for _, n := range meter.Throttles() {
+			wr.Throttles += n
+		}
+		wr.MonthlyCost = pricing.MonthlyRequests(wr.RCU, wr.WCU, runsPerSecond)
+		result.Workloads = append(result.Workloads, wr)
+		if runErr != nil {
+			result.Error = runErr.Error()
+			break
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, migration := range strategy.Migrations(opts) {
+		if seen[migration.TableName()] {
+			continue
+		}
+		seen[migration.TableName()] = true
+		stats, err := bench.MeasureTable(ctx, db.Client, migration.TableName())
+		if err != nil {
+			return result, err
+		}
+		result.Tables = append(result.Tables, stats)
+		result.MonthlyStorage += pricing.MonthlyStorage(stats.StorageBytes)
+	}
+	result.Total()
+	return result, nil
+}
@@ -4,7 +4,15 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dualwrite"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/adjacency-lists-with-gsi-for-reverse-lookup"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/telemetry"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -13,10 +21,164 @@ import (
 type Config struct {
 	AwsConfig           aws.Config
 	LocalDynamoEndpoint string // e.g. "http://localhost:8000"
+
+	// Ограничения степени узлов графа, 0 - без ограничений
+	MaxDemandDegree int
+	MaxSupplyDegree int
+
+	// Число шардов ключа области в ak-gsi, 0 или 1 - без шардирования
+	AreaShards int
+	// Число шардов, с которого ключи области переводятся на AreaShards, пока
+	// shard-area-keys не закончил: чтения идут по обеим раскладкам.
+	// -1 - раскладка не меняется
+	PreviousAreaShards int
+
+	// Границы score и TTL записываемых рёбер
+	EdgeRules graph.Rules
+
+	// Сколько хранить снимки областей, снятые на тиках
+	SnapshotRetention time.Duration
+
+	// Сколько хранить историю рёбер, которую Run пишет из потока изменений
+	HistoryRetention time.Duration
+
+	// Области, которые Run матчит каждые TickInterval, и как часто
+	// перечитывать область целиком, см. buffer.New. Между перечитываниями
+	// области следуют потоку изменений таблицы списков смежности; стратегии
+	// без неё перечитывают область на каждом тике
+	TickAreas      []graph.Area
+	TickInterval   time.Duration
+	ResyncInterval time.Duration
+
+	// Стратегия хранения графа, см. dynamodb.Strategies
+	Strategy dynamodb.Strategy
+
+	// Переезд на другую стратегию: режим dualwrite, пусто - выключен
+	DualWriteMode dualwrite.Mode
+	// Стратегия, на которую переезжаем
+	SecondaryStrategy dynamodb.Strategy
+	// Доля чтений, сверяемых с другой стратегией
+	ShadowReadRate float64
+
+	// Требовать счётчики рёбер: точный Size и reconcile-counters. Стратегии
+	// без счётчиков с ним не запускаются
+	EdgeCounters bool
+
+	// Файл событий спроса и предложения, который Run читает и ждёт новые,
+	// см. ingest.Envelope, и файл недоставленных событий, пусто - в лог
+	EventsFile      string
+	DeadLettersFile string
+	// Радиус поиска соседей по позициям из событий и время жизни позиции
+	SearchRadiusKm float64
+	PositionTTL    time.Duration
+
+	// Куда отправлять спаны и метрики: none, stdout, memory или prometheus
+	TelemetryExporter telemetry.Exporter
+	// Адрес, на котором отдаётся /metrics для prometheus
+	MetricsAddr string
+}
+
+// LogConfig is read before Config, so that every command logs the same way
+// and failures of LoadConfig are logged too.
+type LogConfig struct {
+	// debug, info, warn или error
+	Level string
+	// text или json
+	Format string
+}
+
+func LoadLogConfig() LogConfig {
+	return LogConfig{
+		Level:  getEnv("log_level", "info"),
+		Format: getEnv("log_format", "text"),
+	}
+}
+
+// StrategyOptions returns the settings the strategies are created with.
+func (c *Config) StrategyOptions() dynamodb.StrategyOptions {
+	opts := dynamodb.StrategyOptions{AreaShards: c.AreaShards, Rules: c.EdgeRules}
+	if c.PreviousAreaShards >= 0 {
+		// В StrategyOptions 0 значит «не меняется», старые ключи без шардов - 1
+		opts.PreviousAreaShards = max(c.PreviousAreaShards, 1)
+	}
+	return opts
+}
+
+// StrategyNames returns the strategies whose tables the service uses.
+func (c *Config) StrategyNames() []string {
+	if c.DualWriteMode == "" {
+		return []string{c.Strategy.Name}
+	}
+	return []string{c.Strategy.Name, c.SecondaryStrategy.Name}
 }
 
 func LoadConfig() (*Config, error) {
 	localEndpoint := getEnv("local_dynamodb_endpoint", "http://localhost:8000")
+	maxDemandDegree, err := getEnvInt("max_demand_degree", 0)
+	if err != nil {
+		return nil, err
+	}
+	maxSupplyDegree, err := getEnvInt("max_supply_degree", 0)
+	if err != nil {
+		return nil, err
+	}
+	areaShards, err := getEnvInt("area_shards", 0)
+	if err != nil {
+		return nil, err
+	}
+	previousAreaShards, err := getEnvInt("previous_area_shards", -1)
+	if err != nil {
+		return nil, err
+	}
+	snapshotRetention, err := getEnvDuration("snapshot_retention", 7*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	historyRetention, err := getEnvDuration("history_retention", 30*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	tickInterval, err := getEnvDuration("tick_interval", time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if tickInterval <= 0 {
+		return nil, fmt.Errorf("tick_interval must be positive, got %s", tickInterval)
+	}
+	resyncInterval, err := getEnvDuration("resync_interval", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	strategy, err := dynamodb.LookupStrategy(
+		getEnv("graph_strategy", adjacency_lists_with_gsi_for_reverse_lookup.StrategyName),
+	)
+	if err != nil {
+		return nil, err
+	}
+	shadowReadRate, err := getEnvFloat("shadow_read_rate", 0.01)
+	if err != nil {
+		return nil, err
+	}
+	edgeCounters, err := getEnvBool("edge_counters", false)
+	if err != nil {
+		return nil, err
+	}
+	searchRadius, err := getEnvFloat("search_radius_km", 3)
+	if err != nil {
+		return nil, err
+	}
+	positionTTL, err := getEnvDuration("position_ttl", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	edgeRules, err := loadEdgeRules()
+	if err != nil {
+		return nil, err
+	}
+	telemetryExporter, err := telemetry.ParseExporter(getEnv("otel_exporter", string(telemetry.ExporterNone)))
+	if err != nil {
+		return nil, err
+	}
 	cfg, err := config.LoadDefaultConfig(context.Background())
 	if err != nil {
 		return nil, fmt.Errorf("unable to load AWS SDK config: %v", err)
@@ -24,13 +186,158 @@ func LoadConfig() (*Config, error) {
 	cnf := &Config{
 		LocalDynamoEndpoint: localEndpoint,
 		AwsConfig:           cfg,
+		MaxDemandDegree:     maxDemandDegree,
+		MaxSupplyDegree:     maxSupplyDegree,
+		AreaShards:          areaShards,
+		PreviousAreaShards:  previousAreaShards,
+		EdgeRules:           edgeRules,
+		SnapshotRetention:   snapshotRetention,
+		HistoryRetention:    historyRetention,
+		TickAreas:           getEnvAreas("tick_areas", []graph.Area{"area"}),
+		TickInterval:        tickInterval,
+		ResyncInterval:      resyncInterval,
+		Strategy:            strategy,
+		ShadowReadRate:      shadowReadRate,
+		EdgeCounters:        edgeCounters,
+		EventsFile:          getEnvPath("events_file"),
+		DeadLettersFile:     getEnvPath("dead_letters_file"),
+		SearchRadiusKm:      searchRadius,
+		PositionTTL:         positionTTL,
+		TelemetryExporter:   telemetryExporter,
+		MetricsAddr:         getEnv("metrics_addr", ":9464"),
+	}
+	if mode := getEnv("dual_write_mode", ""); mode != "" {
+		if cnf.DualWriteMode, err = dualwrite.ParseMode(mode); err != nil {
+			return nil, err
+		}
+		if cnf.SecondaryStrategy, err = dynamodb.LookupStrategy(getEnv("secondary_graph_strategy", "")); err != nil {
+			return nil, err
+		}
+		if cnf.SecondaryStrategy.Name == cnf.Strategy.Name {
+			return nil, fmt.Errorf("secondary strategy must differ from %q", cnf.Strategy.Name)
+		}
+	}
+	if cnf.EdgeCounters {
+		if err = cnf.checkEdgeCounters(); err != nil {
+			return nil, err
+		}
 	}
 	return cnf, nil
 }
 
+// checkEdgeCounters fails when a strategy in use keeps no edge counters.
+func (c *Config) checkEdgeCounters() error {
+	for _, s := range []dynamodb.Strategy{c.Strategy, c.SecondaryStrategy} {
+		if s.Name == "" || s.Counters {
+			continue
+		}
+		var counting []string
+		for _, name := range dynamodb.Strategies() {
+			if other, _ := dynamodb.LookupStrategy(name); other.Counters {
+				counting = append(counting, name)
+			}
+		}
+		return fmt.Errorf("edge counters are not kept by the %s strategy, only by %v", s.Name, counting)
+	}
+	return nil
+}
+
+func loadEdgeRules() (graph.Rules, error) {
+	rules := graph.DefaultRules()
+	minScore, err := getEnvFloat("edge_min_score", rules.MinScore.Float64())
+	if err != nil {
+		return rules, err
+	}
+	maxScore, err := getEnvFloat("edge_max_score", rules.MaxScore.Float64())
+	if err != nil {
+		return rules, err
+	}
+	if rules.MinTTL, err = getEnvDuration("edge_min_ttl", rules.MinTTL); err != nil {
+		return rules, err
+	}
+	if rules.MaxTTL, err = getEnvDuration("edge_max_ttl", rules.MaxTTL); err != nil {
+		return rules, err
+	}
+	rules.MinScore, rules.MaxScore = graph.Score(minScore), graph.Score(maxScore)
+	if rules.MinScore > rules.MaxScore || rules.MinTTL > rules.MaxTTL {
+		return rules, fmt.Errorf("invalid edge rules: score [%v, %v], ttl [%s, %s]",
+			minScore, maxScore, rules.MinTTL, rules.MaxTTL)
+	}
+	return rules, nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return strings.ToLower(value)
 	}
 	return defaultValue
 }
+
+// getEnvPath returns the value as is: paths are case sensitive.
+func getEnvPath(key string) string {
+	return os.Getenv(key)
+}
+
+// getEnvAreas reads a comma separated list of areas. Area names are kept
+// as is, like paths.
+func getEnvAreas(key string, defaultValue []graph.Area) []graph.Area {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	var areas []graph.Area
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			areas = append(areas, graph.Area(name))
+		}
+	}
+	return areas
+}
+
+func getEnvInt(key string, defaultValue int) (int, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return n, nil
+}
+
+func getEnvBool(key string, defaultValue bool) (bool, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return b, nil
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return d, nil
+}
+
+func getEnvFloat(key string, defaultValue float64) (float64, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return f, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/graphio"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/adjacency-lists-with-gsi-for-reverse-lookup"
+)
+
+type graphExporter interface {
+	ExportAll(
+		ctx context.Context,
+		w adjacency_lists_with_gsi_for_reverse_lookup.EdgeWriter,
+		opts adjacency_lists_with_gsi_for_reverse_lookup.ExportOptions,
+	) error
+}
+
+// Export writes the graph, or the edges of one area, as a jsonl or csv snapshot.
+//
+//	graph export --area X --format jsonl|csv [--out file]
+//	graph export --format jsonl --segments 8 --checkpoint export.ckpt --out graph.jsonl
+func Export(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	area := fs.String("area", "", "export only the edges of this area")
+	format := fs.String("format", "jsonl", "snapshot format: jsonl or csv")
+	out := fs.String("out", "", "output file, stdout by default")
+	segments := fs.Int("segments", 4, "parallel scan segments for a whole-graph export")
+	checkpoint := fs.String("checkpoint", "", "checkpoint file to resume a whole-graph export")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	f, err := graphio.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+	if *checkpoint != "" && (*area != "" || f != graphio.FormatJSONL || *out == "") {
+		return errors.New("checkpoint needs a whole-graph jsonl export to a file")
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	db, err := dynamodb.NewDatabase(cfg.LocalDynamoEndpoint, cfg.AwsConfig)
+	if err != nil {
+		return err
+	}
+	repo := newGraphRepository(cfg, db)
+
+	var (
+		store *adjacency_lists_with_gsi_for_reverse_lookup.FileCheckpointStore
+		saved *adjacency_lists_with_gsi_for_reverse_lookup.ExportCheckpoint
+	)
+	if *checkpoint != "" {
+		store = adjacency_lists_with_gsi_for_reverse_lookup.NewFileCheckpointStore(*checkpoint)
+		if saved, err = store.Load(ctx); err != nil {
+			return err
+		}
+		if saved != nil && saved.Finished() {
+			return fmt.Errorf("the export to %s is finished, remove %s to export again", *out, *checkpoint)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if saved != nil {
+			// При продолжении выгрузки дописываем в тот же файл
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		file, err := os.OpenFile(*out, flags, 0o644)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	enc, err := graphio.NewEncoder(f, w)
+	if err != nil {
+		return err
+	}
+
+	if *area != "" {
+		edges, err := repo.ReadAreaEdges(ctx, graph.Area(*area))
+		if err != nil {
+			return err
+		}
+		if err = enc.WriteEdges(edges...); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+
+	// Выгрузку всего графа сканированием умеет только стратегия списков смежности
+	exporter, ok := repo.(graphExporter)
+	if !ok {
+		return fmt.Errorf("strategy %q cannot export the whole graph, export by --area", cfg.Strategy.Name)
+	}
+	opts := adjacency_lists_with_gsi_for_reverse_lookup.ExportOptions{TotalSegments: *segments}
+	if store != nil {
+		opts.Checkpoints = store
+	}
+	if err = exporter.ExportAll(ctx, enc, opts); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Import loads a jsonl or csv snapshot into the graph.
+//
+//	graph import --format jsonl|csv [--in file] [--batch 25] [--rate 500]
+func Import(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "jsonl", "snapshot format: jsonl or csv")
+	in := fs.String("in", "", "input file, stdin by default")
+	batch := fs.Int("batch", 25, "edges per write batch")
+	rate := fs.Float64("rate", 0, "max edges written per second, 0 for unlimited")
+	ttl := fs.Duration("ttl", 15*time.Minute, "TTL for records without expires_at")
+	migrate := fs.Bool("migrate", false, "create the tables before importing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	f, err := graphio.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "" {
+		file, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	dec, err := graphio.NewDecoder(f, r)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	db, err := dynamodb.NewDatabase(cfg.LocalDynamoEndpoint, cfg.AwsConfig)
+	if err != nil {
+		return err
+	}
+	if *migrate {
+		db.AreaShards = cfg.AreaShards
+		db.Strategies = cfg.StrategyNames()
+		if err = db.Migrate(ctx); err != nil {
+			return err
+		}
+	}
+
+	importer := graphio.NewImporter(newGraphRepository(cfg, db), graphio.ImportOptions{
+		BatchSize:  *batch,
+		Rate:       *rate,
+		DefaultTTL: *ttl,
+		MinTTL:     cfg.EdgeRules.MinTTL,
+	})
+	stats, err := importer.Import(ctx, dec)
+	slog.InfoContext(ctx, "import",
+		"read", stats.Read,
+		"duplicates", stats.Duplicates,
+		"expired", stats.Expired,
+		"written", stats.Written,
+	)
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+	return nil
+}
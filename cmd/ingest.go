@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/ingest"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/instrumented"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/memory"
+	demandUseCase "github.com/ashabykov/graph-building-in-dynamodb/internal/usecase/demand"
+	supplyUseCase "github.com/ashabykov/graph-building-in-dynamodb/internal/usecase/supply"
+)
+
+// ingestGraph - то, что нужно use case'ам от репозитория
+type ingestGraph interface {
+	UpsertEdges(ctx context.Context, edges ...graph.Edge) error
+	RemoveEdges(ctx context.Context, edges ...graph.Edge) error
+	ReadSupplyEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error)
+}
+
+// Ingest runs the demand and supply events of a JSON lines file through
+// the use cases, see ingest.Envelope for the format. It continues after
+// the last handled event of the previous run and stops at the end of the
+// file, or waits for more with --follow. The positions of the events
+// stand in for the geo readers. The dynamodb backend migrates and writes
+// to the configured endpoint, meant for DynamoDB Local, and logs the mean
+// capacity one event of every use case consumed.
+//
+//	graph ingest --events events.jsonl [--dead-letters dead.jsonl] [--backend memory|dynamodb] [--radius 3] [--follow 1s]
+func Ingest(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	events := fs.String("events", "", "JSON lines file of events")
+	offsets := fs.String("offsets", "", "offset file, the events file with the .offset suffix by default")
+	deadLetters := fs.String("dead-letters", "", "JSON lines file of dead letters, logged by default")
+	backend := fs.String("backend", "memory", "graph backend: memory or dynamodb")
+	radius := fs.Float64("radius", 3, "radius the readers search in, km")
+	ttl := fs.Duration("position-ttl", 15*time.Minute, "how long a position is searched for")
+	maxAttempts := fs.Int("max-attempts", 5, "deliveries of an event before it is a dead letter")
+	follow := fs.Duration("follow", 0, "wait for appended events, checking every interval")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *events == "" {
+		return fmt.Errorf("--events is required")
+	}
+
+	var (
+		repo     ingestGraph
+		capacity *dynamodb.EventCapacity
+	)
+	switch *backend {
+	case "memory":
+		repo = memory.New()
+	case "dynamodb":
+		var err error
+		if repo, err = ingestDynamoDB(ctx); err != nil {
+			return err
+		}
+		capacity = dynamodb.NewEventCapacity()
+	default:
+		return fmt.Errorf("unknown backend %q", *backend)
+	}
+
+	var sourceOpts []ingest.FileOption
+	if *offsets != "" {
+		sourceOpts = append(sourceOpts, ingest.WithOffsetFile(*offsets))
+	}
+	if *follow > 0 {
+		sourceOpts = append(sourceOpts, ingest.WithFollow(*follow))
+	}
+	source, err := ingest.OpenFileSource(*events, sourceOpts...)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	opts := []ingest.Option{ingest.WithMaxAttempts(*maxAttempts)}
+	if *deadLetters != "" {
+		dl, err := ingest.OpenFileDeadLetters(*deadLetters)
+		if err != nil {
+			return err
+		}
+		defer dl.Close()
+		opts = append(opts, ingest.WithDeadLetters(dl))
+	}
+	if capacity != nil {
+		opts = append(opts, ingest.WithTracker(capacity.Track))
+	}
+
+	pipeline := newIngestPipeline(source, repo, *radius, *ttl, opts...)
+
+	// Прерывание останавливает приём, обработанные события уже подтверждены
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	err = pipeline.Run(ctx)
+	stats := pipeline.Stats()
+	slog.InfoContext(ctx, "ingest",
+		"events", *events,
+		"backend", *backend,
+		"received", stats.Received,
+		"handled", stats.Handled,
+		"retried", stats.Retried,
+		"dead_lettered", stats.DeadLettered,
+		"dropped", stats.Dropped,
+	)
+	if capacity != nil {
+		logEventCapacity(ctx, capacity)
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// newIngestPipeline passes the events of the source to the demand and
+// supply use cases writing to repo. The positions of the events stand in
+// for the geo readers, see ingest.Index.
+func newIngestPipeline(
+	source ingest.Source,
+	repo ingestGraph,
+	radiusKm float64,
+	positionTTL time.Duration,
+	opts ...ingest.Option,
+) *ingest.Pipeline {
+	index := ingest.NewIndex(radiusKm, positionTTL)
+	return ingest.New(
+		source,
+		index.Demands(demandUseCase.New(ingest.SupplyReader{Index: index}, repo)),
+		index.Supplies(supplyUseCase.New(ingest.DemandReader{Index: index}, repo)),
+		opts...,
+	)
+}
+
+// logEventCapacity logs the mean capacity of one event of every cause.
+func logEventCapacity(ctx context.Context, capacity *dynamodb.EventCapacity) {
+	for _, usage := range capacity.Usage() {
+		rcu, wcu := usage.PerEvent()
+		slog.InfoContext(ctx, "event capacity",
+			"cause", usage.Cause,
+			"events", usage.Events,
+			"calls", usage.Calls,
+			"rcu_per_event", rcu,
+			"wcu_per_event", wcu,
+		)
+	}
+}
+
+// ingestDynamoDB builds the repository of the configured strategy with
+// the degree caps, like Run does. Its client reports the capacity of
+// every call, see dynamodb.EventCapacity.
+func ingestDynamoDB(ctx context.Context) (ingestGraph, error) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	dynamodb.NewCapacityMeter().AddTo(&cfg.AwsConfig)
+	db, err := dynamodb.NewDatabase(cfg.LocalDynamoEndpoint, cfg.AwsConfig)
+	if err != nil {
+		return nil, err
+	}
+	db.AreaShards = cfg.AreaShards
+	db.Strategies = cfg.StrategyNames()
+	if err = db.Migrate(ctx); err != nil {
+		return nil, fmt.Errorf("migrate the database: %w", err)
+	}
+	backend := newGraphRepository(cfg, db)
+	repo, err := instrumented.New(backend)
+	if err != nil {
+		return nil, fmt.Errorf("instrument the graph repository: %w", err)
+	}
+	return newCappedRepository(cfg, repo, backend), nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/loadgen"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+)
+
+// loadReport is the machine-readable output of the load command.
+type loadReport struct {
+	loadgen.Report
+
+	// Throttles counts throttled attempts by DynamoDB operation,
+	// including the ones the SDK retried successfully
+	Throttles map[string]int           `json:"throttles"`
+	Capacity  []dynamodb.CapacityUsage `json:"capacity"`
+}
+
+// Load drives UpsertEdges, RemoveEdges and ReadAreaEdges against DynamoDB
+// at target rates and writes a JSON report with latencies, throttles
+// and consumed capacity.
+//
+//	graph load [--duration 1m] [--upsert-rate 100] [--remove-rate 20] [--read-rate 5] [--skew 1.2] [--out report.json]
+func Load(ctx context.Context, args []string) error {
+	cfg := loadgen.DefaultConfig()
+	fs := flag.NewFlagSet("load", flag.ContinueOnError)
+	fs.DurationVar(&cfg.Duration, "duration", cfg.Duration, "how long to drive the load")
+	fs.IntVar(&cfg.Workers, "workers", cfg.Workers, "operations in flight at most")
+	fs.Float64Var(&cfg.UpsertRate, "upsert-rate", cfg.UpsertRate, "UpsertEdges calls per second")
+	fs.Float64Var(&cfg.RemoveRate, "remove-rate", cfg.RemoveRate, "RemoveEdges calls per second")
+	fs.Float64Var(&cfg.ReadAreaRate, "read-rate", cfg.ReadAreaRate, "ReadAreaEdges calls per second")
+	fs.IntVar(&cfg.BatchSize, "batch", cfg.BatchSize, "edges per write call")
+	fs.IntVar(&cfg.Demands, "demands", cfg.Demands, "number of distinct demands")
+	fs.IntVar(&cfg.Supplies, "supplies", cfg.Supplies, "number of distinct supplies")
+	fs.IntVar(&cfg.Areas, "areas", cfg.Areas, "number of distinct areas")
+	fs.Float64Var(&cfg.Skew, "skew", cfg.Skew, "Zipf exponent of key popularity (> 1), 0 for uniform keys")
+	fs.DurationVar(&cfg.TTL, "ttl", cfg.TTL, "edge TTL")
+	fs.Uint64Var(&cfg.Seed, "seed", cfg.Seed, "random seed")
+	out := fs.String("out", "", "report file, stdout by default")
+	migrate := fs.Bool("migrate", false, "create the tables before the run")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	appCfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	if *migrate {
+		db, err := dynamodb.NewDatabase(appCfg.LocalDynamoEndpoint, appCfg.AwsConfig)
+		if err != nil {
+			return err
+		}
+		db.AreaShards = appCfg.AreaShards
+		db.Strategies = appCfg.StrategyNames()
+		if err = db.Migrate(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Отдельный клиент, чтобы миграции не попали в отчёт
+	meter := dynamodb.NewCapacityMeter()
+	awsCfg := appCfg.AwsConfig
+	meter.AddTo(&awsCfg)
+	db, err := dynamodb.NewDatabase(appCfg.LocalDynamoEndpoint, awsCfg)
+	if err != nil {
+		return err
+	}
+	generator, err := loadgen.New(cfg, newGraphRepository(appCfg, db))
+	if err != nil {
+		return err
+	}
+	report, runErr := generator.Run(ctx)
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(loadReport{
+		Report:    report,
+		Throttles: meter.Throttles(),
+		Capacity:  meter.Usage(),
+	}); err != nil {
+		return err
+	}
+	return runErr
+}
@@ -2,36 +2,284 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/ingest"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/logging"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/matching"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/capped"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dualwrite"
 	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/adjacency-lists-with-gsi-for-reverse-lookup"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/history"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/snapshot"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/stream"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/instrumented"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/telemetry"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/usecase/buffer"
+
+	// Стратегии хранения регистрируются при импорте
+	_ "github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/area-partitioned-packed-adjacency"
+	_ "github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/duplicated-reverse-items"
 )
 
+// commands - подкоманды, без подкоманды запускается Run
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"export":             Export,
+	"import":             Import,
+	"backup":             Backup,
+	"restore":            Restore,
+	"replay":             Replay,
+	"simulate":           Simulate,
+	"load":               Load,
+	"backfill":           Backfill,
+	"bench":              Bench,
+	"ingest":             Ingest,
+	"reconcile-counters": ReconcileCounters,
+	"shard-area-keys":    ShardAreaKeys,
+}
+
+// Run serves the graph: the demand and supply events of the events file
+// are passed to the use cases, which write the edges with the degree caps,
+// and the tick areas are matched every tick interval. Between resyncs the
+// areas follow the change feed of the graph table. It waits for appended
+// events until it is interrupted; /metrics is served until it returns.
 func Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx = logging.With(logging.WithRequestID(ctx), logging.KeyOperation, "run")
 
 	cfg, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+	if cfg.EventsFile == "" {
+		return fmt.Errorf("events_file is required")
+	}
 
+	tel, err := telemetry.New(cfg.TelemetryExporter)
 	if err != nil {
-		log.Fatalf("Error loading configuration: %v", err)
+		return fmt.Errorf("set up telemetry: %w", err)
+	}
+	tel.Install()
+	defer tel.Shutdown(context.Background())
+	if cfg.TelemetryExporter == telemetry.ExporterPrometheus {
+		metrics := serveMetrics(cfg.MetricsAddr, tel.Handler())
+		defer metrics.Shutdown(context.Background())
 	}
 
+	// Каждый вызов репозитория возвращает потреблённую ёмкость
+	capacityMetrics, err := dynamodb.NewOtelCapacityMetrics(tel.MeterProvider)
+	if err != nil {
+		return fmt.Errorf("create capacity metrics: %w", err)
+	}
+	meter := dynamodb.NewCapacityMeter(dynamodb.WithCapacityMetrics(capacityMetrics))
+	meter.AddTo(&cfg.AwsConfig)
+	dynamodb.NewTracing().AddTo(&cfg.AwsConfig)
+
 	dynamoDb, err := dynamodb.NewDatabase(cfg.LocalDynamoEndpoint, cfg.AwsConfig)
 	if err != nil {
-		log.Fatalf("Error creating DynamoDB client: %v", err)
+		return fmt.Errorf("create DynamoDB client: %w", err)
+	}
+
+	dynamoDb.AreaShards = cfg.AreaShards
+	dynamoDb.Strategies = cfg.StrategyNames()
+	if err = dynamoDb.Migrate(ctx); err != nil {
+		return fmt.Errorf("migrate the database: %w", err)
+	}
+
+	backend := newGraphRepository(cfg, dynamoDb)
+	repo, err := instrumented.New(backend)
+	if err != nil {
+		return fmt.Errorf("instrument the graph repository: %w", err)
 	}
+	graphRepo := newCappedRepository(cfg, repo, backend)
 
-	if migrateErr := dynamoDb.Migrate(context.Background()); migrateErr != nil {
-		log.Fatal("Failed to migrate the database")
-		return err
+	source, err := ingest.OpenFileSource(cfg.EventsFile, ingest.WithFollow(time.Second))
+	if err != nil {
+		return fmt.Errorf("open the events: %w", err)
+	}
+	defer source.Close()
+	// Ёмкость каждого события попадает в лог при остановке
+	capacity := dynamodb.NewEventCapacity()
+	defer logEventCapacity(ctx, capacity)
+	opts := []ingest.Option{ingest.WithTracker(capacity.Track)}
+	if cfg.DeadLettersFile != "" {
+		deadLetters, err := ingest.OpenFileDeadLetters(cfg.DeadLettersFile)
+		if err != nil {
+			return fmt.Errorf("open the dead letters: %w", err)
+		}
+		defer deadLetters.Close()
+		opts = append(opts, ingest.WithDeadLetters(deadLetters))
 	}
+	pipeline := newIngestPipeline(source, graphRepo, cfg.SearchRadiusKm, cfg.PositionTTL, opts...)
 
-	graphRepo := adjacency_lists_with_gsi_for_reverse_lookup.New(dynamoDb.Client)
+	// Поток изменений есть только у таблицы списков смежности: без неё
+	// область перечитывается на каждом тике
+	follow := slices.Contains(cfg.StrategyNames(), adjacency_lists_with_gsi_for_reverse_lookup.StrategyName)
+	resyncInterval := cfg.ResyncInterval
+	if !follow {
+		resyncInterval = 0
+	}
+	// Ограничения степени не нужны для чтения, тики читают напрямую
+	ticks := buffer.New(
+		repo,
+		matching.NewGreedy(),
+		resyncInterval,
+		buffer.WithSnapshots(snapshot.New(dynamoDb.Client, cfg.SnapshotRetention)),
+		buffer.WithMeterProvider(tel.MeterProvider),
+	)
 
-	return nil
+	slog.InfoContext(ctx, "serving",
+		"events", cfg.EventsFile, "strategy", cfg.Strategy.Name, "areas", cfg.TickAreas,
+		"follow_changes", follow)
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	if follow {
+		strategyOpts := cfg.StrategyOptions()
+		// Одно чтение потока двигает тики и пишет историю рёбер
+		handlers := stream.Handlers{ticks, history.New(dynamoDb.Client, cfg.HistoryRetention)}
+		changes := stream.New("run", dynamoDb.StreamsClient, dynamoDb.Client, handlers,
+			stream.WithAreaShards(strategyOpts.AreaShards),
+			stream.WithPreviousAreaShards(strategyOpts.PreviousAreaShards),
+		)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			followChanges(runCtx, changes, cfg.TickInterval)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		tickAreas(runCtx, ticks, cfg.TickAreas, cfg.TickInterval)
+	}()
+	err = pipeline.Run(runCtx)
+	cancel()
+	wg.Wait()
+	if ctx.Err() != nil {
+		// Остановка по сигналу: обработанные события подтверждены
+		return nil
+	}
+	return err
+}
+
+// tickAreas ticks the areas one after another every interval until ctx
+// is done. A failed tick is logged, the area is ticked again next time.
+func tickAreas(ctx context.Context, ticks *buffer.UseCase, areas []graph.Area, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, area := range areas {
+			if err := ticks.Tick(area); err != nil {
+				slog.ErrorContext(ctx, "tick failed", "area", area, "error", err)
+			}
+		}
+	}
+}
+
+// followChanges runs the change feed consumer until ctx is done. A failed
+// consumer is logged and restarted after retry; until it catches up the
+// areas are only as fresh as their resyncs.
+func followChanges(ctx context.Context, changes *stream.Consumer, retry time.Duration) {
+	for {
+		err := changes.Run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.ErrorContext(ctx, "change feed stopped", "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+type supplyDegrees interface {
+	SupplyDegree(ctx context.Context, node graph.Node) (int, error)
+}
+
+// newCappedRepository limits the degree of the nodes the use cases write.
+// The supply cap is checked against the edge counters of the backend when
+// it keeps them.
+func newCappedRepository(cfg *Config, repo *instrumented.Repository, backend dynamodb.GraphRepository) *capped.Repository {
+	var opts []capped.Option
+	if degrees, ok := backend.(supplyDegrees); ok {
+		opts = append(opts, capped.WithSupplyDegrees(degrees))
+	}
+	return capped.New(repo, cfg.MaxDemandDegree, cfg.MaxSupplyDegree, opts...)
+}
+
+// serveMetrics serves /metrics on addr in the background.
+func serveMetrics(addr string, handler http.Handler) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("metrics server stopped", "addr", addr, "error", err)
+		}
+	}()
+	return srv
+}
+
+// newGraphRepository builds the repository of the configured strategy,
+// wrapped for dual writes while moving to the secondary one.
+func newGraphRepository(cfg *Config, db *dynamodb.DynamoDb) dynamodb.GraphRepository {
+	opts := cfg.StrategyOptions()
+	primary := cfg.Strategy.New(db.Client, opts)
+	if cfg.DualWriteMode == "" {
+		return primary
+	}
+	return dualwrite.New(
+		primary,
+		cfg.SecondaryStrategy.New(db.Client, opts),
+		cfg.DualWriteMode,
+		dualwrite.WithShadowRate(cfg.ShadowReadRate),
+	)
 }
 
 func main() {
-	if err := Run(); err != nil {
-		log.Fatal(err)
+	logCfg := LoadLogConfig()
+	logger, err := logging.New(os.Stderr, logCfg.Level, logCfg.Format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	// Выходим только здесь: библиотечный код и команды возвращают ошибки
+	if err = run(os.Args[1:]); err != nil {
+		slog.Error("exit", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return Run()
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
 	}
+	ctx := logging.With(logging.WithRequestID(context.Background()), logging.KeyOperation, args[0])
+	return command(ctx, args[1:])
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+)
+
+type counterReconciler interface {
+	Reconcile(ctx context.Context) (dynamodb.ReconcileStats, error)
+}
+
+// ReconcileCounters recounts the edge counters of the strategies in use
+// that keep them, see dynamodb.Strategy.Counters, and corrects their drift.
+// Without --every it runs once.
+//
+//	graph reconcile-counters [--every 1h]
+func ReconcileCounters(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reconcile-counters", flag.ContinueOnError)
+	every := fs.Duration("every", 0, "run the reconciliation periodically, 0 to run once")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	db, err := dynamodb.NewDatabase(cfg.LocalDynamoEndpoint, cfg.AwsConfig)
+	if err != nil {
+		return err
+	}
+	repos := make(map[string]counterReconciler)
+	for _, s := range []dynamodb.Strategy{cfg.Strategy, cfg.SecondaryStrategy} {
+		if s.Name == "" {
+			continue
+		}
+		if repo, ok := s.New(db.Client, cfg.StrategyOptions()).(counterReconciler); ok && s.Counters {
+			repos[s.Name] = repo
+		}
+	}
+	if len(repos) == 0 {
+		return fmt.Errorf("strategies %v keep no edge counters", cfg.StrategyNames())
+	}
+
+	for {
+		for name, repo := range repos {
+			start := time.Now()
+			stats, err := repo.Reconcile(ctx)
+			slog.InfoContext(ctx, "reconcile counters",
+				"strategy", name,
+				"checked", stats.Checked,
+				"corrected", stats.Corrected,
+				"removed", stats.Removed,
+				"skipped", stats.Skipped,
+				"duration", time.Since(start).Round(time.Millisecond),
+			)
+			if err != nil {
+				return fmt.Errorf("reconcile counters of %s: %w", name, err)
+			}
+		}
+		if *every <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(*every):
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/matching"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/snapshot"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/usecase/buffer"
+)
+
+type matchMaker interface {
+	Match(g map[graph.Node][]graph.Node) (graph.Matching, error)
+}
+
+// matchers - алгоритмы, которые можно прогнать на снимке
+var matchers = map[string]func() matchMaker{
+	"greedy": func() matchMaker { return matching.NewGreedy() },
+}
+
+// Replay loads an area snapshot and re-runs a matcher against it,
+// printing how the result differs from the recorded one. Without --tick
+// it lists the snapshots of the area taken in the last --since.
+//
+//	graph replay --area X [--tick 2025-04-10T12:00:00.123Z] [--matcher greedy] [--since 1h]
+func Replay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	area := fs.String("area", "", "area of the snapshot")
+	tick := fs.String("tick", "", "tick of the snapshot, RFC 3339")
+	name := fs.String("matcher", "greedy", "matcher to replay: "+strings.Join(slices.Sorted(maps.Keys(matchers)), ", "))
+	since := fs.Duration("since", time.Hour, "how far back to list snapshots")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *area == "" {
+		return fmt.Errorf("--area is required")
+	}
+	newMatcher, ok := matchers[*name]
+	if !ok {
+		return fmt.Errorf("unknown matcher %q", *name)
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	db, err := dynamodb.NewDatabase(cfg.LocalDynamoEndpoint, cfg.AwsConfig)
+	if err != nil {
+		return err
+	}
+	store := snapshot.New(db.Client, cfg.SnapshotRetention)
+
+	if *tick == "" {
+		now := time.Now()
+		ticks, err := store.Ticks(ctx, graph.Area(*area), now.Add(-*since), now)
+		if err != nil {
+			return err
+		}
+		for _, t := range ticks {
+			fmt.Println(t.Format(time.RFC3339Nano))
+		}
+		return nil
+	}
+
+	at, err := time.Parse(time.RFC3339Nano, *tick)
+	if err != nil {
+		return fmt.Errorf("invalid --tick: %w", err)
+	}
+	recorded, err := store.Load(ctx, graph.Area(*area), at)
+	if err != nil {
+		return err
+	}
+	replayed, err := buffer.Replay(recorded, newMatcher())
+	if err != nil {
+		return fmt.Errorf("replay with %s: %w", *name, err)
+	}
+
+	slog.InfoContext(ctx, "replay",
+		"area", recorded.Area,
+		"tick", recorded.Tick.Format(time.RFC3339Nano),
+		"edges", len(recorded.Edges),
+		"recorded_matched", len(recorded.Matches),
+		"matcher", *name,
+		"replayed_matched", len(replayed),
+	)
+	if recorded.MatchError != "" {
+		slog.WarnContext(ctx, "replay: recorded matcher failed", "error", recorded.MatchError)
+	}
+	for _, node := range recorded.Matches.Diff(replayed) {
+		fmt.Printf("%s\t%s\t%s\n", node, recorded.Matches[node], replayed[node])
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/adjacency-lists-with-gsi-for-reverse-lookup"
+)
+
+// ShardAreaKeys moves the area keys of the adjacency lists strategy from
+// --from shards to the configured area_shards. Change the shard count
+// together with previous_area_shards, so the service reads both layouts,
+// run this once and unset previous_area_shards when it is done.
+//
+//	graph shard-area-keys [--from 0]
+func ShardAreaKeys(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("shard-area-keys", flag.ContinueOnError)
+	from := fs.Int("from", -1, "shard count the area keys were written with, 0 for unsharded, previous_area_shards by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	if *from < 0 {
+		if cfg.PreviousAreaShards < 0 {
+			return fmt.Errorf("--from or previous_area_shards is required")
+		}
+		*from = cfg.PreviousAreaShards
+	}
+	if !slices.Contains(cfg.StrategyNames(), adjacency_lists_with_gsi_for_reverse_lookup.StrategyName) {
+		return fmt.Errorf("area keys are backfilled for the %s strategy only", adjacency_lists_with_gsi_for_reverse_lookup.StrategyName)
+	}
+	db, err := dynamodb.NewDatabase(cfg.LocalDynamoEndpoint, cfg.AwsConfig)
+	if err != nil {
+		return err
+	}
+	repo := adjacency_lists_with_gsi_for_reverse_lookup.New(db.Client,
+		adjacency_lists_with_gsi_for_reverse_lookup.WithAreaShards(cfg.AreaShards))
+
+	rewritten, err := repo.ShardAreaKeys(ctx, *from)
+	slog.InfoContext(ctx, "shard area keys", "from", *from, "to", cfg.AreaShards, "rewritten", rewritten)
+	if err != nil {
+		return fmt.Errorf("shard area keys: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/memory"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/simulator"
+)
+
+// Simulate runs synthetic demand and supply through the use cases and the
+// tick loop and prints a JSON report. The dynamodb backend migrates and
+// writes to the configured endpoint, meant for DynamoDB Local.
+//
+//	graph simulate [--backend memory|dynamodb] [--duration 1h] [--demand-rate 0.5] [--spatial hotspots]
+func Simulate(ctx context.Context, args []string) error {
+	cfg := simulator.DefaultConfig()
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	backend := fs.String("backend", "memory", "graph backend: memory or dynamodb")
+	name := fs.String("matcher", "greedy", "matcher to run on ticks")
+	fs.DurationVar(&cfg.Duration, "duration", cfg.Duration, "simulated time")
+	fs.DurationVar(&cfg.Step, "step", cfg.Step, "clock resolution")
+	fs.DurationVar(&cfg.TickInterval, "tick", cfg.TickInterval, "tick interval")
+	fs.Float64Var(&cfg.DemandRate, "demand-rate", cfg.DemandRate, "demand arrivals per second")
+	fs.Float64Var(&cfg.SupplyRate, "supply-rate", cfg.SupplyRate, "supply arrivals per second")
+	fs.Float64Var(&cfg.RadiusKm, "radius", cfg.RadiusKm, "region radius, km")
+	spatial := fs.String("spatial", string(cfg.Spatial), "placement: uniform or hotspots")
+	fs.IntVar(&cfg.Hotspots, "hotspots", cfg.Hotspots, "number of hotspots")
+	fs.Float64Var(&cfg.HotspotSpreadKm, "hotspot-spread", cfg.HotspotSpreadKm, "hotspot spread, km")
+	fs.Float64Var(&cfg.SpeedKmh, "speed", cfg.SpeedKmh, "supply speed, km/h")
+	fs.DurationVar(&cfg.UpdateInterval, "update-interval", cfg.UpdateInterval, "supply position update interval")
+	fs.DurationVar(&cfg.Trip, "trip", cfg.Trip, "time a matched supply is busy")
+	fs.DurationVar(&cfg.Shift, "shift", cfg.Shift, "time a supply stays online")
+	fs.Float64Var(&cfg.MatchRadiusKm, "match-radius", cfg.MatchRadiusKm, "radius the readers search in, km")
+	fs.DurationVar(&cfg.Patience, "patience", cfg.Patience, "time a demand waits before leaving")
+	fs.Uint64Var(&cfg.Seed, "seed", cfg.Seed, "random seed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch simulator.Spatial(*spatial) {
+	case simulator.SpatialUniform, simulator.SpatialHotspots:
+		cfg.Spatial = simulator.Spatial(*spatial)
+	default:
+		return fmt.Errorf("unknown spatial distribution %q", *spatial)
+	}
+	newMatcher, ok := matchers[*name]
+	if !ok {
+		return fmt.Errorf("unknown matcher %q", *name)
+	}
+
+	clock := simulator.NewClock(time.Now())
+	var (
+		report simulator.Report
+		err    error
+	)
+	switch *backend {
+	case "memory":
+		repo := memory.New(memory.WithClock(clock.Now))
+		report, err = simulator.New(cfg, clock, repo, newMatcher()).Run(ctx)
+	case "dynamodb":
+		report, err = simulateDynamoDB(ctx, cfg, clock, newMatcher())
+	default:
+		return fmt.Errorf("unknown backend %q", *backend)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if encErr := enc.Encode(report); encErr != nil {
+		return encErr
+	}
+	return err
+}
+
+// simulateDynamoDB runs the simulation against the configured DynamoDB
+// and adds the API calls it made to the report.
+func simulateDynamoDB(
+	ctx context.Context,
+	cfg simulator.Config,
+	clock *simulator.Clock,
+	matcher matchMaker,
+) (simulator.Report, error) {
+	appCfg, err := LoadConfig()
+	if err != nil {
+		return simulator.Report{}, err
+	}
+	operations := dynamodb.NewOperationCounter()
+	operations.AddTo(&appCfg.AwsConfig)
+	db, err := dynamodb.NewDatabase(appCfg.LocalDynamoEndpoint, appCfg.AwsConfig)
+	if err != nil {
+		return simulator.Report{}, err
+	}
+	db.AreaShards = appCfg.AreaShards
+	db.Strategies = appCfg.StrategyNames()
+	if err = db.Migrate(ctx); err != nil {
+		return simulator.Report{}, err
+	}
+
+	before := operations.Counts()
+	report, err := simulator.New(cfg, clock, newGraphRepository(appCfg, db), matcher).Run(ctx)
+	report.DynamoDB = operations.Counts()
+	// Вызовы миграций в отчёт не входят
+	for op, n := range before {
+		report.DynamoDB[op] -= n
+		if report.DynamoDB[op] == 0 {
+			delete(report.DynamoDB, op)
+		}
+	}
+	return report, err
+}
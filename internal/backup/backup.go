@@ -0,0 +1,241 @@
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Layout of the DynamoDB export to S3, written to a local directory:
+//
+//	{dir}/AWSDynamoDB/{exportId}/manifest-summary.json
+//	{dir}/AWSDynamoDB/{exportId}/manifest-files.json
+//	{dir}/AWSDynamoDB/{exportId}/data/{file}.json.gz
+const (
+	exportRoot          = "AWSDynamoDB"
+	manifestSummaryFile = "manifest-summary.json"
+	manifestFilesFile   = "manifest-files.json"
+	dataDir             = "data"
+)
+
+type ManifestSummary struct {
+	Version            string    `json:"version"`
+	ExportArn          string    `json:"exportArn"`
+	StartTime          time.Time `json:"startTime"`
+	EndTime            time.Time `json:"endTime"`
+	TableArn           string    `json:"tableArn"`
+	TableId            string    `json:"tableId"`
+	ExportTime         time.Time `json:"exportTime"`
+	S3Bucket           string    `json:"s3Bucket"`
+	S3Prefix           *string   `json:"s3Prefix"`
+	S3SseAlgorithm     string    `json:"s3SseAlgorithm"`
+	S3SseKmsKeyId      *string   `json:"s3SseKmsKeyId"`
+	ManifestFilesS3Key string    `json:"manifestFilesS3Key"`
+	BilledSizeBytes    int64     `json:"billedSizeBytes"`
+	ItemCount          int64     `json:"itemCount"`
+	OutputFormat       string    `json:"outputFormat"`
+}
+
+// TableName extracts the table name from the table ARN.
+func (s ManifestSummary) TableName() string {
+	_, name, _ := strings.Cut(s.TableArn, ":table/")
+	return name
+}
+
+type ManifestFile struct {
+	ItemCount     int64  `json:"itemCount"`
+	MD5Checksum   string `json:"md5Checksum"`
+	ETag          string `json:"etag"`
+	DataFileS3Key string `json:"dataFileS3Key"`
+}
+
+type BackupOptions struct {
+	Table string
+	// Dir - каталог, в котором создаётся AWSDynamoDB/{exportId}
+	Dir string
+	// Segments - число параллельных сегментов Scan и файлов данных, по умолчанию 1
+	Segments int
+}
+
+// Backup writes every item of the table in the DYNAMODB_JSON export layout
+// and returns the export directory.
+func Backup(ctx context.Context, client *dynamodb.Client, opts BackupOptions) (string, error) {
+	segments := max(opts.Segments, 1)
+	start := time.Now().UTC()
+
+	table, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(opts.Table),
+	})
+	if err != nil {
+		return "", fmt.Errorf("describe table %s: %w", opts.Table, err)
+	}
+
+	exportId, err := newExportId(start)
+	if err != nil {
+		return "", err
+	}
+	prefix := path.Join(exportRoot, exportId)
+	exportDir := filepath.Join(opts.Dir, filepath.FromSlash(prefix))
+	if err = os.MkdirAll(filepath.Join(exportDir, dataDir), 0o755); err != nil {
+		return "", err
+	}
+
+	var (
+		wg    sync.WaitGroup
+		files = make([]ManifestFile, segments)
+		sizes = make([]int64, segments)
+		errs  = make([]error, segments)
+	)
+	for segment := range segments {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			files[segment], sizes[segment], errs[segment] = backupSegment(ctx, client, opts.Table, prefix, exportDir, segment, segments)
+		}()
+	}
+	wg.Wait()
+	if err = errors.Join(errs...); err != nil {
+		return "", err
+	}
+
+	summary := ManifestSummary{
+		Version:            "2020-06-30",
+		ExportArn:          aws.ToString(table.Table.TableArn) + "/export/" + exportId,
+		StartTime:          start,
+		EndTime:            time.Now().UTC(),
+		TableArn:           aws.ToString(table.Table.TableArn),
+		TableId:            aws.ToString(table.Table.TableId),
+		ExportTime:         start,
+		S3SseAlgorithm:     "AES256",
+		ManifestFilesS3Key: path.Join(prefix, manifestFilesFile),
+		OutputFormat:       "DYNAMODB_JSON",
+	}
+	var manifest strings.Builder
+	for i, file := range files {
+		summary.ItemCount += file.ItemCount
+		summary.BilledSizeBytes += sizes[i]
+		line, err := json.Marshal(file)
+		if err != nil {
+			return "", err
+		}
+		manifest.Write(line)
+		manifest.WriteByte('\n')
+	}
+	if err = os.WriteFile(filepath.Join(exportDir, manifestFilesFile), []byte(manifest.String()), 0o644); err != nil {
+		return "", err
+	}
+	// manifest-summary пишется последним: по нему restore понимает, что выгрузка завершена
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return "", err
+	}
+	if err = os.WriteFile(filepath.Join(exportDir, manifestSummaryFile), data, 0o644); err != nil {
+		return "", err
+	}
+	return exportDir, nil
+}
+
+func backupSegment(
+	ctx context.Context,
+	client *dynamodb.Client,
+	table, prefix, exportDir string,
+	segment, total int,
+) (ManifestFile, int64, error) {
+	name, err := randomHex(16)
+	if err != nil {
+		return ManifestFile{}, 0, err
+	}
+	key := path.Join(prefix, dataDir, name+".json.gz")
+	file, err := os.Create(filepath.Join(exportDir, dataDir, name+".json.gz"))
+	if err != nil {
+		return ManifestFile{}, 0, err
+	}
+	defer file.Close()
+
+	sum := md5.New()
+	gz := gzip.NewWriter(io.MultiWriter(file, sum))
+	w := bufio.NewWriter(gz)
+
+	var (
+		count int64
+		size  int64
+		last  map[string]types.AttributeValue
+	)
+	for {
+		out, err := client.Scan(ctx, &dynamodb.ScanInput{
+			TableName:         aws.String(table),
+			Segment:           aws.Int32(int32(segment)),
+			TotalSegments:     aws.Int32(int32(total)),
+			ExclusiveStartKey: last,
+		})
+		if err != nil {
+			return ManifestFile{}, 0, fmt.Errorf("scan segment %d: %w", segment, err)
+		}
+		for _, item := range out.Items {
+			line, err := marshalItem(item)
+			if err != nil {
+				return ManifestFile{}, 0, err
+			}
+			w.Write(line)
+			w.WriteByte('\n')
+			count++
+			size += int64(len(line))
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		last = out.LastEvaluatedKey
+	}
+
+	if err = w.Flush(); err != nil {
+		return ManifestFile{}, 0, err
+	}
+	if err = gz.Close(); err != nil {
+		return ManifestFile{}, 0, err
+	}
+	if err = file.Close(); err != nil {
+		return ManifestFile{}, 0, err
+	}
+	digest := sum.Sum(nil)
+	return ManifestFile{
+		ItemCount:     count,
+		MD5Checksum:   base64.StdEncoding.EncodeToString(digest),
+		ETag:          hex.EncodeToString(digest),
+		DataFileS3Key: key,
+	}, size, nil
+}
+
+// newExportId mimics the export id format: epoch millis and a random suffix.
+func newExportId(now time.Time) (string, error) {
+	suffix, err := randomHex(4)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%014d-%s", now.UnixMilli(), suffix), nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
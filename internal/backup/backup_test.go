@@ -0,0 +1,71 @@
+package backup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/adjacency-lists-with-gsi-for-reverse-lookup"
+)
+
+func TestBackupRestore(t *testing.T) {
+	t.Run("Restore backup into a fresh table", func(t *testing.T) {
+		db, err := dynamodb.NewTestDatabase()
+		assert.NoError(t, err)
+
+		err = db.Migrate(context.Background())
+		assert.NoError(t, err)
+
+		repo := adjacency_lists_with_gsi_for_reverse_lookup.New(db.Client)
+
+		edges := make([]graph.Edge, 0, 60)
+		for i := range 60 {
+			edges = append(edges, graph.Edge{
+				From:  graph.Node(string(rune('A' + i%20))),
+				To:    graph.Node(string(rune('a' + i/20))),
+				Area:  "Area1",
+				Score: graph.Score(i),
+				TTL:   24 * time.Hour,
+			})
+		}
+		err = repo.UpsertEdges(context.Background(), edges...)
+		assert.NoError(t, err)
+
+		dir, err := Backup(context.Background(), db.Client, BackupOptions{
+			Table:    adjacency_lists_with_gsi_for_reverse_lookup.TableName,
+			Dir:      t.TempDir(),
+			Segments: 3,
+		})
+		assert.NoError(t, err)
+
+		// Пересоздаём таблицу и восстанавливаем в неё выгрузку
+		err = db.Rollback(context.Background())
+		assert.NoError(t, err)
+		err = db.Migrate(context.Background())
+		assert.NoError(t, err)
+		defer db.Rollback(context.Background())
+
+		stats, err := Restore(context.Background(), db.Client, RestoreOptions{Dir: dir})
+		assert.NoError(t, err)
+		assert.Equal(t, RestoreStats{
+			Table:    adjacency_lists_with_gsi_for_reverse_lookup.TableName,
+			Expected: 60,
+			Read:     60,
+			Written:  60,
+		}, stats)
+		// Восстановленные рёбра пишутся мимо счётчиков
+		_, err = repo.Reconcile(context.Background())
+		assert.NoError(t, err)
+		size, err := repo.Size(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 60, size)
+
+		restored, err := repo.ReadDemandEdges(context.Background(), "A")
+		assert.NoError(t, err)
+		assert.Len(t, restored, 3)
+	})
+}
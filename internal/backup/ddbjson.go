@@ -0,0 +1,170 @@
+package backup
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// exportLine is one line of a data file in the DynamoDB S3 export layout:
+// {"Item":{"pk":{"S":"DEMAND#1"},"score":{"N":"0.5"}}}
+type exportLine struct {
+	Item map[string]json.RawMessage `json:"Item"`
+}
+
+// marshalItem encodes an item as a DYNAMODB_JSON export line.
+func marshalItem(item map[string]types.AttributeValue) ([]byte, error) {
+	out := make(map[string]any, len(item))
+	for name, av := range item {
+		v, err := encodeValue(av)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", name, err)
+		}
+		out[name] = v
+	}
+	return json.Marshal(map[string]any{"Item": out})
+}
+
+// unmarshalItem decodes a DYNAMODB_JSON export line.
+func unmarshalItem(data []byte) (map[string]types.AttributeValue, error) {
+	var line exportLine
+	if err := json.Unmarshal(data, &line); err != nil {
+		return nil, err
+	}
+	if line.Item == nil {
+		return nil, fmt.Errorf("line has no Item")
+	}
+	item := make(map[string]types.AttributeValue, len(line.Item))
+	for name, raw := range line.Item {
+		av, err := decodeValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", name, err)
+		}
+		item[name] = av
+	}
+	return item, nil
+}
+
+func encodeValue(av types.AttributeValue) (map[string]any, error) {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return map[string]any{"S": v.Value}, nil
+	case *types.AttributeValueMemberN:
+		return map[string]any{"N": v.Value}, nil
+	case *types.AttributeValueMemberB:
+		return map[string]any{"B": base64.StdEncoding.EncodeToString(v.Value)}, nil
+	case *types.AttributeValueMemberBOOL:
+		return map[string]any{"BOOL": v.Value}, nil
+	case *types.AttributeValueMemberNULL:
+		return map[string]any{"NULL": true}, nil
+	case *types.AttributeValueMemberSS:
+		return map[string]any{"SS": v.Value}, nil
+	case *types.AttributeValueMemberNS:
+		return map[string]any{"NS": v.Value}, nil
+	case *types.AttributeValueMemberBS:
+		values := make([]string, 0, len(v.Value))
+		for _, b := range v.Value {
+			values = append(values, base64.StdEncoding.EncodeToString(b))
+		}
+		return map[string]any{"BS": values}, nil
+	case *types.AttributeValueMemberM:
+		m := make(map[string]any, len(v.Value))
+		for name, inner := range v.Value {
+			enc, err := encodeValue(inner)
+			if err != nil {
+				return nil, err
+			}
+			m[name] = enc
+		}
+		return map[string]any{"M": m}, nil
+	case *types.AttributeValueMemberL:
+		l := make([]any, 0, len(v.Value))
+		for _, inner := range v.Value {
+			enc, err := encodeValue(inner)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, enc)
+		}
+		return map[string]any{"L": l}, nil
+	default:
+		return nil, fmt.Errorf("unsupported attribute value %T", av)
+	}
+}
+
+func decodeValue(raw json.RawMessage) (types.AttributeValue, error) {
+	var typed map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &typed); err != nil {
+		return nil, err
+	}
+	if len(typed) != 1 {
+		return nil, fmt.Errorf("expected exactly one type key, got %d", len(typed))
+	}
+	for typ, value := range typed {
+		switch typ {
+		case "S":
+			var s string
+			err := json.Unmarshal(value, &s)
+			return &types.AttributeValueMemberS{Value: s}, err
+		case "N":
+			var n string
+			err := json.Unmarshal(value, &n)
+			return &types.AttributeValueMemberN{Value: n}, err
+		case "B":
+			var b []byte // encoding/json декодирует base64 в []byte
+			err := json.Unmarshal(value, &b)
+			return &types.AttributeValueMemberB{Value: b}, err
+		case "BOOL":
+			var b bool
+			err := json.Unmarshal(value, &b)
+			return &types.AttributeValueMemberBOOL{Value: b}, err
+		case "NULL":
+			return &types.AttributeValueMemberNULL{Value: true}, nil
+		case "SS":
+			var ss []string
+			err := json.Unmarshal(value, &ss)
+			return &types.AttributeValueMemberSS{Value: ss}, err
+		case "NS":
+			var ns []string
+			err := json.Unmarshal(value, &ns)
+			return &types.AttributeValueMemberNS{Value: ns}, err
+		case "BS":
+			var bs [][]byte
+			err := json.Unmarshal(value, &bs)
+			return &types.AttributeValueMemberBS{Value: bs}, err
+		case "M":
+			var m map[string]json.RawMessage
+			if err := json.Unmarshal(value, &m); err != nil {
+				return nil, err
+			}
+			out := make(map[string]types.AttributeValue, len(m))
+			for name, inner := range m {
+				av, err := decodeValue(inner)
+				if err != nil {
+					return nil, err
+				}
+				out[name] = av
+			}
+			return &types.AttributeValueMemberM{Value: out}, nil
+		case "L":
+			var l []json.RawMessage
+			if err := json.Unmarshal(value, &l); err != nil {
+				return nil, err
+			}
+			out := make([]types.AttributeValue, 0, len(l))
+			for _, inner := range l {
+				av, err := decodeValue(inner)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, av)
+			}
+			return &types.AttributeValueMemberL{Value: out}, nil
+		default:
+			return nil, fmt.Errorf("unknown attribute type %q", typ)
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,49 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalItem(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"pk":    &types.AttributeValueMemberS{Value: "DEMAND#A"},
+		"score": &types.AttributeValueMemberN{Value: "67.77868"},
+		"blob":  &types.AttributeValueMemberB{Value: []byte{0, 1, 2}},
+		"ok":    &types.AttributeValueMemberBOOL{Value: true},
+		"none":  &types.AttributeValueMemberNULL{Value: true},
+		"tags":  &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+		"nums":  &types.AttributeValueMemberNS{Value: []string{"1", "2.5"}},
+		"bins":  &types.AttributeValueMemberBS{Value: [][]byte{{1}, {2, 3}}},
+		"n": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"S1": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+				&types.AttributeValueMemberN{Value: "0.5"},
+				&types.AttributeValueMemberS{Value: "x"},
+			}},
+		}},
+	}
+
+	line, err := marshalItem(item)
+	assert.NoError(t, err)
+
+	got, err := unmarshalItem(line)
+	assert.NoError(t, err)
+	assert.Equal(t, item, got)
+}
+
+func TestUnmarshalItem_ExportLine(t *testing.T) {
+	line := `{"Item":{"pk":{"S":"DEMAND#A"},"sk":{"S":"SUPPLY#B"},"score":{"N":"10"}}}`
+
+	got, err := unmarshalItem([]byte(line))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]types.AttributeValue{
+		"pk":    &types.AttributeValueMemberS{Value: "DEMAND#A"},
+		"sk":    &types.AttributeValueMemberS{Value: "SUPPLY#B"},
+		"score": &types.AttributeValueMemberN{Value: "10"},
+	}, got)
+
+	_, err = unmarshalItem([]byte(`{"pk":{"S":"DEMAND#A"}}`))
+	assert.Error(t, err)
+}
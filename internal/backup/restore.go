@@ -0,0 +1,196 @@
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	batchSize    = 25 // Максимальный размер партии для BatchWriteItem
+	maxAttempts  = 8
+	retryBackoff = 50 * time.Millisecond
+)
+
+type RestoreOptions struct {
+	// Dir - каталог выгрузки с manifest-summary.json
+	Dir string
+	// TableMap maps the exported table name to the target table.
+	// Tables missing from the map are restored under their own name.
+	TableMap map[string]string
+}
+
+type RestoreStats struct {
+	Table    string
+	Expected int64
+	Read     int64
+	Written  int64
+}
+
+// Restore writes the items of an export back through BatchWriteItem.
+// It fails if the number of items in a data file, in the whole export or
+// written to the table differs from the manifests. The items bypass the
+// edge counters of the strategy, its Reconcile recounts them.
+func Restore(ctx context.Context, client *dynamodb.Client, opts RestoreOptions) (RestoreStats, error) {
+	var stats RestoreStats
+
+	data, err := os.ReadFile(filepath.Join(opts.Dir, manifestSummaryFile))
+	if err != nil {
+		return stats, fmt.Errorf("read manifest summary: %w", err)
+	}
+	var summary ManifestSummary
+	if err = json.Unmarshal(data, &summary); err != nil {
+		return stats, fmt.Errorf("decode manifest summary: %w", err)
+	}
+	if summary.OutputFormat != "DYNAMODB_JSON" {
+		return stats, fmt.Errorf("unsupported export format %q", summary.OutputFormat)
+	}
+
+	stats.Table = summary.TableName()
+	if target, ok := opts.TableMap[stats.Table]; ok {
+		stats.Table = target
+	}
+	stats.Expected = summary.ItemCount
+
+	files, err := readManifestFiles(filepath.Join(opts.Dir, manifestFilesFile))
+	if err != nil {
+		return stats, err
+	}
+	for _, file := range files {
+		read, written, err := restoreFile(ctx, client, stats.Table, filepath.Join(opts.Dir, dataDir, path.Base(file.DataFileS3Key)))
+		stats.Read += read
+		stats.Written += written
+		if err != nil {
+			return stats, err
+		}
+		if read != file.ItemCount {
+			return stats, fmt.Errorf("%s: manifest has %d items, file has %d", file.DataFileS3Key, file.ItemCount, read)
+		}
+	}
+
+	if stats.Read != stats.Expected {
+		return stats, fmt.Errorf("export has %d items, data files have %d", stats.Expected, stats.Read)
+	}
+	if stats.Written != stats.Read {
+		return stats, fmt.Errorf("read %d items, wrote %d", stats.Read, stats.Written)
+	}
+	return stats, nil
+}
+
+func readManifestFiles(name string) ([]ManifestFile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("read manifest files: %w", err)
+	}
+	defer f.Close()
+
+	var files []ManifestFile
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var file ManifestFile
+		if err = dec.Decode(&file); err != nil {
+			return nil, fmt.Errorf("decode manifest files: %w", err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func restoreFile(ctx context.Context, client *dynamodb.Client, table, name string) (read, written int64, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", name, err)
+	}
+	defer gz.Close()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // элемент DynamoDB не больше 400 KB
+
+	batch := make([]types.WriteRequest, 0, batchSize)
+	flush := func() error {
+		n, err := writeBatch(ctx, client, table, batch)
+		written += n
+		batch = batch[:0]
+		return err
+	}
+	for scanner.Scan() {
+		item, err := unmarshalItem(scanner.Bytes())
+		if err != nil {
+			return read, written, fmt.Errorf("%s: line %d: %w", name, read+1, err)
+		}
+		read++
+		batch = append(batch, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+		if len(batch) == batchSize {
+			if err = flush(); err != nil {
+				return read, written, err
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return read, written, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(batch) > 0 {
+		err = flush()
+	}
+	return read, written, err
+}
+
+// writeBatch retries unprocessed items with a growing backoff.
+func writeBatch(ctx context.Context, client *dynamodb.Client, table string, requests []types.WriteRequest) (int64, error) {
+	pending := slices.Clone(requests)
+	backoff := retryBackoff
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		out, err := client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{table: pending},
+		})
+		if err != nil {
+			return int64(len(requests) - len(pending)), fmt.Errorf("batch write to %s: %w", table, err)
+		}
+		unprocessed := out.UnprocessedItems[table]
+		if len(unprocessed) == 0 {
+			return int64(len(requests)), nil
+		}
+		pending = unprocessed
+		select {
+		case <-ctx.Done():
+			return int64(len(requests) - len(pending)), ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return int64(len(requests) - len(pending)), fmt.Errorf(
+		"batch write to %s: %d items unprocessed after %d attempts", table, len(pending), maxAttempts,
+	)
+}
+
+// ParseTableMap parses comma separated "old=new" table name pairs.
+func ParseTableMap(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	if s == "" {
+		return m, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		from, to, ok := strings.Cut(pair, "=")
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("invalid table mapping %q, expected old=new", pair)
+		}
+		m[from] = to
+	}
+	return m, nil
+}
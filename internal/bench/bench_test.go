@@ -0,0 +1,129 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/memory"
+)
+
+func TestWorkloads(t *testing.T) {
+	t.Run("Run the scripted workloads in order", func(t *testing.T) {
+		cfg := Config{
+			Demands:        20,
+			Supplies:       10,
+			Areas:          2,
+			EdgesPerDemand: 4,
+			BatchSize:      25,
+			Ticks:          3,
+			TTL:            DefaultConfig().TTL,
+			Seed:           1,
+		}
+		assert.NoError(t, cfg.Validate())
+		repo := memory.New()
+
+		calls := make(map[string]int)
+		for _, w := range Workloads(cfg) {
+			rec, err := w.Run(context.Background(), repo)
+			assert.NoError(t, err)
+			assert.Zero(t, rec.Errors())
+			calls[w.Name] = rec.Calls()
+		}
+
+		// 80 рёбер по 25 в батче
+		assert.Equal(t, 4, calls["upsert_storm"])
+		assert.Equal(t, 2*3, calls["area_ticks"])
+		// Чтение каждого предложения плюс удаление и перезапись
+		assert.Greater(t, calls["supply_reconciliation"], 10)
+		// У каждого предложения остаётся половина рёбер, округлённая вниз
+		size, err := repo.Size(context.Background())
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, size, 40)
+		assert.GreaterOrEqual(t, size, 40-10)
+	})
+
+	t.Run("Same seed, same graph", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Demands, cfg.Supplies = 30, 30
+		first, second := memory.New(), memory.New()
+		for _, repo := range []*memory.Repository{first, second} {
+			for _, w := range Workloads(cfg) {
+				_, err := w.Run(context.Background(), repo)
+				assert.NoError(t, err)
+			}
+		}
+		a, _ := first.ReadAreaEdges(context.Background(), area(0))
+		b, _ := second.ReadAreaEdges(context.Background(), area(0))
+		assert.Equal(t, len(a), len(b))
+		for i := range a {
+			assert.Equal(t, a[i].To, b[i].To)
+			assert.Equal(t, a[i].Score, b[i].Score)
+		}
+	})
+}
+
+func TestItemSize(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"pk":    &types.AttributeValueMemberS{Value: "DEMAND#A"},
+		"score": &types.AttributeValueMemberN{Value: "12.5"},
+		"nodes": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"B": &types.AttributeValueMemberN{Value: "1"},
+		}},
+	}
+	// pk: 2+8, score: 5+(2+1), nodes: 5+3+(1+2+1)
+	assert.Equal(t, 10+8+12, ItemSize(item))
+}
+
+func TestIndexProjection(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"pk":    &types.AttributeValueMemberS{Value: "DEMAND#A"},
+		"sk":    &types.AttributeValueMemberS{Value: "SUPPLY#B"},
+		"ak":    &types.AttributeValueMemberS{Value: "AREA#X"},
+		"score": &types.AttributeValueMemberN{Value: "12.5"},
+	}
+
+	t.Run("Copy every attribute", func(t *testing.T) {
+		size, ok := indexProjection{keys: []string{"pk", "sk", "ak"}, all: true}.copySize(item)
+		assert.True(t, ok)
+		assert.Equal(t, ItemSize(item), size)
+	})
+	t.Run("Copy the keys and the included attributes", func(t *testing.T) {
+		size, ok := indexProjection{keys: []string{"pk", "sk", "ak"}, attrs: []string{"score"}}.copySize(item)
+		assert.True(t, ok)
+		// pk: 2+8, sk: 2+8, ak: 2+6, score: 5+3
+		assert.Equal(t, 10+10+8+8, size)
+	})
+	t.Run("Skip items without the index key", func(t *testing.T) {
+		_, ok := indexProjection{keys: []string{"pk", "sk", "ttl"}, all: true}.copySize(item)
+		assert.False(t, ok)
+	})
+}
+
+func TestPricing(t *testing.T) {
+	p := DefaultPricing()
+	// Одна запись в секунду - 2.592 млн записей в месяц
+	assert.InDelta(t, 3.24, p.MonthlyRequests(0, 1, 1), 1e-9)
+	assert.InDelta(t, 0.25, p.MonthlyStorage(1<<30), 1e-9)
+}
+
+func TestReport_WriteTable(t *testing.T) {
+	result := StrategyResult{
+		Strategy:       "s",
+		Workloads:      []WorkloadResult{{Workload: "area_ticks", Calls: 3, RCU: 1.5, MonthlyCost: 1}},
+		Tables:         []TableStats{{Table: "tbl", Items: 2, AvgBytes: 50, MaxBytes: 60}},
+		MonthlyStorage: 0.5,
+	}
+	result.Total()
+	assert.Equal(t, 1.5, result.MonthlyTotal)
+
+	var buf bytes.Buffer
+	err := Report{Pricing: DefaultPricing(), Strategies: []StrategyResult{result}}.WriteTable(&buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "area_ticks")
+	assert.Contains(t, buf.String(), "tbl")
+	assert.Contains(t, buf.String(), "1.50")
+}
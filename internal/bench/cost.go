@@ -0,0 +1,230 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Pricing is the on-demand price list, in dollars.
+type Pricing struct {
+	PerMillionReads   float64 `json:"per_million_reads"`
+	PerMillionWrites  float64 `json:"per_million_writes"`
+	PerGBMonthStorage float64 `json:"per_gb_month_storage"`
+}
+
+// DefaultPricing is the us-east-1 standard table class price list.
+func DefaultPricing() Pricing {
+	return Pricing{
+		PerMillionReads:   0.25,
+		PerMillionWrites:  1.25,
+		PerGBMonthStorage: 0.25,
+	}
+}
+
+const secondsPerMonth = 30 * 24 * 60 * 60
+
+// MonthlyRequests returns the cost of a month of repeating a workload
+// that consumed rcu and wcu runsPerSecond times a second.
+func (p Pricing) MonthlyRequests(rcu, wcu, runsPerSecond float64) float64 {
+	runs := runsPerSecond * secondsPerMonth
+	return runs * (rcu*p.PerMillionReads + wcu*p.PerMillionWrites) / 1e6
+}
+
+// MonthlyStorage returns the cost of storing bytes for a month.
+func (p Pricing) MonthlyStorage(bytes int64) float64 {
+	return float64(bytes) / (1 << 30) * p.PerGBMonthStorage
+}
+
+// itemOverhead is what DynamoDB adds to every item for storage billing.
+const itemOverhead = 100
+
+// TableStats are the item sizes of a table as DynamoDB bills them.
+type TableStats struct {
+	Table    string `json:"table"`
+	Items    int    `json:"items"`
+	AvgBytes int    `json:"avg_bytes"`
+	MaxBytes int    `json:"max_bytes"`
+	// StorageBytes includes the per-item overhead and the copies of the
+	// items in the secondary indexes
+	StorageBytes int64 `json:"storage_bytes"`
+	// IndexBytes is the part of StorageBytes taken by the index copies
+	IndexBytes int64 `json:"index_bytes"`
+}
+
+// indexProjection is what a secondary index copies of every item that
+// has the key attributes of the index.
+type indexProjection struct {
+	keys []string // ключи таблицы и индекса
+	// attrs - копируемые неключевые атрибуты, all - все атрибуты
+	attrs []string
+	all   bool
+}
+
+// copySize returns the size of the copy of item in the index, false when
+// the item lacks a key attribute and the index skips it.
+func (p indexProjection) copySize(item map[string]types.AttributeValue) (int, bool) {
+	if p.all {
+		for _, name := range p.keys {
+			if _, ok := item[name]; !ok {
+				return 0, false
+			}
+		}
+		return ItemSize(item), true
+	}
+	size := 0
+	for _, name := range p.keys {
+		value, ok := item[name]
+		if !ok {
+			return 0, false
+		}
+		size += len(name) + valueSize(value)
+	}
+	for _, name := range p.attrs {
+		if value, ok := item[name]; ok && !slices.Contains(p.keys, name) {
+			size += len(name) + valueSize(value)
+		}
+	}
+	return size, true
+}
+
+// describeIndexes returns the projections of the secondary indexes of the table.
+func describeIndexes(ctx context.Context, client *dynamodb.Client, table string) ([]indexProjection, error) {
+	out, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		return nil, fmt.Errorf("describe %s: %w", table, err)
+	}
+	var tableKeys []string
+	for _, key := range out.Table.KeySchema {
+		tableKeys = append(tableKeys, aws.ToString(key.AttributeName))
+	}
+	projection := func(schema []types.KeySchemaElement, p *types.Projection) indexProjection {
+		idx := indexProjection{keys: slices.Clone(tableKeys)}
+		for _, key := range schema {
+			if name := aws.ToString(key.AttributeName); !slices.Contains(idx.keys, name) {
+				idx.keys = append(idx.keys, name)
+			}
+		}
+		if p != nil {
+			idx.all = p.ProjectionType == types.ProjectionTypeAll
+			idx.attrs = p.NonKeyAttributes
+		}
+		return idx
+	}
+	var indexes []indexProjection
+	for _, gsi := range out.Table.GlobalSecondaryIndexes {
+		indexes = append(indexes, projection(gsi.KeySchema, gsi.Projection))
+	}
+	for _, lsi := range out.Table.LocalSecondaryIndexes {
+		indexes = append(indexes, projection(lsi.KeySchema, lsi.Projection))
+	}
+	return indexes, nil
+}
+
+// MeasureTable scans the table and sizes every item and its copies in
+// the secondary indexes.
+func MeasureTable(ctx context.Context, client *dynamodb.Client, table string) (TableStats, error) {
+	stats := TableStats{Table: table}
+	indexes, err := describeIndexes(ctx, client, table)
+	if err != nil {
+		return stats, err
+	}
+	var total int64
+	paginator := dynamodb.NewScanPaginator(client, &dynamodb.ScanInput{
+		TableName: aws.String(table),
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return stats, fmt.Errorf("scan %s: %w", table, err)
+		}
+		for _, item := range out.Items {
+			size := ItemSize(item)
+			stats.Items++
+			stats.MaxBytes = max(stats.MaxBytes, size)
+			total += int64(size)
+			for _, idx := range indexes {
+				if size, ok := idx.copySize(item); ok {
+					stats.IndexBytes += int64(size + itemOverhead)
+				}
+			}
+		}
+	}
+	if stats.Items > 0 {
+		stats.AvgBytes = int(total / int64(stats.Items))
+	}
+	stats.StorageBytes = total + int64(stats.Items*itemOverhead) + stats.IndexBytes
+	return stats, nil
+}
+
+// ItemSize returns the size of the item by the DynamoDB rules: the
+// lengths of attribute names plus the sizes of their values.
+func ItemSize(item map[string]types.AttributeValue) int {
+	size := 0
+	for name, value := range item {
+		size += len(name) + valueSize(value)
+	}
+	return size
+}
+
+func valueSize(value types.AttributeValue) int {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return len(v.Value)
+	case *types.AttributeValueMemberN:
+		return numberSize(v.Value)
+	case *types.AttributeValueMemberB:
+		return len(v.Value)
+	case *types.AttributeValueMemberBOOL, *types.AttributeValueMemberNULL:
+		return 1
+	case *types.AttributeValueMemberSS:
+		size := 0
+		for _, s := range v.Value {
+			size += len(s)
+		}
+		return size
+	case *types.AttributeValueMemberNS:
+		size := 0
+		for _, n := range v.Value {
+			size += numberSize(n)
+		}
+		return size
+	case *types.AttributeValueMemberBS:
+		size := 0
+		for _, b := range v.Value {
+			size += len(b)
+		}
+		return size
+	case *types.AttributeValueMemberM:
+		// 3 байта на сам контейнер и по байту на каждый элемент
+		size := 3
+		for name, value := range v.Value {
+			size += len(name) + valueSize(value) + 1
+		}
+		return size
+	case *types.AttributeValueMemberL:
+		size := 3
+		for _, value := range v.Value {
+			size += valueSize(value) + 1
+		}
+		return size
+	default:
+		return 0
+	}
+}
+
+// numberSize is about one byte per two significant digits plus one.
+func numberSize(n string) int {
+	digits := strings.TrimLeft(strings.NewReplacer("-", "", ".", "").Replace(n), "0")
+	if i := strings.IndexAny(digits, "eE"); i >= 0 {
+		digits = digits[:i]
+	}
+	digits = strings.TrimRight(digits, "0")
+	return int(math.Ceil(float64(len(digits))/2)) + 1
+}
@@ -0,0 +1,89 @@
+package bench
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/loadgen"
+)
+
+// WorkloadResult is what one workload cost one strategy.
+type WorkloadResult struct {
+	Workload  string          `json:"workload"`
+	Calls     int             `json:"calls"`
+	Errors    int             `json:"errors"`
+	Items     int             `json:"items"`
+	Latency   loadgen.Summary `json:"latency"`
+	RCU       float64         `json:"rcu"`
+	WCU       float64         `json:"wcu"`
+	Throttles int             `json:"throttles"`
+	// MonthlyCost is the request cost of repeating the workload for a month
+	MonthlyCost float64 `json:"monthly_cost"`
+}
+
+type StrategyResult struct {
+	Strategy  string           `json:"strategy"`
+	Workloads []WorkloadResult `json:"workloads"`
+	Tables    []TableStats     `json:"tables"`
+	// MonthlyStorage is the cost of storing the graph the workloads left
+	MonthlyStorage float64 `json:"monthly_storage"`
+	MonthlyTotal   float64 `json:"monthly_total"`
+	// Error is set when the run stopped early, the results cover what ran
+	Error string `json:"error,omitempty"`
+}
+
+// Total sums the workload costs and the storage cost.
+func (r *StrategyResult) Total() {
+	r.MonthlyTotal = r.MonthlyStorage
+	for _, w := range r.Workloads {
+		r.MonthlyTotal += w.MonthlyCost
+	}
+}
+
+type Report struct {
+	Config  Config  `json:"config"`
+	Pricing Pricing `json:"pricing"`
+	// RunsPerSecond is how often every workload is assumed to repeat
+	// when the cost is projected to a month
+	RunsPerSecond float64          `json:"runs_per_second"`
+	Strategies    []StrategyResult `json:"strategies"`
+}
+
+// WriteTable writes the comparison of the strategies as aligned text.
+func (r Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "strategy\tworkload\tcalls\terrors\tp50\tp99\tRCU\tWCU\tthrottles\t$/month\t")
+	for _, s := range r.Strategies {
+		for _, wr := range s.Workloads {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\t%.1f\t%.1f\t%d\t%.2f\t\n",
+				s.Strategy, wr.Workload, wr.Calls, wr.Errors,
+				ms(wr.Latency.P50), ms(wr.Latency.P99),
+				wr.RCU, wr.WCU, wr.Throttles, wr.MonthlyCost,
+			)
+		}
+	}
+	fmt.Fprintln(tw, "\t\t\t\t\t\t\t\t\t\t")
+	fmt.Fprintln(tw, "strategy\ttable\titems\tavg bytes\tmax bytes\tstorage $/month\ttotal $/month\t")
+	for _, s := range r.Strategies {
+		for i, t := range s.Tables {
+			total := ""
+			if i == 0 {
+				total = fmt.Sprintf("%.2f", s.MonthlyTotal)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%.4f\t%s\t\n",
+				s.Strategy, t.Table, t.Items, t.AvgBytes, t.MaxBytes,
+				r.Pricing.MonthlyStorage(t.StorageBytes), total,
+			)
+		}
+		if s.Error != "" {
+			fmt.Fprintf(tw, "%s\terror: %s\t\t\t\t\t\t\n", s.Strategy, s.Error)
+		}
+	}
+	return tw.Flush()
+}
+
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
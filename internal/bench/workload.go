@@ -0,0 +1,206 @@
+package bench
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/loadgen"
+)
+
+type graphRepository interface {
+	UpsertEdges(ctx context.Context, edges ...graph.Edge) error
+	RemoveEdges(ctx context.Context, edges ...graph.Edge) error
+	ReadSupplyEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error)
+	ReadAreaEdges(ctx context.Context, area graph.Area) ([]graph.Edge, error)
+}
+
+// Config describes the scripted workloads. The same config and seed
+// produce the same calls against every strategy.
+type Config struct {
+	Demands  int `json:"demands"`
+	Supplies int `json:"supplies"`
+	Areas    int `json:"areas"`
+	// EdgesPerDemand - рёбер у каждого спроса после шторма записей
+	EdgesPerDemand int `json:"edges_per_demand"`
+	// BatchSize - рёбер в одном вызове UpsertEdges и RemoveEdges
+	BatchSize int `json:"batch_size"`
+	// Ticks - сколько раз читается каждая область
+	Ticks int           `json:"ticks"`
+	TTL   time.Duration `json:"ttl"`
+	Seed  uint64        `json:"seed"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Demands:        500,
+		Supplies:       500,
+		Areas:          5,
+		EdgesPerDemand: 10,
+		BatchSize:      25,
+		Ticks:          10,
+		TTL:            time.Hour,
+		Seed:           1,
+	}
+}
+
+func (c Config) Validate() error {
+	switch {
+	case c.Demands <= 0 || c.Supplies <= 0 || c.Areas <= 0:
+		return fmt.Errorf("key space must not be empty")
+	case c.EdgesPerDemand <= 0 || c.EdgesPerDemand > c.Supplies:
+		return fmt.Errorf("edges per demand must be in 1..%d", c.Supplies)
+	case c.BatchSize <= 0:
+		return fmt.Errorf("batch size must be positive")
+	case c.Ticks <= 0:
+		return fmt.Errorf("ticks must be positive")
+	}
+	return nil
+}
+
+// Workload is one scripted step of the benchmark. Workloads run in
+// order on the same tables: later ones work on the graph earlier ones built.
+type Workload struct {
+	Name string
+	run  func(ctx context.Context, repo graphRepository, rec *Recorder) error
+}
+
+// Workloads returns the upsert storm, the supply reconciliation and the
+// area ticks, in the order they must run.
+func Workloads(cfg Config) []Workload {
+	return []Workload{
+		{Name: "upsert_storm", run: cfg.upsertStorm},
+		{Name: "supply_reconciliation", run: cfg.supplyReconciliation},
+		{Name: "area_ticks", run: cfg.areaTicks},
+	}
+}
+
+// Run executes the workload and records every repository call.
+func (w Workload) Run(ctx context.Context, repo graphRepository) (*Recorder, error) {
+	rec := &Recorder{}
+	err := w.run(ctx, repo, rec)
+	return rec, err
+}
+
+// Recorder collects the latency of repository calls.
+type Recorder struct {
+	latency loadgen.Histogram
+	calls   int
+	errors  int
+	items   int
+}
+
+func (r *Recorder) do(items int, call func() error) error {
+	start := time.Now()
+	err := call()
+	r.latency.Record(time.Since(start))
+	r.calls++
+	r.items += items
+	if err != nil {
+		r.errors++
+	}
+	return err
+}
+
+func (r *Recorder) Calls() int               { return r.calls }
+func (r *Recorder) Errors() int              { return r.errors }
+func (r *Recorder) Items() int               { return r.items }
+func (r *Recorder) Latency() loadgen.Summary { return r.latency.Summary() }
+
+// upsertStorm writes EdgesPerDemand edges of every demand in batches.
+func (c Config) upsertStorm(ctx context.Context, repo graphRepository, rec *Recorder) error {
+	rnd := rand.New(rand.NewPCG(c.Seed, 1))
+	edges := make([]graph.Edge, 0, c.Demands*c.EdgesPerDemand)
+	for d := range c.Demands {
+		for _, s := range rnd.Perm(c.Supplies)[:c.EdgesPerDemand] {
+			edges = append(edges, graph.Edge{
+				From:  demand(d),
+				To:    supply(s),
+				Score: graph.Score(rnd.Float64()),
+				Area:  area(d % c.Areas),
+				TTL:   c.TTL,
+			})
+		}
+	}
+	rnd.Shuffle(len(edges), func(i, j int) {
+		edges[i], edges[j] = edges[j], edges[i]
+	})
+	for batch := range slices.Chunk(edges, c.BatchSize) {
+		if err := rec.do(len(batch), func() error {
+			return repo.UpsertEdges(ctx, batch...)
+		}); err != nil {
+			return fmt.Errorf("upsert storm: %w", err)
+		}
+	}
+	return nil
+}
+
+// supplyReconciliation is what a supply update does: read the edges of
+// the supply, drop every other one and rescore the rest.
+func (c Config) supplyReconciliation(ctx context.Context, repo graphRepository, rec *Recorder) error {
+	rnd := rand.New(rand.NewPCG(c.Seed, 2))
+	for s := range c.Supplies {
+		var edges []graph.Edge
+		if err := rec.do(0, func() (err error) {
+			edges, err = repo.ReadSupplyEdges(ctx, supply(s))
+			return err
+		}); err != nil {
+			return fmt.Errorf("supply reconciliation: %w", err)
+		}
+		rec.items += len(edges)
+
+		// Порядок чтения у стратегий разный, сортируем для одинаковых вызовов
+		slices.SortFunc(edges, func(a, b graph.Edge) int {
+			return cmp.Compare(a.From, b.From)
+		})
+		var remove, rescore []graph.Edge
+		for i, e := range edges {
+			if i%2 == 0 {
+				remove = append(remove, e)
+				continue
+			}
+			e.Score, e.TTL, e.ExpiresAt = graph.Score(rnd.Float64()), c.TTL, time.Time{}
+			rescore = append(rescore, e)
+		}
+		for batch := range slices.Chunk(remove, c.BatchSize) {
+			if err := rec.do(len(batch), func() error {
+				return repo.RemoveEdges(ctx, batch...)
+			}); err != nil {
+				return fmt.Errorf("supply reconciliation: %w", err)
+			}
+		}
+		for batch := range slices.Chunk(rescore, c.BatchSize) {
+			if err := rec.do(len(batch), func() error {
+				return repo.UpsertEdges(ctx, batch...)
+			}); err != nil {
+				return fmt.Errorf("supply reconciliation: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// areaTicks reads every area Ticks times, as the matching loop does.
+func (c Config) areaTicks(ctx context.Context, repo graphRepository, rec *Recorder) error {
+	for range c.Ticks {
+		for a := range c.Areas {
+			var edges []graph.Edge
+			if err := rec.do(0, func() (err error) {
+				edges, err = repo.ReadAreaEdges(ctx, area(a))
+				return err
+			}); err != nil {
+				return fmt.Errorf("area ticks: %w", err)
+			}
+			rec.items += len(edges)
+		}
+	}
+	return nil
+}
+
+func demand(i int) graph.Node { return graph.Node(fmt.Sprintf("demand-%d", i)) }
+func supply(i int) graph.Node { return graph.Node(fmt.Sprintf("supply-%d", i)) }
+func area(i int) graph.Area   { return graph.Area(fmt.Sprintf("area-%d", i)) }
@@ -0,0 +1,16 @@
+package graph
+
+import "context"
+
+type causeKey struct{}
+
+// WithCause tags the edge writes made with ctx, e.g. with the use case name,
+// so the change feed and the audit log can tell who changed an edge.
+func WithCause(ctx context.Context, cause string) context.Context {
+	return context.WithValue(ctx, causeKey{}, cause)
+}
+
+func CauseFromContext(ctx context.Context) string {
+	cause, _ := ctx.Value(causeKey{}).(string)
+	return cause
+}
@@ -0,0 +1,26 @@
+package graph
+
+import (
+	"cmp"
+	"slices"
+)
+
+// TopK splits edges into the k highest scored ones and the rest.
+// Ties are broken by node names so the split is deterministic.
+// k <= 0 means no limit: every edge is kept.
+func TopK(edges []Edge, k int) (keep, evict []Edge) {
+	if k <= 0 || len(edges) <= k {
+		return edges, nil
+	}
+	sorted := slices.Clone(edges)
+	slices.SortFunc(sorted, func(a, b Edge) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.From, b.From); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.To, b.To)
+	})
+	return sorted[:k], sorted[k:]
+}
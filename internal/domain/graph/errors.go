@@ -0,0 +1,105 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors of the graph repository, by kind. Storage errors are wrapped
+// with them, so errors.Is tells the kind and errors.As still reaches the
+// error of the storage.
+var (
+	// ErrThrottled - the storage rejected the call for exceeding its
+	// capacity. Retrying later succeeds.
+	ErrThrottled = errors.New("graph: throttled")
+	// ErrTableNotFound - a table of the graph does not exist, e.g. it is
+	// not migrated yet. Retrying does not help until it is created.
+	ErrTableNotFound = errors.New("graph: table not found")
+	// ErrConditionFailed - a concurrent writer changed the edges the call
+	// depended on. Retrying reads them again.
+	ErrConditionFailed = errors.New("graph: condition failed")
+	// ErrPartialWrite - some of the edges of a write were written and some
+	// were not, see PartialWriteError for which.
+	ErrPartialWrite = errors.New("graph: partial write")
+	// ErrInvalidEdge - the storage cannot hold an edge as it is, retrying
+	// it does not help.
+	ErrInvalidEdge = errors.New("graph: invalid edge")
+)
+
+// EdgeError is the failure of one edge of a write.
+type EdgeError struct {
+	Edge Edge
+	Err  error
+}
+
+func (e EdgeError) Error() string {
+	return fmt.Sprintf("edge %s -> %s: %v", e.Edge.From, e.Edge.To, e.Err)
+}
+
+func (e EdgeError) Unwrap() error {
+	return e.Err
+}
+
+// PartialWriteError lists the edges a write failed on, the other edges of
+// the write were written. It matches ErrPartialWrite and the errors of the
+// failed edges, e.g. errors.Is(err, ErrThrottled) holds when an edge was
+// throttled.
+type PartialWriteError struct {
+	Written int
+	Failed  []EdgeError
+}
+
+func (e *PartialWriteError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v: %d edges written, %d failed", ErrPartialWrite, e.Written, len(e.Failed))
+	writeEdgeErrors(&b, e.Failed)
+	return b.String()
+}
+
+func (e *PartialWriteError) Is(target error) bool {
+	return target == ErrPartialWrite
+}
+
+func (e *PartialWriteError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, f := range e.Failed {
+		errs = append(errs, f)
+	}
+	return errs
+}
+
+// WriteError builds the error of a write of n edges: nil when no edge
+// failed, a *PartialWriteError when only some did, and the distinct errors
+// of the edges when none was written.
+func WriteError(n int, failed []EdgeError) error {
+	switch {
+	case len(failed) == 0:
+		return nil
+	case len(failed) < n:
+		return &PartialWriteError{Written: n - len(failed), Failed: failed}
+	}
+	// Ошибка партии повторяется у каждого её ребра
+	seen := make(map[string]struct{})
+	var errs []error
+	for _, f := range failed {
+		if _, ok := seen[f.Err.Error()]; ok {
+			continue
+		}
+		seen[f.Err.Error()] = struct{}{}
+		errs = append(errs, f.Err)
+	}
+	return errors.Join(errs...)
+}
+
+// writeEdgeErrors appends the first few errors of the edges to b.
+func writeEdgeErrors(b *strings.Builder, errs []EdgeError) {
+	for i, e := range errs {
+		if i == 3 {
+			fmt.Fprintf(b, "; and %d more", len(errs)-i)
+			return
+		}
+		b.WriteString("; ")
+		b.WriteString(e.Error())
+	}
+}
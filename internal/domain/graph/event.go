@@ -0,0 +1,44 @@
+package graph
+
+import "time"
+
+// EdgeEvent is a change of a single edge delivered by the change feed.
+type EdgeEvent interface {
+	edgeEvent()
+}
+
+// Cause of deletions made by DynamoDB TTL.
+const CauseTTL = "ttl"
+
+type (
+	EdgeAdded struct {
+		ID    string // id записи в потоке, одинаковый при повторной доставке
+		Edge  Edge
+		At    time.Time
+		Cause string
+	}
+
+	EdgeUpdated struct {
+		ID       string
+		Old, New Edge
+		At       time.Time
+		Cause    string
+	}
+
+	// EdgeRemoved carries CauseTTL for TTL deletions. A delete does not
+	// write attributes, so the cause of other removals is known only when
+	// the strategy stamps it on the edge before deleting it.
+	EdgeRemoved struct {
+		ID    string
+		Edge  Edge
+		At    time.Time
+		Cause string
+
+		// Expired marks deletions made by DynamoDB TTL rather than by a use case.
+		Expired bool
+	}
+)
+
+func (EdgeAdded) edgeEvent()   {}
+func (EdgeUpdated) edgeEvent() {}
+func (EdgeRemoved) edgeEvent() {}
@@ -0,0 +1,41 @@
+package graph
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// Matching pairs matched nodes: every matched node maps to its partner,
+// so a pair appears under both of its nodes.
+type Matching map[Node]Node
+
+// Snapshot is the graph of an area as one tick saw it, with the result
+// the matcher produced for it.
+type Snapshot struct {
+	Area  Area
+	Tick  time.Time
+	Edges []Edge
+
+	Matches Matching
+	// MatchError is the error returned by the matcher, if any
+	MatchError string
+}
+
+// Diff returns the nodes whose partner differs between two matchings,
+// including nodes matched in only one of them, in sorted order.
+func (m Matching) Diff(other Matching) []Node {
+	changed := make([]Node, 0)
+	for node, partner := range m {
+		if p, ok := other[node]; !ok || p != partner {
+			changed = append(changed, node)
+		}
+	}
+	for node := range other {
+		if _, ok := m[node]; !ok {
+			changed = append(changed, node)
+		}
+	}
+	slices.SortFunc(changed, cmp.Compare)
+	return changed
+}
@@ -1,6 +1,11 @@
 package graph
 
-import "time"
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+)
 
 type (
 	Node  string
@@ -14,6 +19,10 @@ type (
 		// Metadata for graph
 		Area Area
 		TTL  time.Duration
+
+		// ExpiresAt is filled on reads that return the stored expiry;
+		// writes use TTL.
+		ExpiresAt time.Time
 	}
 )
 
@@ -41,6 +50,67 @@ func (a Area) Area() string {
 	return "AREA#" + string(a)
 }
 
+// Shard returns the key of the i-th shard of the area, e.g. AREA#city#03.
+func (a Area) Shard(i int) string {
+	return fmt.Sprintf("%s#%02d", a.Area(), i)
+}
+
+// AreaKey returns the area key the edge is indexed under when the area
+// index is split into shards. The shard is picked by a hash of the edge
+// key, so rewriting the same edge always lands in the same shard.
+// shards <= 1 keeps the unsharded AREA#city key.
+func (e Edge) AreaKey(shards int) string {
+	if shards <= 1 {
+		return e.Area.Area()
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(e.Demand() + "|" + e.Supply()))
+	return e.Area.Shard(int(h.Sum32() % uint32(shards)))
+}
+
+// ParseAreaKey extracts the area from a key AreaKey(shards) returned,
+// AREA#city or AREA#city#03. The shard suffix is parsed only when
+// shards > 1, so an unsharded AREA#zone#12 keeps the area zone#12.
+func ParseAreaKey(key string, shards int) Area {
+	key = strings.TrimPrefix(key, "AREA#")
+	if shards <= 1 {
+		return Area(key)
+	}
+	if i := strings.LastIndexByte(key, '#'); i >= 0 && isDigits(key[i+1:]) {
+		key = key[:i]
+	}
+	return Area(key)
+}
+
+// StoredArea extracts the area of the edge from a key written with any
+// of the shard counts, e.g. while the area keys move to another count.
+// A sharded key is told by its shard matching the hash of the edge, any
+// other key is parsed as unsharded.
+func (e Edge) StoredArea(key string, shards ...int) Area {
+	for _, n := range shards {
+		if n <= 1 {
+			continue
+		}
+		e.Area = ParseAreaKey(key, n)
+		if e.AreaKey(n) == key {
+			return e.Area
+		}
+	}
+	return ParseAreaKey(key, 0)
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 func (s Score) Float64() float64 {
 	return float64(s)
 }
@@ -0,0 +1,37 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAreaKey(t *testing.T) {
+	t.Run("Round trip the area key of an edge", func(t *testing.T) {
+		for _, area := range []Area{"city", "zone#12", "a#b"} {
+			for _, shards := range []int{0, 1, 4, 128} {
+				e := Edge{From: "A", To: "B", Area: area}
+				assert.Equal(t, area, ParseAreaKey(e.AreaKey(shards), shards), "%s in %d shards", area, shards)
+			}
+		}
+	})
+	t.Run("Keep a digit suffix of an unsharded key", func(t *testing.T) {
+		assert.Equal(t, Area("zone#12"), ParseAreaKey("AREA#zone#12", 0))
+		assert.Equal(t, Area("zone"), ParseAreaKey("AREA#zone#12", 4))
+	})
+}
+
+func TestEdge_StoredArea(t *testing.T) {
+	t.Run("Parse keys of either layout", func(t *testing.T) {
+		for _, area := range []Area{"city", "zone#12"} {
+			e := Edge{From: "A", To: "B", Area: area}
+			for _, shards := range []int{0, 4, 8} {
+				assert.Equal(t, area, e.StoredArea(e.AreaKey(shards), 4, 8), "%s in %d shards", area, shards)
+			}
+		}
+	})
+	t.Run("Keep a suffix that is not the shard of the edge", func(t *testing.T) {
+		e := Edge{From: "A", To: "B"}
+		assert.Equal(t, Area("zone#03"), e.StoredArea("AREA#zone#03", 4))
+	})
+}
@@ -0,0 +1,108 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Rules are the bounds of an edge that may be written. The zero Rules
+// are not usable, start from DefaultRules.
+type Rules struct {
+	MinScore, MaxScore Score
+	// TTL is counted from the write, a TTL below MinTTL would write an
+	// edge that expires before it is read
+	MinTTL, MaxTTL time.Duration
+}
+
+// DefaultRules accept non-negative finite scores and TTLs from a second
+// to 30 days.
+func DefaultRules() Rules {
+	return Rules{
+		MinScore: 0,
+		MaxScore: math.MaxFloat64,
+		MinTTL:   time.Second,
+		MaxTTL:   30 * 24 * time.Hour,
+	}
+}
+
+// Check returns why the edge may not be written, nil if it may.
+func (r Rules) Check(e Edge) error {
+	var problems []string
+	problems = append(problems, keyProblems(e)...)
+	if e.Area == "" {
+		problems = append(problems, "empty area")
+	}
+	switch s := e.Score.Float64(); {
+	case math.IsNaN(s) || math.IsInf(s, 0):
+		problems = append(problems, fmt.Sprintf("score %v is not a number", s))
+	case e.Score < r.MinScore || e.Score > r.MaxScore:
+		problems = append(problems, fmt.Sprintf("score %v out of [%v, %v]", s, r.MinScore, r.MaxScore))
+	}
+	if e.TTL < r.MinTTL || e.TTL > r.MaxTTL {
+		problems = append(problems, fmt.Sprintf("ttl %s out of [%s, %s]", e.TTL, r.MinTTL, r.MaxTTL))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, ", "))
+}
+
+// Validate checks the edges of a write, see ValidationError.
+func (r Rules) Validate(edges []Edge) error {
+	return validate(edges, r.Check)
+}
+
+// ValidateKeys checks that the edges identify the items to remove: a
+// removal needs the nodes of an edge only.
+func ValidateKeys(edges []Edge) error {
+	return validate(edges, func(e Edge) error {
+		if problems := keyProblems(e); len(problems) > 0 {
+			return errors.New(strings.Join(problems, ", "))
+		}
+		return nil
+	})
+}
+
+func validate(edges []Edge, check func(Edge) error) error {
+	var invalid []EdgeError
+	for _, e := range edges {
+		if err := check(e); err != nil {
+			invalid = append(invalid, EdgeError{Edge: e, Err: err})
+		}
+	}
+	if len(invalid) == 0 {
+		return nil
+	}
+	return &ValidationError{Invalid: invalid}
+}
+
+func keyProblems(e Edge) []string {
+	var problems []string
+	if e.From == "" {
+		problems = append(problems, "empty demand node")
+	}
+	if e.To == "" {
+		problems = append(problems, "empty supply node")
+	}
+	return problems
+}
+
+// ValidationError lists the edges that broke the rules. A write with an
+// invalid edge writes none of its edges. It matches ErrInvalidEdge.
+type ValidationError struct {
+	Invalid []EdgeError
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v: %d edges", ErrInvalidEdge, len(e.Invalid))
+	writeEdgeErrors(&b, e.Invalid)
+	return b.String()
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidEdge
+}
@@ -0,0 +1,55 @@
+package graph
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRules(t *testing.T) {
+	valid := Edge{From: "A", To: "B", Area: "Area1", Score: 0.5, TTL: 15 * time.Minute}
+
+	t.Run("Accept a valid edge", func(t *testing.T) {
+		assert.NoError(t, DefaultRules().Check(valid))
+		assert.NoError(t, DefaultRules().Validate([]Edge{valid}))
+	})
+	t.Run("Reject broken fields", func(t *testing.T) {
+		for name, edge := range map[string]Edge{
+			"empty demand": {To: "B", Area: "Area1", Score: 1, TTL: time.Minute},
+			"empty supply": {From: "A", Area: "Area1", Score: 1, TTL: time.Minute},
+			"empty area":   {From: "A", To: "B", Score: 1, TTL: time.Minute},
+			"nan score":    {From: "A", To: "B", Area: "Area1", Score: Score(math.NaN()), TTL: time.Minute},
+			"inf score":    {From: "A", To: "B", Area: "Area1", Score: Score(math.Inf(1)), TTL: time.Minute},
+			"negative":     {From: "A", To: "B", Area: "Area1", Score: -1, TTL: time.Minute},
+			"zero ttl":     {From: "A", To: "B", Area: "Area1", Score: 1},
+			"negative ttl": {From: "A", To: "B", Area: "Area1", Score: 1, TTL: -time.Minute},
+			"ttl too long": {From: "A", To: "B", Area: "Area1", Score: 1, TTL: 365 * 24 * time.Hour},
+		} {
+			assert.Error(t, DefaultRules().Check(edge), name)
+		}
+	})
+	t.Run("Apply configured bounds", func(t *testing.T) {
+		rules := Rules{MinScore: 0, MaxScore: 1, MinTTL: time.Minute, MaxTTL: time.Hour}
+		assert.NoError(t, rules.Check(valid))
+		assert.Error(t, rules.Check(Edge{From: "A", To: "B", Area: "Area1", Score: 2, TTL: time.Minute}))
+		assert.Error(t, rules.Check(Edge{From: "A", To: "B", Area: "Area1", Score: 1, TTL: time.Second}))
+	})
+	t.Run("Identify the invalid edges", func(t *testing.T) {
+		broken := Edge{From: "A", To: "C", Area: "Area1", Score: -1}
+		err := DefaultRules().Validate([]Edge{valid, broken})
+		assert.ErrorIs(t, err, ErrInvalidEdge)
+
+		var invalid *ValidationError
+		if assert.ErrorAs(t, err, &invalid) && assert.Len(t, invalid.Invalid, 1) {
+			assert.Equal(t, broken, invalid.Invalid[0].Edge)
+			assert.Contains(t, invalid.Invalid[0].Error(), "score -1")
+			assert.Contains(t, invalid.Invalid[0].Error(), "ttl 0s")
+		}
+	})
+	t.Run("Check only the keys of removed edges", func(t *testing.T) {
+		assert.NoError(t, ValidateKeys([]Edge{{From: "A", To: "B"}}))
+		assert.ErrorIs(t, ValidateKeys([]Edge{{From: "A"}}), ErrInvalidEdge)
+	})
+}
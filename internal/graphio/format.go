@@ -0,0 +1,208 @@
+package graphio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+)
+
+type Format string
+
+const (
+	FormatJSONL Format = "jsonl"
+	FormatCSV   Format = "csv"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatJSONL, FormatCSV:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown format %q, expected jsonl or csv", s)
+	}
+}
+
+// record is one edge in a snapshot file. expires_at is epoch seconds,
+// the same precision as the ttl attribute in DynamoDB.
+type record struct {
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	Score     float64 `json:"score"`
+	Area      string  `json:"area"`
+	ExpiresAt int64   `json:"expires_at"`
+}
+
+var csvHeader = []string{"from", "to", "score", "area", "expires_at"}
+
+func toRecord(e graph.Edge) record {
+	var expiresAt int64
+	if !e.ExpiresAt.IsZero() {
+		expiresAt = e.ExpiresAt.Unix()
+	}
+	return record{
+		From:      e.From.String(),
+		To:        e.To.String(),
+		Score:     e.Score.Float64(),
+		Area:      string(e.Area),
+		ExpiresAt: expiresAt,
+	}
+}
+
+func (r record) edge() graph.Edge {
+	e := graph.Edge{
+		From:  graph.Node(r.From),
+		To:    graph.Node(r.To),
+		Score: graph.Score(r.Score),
+		Area:  graph.Area(r.Area),
+	}
+	if r.ExpiresAt > 0 {
+		e.ExpiresAt = time.Unix(r.ExpiresAt, 0).UTC()
+	}
+	return e
+}
+
+// Encoder writes edges in one of the snapshot formats. Every WriteEdges
+// call is flushed, so a checkpoint saved after it never runs ahead of the data.
+// Close does not close the underlying writer.
+type Encoder interface {
+	WriteEdges(edges ...graph.Edge) error
+	Close() error
+}
+
+// Decoder reads edges until io.EOF.
+type Decoder interface {
+	Next() (graph.Edge, error)
+}
+
+func NewEncoder(format Format, w io.Writer) (Encoder, error) {
+	switch format {
+	case FormatJSONL:
+		bw := bufio.NewWriter(w)
+		return &jsonlEncoder{w: bw, enc: json.NewEncoder(bw)}, nil
+	case FormatCSV:
+		return &csvEncoder{w: csv.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func NewDecoder(format Format, r io.Reader) (Decoder, error) {
+	switch format {
+	case FormatJSONL:
+		return &jsonlDecoder{dec: json.NewDecoder(bufio.NewReader(r))}, nil
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = len(csvHeader)
+		return &csvDecoder{r: cr}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+type jsonlEncoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (e *jsonlEncoder) WriteEdges(edges ...graph.Edge) error {
+	for _, edge := range edges {
+		if err := e.enc.Encode(toRecord(edge)); err != nil {
+			return err
+		}
+	}
+	return e.w.Flush()
+}
+
+func (e *jsonlEncoder) Close() error {
+	return e.w.Flush()
+}
+
+type jsonlDecoder struct {
+	dec *json.Decoder
+}
+
+func (d *jsonlDecoder) Next() (graph.Edge, error) {
+	var r record
+	if err := d.dec.Decode(&r); err != nil {
+		return graph.Edge{}, err
+	}
+	return r.edge(), nil
+}
+
+type csvEncoder struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func (e *csvEncoder) WriteEdges(edges ...graph.Edge) error {
+	if !e.wroteHeader {
+		if err := e.w.Write(csvHeader); err != nil {
+			return err
+		}
+		e.wroteHeader = true
+	}
+	for _, edge := range edges {
+		r := toRecord(edge)
+		if err := e.w.Write([]string{
+			r.From,
+			r.To,
+			strconv.FormatFloat(r.Score, 'g', -1, 64),
+			r.Area,
+			strconv.FormatInt(r.ExpiresAt, 10),
+		}); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvEncoder) Close() error {
+	if !e.wroteHeader {
+		// Пустая выгрузка всё равно содержит заголовок
+		if err := e.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type csvDecoder struct {
+	r          *csv.Reader
+	readHeader bool
+}
+
+func (d *csvDecoder) Next() (graph.Edge, error) {
+	if !d.readHeader {
+		if _, err := d.r.Read(); err != nil {
+			return graph.Edge{}, err
+		}
+		d.readHeader = true
+	}
+	fields, err := d.r.Read()
+	if err != nil {
+		return graph.Edge{}, err
+	}
+	score, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return graph.Edge{}, fmt.Errorf("invalid score %q: %w", fields[2], err)
+	}
+	expiresAt, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return graph.Edge{}, fmt.Errorf("invalid expires_at %q: %w", fields[4], err)
+	}
+	return record{
+		From:      fields[0],
+		To:        fields[1],
+		Score:     score,
+		Area:      fields[3],
+		ExpiresAt: expiresAt,
+	}.edge(), nil
+}
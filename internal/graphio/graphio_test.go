@@ -0,0 +1,107 @@
+package graphio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+)
+
+func TestEncoderDecoder(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+	edges := []graph.Edge{
+		{
+			From:      "A",
+			To:        "B",
+			Area:      "Area1",
+			Score:     67.77868,
+			ExpiresAt: expiresAt,
+		},
+		{
+			From:  "C",
+			To:    "D,E",
+			Area:  "Area2",
+			Score: 0.4556456,
+		},
+	}
+
+	for _, format := range []Format{FormatJSONL, FormatCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+
+			enc, err := NewEncoder(format, &buf)
+			assert.NoError(t, err)
+			assert.NoError(t, enc.WriteEdges(edges...))
+			assert.NoError(t, enc.Close())
+
+			dec, err := NewDecoder(format, &buf)
+			assert.NoError(t, err)
+
+			var got []graph.Edge
+			for {
+				e, err := dec.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				assert.NoError(t, err)
+				got = append(got, e)
+			}
+			assert.Equal(t, edges, got)
+		})
+	}
+}
+
+type sliceDecoder struct {
+	edges []graph.Edge
+}
+
+func (d *sliceDecoder) Next() (graph.Edge, error) {
+	if len(d.edges) == 0 {
+		return graph.Edge{}, io.EOF
+	}
+	e := d.edges[0]
+	d.edges = d.edges[1:]
+	return e, nil
+}
+
+type batchRecorder struct {
+	batches [][]graph.Edge
+}
+
+func (r *batchRecorder) UpsertEdges(_ context.Context, edges ...graph.Edge) error {
+	r.batches = append(r.batches, edges)
+	return nil
+}
+
+func TestImporter_Import(t *testing.T) {
+	now := time.Now()
+	dec := &sliceDecoder{edges: []graph.Edge{
+		{From: "A", To: "B", Score: 1, ExpiresAt: now.Add(time.Hour)},
+		{From: "A", To: "B", Score: 2, ExpiresAt: now.Add(time.Hour)},
+		{From: "A", To: "C", Score: 3},
+		{From: "D", To: "E", Score: 4, ExpiresAt: now.Add(-time.Hour)},
+		{From: "D", To: "F", Score: 4, ExpiresAt: now.Add(500 * time.Millisecond)},
+		{From: "F", To: "G", Score: 5, ExpiresAt: now.Add(time.Hour)},
+		{From: "A", To: "B", Score: 6, ExpiresAt: now.Add(time.Hour)},
+	}}
+	rec := &batchRecorder{}
+
+	stats, err := NewImporter(rec, ImportOptions{BatchSize: 2, DefaultTTL: time.Minute}).Import(context.Background(), dec)
+	require.NoError(t, err)
+	assert.Equal(t, ImportStats{Read: 7, Duplicates: 1, Expired: 2, Written: 4}, stats)
+
+	require.Len(t, rec.batches, 2)
+	require.Len(t, rec.batches[0], 2)
+	assert.Equal(t, graph.Score(2), rec.batches[0][0].Score) // в пачке побеждает последняя запись
+	assert.Equal(t, time.Minute, rec.batches[0][1].TTL)
+	require.Len(t, rec.batches[1], 2)
+	assert.InDelta(t, time.Hour.Seconds(), rec.batches[1][0].TTL.Seconds(), 5)
+	assert.Equal(t, graph.Score(6), rec.batches[1][1].Score) // и перезаписывает прошлые пачки
+}
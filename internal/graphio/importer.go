@@ -0,0 +1,130 @@
+package graphio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+)
+
+type graphBuilder interface {
+	UpsertEdges(ctx context.Context, edges ...graph.Edge) error
+}
+
+type ImportOptions struct {
+	// BatchSize - число рёбер в одном вызове UpsertEdges, по умолчанию 25
+	BatchSize int
+	// Rate - ограничение записи в рёбрах в секунду, 0 - без ограничения
+	Rate float64
+	// DefaultTTL is used for records without expires_at.
+	DefaultTTL time.Duration
+	// MinTTL - записи, которым осталось жить меньше, считаются истёкшими:
+	// граф их не примет. По умолчанию graph.DefaultRules().MinTTL
+	MinTTL time.Duration
+}
+
+type ImportStats struct {
+	Read       int
+	Duplicates int
+	Expired    int
+	Written    int
+}
+
+// Importer loads snapshot files into the graph.
+type Importer struct {
+	graphBuilder graphBuilder
+	opts         ImportOptions
+}
+
+func NewImporter(graphBuilder graphBuilder, opts ImportOptions) *Importer {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 25
+	}
+	if opts.MinTTL <= 0 {
+		opts.MinTTL = graph.DefaultRules().MinTTL
+	}
+	return &Importer{graphBuilder: graphBuilder, opts: opts}
+}
+
+// Import streams the edges from dec and writes them in rate-limited
+// batches. Batches are written in the order of the records, so a later
+// record of a (from, to) pair overwrites the earlier one; within a batch
+// only the last record of a pair is kept. Records that have already
+// expired, or expire within MinTTL, are skipped.
+func (i *Importer) Import(ctx context.Context, dec Decoder) (ImportStats, error) {
+	var (
+		stats ImportStats
+		tick  <-chan time.Time
+	)
+	if i.opts.Rate > 0 {
+		// При очень большом Rate интервал округляется до нуля, а тикер с
+		// нулевым интервалом паникует
+		interval := max(time.Duration(float64(time.Second)*float64(i.opts.BatchSize)/i.opts.Rate), time.Nanosecond)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	batch := make([]graph.Edge, 0, i.opts.BatchSize)
+	index := make(map[[2]graph.Node]int, i.opts.BatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if tick != nil && stats.Written > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-tick:
+			}
+		}
+		if err := i.graphBuilder.UpsertEdges(ctx, batch...); err != nil {
+			return fmt.Errorf("write batch after %d edges: %w", stats.Written, err)
+		}
+		stats.Written += len(batch)
+		batch = make([]graph.Edge, 0, i.opts.BatchSize)
+		clear(index)
+		return nil
+	}
+
+	for {
+		e, err := dec.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return stats, fmt.Errorf("read record %d: %w", stats.Read+1, err)
+		}
+		stats.Read++
+
+		switch now := time.Now(); {
+		case e.ExpiresAt.IsZero():
+			e.TTL = i.opts.DefaultTTL
+		case e.ExpiresAt.Sub(now) >= i.opts.MinTTL:
+			e.TTL = e.ExpiresAt.Sub(now)
+		default:
+			stats.Expired++
+			continue
+		}
+		e.ExpiresAt = time.Time{}
+
+		// BatchWriteItem не принимает два элемента с одним ключом
+		key := [2]graph.Node{e.From, e.To}
+		if j, ok := index[key]; ok {
+			batch[j] = e
+			stats.Duplicates++
+			continue
+		}
+		index[key] = len(batch)
+		batch = append(batch, e)
+		if len(batch) == i.opts.BatchSize {
+			if err = flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+	return stats, flush()
+}
@@ -0,0 +1,116 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// ChannelBroker is an in-process topic for tests and offline runs.
+// Published messages are received in order, a nacked message goes to the
+// end of the queue.
+type ChannelBroker struct {
+	mu       sync.Mutex
+	queue    []Message
+	inFlight map[string]struct{}
+	seq      int
+	closed   bool
+	// changed закрывается и заменяется при каждом изменении очереди
+	changed chan struct{}
+}
+
+func NewChannelBroker() *ChannelBroker {
+	return &ChannelBroker{
+		inFlight: make(map[string]struct{}),
+		changed:  make(chan struct{}),
+	}
+}
+
+// Publish adds an event to the topic, value is encoded as JSON.
+func (b *ChannelBroker) Publish(topic, key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encode %s event: %w", topic, err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+	b.seq++
+	b.queue = append(b.queue, Message{
+		ID:      strconv.Itoa(b.seq),
+		Topic:   topic,
+		Key:     key,
+		Value:   data,
+		Attempt: 1,
+	})
+	b.notify()
+	return nil
+}
+
+// Close stops publishing. Receive returns ErrClosed once every published
+// message is acked.
+func (b *ChannelBroker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.notify()
+}
+
+func (b *ChannelBroker) Receive(ctx context.Context) (Message, error) {
+	for {
+		b.mu.Lock()
+		if len(b.queue) > 0 {
+			m := b.queue[0]
+			b.queue = b.queue[1:]
+			b.inFlight[m.ID] = struct{}{}
+			b.mu.Unlock()
+			return m, nil
+		}
+		if b.closed && len(b.inFlight) == 0 {
+			b.mu.Unlock()
+			return Message{}, ErrClosed
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return Message{}, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (b *ChannelBroker) Ack(_ context.Context, m Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.inFlight[m.ID]; !ok {
+		return fmt.Errorf("ingest: message %s is not in flight", m.ID)
+	}
+	delete(b.inFlight, m.ID)
+	b.notify()
+	return nil
+}
+
+func (b *ChannelBroker) Nack(_ context.Context, m Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.inFlight[m.ID]; !ok {
+		return fmt.Errorf("ingest: message %s is not in flight", m.ID)
+	}
+	delete(b.inFlight, m.ID)
+	m.Attempt++
+	b.queue = append(b.queue, m)
+	b.notify()
+	return nil
+}
+
+// notify wakes up the receivers, b.mu must be held.
+func (b *ChannelBroker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
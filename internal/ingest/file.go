@@ -0,0 +1,268 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Envelope is one line of an events file:
+//
+//	{"topic": "demand", "key": "d1", "value": {"id": "d1", "lat": 43.2, "lon": 76.9}}
+type Envelope struct {
+	Topic string          `json:"topic"`
+	Key   string          `json:"key,omitempty"`
+	Value json.RawMessage `json:"value"`
+	// Error and Attempts are written by FileDeadLetters, so a dead letter
+	// file can be read by FileSource again. FileSource ignores them.
+	Error    string `json:"error,omitempty"`
+	Attempts int    `json:"attempts,omitempty"`
+}
+
+// FileSource reads the events of a JSON lines file of envelopes, see
+// Envelope. The line after the last acked message is kept in an offset
+// file, a restarted source continues from it: messages received but not
+// acked before a crash are delivered again.
+//
+// Messages are handed out one at a time, the next one is received after
+// the previous is acked or nacked. A nacked message is delivered again
+// right away. Attempt numbers are not kept across restarts.
+type FileSource struct {
+	path       string
+	offsetPath string
+	follow     time.Duration
+
+	mu        sync.Mutex
+	file      *os.File
+	reader    *bufio.Reader
+	partial   []byte
+	line      int
+	pending   *Message
+	redeliver *Message
+}
+
+type FileOption func(*FileSource)
+
+// WithOffsetFile sets the offset file, the events file with the .offset
+// suffix by default.
+func WithOffsetFile(path string) FileOption {
+	return func(s *FileSource) {
+		s.offsetPath = path
+	}
+}
+
+// WithFollow waits for lines appended to the file instead of closing the
+// source at the end of it, checking every interval.
+func WithFollow(interval time.Duration) FileOption {
+	return func(s *FileSource) {
+		s.follow = interval
+	}
+}
+
+// OpenFileSource opens the events file and skips the lines handled
+// before, by the offset file.
+func OpenFileSource(path string, opts ...FileOption) (*FileSource, error) {
+	s := &FileSource{path: path, offsetPath: path + ".offset"}
+	for _, opt := range opts {
+		opt(s)
+	}
+	offset, err := s.loadOffset()
+	if err != nil {
+		return nil, err
+	}
+	if s.file, err = os.Open(path); err != nil {
+		return nil, err
+	}
+	s.reader = bufio.NewReader(s.file)
+	for s.line < offset {
+		if _, err = s.readLine(); err != nil {
+			s.file.Close()
+			return nil, fmt.Errorf("skip to line %d of %s: %w", offset, path, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *FileSource) Close() error {
+	return s.file.Close()
+}
+
+func (s *FileSource) Receive(ctx context.Context) (Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending != nil {
+		return Message{}, fmt.Errorf("ingest: message %s is not acked or nacked", s.pending.ID)
+	}
+	if s.redeliver != nil {
+		m := *s.redeliver
+		s.pending, s.redeliver = &m, nil
+		return m, nil
+	}
+
+	for {
+		line, err := s.readLine()
+		if errors.Is(err, io.EOF) && s.follow > 0 {
+			select {
+			case <-ctx.Done():
+				return Message{}, ctx.Err()
+			case <-time.After(s.follow):
+			}
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return Message{}, ErrClosed
+		}
+		if err != nil {
+			return Message{}, err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		m := s.message(line)
+		s.pending = &m
+		return m, nil
+	}
+}
+
+// message turns a line into a message. A line that is not an envelope
+// becomes a message without a topic carrying the line as a JSON string,
+// the pipeline dead-letters it.
+func (s *FileSource) message(line []byte) Message {
+	m := Message{
+		ID:      filepath.Base(s.path) + ":" + strconv.Itoa(s.line),
+		Attempt: 1,
+	}
+	var env Envelope
+	if err := json.Unmarshal(line, &env); err != nil {
+		m.Value, _ = json.Marshal(string(line))
+		return m
+	}
+	m.Topic, m.Key, m.Value = env.Topic, env.Key, env.Value
+	return m
+}
+
+// readLine returns the next full line without the line break. At the end
+// of the file a line without a newline is returned only when the file is
+// not followed: a writer may still be appending it.
+func (s *FileSource) readLine() ([]byte, error) {
+	data, err := s.reader.ReadBytes('\n')
+	s.partial = append(s.partial, data...)
+	if errors.Is(err, io.EOF) && (s.follow > 0 || len(s.partial) == 0) {
+		return nil, io.EOF
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	line := bytes.TrimRight(s.partial, "\r\n")
+	s.partial = nil
+	s.line++
+	return line, nil
+}
+
+func (s *FileSource) Ack(_ context.Context, m Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == nil || s.pending.ID != m.ID {
+		return fmt.Errorf("ingest: message %s is not in flight", m.ID)
+	}
+	if err := s.saveOffset(s.line); err != nil {
+		return err
+	}
+	s.pending = nil
+	return nil
+}
+
+func (s *FileSource) Nack(_ context.Context, m Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == nil || s.pending.ID != m.ID {
+		return fmt.Errorf("ingest: message %s is not in flight", m.ID)
+	}
+	m.Attempt++
+	s.pending, s.redeliver = nil, &m
+	return nil
+}
+
+func (s *FileSource) loadOffset() (int, error) {
+	data, err := os.ReadFile(s.offsetPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	offset, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("decode offset %s: %w", s.offsetPath, err)
+	}
+	return offset, nil
+}
+
+// saveOffset writes the offset to a temporary file and renames it,
+// so an interrupted save never leaves a truncated offset behind.
+func (s *FileSource) saveOffset(offset int) error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.offsetPath), filepath.Base(s.offsetPath)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.WriteString(strconv.Itoa(offset) + "\n"); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.offsetPath)
+}
+
+// FileDeadLetters appends dead letters to a JSON lines file of envelopes
+// with the error and the number of attempts.
+type FileDeadLetters struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func OpenFileDeadLetters(path string) (*FileDeadLetters, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileDeadLetters{file: file}, nil
+}
+
+func (d *FileDeadLetters) Put(_ context.Context, m Message, cause error) error {
+	value := m.Value
+	if !json.Valid(value) {
+		value, _ = json.Marshal(string(value))
+	}
+	line, err := json.Marshal(Envelope{
+		Topic:    m.Topic,
+		Key:      m.Key,
+		Value:    value,
+		Error:    cause.Error(),
+		Attempts: m.Attempt,
+	})
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, err = d.file.Write(append(line, '\n'))
+	return err
+}
+
+func (d *FileDeadLetters) Close() error {
+	return d.file.Close()
+}
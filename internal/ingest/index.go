@@ -0,0 +1,141 @@
+package ingest
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/demand"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/supply"
+)
+
+const earthRadiusKm = 6371.0
+
+type position struct {
+	lat, lon float64
+	seen     time.Time
+}
+
+// Index keeps the last position of every demand and supply seen in the
+// events and stands in for the geo readers of the use cases offline. A
+// position older than the ttl is forgotten, like the edges built from it.
+type Index struct {
+	radiusKm float64
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	demands  map[string]position
+	supplies map[string]position
+}
+
+type IndexOption func(*Index)
+
+// WithIndexClock sets the clock the positions are stamped with.
+func WithIndexClock(now func() time.Time) IndexOption {
+	return func(x *Index) {
+		x.now = now
+	}
+}
+
+// NewIndex creates an index that finds nodes within radiusKm of each other.
+func NewIndex(radiusKm float64, ttl time.Duration, opts ...IndexOption) *Index {
+	x := &Index{
+		radiusKm: radiusKm,
+		ttl:      ttl,
+		now:      time.Now,
+		demands:  make(map[string]position),
+		supplies: make(map[string]position),
+	}
+	for _, opt := range opts {
+		opt(x)
+	}
+	return x
+}
+
+// Demands records the position of every demand before passing it to uc.
+func (x *Index) Demands(uc demandUpdater) demandUpdater {
+	return demandRecorder{x, uc}
+}
+
+// Supplies records the position of every supply before passing it to uc.
+func (x *Index) Supplies(uc supplyUpdater) supplyUpdater {
+	return supplyRecorder{x, uc}
+}
+
+// SupplyReader finds supplies near a demand for demand.UseCase.
+type SupplyReader struct{ *Index }
+
+func (r SupplyReader) FindBy(_ context.Context, order demand.Demand) ([]supply.Supply, error) {
+	found := make([]supply.Supply, 0)
+	for id, p := range r.near(r.supplies, order.Lat, order.Lon) {
+		found = append(found, supply.Supply{ID: id, Lat: p.lat, Lon: p.lon})
+	}
+	return found, nil
+}
+
+// DemandReader finds demands near a supply for supply.UseCase.
+type DemandReader struct{ *Index }
+
+func (r DemandReader) FindBy(_ context.Context, user supply.Supply) ([]demand.Demand, error) {
+	found := make([]demand.Demand, 0)
+	for id, p := range r.near(r.demands, user.Lat, user.Lon) {
+		found = append(found, demand.Demand{ID: id, Lat: p.lat, Lon: p.lon})
+	}
+	return found, nil
+}
+
+func (x *Index) record(nodes map[string]position, id string, lat, lon float64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	nodes[id] = position{lat: lat, lon: lon, seen: x.now()}
+}
+
+// near returns the positions within the radius, forgetting the expired ones.
+func (x *Index) near(nodes map[string]position, lat, lon float64) map[string]position {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	expired := x.now().Add(-x.ttl)
+	found := make(map[string]position)
+	for id, p := range nodes {
+		if p.seen.Before(expired) {
+			delete(nodes, id)
+			continue
+		}
+		if distanceKm(lat, lon, p.lat, p.lon) <= x.radiusKm {
+			found[id] = p
+		}
+	}
+	return found
+}
+
+type demandRecorder struct {
+	*Index
+	next demandUpdater
+}
+
+func (r demandRecorder) Update(ctx context.Context, order demand.Demand) error {
+	r.record(r.demands, order.ID, order.Lat, order.Lon)
+	return r.next.Update(ctx, order)
+}
+
+type supplyRecorder struct {
+	*Index
+	next supplyUpdater
+}
+
+func (r supplyRecorder) Update(ctx context.Context, user supply.Supply) error {
+	r.record(r.supplies, user.ID, user.Lat, user.Lon)
+	return r.next.Update(ctx, user)
+}
+
+// distanceKm - расстояние по большому кругу (формула гаверсинуса)
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const rad = math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(min(a, 1)))
+}
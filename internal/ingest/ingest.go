@@ -0,0 +1,121 @@
+// Package ingest consumes the demand and supply topics and passes their
+// events to the use cases that build the graph.
+//
+// Sources deliver messages at least once: a message that is not acked is
+// delivered again, so handling an event twice must be harmless, which
+// holds for the upserts of the use cases. The local sources, ChannelBroker
+// and FileSource, stand in for a broker to run the pipeline offline.
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/demand"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/supply"
+)
+
+// Topics of the events.
+const (
+	// TopicDemand - заказы, событие - demand.Demand
+	TopicDemand = "demand"
+	// TopicSupply - водители, событие - supply.Supply
+	TopicSupply = "supply"
+)
+
+var (
+	// ErrClosed - the source has no more messages and will not have any.
+	ErrClosed = errors.New("ingest: source closed")
+	// ErrMalformed - the event cannot be decoded, delivering it again does
+	// not help.
+	ErrMalformed = errors.New("ingest: malformed event")
+	// ErrUnknownTopic - the pipeline has no handler for the topic.
+	ErrUnknownTopic = errors.New("ingest: unknown topic")
+)
+
+// Message is one delivery of an event.
+type Message struct {
+	// ID identifies the message within its source, e.g. its offset
+	ID    string
+	Topic string
+	Key   string
+	Value json.RawMessage
+	// Attempt counts deliveries of the message, starting from 1
+	Attempt int
+}
+
+// Source delivers messages at least once.
+type Source interface {
+	// Receive waits for the next message. It returns ErrClosed when the
+	// source is exhausted.
+	Receive(ctx context.Context) (Message, error)
+	// Ack marks the message handled, it is not delivered again.
+	Ack(ctx context.Context, m Message) error
+	// Nack hands the message back, it is delivered again with the next
+	// attempt number.
+	Nack(ctx context.Context, m Message) error
+}
+
+// DeadLetters keeps the messages the pipeline gave up on.
+type DeadLetters interface {
+	Put(ctx context.Context, m Message, cause error) error
+}
+
+// LogDeadLetters logs dead messages with the default slog logger.
+type LogDeadLetters struct{}
+
+func (LogDeadLetters) Put(ctx context.Context, m Message, cause error) error {
+	slog.ErrorContext(ctx, "ingest: dead letter",
+		"message", m.ID,
+		"topic", m.Topic,
+		"key", m.Key,
+		"attempt", m.Attempt,
+		"value", string(m.Value),
+		"error", cause,
+	)
+	return nil
+}
+
+// event is the JSON of both topics.
+type event struct {
+	ID  string   `json:"id"`
+	Lat *float64 `json:"lat"`
+	Lon *float64 `json:"lon"`
+}
+
+func decode(value []byte) (event, error) {
+	var e event
+	if err := json.Unmarshal(value, &e); err != nil {
+		return e, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	switch {
+	case e.ID == "":
+		return e, fmt.Errorf("%w: empty id", ErrMalformed)
+	case e.Lat == nil || e.Lon == nil:
+		return e, fmt.Errorf("%w: %s has no position", ErrMalformed, e.ID)
+	case *e.Lat < -90 || *e.Lat > 90 || *e.Lon < -180 || *e.Lon > 180:
+		return e, fmt.Errorf("%w: %s is at %v, %v", ErrMalformed, e.ID, *e.Lat, *e.Lon)
+	}
+	return e, nil
+}
+
+// DecodeDemand decodes an event of TopicDemand, {"id": "d1", "lat": 43.2, "lon": 76.9}.
+func DecodeDemand(value []byte) (demand.Demand, error) {
+	e, err := decode(value)
+	if err != nil {
+		return demand.Demand{}, err
+	}
+	return demand.Demand{ID: e.ID, Lat: *e.Lat, Lon: *e.Lon}, nil
+}
+
+// DecodeSupply decodes an event of TopicSupply, the same JSON as of demand.
+func DecodeSupply(value []byte) (supply.Supply, error) {
+	e, err := decode(value)
+	if err != nil {
+		return supply.Supply{}, err
+	}
+	return supply.Supply{ID: e.ID, Lat: *e.Lat, Lon: *e.Lon}, nil
+}
@@ -0,0 +1,325 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/demand"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/supply"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/memory"
+	demandUseCase "github.com/ashabykov/graph-building-in-dynamodb/internal/usecase/demand"
+	supplyUseCase "github.com/ashabykov/graph-building-in-dynamodb/internal/usecase/supply"
+)
+
+// fakeUpdaters records the events and fails the first ones with errs.
+type fakeUpdaters struct {
+	demands  []demand.Demand
+	supplies []supply.Supply
+	errs     []error
+}
+
+func (f *fakeUpdaters) fail() error {
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *fakeUpdaters) Update(_ context.Context, order demand.Demand) error {
+	f.demands = append(f.demands, order)
+	return f.fail()
+}
+
+type supplyUpdates struct{ *fakeUpdaters }
+
+func (s supplyUpdates) Update(_ context.Context, user supply.Supply) error {
+	s.supplies = append(s.supplies, user)
+	return s.fail()
+}
+
+type memoryDeadLetters struct {
+	messages []Message
+	causes   []error
+}
+
+func (d *memoryDeadLetters) Put(_ context.Context, m Message, cause error) error {
+	d.messages = append(d.messages, m)
+	d.causes = append(d.causes, cause)
+	return nil
+}
+
+func location(id string, lat, lon float64) map[string]any {
+	return map[string]any{"id": id, "lat": lat, "lon": lon}
+}
+
+func TestPipeline(t *testing.T) {
+	ctx := context.Background()
+
+	run := func(t *testing.T, updaters *fakeUpdaters, publish func(b *ChannelBroker)) (*Pipeline, *memoryDeadLetters) {
+		broker := NewChannelBroker()
+		publish(broker)
+		broker.Close()
+		dl := &memoryDeadLetters{}
+		p := New(broker, updaters, supplyUpdates{updaters},
+			WithDeadLetters(dl),
+			WithMaxAttempts(3),
+			WithBackoff(time.Millisecond),
+		)
+		assert.NoError(t, p.Run(ctx))
+		return p, dl
+	}
+
+	t.Run("Dispatch events to the use cases by topic", func(t *testing.T) {
+		updaters := &fakeUpdaters{}
+		p, dl := run(t, updaters, func(b *ChannelBroker) {
+			assert.NoError(t, b.Publish(TopicDemand, "d1", location("d1", 43.2, 76.9)))
+			assert.NoError(t, b.Publish(TopicSupply, "s1", location("s1", 43.3, 76.8)))
+		})
+		assert.Equal(t, []demand.Demand{{ID: "d1", Lat: 43.2, Lon: 76.9}}, updaters.demands)
+		assert.Equal(t, []supply.Supply{{ID: "s1", Lat: 43.3, Lon: 76.8}}, updaters.supplies)
+		assert.Empty(t, dl.messages)
+		assert.Equal(t, Stats{Received: 2, Handled: 2}, p.Stats())
+	})
+	t.Run("Retry a failed event until it is handled", func(t *testing.T) {
+		updaters := &fakeUpdaters{errs: []error{graph.ErrThrottled, graph.ErrThrottled}}
+		p, dl := run(t, updaters, func(b *ChannelBroker) {
+			assert.NoError(t, b.Publish(TopicDemand, "d1", location("d1", 43.2, 76.9)))
+		})
+		assert.Len(t, updaters.demands, 3)
+		assert.Empty(t, dl.messages)
+		assert.Equal(t, Stats{Received: 3, Handled: 1, Retried: 2}, p.Stats())
+	})
+	t.Run("Dead-letter an event once the attempts run out", func(t *testing.T) {
+		updaters := &fakeUpdaters{errs: []error{graph.ErrThrottled, graph.ErrThrottled, graph.ErrThrottled}}
+		p, dl := run(t, updaters, func(b *ChannelBroker) {
+			assert.NoError(t, b.Publish(TopicDemand, "d1", location("d1", 43.2, 76.9)))
+		})
+		if assert.Len(t, dl.messages, 1) {
+			assert.Equal(t, 3, dl.messages[0].Attempt)
+			assert.ErrorIs(t, dl.causes[0], graph.ErrThrottled)
+		}
+		assert.Equal(t, Stats{Received: 3, Retried: 2, DeadLettered: 1}, p.Stats())
+	})
+	t.Run("Dead-letter malformed events and rejected edges right away", func(t *testing.T) {
+		updaters := &fakeUpdaters{errs: []error{&graph.ValidationError{}}}
+		p, dl := run(t, updaters, func(b *ChannelBroker) {
+			assert.NoError(t, b.Publish(TopicSupply, "s1", location("s1", 43.3, 76.8)))
+			assert.NoError(t, b.Publish(TopicDemand, "d1", map[string]any{"id": "d1"}))
+			assert.NoError(t, b.Publish(TopicDemand, "d2", location("d2", 91, 76.9)))
+			assert.NoError(t, b.Publish(TopicDemand, "d3", "not an object"))
+		})
+		assert.Empty(t, updaters.demands)
+		if assert.Len(t, dl.causes, 4) {
+			assert.ErrorIs(t, dl.causes[0], graph.ErrInvalidEdge)
+			for _, cause := range dl.causes[1:] {
+				assert.ErrorIs(t, cause, ErrMalformed)
+			}
+		}
+		assert.Equal(t, Stats{Received: 4, DeadLettered: 4}, p.Stats())
+	})
+	t.Run("Drop events of unknown topics", func(t *testing.T) {
+		updaters := &fakeUpdaters{}
+		p, dl := run(t, updaters, func(b *ChannelBroker) {
+			assert.NoError(t, b.Publish("payments", "p1", map[string]any{"id": "p1"}))
+		})
+		assert.Empty(t, dl.messages)
+		assert.Equal(t, Stats{Received: 1, Dropped: 1}, p.Stats())
+	})
+	t.Run("Track every delivery", func(t *testing.T) {
+		broker := NewChannelBroker()
+		assert.NoError(t, broker.Publish(TopicDemand, "d1", location("d1", 43.2, 76.9)))
+		assert.NoError(t, broker.Publish(TopicSupply, "s1", location("s1", 43.3, 76.8)))
+		broker.Close()
+		var tracked, done int
+		updaters := &fakeUpdaters{errs: []error{graph.ErrThrottled}}
+		p := New(broker, updaters, supplyUpdates{updaters},
+			WithBackoff(time.Millisecond),
+			WithTracker(func(ctx context.Context) (context.Context, func()) {
+				tracked++
+				return ctx, func() { done++ }
+			}),
+		)
+		assert.NoError(t, p.Run(ctx))
+		assert.Equal(t, 3, tracked, "the retried delivery is tracked too")
+		assert.Equal(t, tracked, done)
+	})
+	t.Run("Stop on a cancelled context without losing the message", func(t *testing.T) {
+		broker := NewChannelBroker()
+		assert.NoError(t, broker.Publish(TopicDemand, "d1", location("d1", 43.2, 76.9)))
+		cancelled, cancel := context.WithCancel(ctx)
+		updaters := &fakeUpdaters{errs: []error{errors.New("unavailable")}}
+		p := New(broker, updaters, supplyUpdates{updaters}, WithBackoff(time.Hour))
+		cancel()
+		assert.ErrorIs(t, p.Run(cancelled), context.Canceled)
+
+		m, err := broker.Receive(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, m.Attempt)
+	})
+}
+
+func TestClassify(t *testing.T) {
+	assert.Equal(t, Retry, Classify(graph.ErrThrottled))
+	assert.Equal(t, Retry, Classify(&graph.PartialWriteError{Written: 1}))
+	assert.Equal(t, DeadLetter, Classify(ErrMalformed))
+	assert.Equal(t, DeadLetter, Classify(&graph.ValidationError{}))
+	assert.Equal(t, Retry, Classify(fmt.Errorf("%w: %w", graph.ErrPartialWrite, &graph.ValidationError{})))
+	assert.Equal(t, Drop, Classify(ErrUnknownTopic))
+}
+
+func writeEvents(t *testing.T, lines ...string) string {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	assert.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o644))
+	return path
+}
+
+func TestFileSource(t *testing.T) {
+	ctx := context.Background()
+	lines := []string{
+		`{"topic":"demand","key":"d1","value":{"id":"d1","lat":43.2,"lon":76.9}}`,
+		``,
+		`{"topic":"supply","key":"s1","value":{"id":"s1","lat":43.3,"lon":76.8}}`,
+		`{"topic":"demand","key":"d2","value":{"id":"d2","lat":43.2,"lon":76.9}}`,
+	}
+
+	t.Run("Resume after the last acked message", func(t *testing.T) {
+		path := writeEvents(t, lines...)
+		source, err := OpenFileSource(path)
+		assert.NoError(t, err)
+		m, err := source.Receive(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, Message{ID: "events.jsonl:1", Topic: TopicDemand, Key: "d1", Value: []byte(`{"id":"d1","lat":43.2,"lon":76.9}`), Attempt: 1}, m)
+		assert.NoError(t, source.Ack(ctx, m))
+		m, err = source.Receive(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "events.jsonl:3", m.ID)
+		assert.NoError(t, source.Close())
+
+		// s1 не подтверждён: после перезапуска он приходит снова
+		source, err = OpenFileSource(path)
+		assert.NoError(t, err)
+		defer source.Close()
+		m, err = source.Receive(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "s1", m.Key)
+		assert.NoError(t, source.Ack(ctx, m))
+		m, err = source.Receive(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "d2", m.Key)
+		assert.NoError(t, source.Ack(ctx, m))
+		_, err = source.Receive(ctx)
+		assert.ErrorIs(t, err, ErrClosed)
+	})
+	t.Run("Deliver a nacked message again", func(t *testing.T) {
+		source, err := OpenFileSource(writeEvents(t, lines...), WithOffsetFile(filepath.Join(t.TempDir(), "offset")))
+		assert.NoError(t, err)
+		defer source.Close()
+		m, err := source.Receive(ctx)
+		assert.NoError(t, err)
+		_, err = source.Receive(ctx)
+		assert.Error(t, err, "the previous message is not settled")
+		assert.NoError(t, source.Nack(ctx, m))
+		again, err := source.Receive(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, m.ID, again.ID)
+		assert.Equal(t, 2, again.Attempt)
+	})
+	t.Run("Feed dead letters back", func(t *testing.T) {
+		path := writeEvents(t, `garbage`, lines[0])
+		dlPath := filepath.Join(t.TempDir(), "dead.jsonl")
+		source, err := OpenFileSource(path)
+		assert.NoError(t, err)
+		defer source.Close()
+		dl, err := OpenFileDeadLetters(dlPath)
+		assert.NoError(t, err)
+		updaters := &fakeUpdaters{errs: []error{&graph.ValidationError{}}}
+		p := New(source, updaters, supplyUpdates{updaters}, WithDeadLetters(dl))
+		assert.NoError(t, p.Run(ctx))
+		assert.NoError(t, dl.Close())
+		assert.Equal(t, Stats{Received: 2, DeadLettered: 2}, p.Stats())
+
+		dead, err := OpenFileSource(dlPath)
+		assert.NoError(t, err)
+		defer dead.Close()
+		m, err := dead.Receive(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, Message{ID: "dead.jsonl:1", Value: []byte(`"garbage"`), Attempt: 1}, m)
+		assert.NoError(t, dead.Ack(ctx, m))
+		m, err = dead.Receive(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, TopicDemand, m.Topic)
+		assert.Equal(t, "d1", m.Key)
+	})
+}
+
+func TestIndex(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	index := NewIndex(1, time.Minute, WithIndexClock(func() time.Time { return now }))
+	repo := memory.New()
+	demands := index.Demands(demandUseCase.New(SupplyReader{index}, repo))
+	supplies := index.Supplies(supplyUseCase.New(DemandReader{index}, repo))
+
+	broker := NewChannelBroker()
+	assert.NoError(t, broker.Publish(TopicSupply, "s1", location("s1", 43.2380, 76.9450)))
+	assert.NoError(t, broker.Publish(TopicSupply, "s2", location("s2", 43.3000, 76.9450)))
+	assert.NoError(t, broker.Publish(TopicDemand, "d1", location("d1", 43.2400, 76.9460)))
+	broker.Close()
+	assert.NoError(t, New(broker, demands, supplies).Run(ctx))
+
+	t.Run("Connect the nodes within the radius", func(t *testing.T) {
+		edges, err := repo.ReadDemandEdges(ctx, "d1")
+		assert.NoError(t, err)
+		if assert.Len(t, edges, 1) {
+			assert.Equal(t, graph.Node("s1"), edges[0].To)
+		}
+	})
+	t.Run("Forget expired positions", func(t *testing.T) {
+		now = now.Add(2 * time.Minute)
+		found, err := SupplyReader{index}.FindBy(ctx, demand.Demand{ID: "d2", Lat: 43.2400, Lon: 76.9460})
+		assert.NoError(t, err)
+		assert.Empty(t, found)
+	})
+	t.Run("Move the edges of a supply that moved", func(t *testing.T) {
+		// Репозиторий в памяти проверяет рёбра: удаление лишних рёбер
+		// водителя не должно попадать в недоставленные
+		repo := memory.New()
+		index := NewIndex(1, time.Minute)
+		deadLetters := &memoryDeadLetters{}
+		broker := NewChannelBroker()
+		assert.NoError(t, broker.Publish(TopicDemand, "d1", location("d1", 43.2400, 76.9460)))
+		assert.NoError(t, broker.Publish(TopicDemand, "d2", location("d2", 43.3000, 76.9460)))
+		assert.NoError(t, broker.Publish(TopicSupply, "s1", location("s1", 43.2380, 76.9450)))
+		assert.NoError(t, broker.Publish(TopicSupply, "s1", location("s1", 43.3010, 76.9450)))
+		broker.Close()
+		p := New(broker,
+			index.Demands(demandUseCase.New(SupplyReader{index}, repo)),
+			index.Supplies(supplyUseCase.New(DemandReader{index}, repo)),
+			WithDeadLetters(deadLetters),
+		)
+		assert.NoError(t, p.Run(ctx))
+
+		assert.Empty(t, deadLetters.causes)
+		assert.Equal(t, int64(4), p.Stats().Handled)
+		edges, err := repo.ReadSupplyEdges(ctx, "s1")
+		assert.NoError(t, err)
+		if assert.Len(t, edges, 1) {
+			assert.Equal(t, graph.Node("d2"), edges[0].From)
+		}
+	})
+	t.Run("Measure great circle distances", func(t *testing.T) {
+		// Алматы - Астана, около 970 км
+		assert.InDelta(t, 970, distanceKm(43.2380, 76.9450, 51.1694, 71.4491), 15)
+	})
+}
@@ -0,0 +1,267 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/demand"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/supply"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/logging"
+)
+
+const (
+	defaultMaxAttempts = 5
+	defaultBackoff     = 100 * time.Millisecond
+	maxBackoff         = 10 * time.Second
+)
+
+type demandUpdater interface {
+	Update(ctx context.Context, order demand.Demand) error
+}
+
+type supplyUpdater interface {
+	Update(ctx context.Context, user supply.Supply) error
+}
+
+// Action is what the pipeline does with a message it failed to handle.
+type Action int
+
+const (
+	// Retry delivers the message again, until the attempts run out.
+	Retry Action = iota
+	// DeadLetter hands the message to DeadLetters: it will not succeed.
+	DeadLetter
+	// Drop acks the message: nobody needs it.
+	Drop
+)
+
+func (a Action) String() string {
+	switch a {
+	case Retry:
+		return "retry"
+	case DeadLetter:
+		return "dead_letter"
+	case Drop:
+		return "drop"
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// Classify picks the action for an error of a handler. Malformed events
+// and edges the repository rejects are dead letters, events of unknown
+// topics are dropped. The rest, throttling, conflicts, partial writes and
+// a missing table among them, is retried. A partially applied event is
+// retried even when an edge of it was rejected: the use cases rebuild the
+// edges of an event, so a dead letter would leave the graph half updated.
+func Classify(err error) Action {
+	switch {
+	case errors.Is(err, graph.ErrPartialWrite):
+		return Retry
+	case errors.Is(err, ErrMalformed), errors.Is(err, graph.ErrInvalidEdge):
+		return DeadLetter
+	case errors.Is(err, ErrUnknownTopic):
+		return Drop
+	default:
+		return Retry
+	}
+}
+
+// Stats counts what the pipeline did since it was created.
+type Stats struct {
+	Received     int64 `json:"received"`
+	Handled      int64 `json:"handled"`
+	Retried      int64 `json:"retried"`
+	DeadLettered int64 `json:"dead_lettered"`
+	Dropped      int64 `json:"dropped"`
+}
+
+// Pipeline receives the messages of a source one at a time and passes
+// the events to the use cases by topic.
+type Pipeline struct {
+	source      Source
+	handlers    map[string]func(ctx context.Context, value []byte) error
+	deadLetters DeadLetters
+	maxAttempts int
+	backoff     time.Duration
+	track       Tracker
+
+	received, handled, retried, deadLettered, dropped atomic.Int64
+}
+
+type Option func(*Pipeline)
+
+// Tracker wraps the handling of every delivery: the use case runs with
+// the returned context and done is called once it returns, e.g.
+// dynamodb.EventCapacity.Track attributes the capacity to the events.
+type Tracker func(ctx context.Context) (_ context.Context, done func())
+
+// WithTracker tracks the handling of every delivery, see Tracker.
+func WithTracker(track Tracker) Option {
+	return func(p *Pipeline) {
+		p.track = track
+	}
+}
+
+// WithDeadLetters sets where the messages the pipeline gives up on go,
+// LogDeadLetters by default.
+func WithDeadLetters(dl DeadLetters) Option {
+	return func(p *Pipeline) {
+		p.deadLetters = dl
+	}
+}
+
+// WithMaxAttempts sets how many times a message is delivered before it
+// becomes a dead letter, 5 by default.
+func WithMaxAttempts(n int) Option {
+	return func(p *Pipeline) {
+		p.maxAttempts = n
+	}
+}
+
+// WithBackoff sets the pause before the first redelivery, it doubles with
+// every attempt up to 10s.
+func WithBackoff(d time.Duration) Option {
+	return func(p *Pipeline) {
+		p.backoff = d
+	}
+}
+
+func New(source Source, demands demandUpdater, supplies supplyUpdater, opts ...Option) *Pipeline {
+	p := &Pipeline{
+		source: source,
+		handlers: map[string]func(ctx context.Context, value []byte) error{
+			TopicDemand: func(ctx context.Context, value []byte) error {
+				order, err := DecodeDemand(value)
+				if err != nil {
+					return err
+				}
+				return demands.Update(ctx, order)
+			},
+			TopicSupply: func(ctx context.Context, value []byte) error {
+				user, err := DecodeSupply(value)
+				if err != nil {
+					return err
+				}
+				return supplies.Update(ctx, user)
+			},
+		},
+		deadLetters: LogDeadLetters{},
+		maxAttempts: defaultMaxAttempts,
+		backoff:     defaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Run handles messages until the source is closed, then returns nil, or
+// until ctx is done. An error of the source or of DeadLetters stops it.
+func (p *Pipeline) Run(ctx context.Context) error {
+	for {
+		m, err := p.source.Receive(ctx)
+		if errors.Is(err, ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = p.handle(ctx, m); err != nil {
+			return err
+		}
+	}
+}
+
+// handle settles one message: acks it or hands it back.
+func (p *Pipeline) handle(ctx context.Context, m Message) error {
+	p.received.Add(1)
+	ctx = logging.With(logging.WithRequestID(ctx),
+		"message", m.ID,
+		"topic", m.Topic,
+		"attempt", m.Attempt,
+	)
+
+	err := p.trackedDispatch(ctx, m)
+	if err == nil {
+		p.handled.Add(1)
+		return p.source.Ack(ctx, m)
+	}
+
+	action := Classify(err)
+	if action == Retry && m.Attempt >= p.maxAttempts {
+		action = DeadLetter
+	}
+	slog.WarnContext(ctx, "ingest: message failed", "action", action.String(), "error", err)
+	switch action {
+	case Retry:
+		p.retried.Add(1)
+		// Сообщения обрабатываются по одному: пауза задерживает и следующие,
+		// как и должна при нехватке ёмкости
+		select {
+		case <-ctx.Done():
+		case <-time.After(p.delay(m.Attempt)):
+		}
+		if nackErr := p.source.Nack(context.WithoutCancel(ctx), m); nackErr != nil {
+			return nackErr
+		}
+		return ctx.Err()
+	case Drop:
+		p.dropped.Add(1)
+		return p.source.Ack(ctx, m)
+	default:
+		if dlErr := p.deadLetters.Put(ctx, m, err); dlErr != nil {
+			// Без очереди недоставленных сообщение нельзя подтверждать
+			return errors.Join(fmt.Errorf("dead letter %s: %w", m.ID, dlErr), p.source.Nack(ctx, m))
+		}
+		p.deadLettered.Add(1)
+		return p.source.Ack(ctx, m)
+	}
+}
+
+func (p *Pipeline) trackedDispatch(ctx context.Context, m Message) error {
+	if p.track == nil {
+		return p.dispatch(ctx, m)
+	}
+	tracked, done := p.track(ctx)
+	defer done()
+	return p.dispatch(tracked, m)
+}
+
+func (p *Pipeline) dispatch(ctx context.Context, m Message) error {
+	handler, ok := p.handlers[m.Topic]
+	if m.Topic == "" {
+		// Источник не смог разобрать конверт сообщения
+		return fmt.Errorf("%w: no topic", ErrMalformed)
+	}
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownTopic, m.Topic)
+	}
+	return handler(ctx, m.Value)
+}
+
+// delay is the pause before delivering the message again after attempt.
+func (p *Pipeline) delay(attempt int) time.Duration {
+	d := p.backoff
+	for range attempt - 1 {
+		if d >= maxBackoff {
+			break
+		}
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+func (p *Pipeline) Stats() Stats {
+	return Stats{
+		Received:     p.received.Load(),
+		Handled:      p.handled.Load(),
+		Retried:      p.retried.Load(),
+		DeadLettered: p.deadLettered.Load(),
+		Dropped:      p.dropped.Load(),
+	}
+}
@@ -0,0 +1,112 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+)
+
+// Бакеты растут в 2^(1/8) раз: погрешность квантилей не больше 9%
+const (
+	bucketsPerOctave = 8
+	minLatency       = time.Microsecond
+	buckets          = 32 * bucketsPerOctave // до ~70 минут
+)
+
+// Histogram is a latency histogram with logarithmic buckets.
+// It is safe for concurrent use.
+type Histogram struct {
+	mu     sync.Mutex
+	counts [buckets]int
+	count  int
+	sum    time.Duration
+	max    time.Duration
+}
+
+func (h *Histogram) Record(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[bucket(d)]++
+	h.count++
+	h.sum += d
+	h.max = max(h.max, d)
+}
+
+// Quantile returns the upper bound of the bucket the q-th quantile falls in.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.quantile(q)
+}
+
+func (h *Histogram) quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(q * float64(h.count)))
+	seen := 0
+	for i, n := range h.counts {
+		seen += n
+		if seen >= max(rank, 1) {
+			return min(upperBound(i), h.max)
+		}
+	}
+	return h.max
+}
+
+// Summary is the part of a histogram that goes into reports.
+type Summary struct {
+	Count int           `json:"count"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	P999  time.Duration `json:"p999"`
+	Max   time.Duration `json:"max"`
+}
+
+func (h *Histogram) Summary() Summary {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := Summary{
+		Count: h.count,
+		P50:   h.quantile(0.5),
+		P90:   h.quantile(0.9),
+		P99:   h.quantile(0.99),
+		P999:  h.quantile(0.999),
+		Max:   h.max,
+	}
+	if h.count > 0 {
+		s.Mean = h.sum / time.Duration(h.count)
+	}
+	return s
+}
+
+// MarshalJSON writes latencies in milliseconds.
+func (s Summary) MarshalJSON() ([]byte, error) {
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+	return json.Marshal(map[string]any{
+		"count":   s.Count,
+		"mean_ms": ms(s.Mean),
+		"p50_ms":  ms(s.P50),
+		"p90_ms":  ms(s.P90),
+		"p99_ms":  ms(s.P99),
+		"p999_ms": ms(s.P999),
+		"max_ms":  ms(s.Max),
+	})
+}
+
+func bucket(d time.Duration) int {
+	if d <= minLatency {
+		return 0
+	}
+	i := int(math.Ceil(math.Log2(float64(d)/float64(minLatency)) * bucketsPerOctave))
+	return min(i, buckets-1)
+}
+
+func upperBound(i int) time.Duration {
+	return time.Duration(float64(minLatency) * math.Exp2(float64(i)/bucketsPerOctave))
+}
@@ -0,0 +1,330 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+)
+
+type graphRepository interface {
+	UpsertEdges(ctx context.Context, edges ...graph.Edge) error
+	RemoveEdges(ctx context.Context, edges ...graph.Edge) error
+	ReadAreaEdges(ctx context.Context, area graph.Area) ([]graph.Edge, error)
+}
+
+type Operation string
+
+const (
+	OpUpsert   Operation = "upsert_edges"
+	OpRemove   Operation = "remove_edges"
+	OpReadArea Operation = "read_area_edges"
+)
+
+type Config struct {
+	Duration time.Duration `json:"duration"`
+	// Workers caps the operations in flight
+	Workers int `json:"workers"`
+
+	// Target rates, operations per second, 0 disables the operation
+	UpsertRate   float64 `json:"upsert_rate"`
+	RemoveRate   float64 `json:"remove_rate"`
+	ReadAreaRate float64 `json:"read_area_rate"`
+
+	// Edges per UpsertEdges and RemoveEdges call
+	BatchSize int `json:"batch_size"`
+
+	// Key space. A demand always belongs to the same area.
+	Demands  int `json:"demands"`
+	Supplies int `json:"supplies"`
+	Areas    int `json:"areas"`
+	// Skew is the Zipf exponent of key popularity, it must be > 1;
+	// 0 picks keys uniformly.
+	Skew float64 `json:"skew"`
+
+	TTL  time.Duration `json:"ttl"`
+	Seed uint64        `json:"seed"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Duration:     time.Minute,
+		Workers:      32,
+		UpsertRate:   100,
+		RemoveRate:   20,
+		ReadAreaRate: 5,
+		BatchSize:    25,
+		Demands:      10000,
+		Supplies:     10000,
+		Areas:        20,
+		TTL:          15 * time.Minute,
+		Seed:         1,
+	}
+}
+
+func (c Config) Validate() error {
+	switch {
+	case c.Duration <= 0:
+		return fmt.Errorf("duration must be positive")
+	case c.Workers <= 0:
+		return fmt.Errorf("workers must be positive")
+	case c.BatchSize <= 0:
+		return fmt.Errorf("batch size must be positive")
+	case c.Demands <= 0 || c.Supplies <= 0 || c.Areas <= 0:
+		return fmt.Errorf("key space must not be empty")
+	case c.Skew != 0 && c.Skew <= 1:
+		return fmt.Errorf("skew must be 0 or greater than 1, got %v", c.Skew)
+	}
+	return nil
+}
+
+// OperationReport is what happened to one kind of operation.
+type OperationReport struct {
+	// Requested operations, including the ones dropped
+	Target int `json:"target"`
+	// Dropped operations could not start because every worker was busy:
+	// the backend did not keep up with the target rate.
+	Dropped    int     `json:"dropped"`
+	Errors     int     `json:"errors"`
+	Throughput float64 `json:"throughput"`
+	Items      int     `json:"items"`
+	Latency    Summary `json:"latency"`
+}
+
+type Report struct {
+	Config     Config                        `json:"config"`
+	Elapsed    float64                       `json:"elapsed_seconds"`
+	Operations map[Operation]OperationReport `json:"operations"`
+	// LastError is a sample error to tell what failed
+	LastError string `json:"last_error,omitempty"`
+}
+
+type job struct {
+	op    Operation
+	edges []graph.Edge
+	area  graph.Area
+}
+
+type counters struct {
+	target, dropped, errors, items atomic.Int64
+	latency                        Histogram
+}
+
+// Generator drives the repository at the target rates. Operations are
+// scheduled open-loop: a slow backend does not slow the schedule down,
+// the operations that find no free worker are counted as dropped.
+type Generator struct {
+	cfg  Config
+	repo graphRepository
+
+	stats     map[Operation]*counters
+	lastError atomic.Value
+}
+
+func New(cfg Config, repo graphRepository) (*Generator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &Generator{
+		cfg:  cfg,
+		repo: repo,
+		stats: map[Operation]*counters{
+			OpUpsert:   {},
+			OpRemove:   {},
+			OpReadArea: {},
+		},
+	}, nil
+}
+
+// Run drives the load for the configured duration. Cancelling ctx stops
+// it early, the report then covers the time it ran.
+func (g *Generator) Run(parent context.Context) (Report, error) {
+	ctx, cancel := context.WithTimeout(parent, g.cfg.Duration)
+	defer cancel()
+
+	jobs := make(chan job, g.cfg.Workers)
+	var workers sync.WaitGroup
+	for range g.cfg.Workers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for j := range jobs {
+				g.do(j)
+			}
+		}()
+	}
+
+	start := time.Now()
+	var schedulers sync.WaitGroup
+	for i, op := range []Operation{OpUpsert, OpRemove, OpReadArea} {
+		rate := g.rate(op)
+		if rate <= 0 {
+			continue
+		}
+		keys := newKeys(g.cfg, rand.New(rand.NewPCG(g.cfg.Seed, uint64(i))))
+		schedulers.Add(1)
+		go func() {
+			defer schedulers.Done()
+			g.schedule(ctx, op, rate, keys, jobs)
+		}()
+	}
+	schedulers.Wait()
+	close(jobs)
+	workers.Wait()
+	elapsed := time.Since(start)
+
+	report := Report{
+		Config:     g.cfg,
+		Elapsed:    elapsed.Seconds(),
+		Operations: make(map[Operation]OperationReport, len(g.stats)),
+	}
+	for op, c := range g.stats {
+		if c.target.Load() == 0 {
+			continue
+		}
+		latency := c.latency.Summary()
+		report.Operations[op] = OperationReport{
+			Target:     int(c.target.Load()),
+			Dropped:    int(c.dropped.Load()),
+			Errors:     int(c.errors.Load()),
+			Throughput: float64(latency.Count-int(c.errors.Load())) / elapsed.Seconds(),
+			Items:      int(c.items.Load()),
+			Latency:    latency,
+		}
+	}
+	if err, ok := g.lastError.Load().(string); ok {
+		report.LastError = err
+	}
+	return report, parent.Err()
+}
+
+func (g *Generator) rate(op Operation) float64 {
+	switch op {
+	case OpUpsert:
+		return g.cfg.UpsertRate
+	case OpRemove:
+		return g.cfg.RemoveRate
+	default:
+		return g.cfg.ReadAreaRate
+	}
+}
+
+// schedule emits operations at rate until ctx is done. The ticker is
+// coarse, so each tick emits the operations that became due since the last one.
+func (g *Generator) schedule(ctx context.Context, op Operation, rate float64, keys *keys, jobs chan<- job) {
+	const resolution = 10 * time.Millisecond
+	ticker := time.NewTicker(resolution)
+	defer ticker.Stop()
+
+	c := g.stats[op]
+	start, emitted := time.Now(), 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			due := int(now.Sub(start).Seconds() * rate)
+			for ; emitted < due; emitted++ {
+				c.target.Add(1)
+				select {
+				case jobs <- g.makeJob(op, keys):
+				default:
+					c.dropped.Add(1)
+				}
+			}
+		}
+	}
+}
+
+func (g *Generator) makeJob(op Operation, keys *keys) job {
+	if op == OpReadArea {
+		return job{op: op, area: keys.area()}
+	}
+	edges := make([]graph.Edge, 0, g.cfg.BatchSize)
+	seen := make(map[[2]graph.Node]struct{}, g.cfg.BatchSize)
+	for range g.cfg.BatchSize {
+		e := keys.edge(g.cfg.TTL)
+		// В одном BatchWriteItem ключ не может повторяться
+		if _, ok := seen[[2]graph.Node{e.From, e.To}]; ok {
+			continue
+		}
+		seen[[2]graph.Node{e.From, e.To}] = struct{}{}
+		edges = append(edges, e)
+	}
+	return job{op: op, edges: edges}
+}
+
+func (g *Generator) do(j job) {
+	// Операция не прерывается по окончании нагрузки, чтобы дождаться её задержки
+	ctx := context.Background()
+	c := g.stats[j.op]
+
+	start := time.Now()
+	var (
+		err   error
+		items int
+	)
+	switch j.op {
+	case OpUpsert:
+		err, items = g.repo.UpsertEdges(ctx, j.edges...), len(j.edges)
+	case OpRemove:
+		err, items = g.repo.RemoveEdges(ctx, j.edges...), len(j.edges)
+	case OpReadArea:
+		var edges []graph.Edge
+		edges, err = g.repo.ReadAreaEdges(ctx, j.area)
+		items = len(edges)
+	}
+	c.latency.Record(time.Since(start))
+	if err != nil {
+		c.errors.Add(1)
+		g.lastError.Store(fmt.Sprintf("%s: %v", j.op, err))
+		return
+	}
+	c.items.Add(int64(items))
+}
+
+// keys picks demands, supplies and areas with the configured skew.
+// It is not safe for concurrent use.
+type keys struct {
+	cfg                    Config
+	demand, supply, areaID func() int
+}
+
+func newKeys(cfg Config, rnd *rand.Rand) *keys {
+	pick := func(n int) func() int {
+		if cfg.Skew == 0 || n == 1 {
+			return func() int { return rnd.IntN(n) }
+		}
+		z := rand.NewZipf(rnd, cfg.Skew, 1, uint64(n-1))
+		return func() int { return int(z.Uint64()) }
+	}
+	return &keys{
+		cfg:    cfg,
+		demand: pick(cfg.Demands),
+		supply: pick(cfg.Supplies),
+		areaID: pick(cfg.Areas),
+	}
+}
+
+func (k *keys) edge(ttl time.Duration) graph.Edge {
+	d := k.demand()
+	return graph.Edge{
+		From:  graph.Node(fmt.Sprintf("demand-%d", d)),
+		To:    graph.Node(fmt.Sprintf("supply-%d", k.supply())),
+		Score: graph.Score(float64(d%100) / 100),
+		Area:  areaOf(d % k.cfg.Areas),
+		TTL:   ttl,
+	}
+}
+
+func (k *keys) area() graph.Area {
+	return areaOf(k.areaID())
+}
+
+func areaOf(i int) graph.Area {
+	return graph.Area(fmt.Sprintf("area-%d", i))
+}
@@ -0,0 +1,102 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/memory"
+)
+
+func TestHistogram(t *testing.T) {
+	t.Run("Estimate quantiles within a bucket", func(t *testing.T) {
+		var h Histogram
+		for i := 1; i <= 1000; i++ {
+			h.Record(time.Duration(i) * time.Millisecond)
+		}
+		s := h.Summary()
+		assert.Equal(t, 1000, s.Count)
+		assert.Equal(t, 500500*time.Microsecond, s.Mean)
+		assert.Equal(t, time.Second, s.Max)
+		assert.InEpsilon(t, float64(500*time.Millisecond), float64(s.P50), 0.09)
+		assert.InEpsilon(t, float64(990*time.Millisecond), float64(s.P99), 0.09)
+		assert.LessOrEqual(t, s.P999, s.Max)
+	})
+}
+
+type slowRepo struct {
+	*memory.Repository
+	delay time.Duration
+}
+
+func (r slowRepo) UpsertEdges(ctx context.Context, edges ...graph.Edge) error {
+	time.Sleep(r.delay)
+	return r.Repository.UpsertEdges(ctx, edges...)
+}
+
+func (r slowRepo) RemoveEdges(context.Context, ...graph.Edge) error {
+	return errors.New("remove failed")
+}
+
+func TestGenerator_Run(t *testing.T) {
+	t.Run("Drive operations at the target rates", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Duration = 500 * time.Millisecond
+		cfg.UpsertRate = 200
+		cfg.RemoveRate = 40
+		cfg.ReadAreaRate = 20
+		cfg.BatchSize = 10
+		cfg.Demands, cfg.Supplies, cfg.Areas = 100, 100, 4
+		cfg.Skew = 1.5
+
+		repo := slowRepo{Repository: memory.New()}
+		g, err := New(cfg, repo)
+		assert.NoError(t, err)
+		report, err := g.Run(context.Background())
+		assert.NoError(t, err)
+
+		upsert := report.Operations[OpUpsert]
+		assert.InDelta(t, 100, upsert.Target, 10)
+		assert.Zero(t, upsert.Dropped)
+		assert.Zero(t, upsert.Errors)
+		assert.Equal(t, upsert.Target, upsert.Latency.Count)
+		size, err := repo.Size(context.Background())
+		assert.NoError(t, err)
+		assert.Positive(t, size)
+
+		remove := report.Operations[OpRemove]
+		assert.Equal(t, remove.Target, remove.Errors)
+		assert.Contains(t, report.LastError, "remove failed")
+
+		read := report.Operations[OpReadArea]
+		assert.Positive(t, read.Target)
+		assert.Positive(t, read.Items)
+	})
+	t.Run("Drop operations the backend cannot keep up with", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Duration = 300 * time.Millisecond
+		cfg.Workers = 1
+		cfg.UpsertRate = 500
+		cfg.RemoveRate, cfg.ReadAreaRate = 0, 0
+
+		g, err := New(cfg, slowRepo{Repository: memory.New(), delay: 50 * time.Millisecond})
+		assert.NoError(t, err)
+		report, err := g.Run(context.Background())
+		assert.NoError(t, err)
+
+		upsert := report.Operations[OpUpsert]
+		assert.Positive(t, upsert.Dropped)
+		assert.Equal(t, upsert.Target-upsert.Dropped, upsert.Latency.Count)
+		assert.NotContains(t, report.Operations, OpRemove)
+	})
+	t.Run("Reject skew that Zipf does not support", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Skew = 0.8
+		_, err := New(cfg, memory.New())
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,119 @@
+// Package logging builds the slog logger of the service and carries log
+// fields in the context: a use case adds the area, node and operation it
+// works on once, and every record logged with that context has them.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// Keys of the fields the service logs with.
+const (
+	KeyRequestID = "request_id"
+	KeyOperation = "operation"
+	KeyArea      = "area"
+	KeyNode      = "node"
+)
+
+type fieldsKey struct{}
+
+// With returns ctx with the fields added to the ones it already carries.
+// args are key-value pairs or slog.Attr, as for slog.Logger.With.
+func With(ctx context.Context, args ...any) context.Context {
+	attrs := slices.Clip(fields(ctx))
+	r := slog.Record{}
+	r.Add(args...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return context.WithValue(ctx, fieldsKey{}, attrs)
+}
+
+func fields(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(fieldsKey{}).([]slog.Attr)
+	return attrs
+}
+
+type requestIDKey struct{}
+
+// WithRequestID gives ctx a new request ID unless it already has one.
+// The ID is logged with every record of the context.
+func WithRequestID(ctx context.Context) context.Context {
+	if RequestID(ctx) != "" {
+		return ctx
+	}
+	id := newRequestID()
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	return With(ctx, KeyRequestID, id)
+}
+
+// RequestID returns the request ID of ctx, empty when it has none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Handler adds the fields of the context to every record.
+type Handler struct {
+	slog.Handler
+}
+
+func (h Handler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs := fields(ctx); len(attrs) > 0 {
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return Handler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h Handler) WithGroup(name string) slog.Handler {
+	return Handler{h.Handler.WithGroup(name)}
+}
+
+// New creates the logger of the service. level is debug, info, warn or
+// error; format is text or json.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+	return slog.New(Handler{h}), nil
+}
+
+// Done logs the end of an operation with the default logger: a failed one
+// at error level with the error, the others at debug level.
+func Done(ctx context.Context, msg string, err error, args ...any) {
+	if err != nil {
+		slog.ErrorContext(ctx, msg, append(args, slog.Any("error", err))...)
+		return
+	}
+	slog.DebugContext(ctx, msg, args...)
+}
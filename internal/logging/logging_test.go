@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogging(t *testing.T) {
+	t.Run("Log the fields of the context", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := New(&buf, "info", "json")
+		assert.NoError(t, err)
+
+		ctx := With(context.Background(), KeyOperation, "demand.UseCase.Update", KeyNode, "d1")
+		ctx = With(ctx, slog.String(KeyArea, "almaty"))
+		logger.With("component", "test").InfoContext(ctx, "updated", "edges", 3)
+
+		var record map[string]any
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+		assert.Equal(t, "updated", record["msg"])
+		assert.Equal(t, "demand.UseCase.Update", record[KeyOperation])
+		assert.Equal(t, "d1", record[KeyNode])
+		assert.Equal(t, "almaty", record[KeyArea])
+		assert.Equal(t, "test", record["component"])
+		assert.Equal(t, float64(3), record["edges"])
+	})
+	t.Run("Do not share fields between branches of a context", func(t *testing.T) {
+		parent := With(context.Background(), KeyArea, "a")
+		left := With(parent, KeyNode, "l")
+		right := With(parent, KeyNode, "r")
+		assert.Len(t, fields(parent), 1)
+		assert.Equal(t, "l", fields(left)[1].Value.String())
+		assert.Equal(t, "r", fields(right)[1].Value.String())
+	})
+	t.Run("Keep the request ID of a context", func(t *testing.T) {
+		ctx := WithRequestID(context.Background())
+		id := RequestID(ctx)
+		assert.Len(t, id, 16)
+		assert.Equal(t, id, RequestID(WithRequestID(ctx)))
+		assert.Len(t, fields(WithRequestID(ctx)), 1)
+		assert.NotEqual(t, id, RequestID(WithRequestID(context.Background())))
+	})
+	t.Run("Filter by level", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := New(&buf, "warn", "text")
+		assert.NoError(t, err)
+		logger.Info("dropped")
+		assert.Empty(t, buf.String())
+		logger.Warn("kept")
+		assert.Contains(t, buf.String(), "msg=kept")
+	})
+	t.Run("Log a failed operation at error level", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := New(&buf, "debug", "json")
+		assert.NoError(t, err)
+		defer slog.SetDefault(slog.Default())
+		slog.SetDefault(logger)
+
+		Done(context.Background(), "ok", nil)
+		Done(context.Background(), "failed", errors.New("boom"))
+
+		dec := json.NewDecoder(&buf)
+		var ok, failed map[string]any
+		assert.NoError(t, dec.Decode(&ok))
+		assert.NoError(t, dec.Decode(&failed))
+		assert.Equal(t, "DEBUG", ok["level"])
+		assert.Equal(t, "ERROR", failed["level"])
+		assert.Equal(t, "boom", failed["error"])
+	})
+	t.Run("Reject unknown level and format", func(t *testing.T) {
+		_, err := New(&bytes.Buffer{}, "verbose", "text")
+		assert.Error(t, err)
+		_, err = New(&bytes.Buffer{}, "info", "xml")
+		assert.Error(t, err)
+	})
+}
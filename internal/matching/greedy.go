@@ -0,0 +1,37 @@
+package matching
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+)
+
+// Greedy is the simplest matcher: nodes are visited in sorted order and
+// each unmatched node takes its first unmatched neighbour. It is
+// deterministic, so it serves as the baseline when replaying snapshots.
+type Greedy struct{}
+
+func NewGreedy() *Greedy {
+	return &Greedy{}
+}
+
+func (m *Greedy) Match(g map[graph.Node][]graph.Node) (graph.Matching, error) {
+	matches := make(graph.Matching)
+	for _, node := range slices.Sorted(maps.Keys(g)) {
+		if _, ok := matches[node]; ok {
+			continue
+		}
+		neighbours := slices.Clone(g[node])
+		slices.SortFunc(neighbours, cmp.Compare)
+		for _, n := range neighbours {
+			if _, ok := matches[n]; ok || n == node {
+				continue
+			}
+			matches[node], matches[n] = n, node
+			break
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,28 @@
+package matching
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+)
+
+func TestGreedy_Match(t *testing.T) {
+	t.Run("Match each node at most once", func(t *testing.T) {
+		g := map[graph.Node][]graph.Node{
+			"A": {"Y", "X"},
+			"B": {"X"},
+			"C": {"X", "Z"},
+			"X": {"A", "B", "C"},
+			"Y": {"A"},
+			"Z": {"C"},
+		}
+		matches, err := NewGreedy().Match(g)
+		assert.NoError(t, err)
+		assert.Equal(t, graph.Matching{
+			"A": "X", "X": "A",
+			"C": "Z", "Z": "C",
+		}, matches)
+	})
+}
@@ -0,0 +1,212 @@
+package capped
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+)
+
+type graphRepository interface {
+	UpsertEdges(ctx context.Context, edges ...graph.Edge) error
+	RemoveEdges(ctx context.Context, edges ...graph.Edge) error
+	ReadDemandEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error)
+	ReadSupplyEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error)
+}
+
+// supplyDegrees tells the exact in-degree of a supply, e.g. from the edge
+// counters of the strategy.
+type supplyDegrees interface {
+	SupplyDegree(ctx context.Context, node graph.Node) (int, error)
+}
+
+const (
+	// Сколько раз перечитывать рёбра предложения, пока индекс не покажет
+	// столько рёбер, сколько насчитал счётчик
+	supplyReadAttempts = 3
+	supplyReadBackoff  = 50 * time.Millisecond
+)
+
+// Repository limits the out-degree of demands and the in-degree of supplies.
+// Only the top-K edges by score are kept, the rest are evicted through
+// the wrapped repository right after the write.
+type Repository struct {
+	graphRepository
+
+	maxDemandDegree int
+	maxSupplyDegree int
+	supplyDegrees   supplyDegrees
+}
+
+type Option func(*Repository)
+
+// WithSupplyDegrees checks the supply cap against exact in-degrees. The
+// supply edges of some strategies come from an eventually consistent
+// index: without exact degrees an edge the index does not show yet is
+// neither counted nor evicted.
+func WithSupplyDegrees(degrees supplyDegrees) Option {
+	return func(r *Repository) {
+		r.supplyDegrees = degrees
+	}
+}
+
+// New wraps repo with degree caps. A cap <= 0 disables the corresponding limit.
+func New(repo graphRepository, maxDemandDegree, maxSupplyDegree int, opts ...Option) *Repository {
+	r := &Repository{
+		graphRepository: repo,
+		maxDemandDegree: maxDemandDegree,
+		maxSupplyDegree: maxSupplyDegree,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// UpsertEdges writes edges and evicts the lowest scored edges of every
+// touched node that went over its cap.
+//
+// Every write evicts what it sees over the cap, so concurrent writes to
+// one node can leave it over its cap: each of them may read the edges
+// before the other one wrote. The next write to the node evicts the excess.
+func (r *Repository) UpsertEdges(ctx context.Context, edges ...graph.Edge) error {
+	if len(edges) == 0 {
+		return nil
+	}
+
+	// Рёбра, которые не попадают в top-K даже среди новых, не пишем вовсе.
+	edges = r.trim(dedup(edges))
+	if err := r.graphRepository.UpsertEdges(ctx, edges...); err != nil {
+		return err
+	}
+
+	var (
+		evict    []graph.Edge
+		evictErr error
+	)
+	if r.maxDemandDegree > 0 {
+		for _, node := range nodes(edges, func(e graph.Edge) graph.Node { return e.From }) {
+			current, err := r.ReadDemandEdges(ctx, node)
+			if err != nil {
+				evictErr = errors.Join(evictErr, fmt.Errorf("read demand %s edges: %w", node, err))
+				continue
+			}
+			_, over := graph.TopK(current, r.maxDemandDegree)
+			evict = append(evict, over...)
+		}
+	}
+	if r.maxSupplyDegree > 0 {
+		for _, node := range nodes(edges, func(e graph.Edge) graph.Node { return e.To }) {
+			current, err := r.readSupplyEdges(ctx, node, edges)
+			if err != nil {
+				evictErr = errors.Join(evictErr, fmt.Errorf("read supply %s edges: %w", node, err))
+				continue
+			}
+			_, over := graph.TopK(current, r.maxSupplyDegree)
+			evict = append(evict, over...)
+		}
+	}
+	if len(evict) > 0 {
+		if err := r.RemoveEdges(ctx, evict...); err != nil {
+			evictErr = errors.Join(evictErr, fmt.Errorf("evict edges: %w", err))
+		}
+	}
+	return evictErr
+}
+
+// readSupplyEdges reads the edges of the supply together with the edges
+// just written to it, which an index may not show yet. With exact degrees
+// a supply within its cap is not read at all, and a read that shows fewer
+// edges than the degree is repeated while the index catches up.
+func (r *Repository) readSupplyEdges(ctx context.Context, node graph.Node, written []graph.Edge) ([]graph.Edge, error) {
+	degree := -1
+	if r.supplyDegrees != nil {
+		var err error
+		if degree, err = r.supplyDegrees.SupplyDegree(ctx, node); err != nil {
+			return nil, err
+		}
+		if degree <= r.maxSupplyDegree {
+			return nil, nil
+		}
+	}
+
+	var current []graph.Edge
+	for attempt := range supplyReadAttempts {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Duration(attempt) * supplyReadBackoff):
+			}
+		}
+		read, err := r.ReadSupplyEdges(ctx, node)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range written {
+			if e.To == node {
+				read = append(read, e)
+			}
+		}
+		// Индекс и только что записанные рёбра могут совпадать
+		current = dedup(read)
+		if len(current) >= degree {
+			break
+		}
+	}
+	return current, nil
+}
+
+// trim drops incoming edges that cannot make it into the top-K of their nodes.
+func (r *Repository) trim(edges []graph.Edge) []graph.Edge {
+	edges = topKBy(edges, r.maxDemandDegree, func(e graph.Edge) graph.Node { return e.From })
+	return topKBy(edges, r.maxSupplyDegree, func(e graph.Edge) graph.Node { return e.To })
+}
+
+func topKBy(edges []graph.Edge, k int, node func(graph.Edge) graph.Node) []graph.Edge {
+	if k <= 0 {
+		return edges
+	}
+	groups := make(map[graph.Node][]graph.Edge)
+	for _, e := range edges {
+		groups[node(e)] = append(groups[node(e)], e)
+	}
+	keep := make([]graph.Edge, 0, len(edges))
+	for _, n := range nodes(edges, node) {
+		top, _ := graph.TopK(groups[n], k)
+		keep = append(keep, top...)
+	}
+	return keep
+}
+
+// dedup keeps the last occurrence of every edge, as UpsertEdges does.
+func dedup(edges []graph.Edge) []graph.Edge {
+	last := make(map[[2]graph.Node]int, len(edges))
+	for i, e := range edges {
+		last[[2]graph.Node{e.From, e.To}] = i
+	}
+	out := make([]graph.Edge, 0, len(last))
+	for i, e := range edges {
+		if last[[2]graph.Node{e.From, e.To}] == i {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// nodes returns distinct nodes of edges in the order of first appearance.
+func nodes(edges []graph.Edge, node func(graph.Edge) graph.Node) []graph.Node {
+	seen := make(map[graph.Node]struct{}, len(edges))
+	out := make([]graph.Node, 0, len(edges))
+	for _, e := range edges {
+		n := node(e)
+		if _, ok := seen[n]; ok {
+			continue
+		}
+		seen[n] = struct{}{}
+		out = append(out, n)
+	}
+	return out
+}
@@ -0,0 +1,177 @@
+package capped
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+)
+
+type memRepo struct {
+	edges map[[2]graph.Node]graph.Edge
+}
+
+func newMemRepo() *memRepo {
+	return &memRepo{edges: make(map[[2]graph.Node]graph.Edge)}
+}
+
+func (m *memRepo) UpsertEdges(_ context.Context, edges ...graph.Edge) error {
+	for _, e := range edges {
+		m.edges[[2]graph.Node{e.From, e.To}] = e
+	}
+	return nil
+}
+
+func (m *memRepo) RemoveEdges(_ context.Context, edges ...graph.Edge) error {
+	for _, e := range edges {
+		delete(m.edges, [2]graph.Node{e.From, e.To})
+	}
+	return nil
+}
+
+func (m *memRepo) ReadDemandEdges(_ context.Context, node graph.Node) ([]graph.Edge, error) {
+	var out []graph.Edge
+	for _, e := range m.edges {
+		if e.From == node {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (m *memRepo) ReadSupplyEdges(_ context.Context, node graph.Node) ([]graph.Edge, error) {
+	var out []graph.Edge
+	for _, e := range m.edges {
+		if e.To == node {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// laggingRepo serves supply edges from a stale index: edges written by
+// the last UpsertEdges are not shown yet.
+type laggingRepo struct {
+	*memRepo
+	recent      map[[2]graph.Node]struct{}
+	supplyReads int
+}
+
+func newLaggingRepo() *laggingRepo {
+	return &laggingRepo{memRepo: newMemRepo(), recent: make(map[[2]graph.Node]struct{})}
+}
+
+func (m *laggingRepo) UpsertEdges(ctx context.Context, edges ...graph.Edge) error {
+	clear(m.recent)
+	for _, e := range edges {
+		m.recent[[2]graph.Node{e.From, e.To}] = struct{}{}
+	}
+	return m.memRepo.UpsertEdges(ctx, edges...)
+}
+
+func (m *laggingRepo) ReadSupplyEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error) {
+	m.supplyReads++
+	edges, err := m.memRepo.ReadSupplyEdges(ctx, node)
+	var out []graph.Edge
+	for _, e := range edges {
+		if _, ok := m.recent[[2]graph.Node{e.From, e.To}]; !ok {
+			out = append(out, e)
+		}
+	}
+	return out, err
+}
+
+// SupplyDegree counts every stored edge, as the edge counters do.
+func (m *laggingRepo) SupplyDegree(ctx context.Context, node graph.Node) (int, error) {
+	edges, err := m.memRepo.ReadSupplyEdges(ctx, node)
+	return len(edges), err
+}
+
+func targets(edges []graph.Edge) []graph.Node {
+	out := make([]graph.Node, 0, len(edges))
+	for _, e := range edges {
+		out = append(out, e.To)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+func TestRepository_UpsertEdges(t *testing.T) {
+	t.Run("Keep top-K out edges of a demand", func(t *testing.T) {
+		mem := newMemRepo()
+		repo := New(mem, 2, 0)
+
+		err := repo.UpsertEdges(context.Background(),
+			graph.Edge{From: "A", To: "B", Score: 10},
+			graph.Edge{From: "A", To: "C", Score: 30},
+		)
+		assert.NoError(t, err)
+
+		err = repo.UpsertEdges(context.Background(),
+			graph.Edge{From: "A", To: "D", Score: 20},
+			graph.Edge{From: "A", To: "E", Score: 5},
+		)
+		assert.NoError(t, err)
+
+		edges, err := mem.ReadDemandEdges(context.Background(), "A")
+		assert.NoError(t, err)
+		assert.Equal(t, []graph.Node{"C", "D"}, targets(edges))
+	})
+	t.Run("Keep top-K in edges of a supply", func(t *testing.T) {
+		mem := newMemRepo()
+		repo := New(mem, 0, 1)
+
+		err := repo.UpsertEdges(context.Background(),
+			graph.Edge{From: "A", To: "S", Score: 10},
+			graph.Edge{From: "B", To: "S", Score: 30},
+			graph.Edge{From: "C", To: "S", Score: 20},
+		)
+		assert.NoError(t, err)
+
+		edges, err := mem.ReadSupplyEdges(context.Background(), "S")
+		assert.NoError(t, err)
+		assert.Len(t, edges, 1)
+		assert.Equal(t, graph.Node("B"), edges[0].From)
+	})
+	t.Run("Evict supply edges the index does not show yet", func(t *testing.T) {
+		mem := newLaggingRepo()
+		repo := New(mem, 0, 1, WithSupplyDegrees(mem))
+
+		err := repo.UpsertEdges(context.Background(), graph.Edge{From: "A", To: "S", Score: 30})
+		assert.NoError(t, err)
+		err = repo.UpsertEdges(context.Background(), graph.Edge{From: "B", To: "S", Score: 10})
+		assert.NoError(t, err)
+
+		edges, err := mem.memRepo.ReadSupplyEdges(context.Background(), "S")
+		assert.NoError(t, err)
+		if assert.Len(t, edges, 1) {
+			assert.Equal(t, graph.Node("A"), edges[0].From)
+		}
+	})
+	t.Run("Do not read supplies within the cap", func(t *testing.T) {
+		mem := newLaggingRepo()
+		repo := New(mem, 0, 2, WithSupplyDegrees(mem))
+
+		err := repo.UpsertEdges(context.Background(),
+			graph.Edge{From: "A", To: "S", Score: 10},
+			graph.Edge{From: "B", To: "S", Score: 20},
+		)
+		assert.NoError(t, err)
+		assert.Zero(t, mem.supplyReads)
+	})
+	t.Run("Disabled caps keep all edges", func(t *testing.T) {
+		mem := newMemRepo()
+		repo := New(mem, 0, 0)
+
+		err := repo.UpsertEdges(context.Background(),
+			graph.Edge{From: "A", To: "B", Score: 10},
+			graph.Edge{From: "A", To: "C", Score: 30},
+			graph.Edge{From: "D", To: "C", Score: 30},
+		)
+		assert.NoError(t, err)
+		assert.Len(t, mem.edges, 3)
+	})
+}
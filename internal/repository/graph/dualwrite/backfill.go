@@ -0,0 +1,112 @@
+package dualwrite
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/adjacency-lists-with-gsi-for-reverse-lookup"
+)
+
+type edgeSource interface {
+	ExportAll(
+		ctx context.Context,
+		w adjacency_lists_with_gsi_for_reverse_lookup.EdgeWriter,
+		opts adjacency_lists_with_gsi_for_reverse_lookup.ExportOptions,
+	) error
+}
+
+type graphBuilder interface {
+	UpsertEdges(ctx context.Context, edges ...graph.Edge) error
+}
+
+type BackfillOptions struct {
+	// BatchSize - число рёбер в одном вызове UpsertEdges, по умолчанию 25
+	BatchSize int
+	// Rate - ограничение записи в рёбрах в секунду, 0 - без ограничения
+	Rate float64
+	// Export - сегменты и контрольные точки сканирования источника
+	Export adjacency_lists_with_gsi_for_reverse_lookup.ExportOptions
+	// MinTTL - рёбра, которым осталось жить меньше, считаются истёкшими:
+	// цель их не примет. По умолчанию graph.DefaultRules().MinTTL
+	MinTTL time.Duration
+}
+
+type BackfillStats struct {
+	Read    int `json:"read"`
+	Expired int `json:"expired"`
+	Written int `json:"written"`
+}
+
+// Backfill copies every edge of source into target, keeping the expiry
+// of each edge. It is meant to run while the wrapper already writes to
+// both backends: a backfilled edge may overwrite a newer write made in
+// between, shadow reads show whether that happened.
+//
+// The source has to scan the whole graph, which only the adjacency lists
+// strategy does. To move off another strategy, export it by area and
+// import the snapshots into the target instead.
+//
+// With checkpoints in the export options the copy can be resumed; every
+// page is written before its checkpoint is saved.
+func Backfill(ctx context.Context, source edgeSource, target graphBuilder, opts BackfillOptions) (BackfillStats, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 25
+	}
+	if opts.MinTTL <= 0 {
+		opts.MinTTL = graph.DefaultRules().MinTTL
+	}
+	w := &backfillWriter{ctx: ctx, target: target, opts: opts}
+	if opts.Rate > 0 {
+		// При очень большом Rate интервал округляется до нуля, а тикер с
+		// нулевым интервалом паникует
+		interval := max(time.Duration(float64(time.Second)*float64(opts.BatchSize)/opts.Rate), time.Nanosecond)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		w.tick = ticker.C
+	}
+	err := source.ExportAll(ctx, w, opts.Export)
+	return w.stats, err
+}
+
+// backfillWriter writes every exported page before returning, so the
+// export checkpoint never runs ahead of the target.
+type backfillWriter struct {
+	ctx    context.Context
+	target graphBuilder
+	opts   BackfillOptions
+	tick   <-chan time.Time
+	stats  BackfillStats
+}
+
+func (w *backfillWriter) WriteEdges(edges ...graph.Edge) error {
+	now := time.Now()
+	live := make([]graph.Edge, 0, len(edges))
+	for _, e := range edges {
+		w.stats.Read++
+		ttl := e.ExpiresAt.Sub(now)
+		if ttl < w.opts.MinTTL {
+			w.stats.Expired++
+			continue
+		}
+		e.TTL, e.ExpiresAt = ttl, time.Time{}
+		live = append(live, e)
+	}
+
+	for batch := range slices.Chunk(live, w.opts.BatchSize) {
+		if w.tick != nil && w.stats.Written > 0 {
+			select {
+			case <-w.ctx.Done():
+				return w.ctx.Err()
+			case <-w.tick:
+			}
+		}
+		if err := w.target.UpsertEdges(w.ctx, batch...); err != nil {
+			return fmt.Errorf("write batch after %d edges: %w", w.stats.Written, err)
+		}
+		w.stats.Written += len(batch)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package dualwrite
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/adjacency-lists-with-gsi-for-reverse-lookup"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/memory"
+)
+
+// pagedSource exports its edges in pages of two, like a segmented scan.
+type pagedSource []graph.Edge
+
+func (s pagedSource) ExportAll(
+	_ context.Context,
+	w adjacency_lists_with_gsi_for_reverse_lookup.EdgeWriter,
+	_ adjacency_lists_with_gsi_for_reverse_lookup.ExportOptions,
+) error {
+	for page := range slices.Chunk(s, 2) {
+		if err := w.WriteEdges(page...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestBackfill(t *testing.T) {
+	t.Run("Copy live edges with their expiry", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+		source := pagedSource{
+			{From: "A", To: "B", Area: "Area1", Score: 10, ExpiresAt: expiresAt},
+			{From: "A", To: "C", Area: "Area1", Score: 20, ExpiresAt: expiresAt},
+			{From: "A", To: "D", Area: "Area1", Score: 30, ExpiresAt: time.Now().Add(-time.Minute)},
+			{From: "A", To: "E", Area: "Area1", Score: 30, ExpiresAt: time.Now().Add(500 * time.Millisecond)},
+			{From: "E", To: "B", Area: "Area2", Score: 40, ExpiresAt: expiresAt},
+		}
+		target := memory.New()
+
+		stats, err := Backfill(context.Background(), source, target, BackfillOptions{BatchSize: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, BackfillStats{Read: 5, Expired: 2, Written: 3}, stats)
+
+		copied, err := target.ReadDemandEdges(context.Background(), "A")
+		assert.NoError(t, err)
+		assert.Equal(t, []graph.Node{"B", "C"}, targets(copied))
+		for _, e := range copied {
+			assert.WithinDuration(t, expiresAt, e.ExpiresAt, time.Second)
+		}
+	})
+	t.Run("Rates too high for a ticker interval do not panic", func(t *testing.T) {
+		source := pagedSource{
+			{From: "A", To: "B", Area: "Area1", Score: 10, ExpiresAt: time.Now().Add(time.Hour)},
+			{From: "A", To: "C", Area: "Area1", Score: 20, ExpiresAt: time.Now().Add(time.Hour)},
+		}
+
+		stats, err := Backfill(context.Background(), source, memory.New(), BackfillOptions{BatchSize: 1, Rate: 1e12})
+		assert.NoError(t, err)
+		assert.Equal(t, BackfillStats{Read: 2, Written: 2}, stats)
+	})
+}
@@ -0,0 +1,77 @@
+package dualwrite
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+)
+
+// Mismatch is how a shadow read differs from the read that was served.
+// Edges are compared by their nodes, score and area; the expiry depends
+// on when each backend was written and is ignored.
+type Mismatch struct {
+	Operation string `json:"operation"`
+	// Key is the node or the area that was read
+	Key string `json:"key"`
+	// Missing edges were served but the other backend does not have them
+	Missing []graph.Edge `json:"missing,omitempty"`
+	// Unexpected edges are only in the other backend
+	Unexpected []graph.Edge `json:"unexpected,omitempty"`
+	Changed    []Change     `json:"changed,omitempty"`
+}
+
+// Change is an edge both backends have with a different score or area.
+type Change struct {
+	Served graph.Edge `json:"served"`
+	Shadow graph.Edge `json:"shadow"`
+}
+
+func (m Mismatch) Empty() bool {
+	return len(m.Missing) == 0 && len(m.Unexpected) == 0 && len(m.Changed) == 0
+}
+
+func compare(op, key string, served, shadow []graph.Edge, top bool) Mismatch {
+	if top {
+		served, shadow = withoutTies(served, shadow)
+	}
+
+	m := Mismatch{Operation: op, Key: key}
+	index := make(map[[2]graph.Node]graph.Edge, len(shadow))
+	for _, e := range shadow {
+		index[[2]graph.Node{e.From, e.To}] = e
+	}
+	for _, e := range served {
+		k := [2]graph.Node{e.From, e.To}
+		other, ok := index[k]
+		switch {
+		case !ok:
+			m.Missing = append(m.Missing, e)
+		case other.Score != e.Score || other.Area != e.Area:
+			m.Changed = append(m.Changed, Change{Served: e, Shadow: other})
+		}
+		delete(index, k)
+	}
+	for _, e := range index {
+		m.Unexpected = append(m.Unexpected, e)
+	}
+	slices.SortFunc(m.Unexpected, func(a, b graph.Edge) int {
+		return cmp.Or(cmp.Compare(a.From, b.From), cmp.Compare(a.To, b.To))
+	})
+	return m
+}
+
+// withoutTies drops the edges scored as low as the last served one: the
+// backends may break the tie at the cut of a top-N read differently.
+func withoutTies(served, shadow []graph.Edge) ([]graph.Edge, []graph.Edge) {
+	if len(served) == 0 {
+		return served, shadow
+	}
+	cut := served[len(served)-1].Score
+	above := func(edges []graph.Edge) []graph.Edge {
+		return slices.DeleteFunc(slices.Clone(edges), func(e graph.Edge) bool {
+			return e.Score <= cut
+		})
+	}
+	return above(served), above(shadow)
+}
@@ -0,0 +1,304 @@
+package dualwrite
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/adjacency-lists-with-gsi-for-reverse-lookup"
+)
+
+type graphRepository interface {
+	Size(ctx context.Context) (int, error)
+	UpsertEdges(ctx context.Context, edges ...graph.Edge) error
+	RemoveEdges(ctx context.Context, edges ...graph.Edge) error
+	ReadDemandEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error)
+	ReadTopDemandEdges(ctx context.Context, node graph.Node, n int) ([]graph.Edge, error)
+	ReadSupplyEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error)
+	ReadAreaEdges(ctx context.Context, area graph.Area) ([]graph.Edge, error)
+	RemoveNodeEdges(ctx context.Context, node graph.Node) error
+	RemoveDemandEdges(ctx context.Context, node graph.Node) error
+}
+
+// Mode is a phase of a migration from the primary to the secondary backend.
+// Every mode writes to both backends.
+type Mode string
+
+const (
+	// ModeDualWrite serves reads from the primary.
+	ModeDualWrite Mode = "dual_write"
+	// ModeShadowRead serves reads from the primary and compares a sample
+	// of them with the secondary.
+	ModeShadowRead Mode = "shadow_read"
+	// ModeCutover serves reads from the secondary and compares a sample
+	// of them with the primary, which is still written for a rollback.
+	ModeCutover Mode = "cutover"
+)
+
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case ModeDualWrite, ModeShadowRead, ModeCutover:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown dual write mode %q", s)
+	}
+}
+
+const (
+	defaultShadowRate     = 0.01
+	defaultMaxShadowReads = 16
+	shadowTimeout         = 5 * time.Second
+)
+
+// Stats counts what the wrapper did since it was created.
+type Stats struct {
+	ShadowReads    int64 `json:"shadow_reads"`
+	SkippedShadows int64 `json:"skipped_shadows"`
+	ShadowErrors   int64 `json:"shadow_errors"`
+	Mismatches     int64 `json:"mismatches"`
+	WriteErrors    int64 `json:"write_errors"`
+}
+
+// Repository writes to two backends and reads from one of them, see Mode.
+//
+// Writes go to the backend that serves reads first, its error is returned.
+// A failed write to the other backend is reported and counted but does not
+// fail the call: the backend being migrated to must not break the one
+// that serves traffic.
+type Repository struct {
+	primary, secondary graphRepository
+	mode               Mode
+
+	shadowRate float64
+	reporter   Reporter
+	sample     func() float64
+
+	shadows chan struct{}
+	wg      sync.WaitGroup
+
+	shadowReads, skippedShadows, shadowErrors atomic.Int64
+	mismatches, writeErrors                   atomic.Int64
+}
+
+type Option func(*Repository)
+
+// WithShadowRate sets the share of reads, 0..1, compared with the other backend.
+func WithShadowRate(rate float64) Option {
+	return func(r *Repository) {
+		r.shadowRate = rate
+	}
+}
+
+// WithReporter sets where mismatches and failed writes go, LogReporter by default.
+func WithReporter(reporter Reporter) Option {
+	return func(r *Repository) {
+		r.reporter = reporter
+	}
+}
+
+// WithMaxShadowReads caps the shadow reads in flight. Sampled reads over
+// the cap are skipped rather than queued.
+func WithMaxShadowReads(n int) Option {
+	return func(r *Repository) {
+		r.shadows = make(chan struct{}, max(n, 1))
+	}
+}
+
+func New(primary, secondary graphRepository, mode Mode, opts ...Option) *Repository {
+	r := &Repository{
+		primary:    primary,
+		secondary:  secondary,
+		mode:       mode,
+		shadowRate: defaultShadowRate,
+		reporter:   LogReporter{},
+		sample:     rand.Float64,
+		shadows:    make(chan struct{}, defaultMaxShadowReads),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Stats returns the counters of the wrapper.
+func (r *Repository) Stats() Stats {
+	return Stats{
+		ShadowReads:    r.shadowReads.Load(),
+		SkippedShadows: r.skippedShadows.Load(),
+		ShadowErrors:   r.shadowErrors.Load(),
+		Mismatches:     r.mismatches.Load(),
+		WriteErrors:    r.writeErrors.Load(),
+	}
+}
+
+// Wait blocks until the shadow reads in flight are compared.
+func (r *Repository) Wait() {
+	r.wg.Wait()
+}
+
+// backends returns the backend that serves reads and the other one.
+func (r *Repository) backends() (serving, other graphRepository) {
+	if r.mode == ModeCutover {
+		return r.secondary, r.primary
+	}
+	return r.primary, r.secondary
+}
+
+func (r *Repository) Size(ctx context.Context) (int, error) {
+	serving, _ := r.backends()
+	return serving.Size(ctx)
+}
+
+// ExportAll exports the whole graph from the backend that serves reads.
+// It fails if that backend cannot scan the whole graph.
+func (r *Repository) ExportAll(
+	ctx context.Context,
+	w adjacency_lists_with_gsi_for_reverse_lookup.EdgeWriter,
+	opts adjacency_lists_with_gsi_for_reverse_lookup.ExportOptions,
+) error {
+	serving, _ := r.backends()
+	source, ok := serving.(edgeSource)
+	if !ok {
+		return fmt.Errorf("the serving backend %T cannot export the whole graph", serving)
+	}
+	return source.ExportAll(ctx, w, opts)
+}
+
+func (r *Repository) UpsertEdges(ctx context.Context, edges ...graph.Edge) error {
+	return r.write(ctx, "UpsertEdges", func(repo graphRepository) error {
+		return repo.UpsertEdges(ctx, edges...)
+	})
+}
+
+func (r *Repository) RemoveEdges(ctx context.Context, edges ...graph.Edge) error {
+	return r.write(ctx, "RemoveEdges", func(repo graphRepository) error {
+		return repo.RemoveEdges(ctx, edges...)
+	})
+}
+
+func (r *Repository) RemoveNodeEdges(ctx context.Context, node graph.Node) error {
+	return r.write(ctx, "RemoveNodeEdges", func(repo graphRepository) error {
+		return repo.RemoveNodeEdges(ctx, node)
+	})
+}
+
+func (r *Repository) RemoveDemandEdges(ctx context.Context, node graph.Node) error {
+	return r.write(ctx, "RemoveDemandEdges", func(repo graphRepository) error {
+		return repo.RemoveDemandEdges(ctx, node)
+	})
+}
+
+func (r *Repository) write(ctx context.Context, op string, write func(graphRepository) error) error {
+	serving, other := r.backends()
+	if err := write(serving); err != nil {
+		return err
+	}
+	if err := write(other); err != nil {
+		r.writeErrors.Add(1)
+		r.reporter.ReportError(ctx, op, err)
+	}
+	return nil
+}
+
+func (r *Repository) ReadDemandEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error) {
+	return r.read(ctx, "ReadDemandEdges", node.String(), false, func(ctx context.Context, repo graphRepository) ([]graph.Edge, error) {
+		return repo.ReadDemandEdges(ctx, node)
+	})
+}
+
+func (r *Repository) ReadTopDemandEdges(ctx context.Context, node graph.Node, n int) ([]graph.Edge, error) {
+	return r.read(ctx, "ReadTopDemandEdges", node.String(), true, func(ctx context.Context, repo graphRepository) ([]graph.Edge, error) {
+		return repo.ReadTopDemandEdges(ctx, node, n)
+	})
+}
+
+func (r *Repository) ReadSupplyEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error) {
+	return r.read(ctx, "ReadSupplyEdges", node.String(), false, func(ctx context.Context, repo graphRepository) ([]graph.Edge, error) {
+		return repo.ReadSupplyEdges(ctx, node)
+	})
+}
+
+func (r *Repository) ReadAreaEdges(ctx context.Context, area graph.Area) ([]graph.Edge, error) {
+	return r.read(ctx, "ReadAreaEdges", string(area), false, func(ctx context.Context, repo graphRepository) ([]graph.Edge, error) {
+		return repo.ReadAreaEdges(ctx, area)
+	})
+}
+
+// read serves the read from the serving backend and, for a sample of
+// reads, repeats it on the other backend in the background.
+func (r *Repository) read(
+	ctx context.Context,
+	op, key string,
+	top bool,
+	read func(context.Context, graphRepository) ([]graph.Edge, error),
+) ([]graph.Edge, error) {
+	serving, other := r.backends()
+	edges, err := read(ctx, serving)
+	if err != nil || r.mode == ModeDualWrite || r.sample() >= r.shadowRate {
+		return edges, err
+	}
+
+	select {
+	case r.shadows <- struct{}{}:
+	default:
+		r.skippedShadows.Add(1)
+		return edges, nil
+	}
+	expected := slices.Clone(edges)
+	r.wg.Add(1)
+	go func() {
+		defer func() {
+			<-r.shadows
+			r.wg.Done()
+		}()
+		// Теневое чтение не должно зависеть от отмены исходного запроса
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shadowTimeout)
+		defer cancel()
+
+		r.shadowReads.Add(1)
+		actual, err := read(ctx, other)
+		if err != nil {
+			r.shadowErrors.Add(1)
+			r.reporter.ReportError(ctx, "shadow "+op, err)
+			return
+		}
+		if m := compare(op, key, expected, actual, top); !m.Empty() {
+			r.mismatches.Add(1)
+			r.reporter.ReportMismatch(ctx, m)
+		}
+	}()
+	return edges, nil
+}
+
+// Reporter receives what the wrapper found out about the other backend.
+type Reporter interface {
+	ReportMismatch(ctx context.Context, m Mismatch)
+	ReportError(ctx context.Context, op string, err error)
+}
+
+// LogReporter writes reports to the default slog logger with the fields
+// of the context.
+type LogReporter struct{}
+
+func (LogReporter) ReportMismatch(ctx context.Context, m Mismatch) {
+	slog.WarnContext(ctx, "dualwrite: read mismatch",
+		slog.String("shadow_operation", m.Operation),
+		slog.String("key", m.Key),
+		slog.Int("missing", len(m.Missing)),
+		slog.Int("unexpected", len(m.Unexpected)),
+		slog.Int("changed", len(m.Changed)),
+	)
+}
+
+func (LogReporter) ReportError(ctx context.Context, op string, err error) {
+	slog.ErrorContext(ctx, "dualwrite: call on the other backend failed",
+		slog.String("shadow_operation", op),
+		slog.Any("error", err),
+	)
+}
@@ -0,0 +1,235 @@
+package dualwrite
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/adjacency-lists-with-gsi-for-reverse-lookup"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/memory"
+)
+
+type recordingReporter struct {
+	mu         sync.Mutex
+	mismatches []Mismatch
+	errors     []error
+}
+
+func (r *recordingReporter) ReportMismatch(_ context.Context, m Mismatch) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mismatches = append(r.mismatches, m)
+}
+
+func (r *recordingReporter) ReportError(_ context.Context, _ string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, err)
+}
+
+// failingRepo fails every write.
+type failingRepo struct {
+	*memory.Repository
+}
+
+func (failingRepo) UpsertEdges(context.Context, ...graph.Edge) error {
+	return errors.New("unavailable")
+}
+
+func targets(edges []graph.Edge) []graph.Node {
+	out := make([]graph.Node, 0, len(edges))
+	for _, e := range edges {
+		out = append(out, e.To)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+var edges = []graph.Edge{
+	{From: "A", To: "B", Area: "Area1", Score: 10, TTL: time.Hour},
+	{From: "A", To: "C", Area: "Area1", Score: 20, TTL: time.Hour},
+	{From: "D", To: "B", Area: "Area2", Score: 30, TTL: time.Hour},
+}
+
+func TestRepository_Writes(t *testing.T) {
+	t.Run("Write to both backends", func(t *testing.T) {
+		primary, secondary := memory.New(), memory.New()
+		repo := New(primary, secondary, ModeDualWrite)
+
+		err := repo.UpsertEdges(context.Background(), edges...)
+		assert.NoError(t, err)
+		assertSize(t, 3, primary)
+		assertSize(t, 3, secondary)
+
+		err = repo.RemoveDemandEdges(context.Background(), "A")
+		assert.NoError(t, err)
+		assertSize(t, 1, primary)
+		assertSize(t, 1, secondary)
+	})
+
+	t.Run("Failed write to the other backend is reported", func(t *testing.T) {
+		reporter := &recordingReporter{}
+		repo := New(memory.New(), failingRepo{memory.New()}, ModeDualWrite, WithReporter(reporter))
+
+		err := repo.UpsertEdges(context.Background(), edges...)
+		assert.NoError(t, err)
+		assert.Len(t, reporter.errors, 1)
+		assert.Equal(t, int64(1), repo.Stats().WriteErrors)
+	})
+
+	t.Run("Failed write to the serving backend is returned", func(t *testing.T) {
+		repo := New(memory.New(), failingRepo{memory.New()}, ModeCutover)
+
+		err := repo.UpsertEdges(context.Background(), edges...)
+		assert.Error(t, err)
+	})
+}
+
+func TestRepository_ShadowReads(t *testing.T) {
+	t.Run("Report edges the secondary misses", func(t *testing.T) {
+		primary, secondary := memory.New(), memory.New()
+		assert.NoError(t, primary.UpsertEdges(context.Background(), edges...))
+		assert.NoError(t, secondary.UpsertEdges(context.Background(),
+			graph.Edge{From: "A", To: "B", Area: "Area1", Score: 15, TTL: time.Hour},
+			graph.Edge{From: "A", To: "E", Area: "Area1", Score: 5, TTL: time.Hour},
+		))
+
+		reporter := &recordingReporter{}
+		repo := New(primary, secondary, ModeShadowRead, WithShadowRate(1), WithReporter(reporter))
+
+		served, err := repo.ReadDemandEdges(context.Background(), "A")
+		assert.NoError(t, err)
+		assert.Len(t, served, 2)
+		repo.Wait()
+
+		assert.Len(t, reporter.mismatches, 1)
+		m := reporter.mismatches[0]
+		assert.Equal(t, "ReadDemandEdges", m.Operation)
+		assert.Equal(t, "A", m.Key)
+		assert.Equal(t, []graph.Node{"C"}, targets(m.Missing))
+		assert.Equal(t, []graph.Node{"E"}, targets(m.Unexpected))
+		assert.Len(t, m.Changed, 1)
+		assert.Equal(t, graph.Score(15), m.Changed[0].Shadow.Score)
+		assert.Equal(t, Stats{ShadowReads: 1, Mismatches: 1}, repo.Stats())
+	})
+
+	t.Run("Matching backends report nothing", func(t *testing.T) {
+		reporter := &recordingReporter{}
+		repo := New(memory.New(), memory.New(), ModeShadowRead, WithShadowRate(1), WithReporter(reporter))
+		assert.NoError(t, repo.UpsertEdges(context.Background(), edges...))
+
+		_, err := repo.ReadAreaEdges(context.Background(), "Area1")
+		assert.NoError(t, err)
+		_, err = repo.ReadSupplyEdges(context.Background(), "B")
+		assert.NoError(t, err)
+		repo.Wait()
+
+		assert.Empty(t, reporter.mismatches)
+		assert.Equal(t, int64(2), repo.Stats().ShadowReads)
+	})
+
+	t.Run("Ties at the cut of a top read are not a mismatch", func(t *testing.T) {
+		primary, secondary := memory.New(), memory.New()
+		assert.NoError(t, primary.UpsertEdges(context.Background(),
+			graph.Edge{From: "A", To: "B", Area: "Area1", Score: 20, TTL: time.Hour},
+			graph.Edge{From: "A", To: "C", Area: "Area1", Score: 10, TTL: time.Hour},
+		))
+		assert.NoError(t, secondary.UpsertEdges(context.Background(),
+			graph.Edge{From: "A", To: "B", Area: "Area1", Score: 20, TTL: time.Hour},
+			graph.Edge{From: "A", To: "D", Area: "Area1", Score: 10, TTL: time.Hour},
+		))
+
+		reporter := &recordingReporter{}
+		repo := New(primary, secondary, ModeShadowRead, WithShadowRate(1), WithReporter(reporter))
+
+		_, err := repo.ReadTopDemandEdges(context.Background(), "A", 2)
+		assert.NoError(t, err)
+		repo.Wait()
+		assert.Empty(t, reporter.mismatches)
+	})
+
+	t.Run("Cutover serves the secondary", func(t *testing.T) {
+		primary, secondary := memory.New(), memory.New()
+		assert.NoError(t, secondary.UpsertEdges(context.Background(), edges...))
+
+		reporter := &recordingReporter{}
+		repo := New(primary, secondary, ModeCutover, WithShadowRate(1), WithReporter(reporter))
+
+		served, err := repo.ReadDemandEdges(context.Background(), "A")
+		assert.NoError(t, err)
+		assert.Len(t, served, 2)
+		repo.Wait()
+		assert.Len(t, reporter.mismatches, 1)
+		assert.Len(t, reporter.mismatches[0].Missing, 2)
+	})
+
+	t.Run("Dual write mode does not shadow", func(t *testing.T) {
+		repo := New(memory.New(), memory.New(), ModeDualWrite, WithShadowRate(1))
+
+		_, err := repo.ReadDemandEdges(context.Background(), "A")
+		assert.NoError(t, err)
+		repo.Wait()
+		assert.Equal(t, Stats{}, repo.Stats())
+	})
+}
+
+// exportingRepo is a backend that can also scan the whole graph.
+type exportingRepo struct {
+	*memory.Repository
+	pagedSource
+}
+
+// edgeCollector collects the exported edges.
+type edgeCollector []graph.Edge
+
+func (c *edgeCollector) WriteEdges(edges ...graph.Edge) error {
+	*c = append(*c, edges...)
+	return nil
+}
+
+func TestRepository_ExportAll(t *testing.T) {
+	t.Run("Export from the serving backend", func(t *testing.T) {
+		primary := exportingRepo{memory.New(), pagedSource{edges[0], edges[1]}}
+		secondary := exportingRepo{memory.New(), pagedSource{edges[2]}}
+
+		var exported edgeCollector
+		err := New(primary, secondary, ModeShadowRead).ExportAll(context.Background(), &exported, adjacency_lists_with_gsi_for_reverse_lookup.ExportOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, edgeCollector{edges[0], edges[1]}, exported)
+
+		exported = nil
+		err = New(primary, secondary, ModeCutover).ExportAll(context.Background(), &exported, adjacency_lists_with_gsi_for_reverse_lookup.ExportOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, edgeCollector{edges[2]}, exported)
+	})
+	t.Run("Fail if the serving backend cannot scan the graph", func(t *testing.T) {
+		primary := exportingRepo{memory.New(), pagedSource{edges[0]}}
+
+		var exported edgeCollector
+		err := New(primary, memory.New(), ModeCutover).ExportAll(context.Background(), &exported, adjacency_lists_with_gsi_for_reverse_lookup.ExportOptions{})
+		assert.Error(t, err)
+		assert.Empty(t, exported)
+	})
+}
+
+func TestParseMode(t *testing.T) {
+	mode, err := ParseMode("shadow_read")
+	assert.NoError(t, err)
+	assert.Equal(t, ModeShadowRead, mode)
+
+	_, err = ParseMode("both")
+	assert.Error(t, err)
+}
+
+func assertSize(t *testing.T, expected int, repo graphRepository) {
+	t.Helper()
+	size, err := repo.Size(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, expected, size)
+}
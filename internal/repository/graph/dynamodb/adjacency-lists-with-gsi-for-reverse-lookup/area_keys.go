@@ -0,0 +1,86 @@
+package adjacency_lists_with_gsi_for_reverse_lookup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	graphdb "github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ShardAreaKeys rewrites the ak attribute of the edges written with from
+// area shards into the layout of the repository, see WithAreaShards, and
+// returns the number of rewritten edges. It scans the whole table, so it
+// is a one-off backfill run when the shard count changes rather than a
+// migration. The area counters follow every rewritten edge. Edges already
+// in the new layout are left alone, so an interrupted run can be repeated.
+// Until it is done the repository has to read both layouts, see
+// WithPreviousAreaShards.
+func (r *Repository) ShardAreaKeys(ctx context.Context, from int) (int, error) {
+	var (
+		rewritten int
+		last      map[string]types.AttributeValue
+	)
+	for {
+		out, err := r.client.Scan(ctx, &dynamodb.ScanInput{
+			TableName:            aws.String(TableName),
+			ProjectionExpression: aws.String("pk, sk, ak"),
+			ExclusiveStartKey:    last,
+		})
+		if err != nil {
+			return rewritten, fmt.Errorf("scan edges: %w", err)
+		}
+
+		for _, item := range out.Items {
+			pk, sk, ak := stringAttr(item, "pk"), stringAttr(item, "sk"), stringAttr(item, "ak")
+			edge := graph.Edge{
+				From: graph.Node(strings.TrimPrefix(pk, "DEMAND#")),
+				To:   graph.Node(strings.TrimPrefix(sk, "SUPPLY#")),
+			}
+			edge.Area = edge.StoredArea(ak, r.areaShards, from)
+			want := edge.AreaKey(r.areaShards)
+			if ak == want {
+				continue
+			}
+			// Ребро переходит между счётчиками областей в той же транзакции
+			counts := graphdb.CounterDeltas{ak: -1, want: 1}
+			items := append([]types.TransactWriteItem{{
+				Update: &types.Update{
+					TableName: aws.String(TableName),
+					Key: map[string]types.AttributeValue{
+						"pk": &types.AttributeValueMemberS{Value: pk},
+						"sk": &types.AttributeValueMemberS{Value: sk},
+					},
+					// Ребро могли перезаписать или удалить после Scan
+					ConditionExpression: aws.String("ak = :old"),
+					UpdateExpression:    aws.String("SET ak = :new"),
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":old": &types.AttributeValueMemberS{Value: ak},
+						":new": &types.AttributeValueMemberS{Value: want},
+					},
+				},
+			}}, r.counters.Updates(counts)...)
+			_, err = r.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+				TransactItems: items,
+			})
+			switch {
+			case graphdb.IsTransactionConflict(err):
+				// Ребро перезаписали уже в новой раскладке или удалили
+			case err != nil:
+				return rewritten, fmt.Errorf("rewrite area key of %s|%s: %w", pk, sk, err)
+			default:
+				rewritten++
+			}
+		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			return rewritten, nil
+		}
+		last = out.LastEvaluatedKey
+	}
+}
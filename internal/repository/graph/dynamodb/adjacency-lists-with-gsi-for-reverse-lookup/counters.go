@@ -0,0 +1,166 @@
+package adjacency_lists_with_gsi_for_reverse_lookup
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	graphdb "github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// CountersTableName is the table of the edge counters, see graphdb.EdgeCounters.
+const CountersTableName = "graph_based_on_gsi_counters_tbl"
+
+// Ребро занимает до 5 действий транзакции: элемент, степени спроса и
+// предложения, старый и новый ключ области
+const edgesPerTransaction = 20
+
+// planUpsert puts every edge. A new edge adds one to its area and to the
+// degrees of its nodes, an edge that moves to another area key moves
+// between the area counters.
+func (r *Repository) planUpsert(cause string) graphdb.TransactPlan {
+	return func(chunk []graph.Edge, stored graphdb.StoredAreaKeys) ([]types.TransactWriteItem, error) {
+		items := make([]types.TransactWriteItem, 0, 5*len(chunk))
+		counts := make(graphdb.CounterDeltas)
+		for i, dto := range r.makeDTO(chunk...) {
+			edge := chunk[i]
+			dto.Cause = cause
+			av, err := attributevalue.MarshalMap(dto)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal edge: %w", err)
+			}
+			av["ttl"] = &types.AttributeValueMemberN{
+				Value: strconv.FormatInt(dto.TTL, 10),
+			}
+			put := &types.Put{
+				TableName: aws.String(TableName),
+				Item:      av,
+			}
+			put.ConditionExpression, put.ExpressionAttributeValues = stored.Condition(edge)
+			items = append(items, types.TransactWriteItem{Put: put})
+
+			ak, ok := stored.Lookup(edge)
+			switch {
+			case !ok:
+				counts.Add(dto.AK, 1)
+				counts.Add(edge.Demand(), 1)
+				counts.Add(edge.Supply(), 1)
+			case ak != dto.AK:
+				counts.Add(ak, -1)
+				counts.Add(dto.AK, 1)
+			}
+		}
+		return append(items, r.counters.Updates(counts)...), nil
+	}
+}
+
+// planRemove deletes every stored edge and takes it off the counters.
+// Edges that are not stored are skipped.
+func (r *Repository) planRemove(chunk []graph.Edge, stored graphdb.StoredAreaKeys) ([]types.TransactWriteItem, error) {
+	items := make([]types.TransactWriteItem, 0, 4*len(chunk))
+	counts := make(graphdb.CounterDeltas)
+	for _, edge := range chunk {
+		ak, ok := stored.Lookup(edge)
+		if !ok {
+			continue
+		}
+		del := &types.Delete{
+			TableName: aws.String(TableName),
+			Key: map[string]types.AttributeValue{
+				"pk": &types.AttributeValueMemberS{Value: edge.Demand()},
+				"sk": &types.AttributeValueMemberS{Value: edge.Supply()},
+			},
+		}
+		del.ConditionExpression, del.ExpressionAttributeValues = stored.Condition(edge)
+		items = append(items, types.TransactWriteItem{Delete: del})
+		counts.Add(ak, -1)
+		counts.Add(edge.Demand(), -1)
+		counts.Add(edge.Supply(), -1)
+	}
+	return append(items, r.counters.Updates(counts)...), nil
+}
+
+// AreaEdgeCount returns the number of edges of the area from its counters.
+// While the area keys move, see WithPreviousAreaShards, the counters of
+// both layouts are summed.
+func (r *Repository) AreaEdgeCount(ctx context.Context, area graph.Area) (int, error) {
+	keys := areaKeys(area, r.areaShards)
+	if r.previousAreaShards > 0 {
+		for _, key := range areaKeys(area, r.previousAreaShards) {
+			if !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	counts, err := r.counters.Read(ctx, keys)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	return total, nil
+}
+
+// DemandDegree returns the number of edges from the demand node.
+func (r *Repository) DemandDegree(ctx context.Context, node graph.Node) (int, error) {
+	return r.counters.DemandDegree(ctx, node)
+}
+
+// SupplyDegree returns the number of edges to the supply node.
+func (r *Repository) SupplyDegree(ctx context.Context, node graph.Node) (int, error) {
+	return r.counters.SupplyDegree(ctx, node)
+}
+
+// Reconcile recounts every counter by query and corrects the ones that
+// drifted, see graphdb.EdgeCounters.Reconcile. Out-degrees are counted
+// with strongly consistent queries of the demand partition, in-degrees
+// with sk-gsi and areas with ak-gsi.
+func (r *Repository) Reconcile(ctx context.Context) (graphdb.ReconcileStats, error) {
+	return r.counters.Reconcile(ctx, TableName, r.countEdges)
+}
+
+// countEdges counts the edges of a counter key.
+func (r *Repository) countEdges(ctx context.Context, key string) (int, bool, error) {
+	in := &dynamodb.QueryInput{
+		TableName:              aws.String(TableName),
+		KeyConditionExpression: aws.String("pk = :key"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":key": &types.AttributeValueMemberS{Value: key},
+		},
+		ConsistentRead: aws.Bool(true),
+		Select:         types.SelectCount,
+	}
+	indexed := true
+	switch {
+	case graphdb.IsAreaKey(key):
+		in.IndexName = aws.String("ak-gsi")
+		in.KeyConditionExpression = aws.String("ak = :key")
+		in.ConsistentRead = nil
+	case strings.HasPrefix(key, "SUPPLY#"):
+		in.IndexName = aws.String("sk-gsi")
+		in.KeyConditionExpression = aws.String("sk = :key")
+		in.ConsistentRead = nil
+	default:
+		indexed = false
+	}
+	count := 0
+	paginator := dynamodb.NewQueryPaginator(r.client, in)
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to count edges: %w", err)
+		}
+		count += int(out.Count)
+	}
+	return count, indexed, nil
+}
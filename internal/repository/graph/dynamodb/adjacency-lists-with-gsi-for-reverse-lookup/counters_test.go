@@ -0,0 +1,133 @@
+package adjacency_lists_with_gsi_for_reverse_lookup
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsdynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+)
+
+func TestRepository_Counters(t *testing.T) {
+	ctx := context.Background()
+	db, err := dynamodb.NewTestDatabase()
+	assert.NoError(t, err)
+	assert.NoError(t, db.Migrate(ctx))
+	defer db.Rollback(ctx)
+
+	repo := New(db.Client, WithAreaShards(4))
+	edges := []graph.Edge{
+		{From: "A", To: "X", Area: "Area1", Score: 1, TTL: time.Hour},
+		{From: "A", To: "Y", Area: "Area1", Score: 2, TTL: time.Hour},
+		{From: "B", To: "X", Area: "Area2", Score: 3, TTL: time.Hour},
+	}
+	assert.NoError(t, repo.UpsertEdges(ctx, edges...))
+
+	t.Run("Count new edges once", func(t *testing.T) {
+		// Повторная запись тех же рёбер не меняет счётчики
+		assert.NoError(t, repo.UpsertEdges(ctx, edges...))
+
+		assertCount(t, 2, repo.AreaEdgeCount, graph.Area("Area1"))
+		assertCount(t, 1, repo.AreaEdgeCount, graph.Area("Area2"))
+		assertCount(t, 2, repo.DemandDegree, graph.Node("A"))
+		assertCount(t, 2, repo.SupplyDegree, graph.Node("X"))
+	})
+	t.Run("Move edge between area counters", func(t *testing.T) {
+		moved := edges[1]
+		moved.Area = "Area2"
+		assert.NoError(t, repo.UpsertEdges(ctx, moved))
+
+		assertCount(t, 1, repo.AreaEdgeCount, graph.Area("Area1"))
+		assertCount(t, 2, repo.AreaEdgeCount, graph.Area("Area2"))
+		assertCount(t, 2, repo.DemandDegree, graph.Node("A"))
+	})
+	t.Run("Take removed edges off the counters", func(t *testing.T) {
+		missing := graph.Edge{From: "C", To: "Z", Area: "Area1"}
+		assert.NoError(t, repo.RemoveEdges(ctx, edges[0], missing))
+
+		assertCount(t, 0, repo.AreaEdgeCount, graph.Area("Area1"))
+		assertCount(t, 1, repo.DemandDegree, graph.Node("A"))
+		assertCount(t, 1, repo.SupplyDegree, graph.Node("X"))
+		assertCount(t, 0, repo.DemandDegree, graph.Node("C"))
+
+		assert.NoError(t, repo.RemoveDemandEdges(ctx, "B"))
+		assertCount(t, 1, repo.AreaEdgeCount, graph.Area("Area2"))
+		assertCount(t, 0, repo.SupplyDegree, graph.Node("X"))
+	})
+	t.Run("Keep counters right under concurrent writes", func(t *testing.T) {
+		done := make(chan error)
+		for i := range 8 {
+			go func() {
+				done <- repo.UpsertEdges(ctx, graph.Edge{
+					From: "D", To: graph.Node("S" + strconv.Itoa(i)), Area: "Area3", TTL: time.Hour,
+				})
+			}()
+		}
+		for range 8 {
+			assert.NoError(t, <-done)
+		}
+		assertCount(t, 8, repo.AreaEdgeCount, graph.Area("Area3"))
+		assertCount(t, 8, repo.DemandDegree, graph.Node("D"))
+	})
+}
+
+func TestRepository_Reconcile(t *testing.T) {
+	ctx := context.Background()
+	db, err := dynamodb.NewTestDatabase()
+	assert.NoError(t, err)
+	assert.NoError(t, db.Migrate(ctx))
+	defer db.Rollback(ctx)
+
+	repo := New(db.Client)
+	assert.NoError(t, repo.UpsertEdges(ctx,
+		graph.Edge{From: "A", To: "X", Area: "Area1", TTL: time.Hour},
+		graph.Edge{From: "B", To: "X", Area: "Area1", TTL: time.Hour},
+	))
+
+	// Дрейф: TTL удалил ребро в обход счётчиков, а у узла C счётчик остался
+	_, err = db.Client.DeleteItem(ctx, &awsdynamodb.DeleteItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: "DEMAND#B"},
+			"sk": &types.AttributeValueMemberS{Value: "SUPPLY#X"},
+		},
+	})
+	assert.NoError(t, err)
+	_, err = db.Client.PutItem(ctx, &awsdynamodb.PutItemInput{
+		TableName: aws.String(CountersTableName),
+		Item: map[string]types.AttributeValue{
+			"pk":    &types.AttributeValueMemberS{Value: "DEMAND#C"},
+			"edges": &types.AttributeValueMemberN{Value: "3"},
+		},
+	})
+	assert.NoError(t, err)
+
+	stats, err := repo.Reconcile(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.Corrected) // Area1 и X
+	assert.Equal(t, 2, stats.Removed)   // B и C
+	assert.Zero(t, stats.Skipped)
+
+	assertCount(t, 1, repo.AreaEdgeCount, graph.Area("Area1"))
+	assertCount(t, 1, repo.SupplyDegree, graph.Node("X"))
+	assertCount(t, 0, repo.DemandDegree, graph.Node("B"))
+	assertCount(t, 0, repo.DemandDegree, graph.Node("C"))
+
+	stats, err = repo.Reconcile(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, stats.Corrected+stats.Removed+stats.Skipped)
+}
+
+func assertCount[K any](t *testing.T, expected int, count func(context.Context, K) (int, error), key K) {
+	t.Helper()
+	n, err := count(context.Background(), key)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, n, "count of %v", key)
+}
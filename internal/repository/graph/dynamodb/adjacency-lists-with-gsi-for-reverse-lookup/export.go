@@ -0,0 +1,247 @@
+package adjacency_lists_with_gsi_for_reverse_lookup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// EdgeWriter receives exported edges. ExportAll serializes the calls,
+// so implementations do not need to be safe for concurrent use.
+type EdgeWriter interface {
+	WriteEdges(edges ...graph.Edge) error
+}
+
+// ExportCheckpoint is the position of every scan segment of an export.
+//
+// It is saved after each written page, so a resumed export continues from
+// the last saved page. Edges written after the last save are exported again.
+type ExportCheckpoint struct {
+	TotalSegments int                 `json:"total_segments"`
+	Segments      []SegmentCheckpoint `json:"segments"`
+}
+
+// Finished tells whether every segment was exported to the end.
+func (c ExportCheckpoint) Finished() bool {
+	for _, segment := range c.Segments {
+		if !segment.Done {
+			return false
+		}
+	}
+	return len(c.Segments) > 0
+}
+
+type SegmentCheckpoint struct {
+	LastPK string `json:"last_pk,omitempty"`
+	LastSK string `json:"last_sk,omitempty"`
+	Done   bool   `json:"done"`
+}
+
+// ErrExportFinished is returned when the checkpoint of an export is
+// resumed after the export finished: nothing would be written.
+var ErrExportFinished = errors.New("the export of the checkpoint is finished")
+
+// CheckpointStore persists export checkpoints. Load returns nil when there
+// is nothing to resume.
+type CheckpointStore interface {
+	Load(ctx context.Context) (*ExportCheckpoint, error)
+	Save(ctx context.Context, checkpoint ExportCheckpoint) error
+}
+
+type ExportOptions struct {
+	// TotalSegments - число параллельных сегментов Scan, по умолчанию 1
+	TotalSegments int
+	// Checkpoints - хранилище позиции для продолжения выгрузки, может быть nil
+	Checkpoints CheckpointStore
+	// PageSize - рёбер на страницу Scan, 0 - до 1 МБ на страницу
+	PageSize int
+}
+
+// ExportAll streams every edge of the graph to w using a parallel segmented Scan.
+// It fails with ErrExportFinished when the saved checkpoint is of a
+// finished export.
+func (r *Repository) ExportAll(ctx context.Context, w EdgeWriter, opts ExportOptions) error {
+	segments := max(opts.TotalSegments, 1)
+
+	checkpoint := ExportCheckpoint{
+		TotalSegments: segments,
+		Segments:      make([]SegmentCheckpoint, segments),
+	}
+	if opts.Checkpoints != nil {
+		saved, err := opts.Checkpoints.Load(ctx)
+		if err != nil {
+			return fmt.Errorf("load export checkpoint: %w", err)
+		}
+		if saved != nil {
+			if saved.TotalSegments != segments || len(saved.Segments) != segments {
+				return fmt.Errorf("checkpoint has %d segments, export has %d", saved.TotalSegments, segments)
+			}
+			if saved.Finished() {
+				return ErrExportFinished
+			}
+			checkpoint = *saved
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs = make([]error, segments)
+	)
+	// commit пишет страницу и сохраняет позицию сегмента под одной блокировкой
+	commit := func(segment int, edges []graph.Edge, last map[string]types.AttributeValue) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(edges) > 0 {
+			if err := w.WriteEdges(edges...); err != nil {
+				return fmt.Errorf("write edges: %w", err)
+			}
+		}
+		checkpoint.Segments[segment] = SegmentCheckpoint{
+			LastPK: stringAttr(last, "pk"),
+			LastSK: stringAttr(last, "sk"),
+			Done:   len(last) == 0,
+		}
+		if opts.Checkpoints == nil {
+			return nil
+		}
+		saved := checkpoint
+		saved.Segments = append([]SegmentCheckpoint(nil), checkpoint.Segments...)
+		if err := opts.Checkpoints.Save(ctx, saved); err != nil {
+			return fmt.Errorf("save export checkpoint: %w", err)
+		}
+		return nil
+	}
+
+	for segment := range segments {
+		if checkpoint.Segments[segment].Done {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.exportSegment(ctx, segment, segments, opts.PageSize, checkpoint.Segments[segment], commit); err != nil {
+				errs[segment] = fmt.Errorf("segment %d: %w", segment, err)
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (r *Repository) exportSegment(
+	ctx context.Context,
+	segment, total, pageSize int,
+	from SegmentCheckpoint,
+	commit func(segment int, edges []graph.Edge, last map[string]types.AttributeValue) error,
+) error {
+	var last map[string]types.AttributeValue
+	if from.LastPK != "" {
+		last = map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: from.LastPK},
+			"sk": &types.AttributeValueMemberS{Value: from.LastSK},
+		}
+	}
+	var limit *int32
+	if pageSize > 0 {
+		limit = aws.Int32(int32(pageSize))
+	}
+	for {
+		out, err := r.client.Scan(ctx, &dynamodb.ScanInput{
+			TableName:         aws.String(TableName),
+			Segment:           aws.Int32(int32(segment)),
+			TotalSegments:     aws.Int32(int32(total)),
+			ExclusiveStartKey: last,
+			Limit:             limit,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to scan edges: %w", err)
+		}
+
+		edges := make([]graph.Edge, 0, len(out.Items))
+		for _, item := range out.Items {
+			var dto edgeDTO
+			if err = attributevalue.UnmarshalMap(item, &dto); err != nil {
+				return fmt.Errorf("failed to unmarshal edge: %w", err)
+			}
+			edges = append(edges, r.edge(dto))
+		}
+
+		if err = commit(segment, edges, out.LastEvaluatedKey); err != nil {
+			return err
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		last = out.LastEvaluatedKey
+	}
+}
+
+func stringAttr(item map[string]types.AttributeValue, name string) string {
+	if v, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+// FileCheckpointStore keeps the export checkpoint in a JSON file.
+type FileCheckpointStore struct {
+	path string
+}
+
+func NewFileCheckpointStore(path string) *FileCheckpointStore {
+	return &FileCheckpointStore{path: path}
+}
+
+func (s *FileCheckpointStore) Load(_ context.Context) (*ExportCheckpoint, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var checkpoint ExportCheckpoint
+	if err = json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("decode checkpoint %s: %w", s.path, err)
+	}
+	return &checkpoint, nil
+}
+
+// Save writes the checkpoint to a temporary file and renames it,
+// so an interrupted save never leaves a truncated checkpoint behind.
+func (s *FileCheckpointStore) Save(_ context.Context, checkpoint ExportCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,140 @@
+package adjacency_lists_with_gsi_for_reverse_lookup
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/strategytest"
+)
+
+type collectWriter struct {
+	edges []graph.Edge
+	// failAfter - число успешных вызовов до ошибки, 0 - без ошибок
+	failAfter int
+	calls     int
+}
+
+var errInterrupted = errors.New("interrupted")
+
+func (w *collectWriter) WriteEdges(edges ...graph.Edge) error {
+	w.calls++
+	if w.failAfter > 0 && w.calls > w.failAfter {
+		return errInterrupted
+	}
+	w.edges = append(w.edges, edges...)
+	return nil
+}
+
+func TestRepository_ExportAll(t *testing.T) {
+	t.Run("Export all edges with parallel scan", func(t *testing.T) {
+		db, err := dynamodb.NewTestDatabase()
+		assert.NoError(t, err)
+
+		err = db.Migrate(context.Background())
+		assert.NoError(t, err)
+
+		defer db.Rollback(context.Background())
+
+		repo := New(db.Client)
+
+		err = repo.UpsertEdges(context.Background(), strategytest.MakeEdges(30)...)
+		assert.NoError(t, err)
+
+		w := &collectWriter{}
+		err = repo.ExportAll(context.Background(), w, ExportOptions{TotalSegments: 4})
+		assert.NoError(t, err)
+		assert.Len(t, w.edges, 30)
+		for _, e := range w.edges {
+			assert.False(t, e.ExpiresAt.IsZero())
+		}
+	})
+	t.Run("Resume export from checkpoint", func(t *testing.T) {
+		db, err := dynamodb.NewTestDatabase()
+		assert.NoError(t, err)
+
+		err = db.Migrate(context.Background())
+		assert.NoError(t, err)
+
+		defer db.Rollback(context.Background())
+
+		repo := New(db.Client)
+
+		err = repo.UpsertEdges(context.Background(), strategytest.MakeEdges(30)...)
+		assert.NoError(t, err)
+
+		store := NewFileCheckpointStore(filepath.Join(t.TempDir(), "export.json"))
+
+		w := &collectWriter{}
+		err = repo.ExportAll(context.Background(), w, ExportOptions{TotalSegments: 2, Checkpoints: store})
+		assert.NoError(t, err)
+		assert.Len(t, w.edges, 30)
+
+		checkpoint, err := store.Load(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 2, checkpoint.TotalSegments)
+		for _, segment := range checkpoint.Segments {
+			assert.True(t, segment.Done)
+		}
+
+		// Завершённую выгрузку повторно не запускаем
+		w = &collectWriter{}
+		err = repo.ExportAll(context.Background(), w, ExportOptions{TotalSegments: 2, Checkpoints: store})
+		assert.ErrorIs(t, err, ErrExportFinished)
+		assert.Empty(t, w.edges)
+
+		err = repo.ExportAll(context.Background(), w, ExportOptions{TotalSegments: 3, Checkpoints: store})
+		assert.Error(t, err)
+	})
+	t.Run("Resume an export interrupted in the middle of a segment", func(t *testing.T) {
+		db, err := dynamodb.NewTestDatabase()
+		require.NoError(t, err)
+
+		err = db.Migrate(context.Background())
+		require.NoError(t, err)
+
+		defer db.Rollback(context.Background())
+
+		repo := New(db.Client)
+
+		edges := strategytest.MakeEdges(30)
+		err = repo.UpsertEdges(context.Background(), edges...)
+		require.NoError(t, err)
+
+		store := NewFileCheckpointStore(filepath.Join(t.TempDir(), "export.json"))
+		opts := ExportOptions{TotalSegments: 2, Checkpoints: store, PageSize: 4}
+
+		first := &collectWriter{failAfter: 3}
+		err = repo.ExportAll(context.Background(), first, opts)
+		require.ErrorIs(t, err, errInterrupted)
+		require.Less(t, len(first.edges), len(edges))
+
+		checkpoint, err := store.Load(context.Background())
+		require.NoError(t, err)
+		require.NotNil(t, checkpoint)
+		require.Len(t, checkpoint.Segments, 2)
+		assert.True(t, slices.ContainsFunc(checkpoint.Segments, func(s SegmentCheckpoint) bool {
+			return !s.Done && s.LastPK != ""
+		}), "the export stopped in the middle of a segment")
+
+		second := &collectWriter{}
+		err = repo.ExportAll(context.Background(), second, opts)
+		require.NoError(t, err)
+
+		exported := append(first.edges, second.edges...)
+		strategytest.SortEdges(exported)
+		strategytest.SortEdges(edges)
+		require.Len(t, exported, len(edges), "no edge is missing or exported twice")
+		for i := range edges {
+			assert.Equal(t, edges[i].From, exported[i].From)
+			assert.Equal(t, edges[i].To, exported[i].To)
+		}
+	})
+}
@@ -5,10 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"slices"
-	"strconv"
+	"sync"
 	"time"
 
 	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	graphdb "github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -16,17 +17,15 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
-const (
-	TableName = "graph_based_on_gsi_tbl"
-	batchSize = 25 // Максимальный размер партии для BatchWriteItem
-)
+const TableName = "graph_based_on_gsi_tbl"
 
 type edgeDTO struct {
-	PK    string  `dynamodbav:"pk"`    // DEMAND#{FromNodeName}
-	SK    string  `dynamodbav:"sk"`    // SUPPLY#{ToNodeName}
-	AK    string  `dynamodbav:"ak"`    // AREA#{AreaName}
-	Score float64 `dynamodbav:"score"` // score of the edge
-	TTL   int64   `dynamodbav:"ttl"`   // time to live (epoch time in seconds)
+	PK    string  `dynamodbav:"pk"`              // DEMAND#{FromNodeName}
+	SK    string  `dynamodbav:"sk"`              // SUPPLY#{ToNodeName}
+	AK    string  `dynamodbav:"ak"`              // AREA#{AreaName} или AREA#{AreaName}#{Shard}
+	Score float64 `dynamodbav:"score"`           // score of the edge
+	TTL   int64   `dynamodbav:"ttl"`             // time to live (epoch time in seconds)
+	Cause string  `dynamodbav:"cause,omitempty"` // who wrote the edge, see graph.WithCause
 }
 
 func parseDemand(pk string) graph.Node {
@@ -37,98 +36,178 @@ func parseSupply(sk string) graph.Node {
 	return graph.Node(sk[7:]) // Убираем "SUPPLY#"
 }
 
-func parseArea(ak string) graph.Area {
-	return graph.Area(ak[5:]) // Убираем "AREA#"
+func expiresAt(ttl int64) time.Time {
+	return time.Unix(ttl, 0).UTC()
+}
+
+func (r *Repository) edge(dto edgeDTO) graph.Edge {
+	edge := graph.Edge{
+		From:      parseDemand(dto.PK),
+		To:        parseSupply(dto.SK),
+		Score:     graph.Score(dto.Score),
+		ExpiresAt: expiresAt(dto.TTL),
+	}
+	if r.previousAreaShards == 0 {
+		edge.Area = graph.ParseAreaKey(dto.AK, r.areaShards) // Убираем "AREA#" и номер шарда
+	} else {
+		// Пока ключи переписываются, часть рёбер ещё в старой раскладке
+		edge.Area = edge.StoredArea(dto.AK, r.areaShards, r.previousAreaShards)
+	}
+	return edge
 }
 
+// Repository stores every edge as one item of its demand partition,
+// supply edges are read from sk-gsi and area edges from ak-gsi.
+//
+// Edges are written in transactions that keep the edge counters of areas
+// and nodes, see CountersTableName. Edges deleted by TTL bypass them,
+// Reconcile corrects the drift.
 type Repository struct {
-	client *dynamodb.Client
+	client             *dynamodb.Client
+	counters           *graphdb.EdgeCounters
+	areaShards         int
+	previousAreaShards int
+	rules              graph.Rules
 }
 
-func New(client *dynamodb.Client) *Repository {
-	return &Repository{client: client}
+type Option func(*Repository)
+
+// WithAreaShards spreads the area key of ak-gsi across n shards
+// (AREA#city#00 .. AREA#city#{n-1}) to avoid a hot partition per area.
+// n <= 1 keeps a single AREA#city key.
+func WithAreaShards(n int) Option {
+	return func(r *Repository) {
+		r.areaShards = n
+	}
 }
 
-func (r *Repository) Size(ctx context.Context) int {
-	out, err := r.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
-		TableName: aws.String(TableName),
-	})
-	if err != nil || out.Table == nil || out.Table.ItemCount == nil {
-		return 0
+// WithPreviousAreaShards tells that the area keys are moving from n
+// shards to the count of WithAreaShards and ShardAreaKeys has not
+// rewritten them all yet: area reads query the keys of both layouts.
+// n = 1 stands for unsharded keys, n = 0 for no move.
+func WithPreviousAreaShards(n int) Option {
+	return func(r *Repository) {
+		r.previousAreaShards = n
+	}
+}
+
+func New(client *dynamodb.Client, opts ...Option) *Repository {
+	r := &Repository{
+		client:   client,
+		counters: graphdb.NewEdgeCounters(client, CountersTableName),
+		rules:    graph.DefaultRules(),
 	}
-	return int(*out.Table.ItemCount)
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Size returns the number of edges, the sum of the area counters.
+func (r *Repository) Size(ctx context.Context) (int, error) {
+	return r.counters.Size(ctx)
 }
 
-// UpsertEdges adds or updates edges in the graph.
+// UpsertEdges adds or updates edges in the graph. An edge and the counters
+// it changes are written atomically; a failed transaction leaves its edges
+// unchanged. Nothing is written when an edge breaks the rules, see
+// graphdb.StrategyOptions.
 func (r *Repository) UpsertEdges(ctx context.Context, edges ...graph.Edge) error {
 	if len(edges) == 0 {
 		return nil
 	}
+	if err := r.rules.Validate(edges); err != nil {
+		return err
+	}
+	return graphdb.TransactEdges(ctx, r.client, TableName, dedup(edges), edgesPerTransaction, r.planUpsert(graph.CauseFromContext(ctx)))
+}
 
-	seen := make(map[string]types.WriteRequest, len(edges))
-	for _, dto := range makeDTO(edges...) {
-		av, err := attributevalue.MarshalMap(dto)
-		if err != nil {
-			return fmt.Errorf("failed to marshal edge: %w", err)
-		}
-		av["ttl"] = &types.AttributeValueMemberN{
-			Value: strconv.FormatInt(dto.TTL, 10),
-		}
-		key := dto.PK + "|" + dto.SK
-		seen[key] = types.WriteRequest{
-			PutRequest: &types.PutRequest{Item: av},
+// dedup keeps the last occurrence of every edge: a transaction cannot
+// write the same item twice.
+func dedup(edges []graph.Edge) []graph.Edge {
+	index := make(map[[2]graph.Node]int, len(edges))
+	out := make([]graph.Edge, 0, len(edges))
+	for _, e := range edges {
+		key := [2]graph.Node{e.From, e.To}
+		if i, ok := index[key]; ok {
+			out[i] = e
+			continue
 		}
+		index[key] = len(out)
+		out = append(out, e)
 	}
+	return out
+}
 
-	// convert map to slice
-	writeRequests := make([]types.WriteRequest, 0, len(seen))
-	for _, wr := range seen {
-		writeRequests = append(writeRequests, wr)
-	}
+// ReadDemandEdges retrieves all edges from the demand node with strongly
+// consistent reads of its partition.
+func (r *Repository) ReadDemandEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error) {
+	key := node.Demand()
 
-	var writeErr error
-	for requests := range slices.Chunk(writeRequests, batchSize) {
-		if _, err := r.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
-			RequestItems: map[string][]types.WriteRequest{
-				TableName: requests,
+	var last map[string]types.AttributeValue
+	edges := make([]graph.Edge, 0)
+	for {
+		out, err := r.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(TableName),
+			KeyConditionExpression: aws.String("pk = :pk"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk": &types.AttributeValueMemberS{Value: key},
 			},
-		}); err != nil {
-			writeErr = errors.Join(writeErr, err)
+			ConsistentRead:    aws.Bool(true),
+			ExclusiveStartKey: last,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query edges: %w", err)
 		}
+
+		for _, item := range out.Items {
+			var dto edgeDTO
+
+			if err = attributevalue.UnmarshalMap(item, &dto); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal edge: %w", err)
+			}
+
+			// Извлекаем имена узлов из ключей
+			edges = append(edges, r.edge(dto))
+		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		last = out.LastEvaluatedKey
 	}
-	return writeErr
+	return edges, nil
 }
 
-// ReadDemandEdges retrieves all edges from the demand node.
-func (r *Repository) ReadDemandEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error) {
-	key := node.Demand()
-	queryResult, err := r.client.Query(ctx, &dynamodb.QueryInput{
+// ReadTopDemandEdges retrieves up to n edges from the demand node
+// in descending score order. score-lsi is a local index of the demand
+// partition, so the read is strongly consistent.
+func (r *Repository) ReadTopDemandEdges(ctx context.Context, node graph.Node, n int) ([]graph.Edge, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	out, err := r.client.Query(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(TableName),
+		IndexName:              aws.String("score-lsi"),
 		KeyConditionExpression: aws.String("pk = :pk"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":pk": &types.AttributeValueMemberS{Value: key},
+			":pk": &types.AttributeValueMemberS{Value: node.Demand()},
 		},
+		ConsistentRead:   aws.Bool(true),
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(int32(n)),
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to query edges: %w", err)
+		return nil, fmt.Errorf("failed to query top edges: %w", err)
 	}
 
-	edges := make([]graph.Edge, 0, len(queryResult.Items))
-	for _, item := range queryResult.Items {
+	edges := make([]graph.Edge, 0, len(out.Items))
+	for _, item := range out.Items {
 		var dto edgeDTO
-
-		err = attributevalue.UnmarshalMap(item, &dto)
-		if err != nil {
+		if err = attributevalue.UnmarshalMap(item, &dto); err != nil {
 			return nil, fmt.Errorf("failed to unmarshal edge: %w", err)
 		}
-
-		// Извлекаем имена узлов из ключей
-		edges = append(edges, graph.Edge{
-			From:  parseDemand(dto.PK),
-			To:    parseSupply(dto.SK),
-			Area:  parseArea(dto.AK),
-			Score: graph.Score(dto.Score),
-		})
+		edges = append(edges, r.edge(dto))
 	}
 	return edges, nil
 }
@@ -162,12 +241,7 @@ func (r *Repository) ReadSupplyEdges(ctx context.Context, node graph.Node) ([]gr
 				return nil, fmt.Errorf("failed to unmarshal edge: %w", err)
 			}
 
-			edges = append(edges, graph.Edge{
-				From:  parseSupply(dto.PK),
-				To:    parseDemand(dto.SK),
-				Area:  parseArea(dto.AK),
-				Score: graph.Score(dto.Score),
-			})
+			edges = append(edges, r.edge(dto))
 		}
 
 		if out.LastEvaluatedKey == nil || len(out.LastEvaluatedKey) == 0 {
@@ -179,9 +253,63 @@ func (r *Repository) ReadSupplyEdges(ctx context.Context, node graph.Node) ([]gr
 }
 
 // ReadAreaEdges retrieves all edges associated with a specific area.
+// With a sharded area index all shards are queried in parallel and merged.
+// While the area keys move to another shard count, see
+// WithPreviousAreaShards, the keys of both layouts are queried.
 func (r *Repository) ReadAreaEdges(ctx context.Context, area graph.Area) ([]graph.Edge, error) {
-	key := area.Area()
+	keys := areaKeys(area, r.areaShards)
+	if r.previousAreaShards > 0 {
+		for _, key := range areaKeys(area, r.previousAreaShards) {
+			if !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	if len(keys) == 1 {
+		return r.readAreaKey(ctx, keys[0])
+	}
+
+	var (
+		wg      sync.WaitGroup
+		results = make([][]graph.Edge, len(keys))
+		errs    = make([]error, len(keys))
+	)
+	for i, key := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = r.readAreaKey(ctx, key)
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	edges := make([]graph.Edge, 0)
+	for _, keyEdges := range results {
+		edges = append(edges, keyEdges...)
+	}
+	if r.previousAreaShards > 0 {
+		// Ребро, переписанное во время чтения, индекс может отдать по обоим ключам
+		edges = dedup(edges)
+	}
+	return edges, nil
+}
 
+// areaKeys returns the keys of the area in the layout of shards shards.
+func areaKeys(area graph.Area, shards int) []string {
+	if shards <= 1 {
+		return []string{area.Area()}
+	}
+	keys := make([]string, 0, shards)
+	for shard := range shards {
+		keys = append(keys, area.Shard(shard))
+	}
+	return keys
+}
+
+func (r *Repository) readAreaKey(ctx context.Context, key string) ([]graph.Edge, error) {
 	var last map[string]types.AttributeValue
 	edges := make([]graph.Edge, 0)
 
@@ -206,12 +334,7 @@ func (r *Repository) ReadAreaEdges(ctx context.Context, area graph.Area) ([]grap
 			if err = attributevalue.UnmarshalMap(item, &dto); err != nil {
 				return nil, fmt.Errorf("failed to unmarshal edge: %w", err)
 			}
-			edges = append(edges, graph.Edge{
-				From:  parseDemand(dto.PK),
-				To:    parseSupply(dto.SK),
-				Area:  parseArea(dto.AK),
-				Score: graph.Score(dto.Score),
-			})
+			edges = append(edges, r.edge(dto))
 		}
 
 		if out.LastEvaluatedKey == nil || len(out.LastEvaluatedKey) == 0 {
@@ -228,41 +351,11 @@ func (r *Repository) RemoveEdges(ctx context.Context, edges ...graph.Edge) error
 	if len(edges) == 0 {
 		return nil
 	}
-
-	seen := make(map[string]types.WriteRequest, len(edges))
-	for _, dto := range makeDTO(edges...) {
-		key := dto.PK + "|" + dto.SK
-		seen[key] = types.WriteRequest{
-			DeleteRequest: &types.DeleteRequest{
-				Key: map[string]types.AttributeValue{
-					"pk": &types.AttributeValueMemberS{
-						Value: dto.PK,
-					},
-					"sk": &types.AttributeValueMemberS{
-						Value: dto.SK,
-					},
-				},
-			},
-		}
-	}
-	writeRequests := make([]types.WriteRequest, 0, len(seen))
-	for _, edge := range seen {
-		writeRequests = append(writeRequests, types.WriteRequest{
-			DeleteRequest: edge.DeleteRequest,
-		})
+	if err := graph.ValidateKeys(edges); err != nil {
+		return err
 	}
 
-	var deleteErr error
-	for requests := range slices.Chunk(writeRequests, batchSize) {
-		if _, err := r.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
-			RequestItems: map[string][]types.WriteRequest{
-				TableName: requests,
-			},
-		}); err != nil {
-			deleteErr = errors.Join(deleteErr, err)
-		}
-	}
-	return deleteErr
+	return graphdb.TransactEdges(ctx, r.client, TableName, dedup(edges), edgesPerTransaction, r.planRemove)
 }
 
 // RemoveNodeEdges removes all edges associated with a specific node.
@@ -291,7 +384,8 @@ func (r *Repository) RemoveNodeEdges(ctx context.Context, node graph.Node) error
 }
 
 // RemoveDemandEdges удаляет все исходящие рёбра узла (pk = DEMAND#...).
-// Делает Query только по ключам (pk, sk) и батчевое удаление.
+// Делает Query только по ключам (pk, sk) и удаляет страницу транзакциями
+// вместе со счётчиками.
 func (r *Repository) RemoveDemandEdges(ctx context.Context, node graph.Node) error {
 	pk := node.Demand()
 	var last map[string]types.AttributeValue
@@ -315,28 +409,14 @@ func (r *Repository) RemoveDemandEdges(ctx context.Context, node graph.Node) err
 			}
 		}
 
-		writeBatch := make([]types.WriteRequest, 0, len(out.Items))
+		edges := make([]graph.Edge, 0, len(out.Items))
 		for _, item := range out.Items {
 			pkAttr := item["pk"].(*types.AttributeValueMemberS).Value
 			skAttr := item["sk"].(*types.AttributeValueMemberS).Value
-			writeBatch = append(writeBatch, types.WriteRequest{
-				DeleteRequest: &types.DeleteRequest{
-					Key: map[string]types.AttributeValue{
-						"pk": &types.AttributeValueMemberS{Value: pkAttr},
-						"sk": &types.AttributeValueMemberS{Value: skAttr},
-					},
-				},
-			})
+			edges = append(edges, graph.Edge{From: parseDemand(pkAttr), To: parseSupply(skAttr)})
 		}
-
-		for requests := range slices.Chunk(writeBatch, batchSize) {
-			if _, err = r.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
-				RequestItems: map[string][]types.WriteRequest{
-					TableName: requests,
-				},
-			}); err != nil {
-				removeErr = errors.Join(removeErr, err)
-			}
+		if err = graphdb.TransactEdges(ctx, r.client, TableName, edges, edgesPerTransaction, r.planRemove); err != nil {
+			removeErr = errors.Join(removeErr, err)
 		}
 		if len(out.LastEvaluatedKey) == 0 {
 			break
@@ -350,14 +430,14 @@ func (r *Repository) RemoveDemandEdges(ctx context.Context, node graph.Node) err
 	return nil
 }
 
-func makeDTO(edges ...graph.Edge) []edgeDTO {
+func (r *Repository) makeDTO(edges ...graph.Edge) []edgeDTO {
 	items := make([]edgeDTO, 0, len(edges))
 	for _, edge := range edges {
 		ttl := time.Now().UTC().Add(edge.TTL).Unix()
 		dto := edgeDTO{
 			PK:    edge.Demand(),
 			SK:    edge.Supply(),
-			AK:    edge.Area.Area(),
+			AK:    edge.AreaKey(r.areaShards),
 			Score: edge.Score.Float64(),
 			TTL:   ttl,
 		}
@@ -0,0 +1,31 @@
+package adjacency_lists_with_gsi_for_reverse_lookup
+
+import (
+	graphdb "github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/migrate"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// StrategyName is the name the strategy is registered under.
+const StrategyName = "adjacency-lists-with-gsi-for-reverse-lookup"
+
+func init() {
+	graphdb.RegisterStrategy(graphdb.Strategy{
+		Name:     StrategyName,
+		Counters: true,
+		New: func(client *dynamodb.Client, opts graphdb.StrategyOptions) graphdb.GraphRepository {
+			r := New(client, WithAreaShards(opts.AreaShards), WithPreviousAreaShards(opts.PreviousAreaShards))
+			r.rules = opts.Rules
+			return r
+		},
+		Migrations: func(opts graphdb.StrategyOptions) []graphdb.Migration {
+			return []graphdb.Migration{
+				&migrate.CreateAdjacencyListsTableWithGSI{},
+				&migrate.AddScoreIndexForTopDemandEdges{},
+				&migrate.EnableGraphTableStream{},
+				&migrate.CreateGSIEdgeCountersTable{},
+			}
+		},
+	})
+}
@@ -0,0 +1,672 @@
+package area_partitioned_packed_adjacency
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	TableName = "graph_packed_area_tbl"
+
+	// Предел элемента 400 KB, оставляем запас на неточность оценки размера
+	defaultPageSize = 350 * 1024
+	// Оценка элемента карты: имя узла + {"s": N, "t": N} с накладными расходами
+	neighbourOverhead = 48
+	pageOverhead      = 128
+
+	maxAttempts     = 8
+	parallelUpdates = 16
+)
+
+type neighbourDTO struct {
+	Score float64 `dynamodbav:"s"` // score of the edge
+	TTL   int64   `dynamodbav:"t"` // expiry of the edge (epoch time in seconds)
+}
+
+// pageDTO packs the neighbours of one node in one area. Demand pages
+// carry the area key and hold supplies, supply pages hold demands and
+// have no area key, so ak-gsi sees every edge once. A page that would
+// outgrow the item size limit spills into the next page of the area.
+type pageDTO struct {
+	PK    string                  `dynamodbav:"pk"`           // DEMAND#{Node} или SUPPLY#{Node}
+	SK    string                  `dynamodbav:"sk"`           // AREA#{AreaName}#PAGE#{Page}
+	AK    string                  `dynamodbav:"ak,omitempty"` // AREA#{AreaName} или AREA#{AreaName}#{Shard}
+	Area  string                  `dynamodbav:"area"`
+	Page  int                     `dynamodbav:"page"`
+	Nodes map[string]neighbourDTO `dynamodbav:"nodes"`
+	// Version guards read-modify-write cycles of concurrent writers
+	Version int64 `dynamodbav:"version"`
+	// TTL is the latest expiry of the neighbours, the page expires with the last edge
+	TTL   int64  `dynamodbav:"ttl"`
+	Cause string `dynamodbav:"cause,omitempty"` // who wrote the page last, see graph.WithCause
+}
+
+func pageKey(area graph.Area, page int) string {
+	return fmt.Sprintf("%s#PAGE#%02d", area.Area(), page)
+}
+
+// edges unpacks the neighbours of the page. Like the edge items of the
+// other strategies, expired neighbours are returned until they are gone.
+func (p pageDTO) edges() []graph.Edge {
+	node := graph.Node(strings.TrimPrefix(p.PK, "DEMAND#"))
+	reverse := strings.HasPrefix(p.PK, "SUPPLY#")
+	if reverse {
+		node = graph.Node(strings.TrimPrefix(p.PK, "SUPPLY#"))
+	}
+
+	edges := make([]graph.Edge, 0, len(p.Nodes))
+	for id, n := range p.Nodes {
+		edge := graph.Edge{
+			From:      node,
+			To:        graph.Node(id),
+			Area:      graph.Area(p.Area),
+			Score:     graph.Score(n.Score),
+			ExpiresAt: time.Unix(n.TTL, 0).UTC(),
+		}
+		if reverse {
+			edge.From, edge.To = edge.To, edge.From
+		}
+		edges = append(edges, edge)
+	}
+	return edges
+}
+
+// Repository packs the adjacency of every node into a few large items:
+// one page per demand per area with the supplies and scores in a map
+// attribute, and the same for supplies in the reverse direction.
+// ReadAreaEdges reads whole pages from ak-gsi instead of one item per edge.
+//
+// Pages are rewritten with a read-modify-write cycle guarded by their
+// version, conflicting writers re-read and retry. The demand and the
+// supply side of an edge are updated one after another, not atomically.
+type Repository struct {
+	client     *dynamodb.Client
+	areaShards int
+	pageSize   int
+	rules      graph.Rules
+}
+
+type Option func(*Repository)
+
+// WithAreaShards spreads the demand pages of an area across n shards of
+// ak-gsi, picked by a hash of the demand. n <= 1 keeps a single AREA#city key.
+func WithAreaShards(n int) Option {
+	return func(r *Repository) {
+		r.areaShards = n
+	}
+}
+
+// WithPageSize sets the estimated page size, in bytes, at which new
+// neighbours spill into an overflow page.
+func WithPageSize(bytes int) Option {
+	return func(r *Repository) {
+		r.pageSize = bytes
+	}
+}
+
+func New(client *dynamodb.Client, opts ...Option) *Repository {
+	r := &Repository{client: client, pageSize: defaultPageSize, rules: graph.DefaultRules()}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Size returns the number of edges. Pages hold many edges, so the
+// item count tells nothing and the demand pages are scanned.
+func (r *Repository) Size(ctx context.Context) (int, error) {
+	size := 0
+	paginator := dynamodb.NewScanPaginator(r.client, &dynamodb.ScanInput{
+		TableName:        aws.String(TableName),
+		FilterExpression: aws.String("begins_with(pk, :demand)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":demand": &types.AttributeValueMemberS{Value: "DEMAND#"},
+		},
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, err
+		}
+		pages, err := unmarshalPages(out.Items)
+		if err != nil {
+			return 0, err
+		}
+		for _, p := range pages {
+			size += len(p.edges())
+		}
+	}
+	return size, nil
+}
+
+// change sets a neighbour of a node, or removes it when value is nil.
+type change struct {
+	edge  graph.Edge
+	area  graph.Area
+	value *neighbourDTO
+}
+
+// UpsertEdges adds or updates edges in the graph. An edge that moves to
+// another area leaves the pages of the old area. Nothing is written when
+// an edge breaks the rules, see graphdb.StrategyOptions.
+func (r *Repository) UpsertEdges(ctx context.Context, edges ...graph.Edge) error {
+	if len(edges) == 0 {
+		return nil
+	}
+	if err := r.rules.Validate(edges); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	return r.updateAll(ctx, groupChanges(edges, func(e graph.Edge) *neighbourDTO {
+		return &neighbourDTO{
+			Score: e.Score.Float64(),
+			TTL:   now.Add(e.TTL).Unix(),
+		}
+	}))
+}
+
+// RemoveEdges removes specific edges from the graph, whatever area they are in.
+func (r *Repository) RemoveEdges(ctx context.Context, edges ...graph.Edge) error {
+	if len(edges) == 0 {
+		return nil
+	}
+	if err := graph.ValidateKeys(edges); err != nil {
+		return err
+	}
+	return r.updateAll(ctx, groupChanges(edges, func(graph.Edge) *neighbourDTO {
+		return nil
+	}))
+}
+
+// groupChanges groups the edges by the node partitions they touch: every
+// edge is a neighbour of its demand and of its supply. The last
+// occurrence of an edge wins.
+func groupChanges(edges []graph.Edge, value func(graph.Edge) *neighbourDTO) map[string]map[string]change {
+	out := make(map[string]map[string]change)
+	add := func(pk, neighbour string, c change) {
+		if out[pk] == nil {
+			out[pk] = make(map[string]change)
+		}
+		out[pk][neighbour] = c
+	}
+	for _, e := range edges {
+		c := change{edge: e, area: e.Area, value: value(e)}
+		add(e.Demand(), e.To.String(), c)
+		add(e.Supply(), e.From.String(), c)
+	}
+	return out
+}
+
+// updateAll applies the changes of every node partition. Partitions are
+// independent, so they are updated in parallel. An edge fails when either
+// of its partitions does, see graph.WriteError.
+func (r *Repository) updateAll(ctx context.Context, changes map[string]map[string]change) error {
+	var (
+		mu   sync.Mutex
+		errs = make(map[string]error)
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, parallelUpdates)
+	)
+	cause := graph.CauseFromContext(ctx)
+	for _, pk := range slices.Sorted(maps.Keys(changes)) {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := r.update(ctx, pk, changes[pk], cause); err != nil {
+				mu.Lock()
+				errs[pk] = err
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	edges := make(map[[2]graph.Node]struct{})
+	failed := make(map[[2]graph.Node]graph.EdgeError)
+	for _, pk := range slices.Sorted(maps.Keys(changes)) {
+		for _, c := range changes[pk] {
+			key := [2]graph.Node{c.edge.From, c.edge.To}
+			edges[key] = struct{}{}
+			if _, ok := failed[key]; !ok && errs[pk] != nil {
+				failed[key] = graph.EdgeError{Edge: c.edge, Err: errs[pk]}
+			}
+		}
+	}
+	return graph.WriteError(len(edges), slices.SortedFunc(maps.Values(failed), compareEdgeErrors))
+}
+
+func compareEdgeErrors(a, b graph.EdgeError) int {
+	if c := cmp.Compare(a.Edge.From, b.Edge.From); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Edge.To, b.Edge.To)
+}
+
+// update rewrites the pages of one node. A conditional check failure
+// means another writer changed a page since it was read: the pages are
+// read again and the changes replanned.
+func (r *Repository) update(ctx context.Context, pk string, changes map[string]change, cause string) error {
+	var err error
+	for attempt := range maxAttempts {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt*attempt) * 10 * time.Millisecond):
+			}
+		}
+
+		var pages []pageDTO
+		pages, err = r.readPages(ctx, pk)
+		if err != nil {
+			return err
+		}
+		err = r.apply(ctx, r.plan(pk, pages, changes, cause))
+
+		var conditionErr *types.ConditionalCheckFailedException
+		if !errors.As(err, &conditionErr) {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to update %s after %d attempts: %w", pk, maxAttempts, err)
+}
+
+// write is a page to put or delete. Pages that were read are conditioned
+// on their version, new pages on not existing yet.
+type write struct {
+	page    pageDTO
+	version int64
+	exists  bool
+	delete  bool
+}
+
+// pageState tracks a page while the changes are planned.
+type pageState struct {
+	page          *pageDTO
+	version, size int64
+	exists, dirty bool
+}
+
+// plan applies the changes to the pages read and returns the pages to write.
+func (r *Repository) plan(pk string, pages []pageDTO, changes map[string]change, cause string) []write {
+	now := time.Now().Unix()
+
+	all := make([]*pageState, 0, len(pages))
+	for i := range pages {
+		p := &pages[i]
+		// TTL не удаляет элементы карты: истёкшие соседи уходят
+		// при перезаписи страницы, иначе они занимали бы место
+		maps.DeleteFunc(p.Nodes, func(_ string, n neighbourDTO) bool {
+			return n.TTL < now
+		})
+		if p.Nodes == nil {
+			p.Nodes = make(map[string]neighbourDTO)
+		}
+		all = append(all, &pageState{page: p, version: p.Version, size: estimateSize(*p), exists: true})
+	}
+
+	for _, neighbour := range slices.Sorted(maps.Keys(changes)) {
+		c := changes[neighbour]
+		var target *pageState
+		for _, s := range all {
+			if _, ok := s.page.Nodes[neighbour]; !ok {
+				continue
+			}
+			if c.value != nil && graph.Area(s.page.Area) == c.area {
+				target = s
+				continue
+			}
+			delete(s.page.Nodes, neighbour)
+			s.size -= int64(len(neighbour) + neighbourOverhead)
+			s.dirty = true
+		}
+		if c.value == nil {
+			continue
+		}
+
+		if target == nil {
+			target = r.pageWithRoom(all, c.area, neighbour)
+			if target == nil {
+				page := 0
+				for _, s := range all {
+					if graph.Area(s.page.Area) == c.area {
+						page = max(page, s.page.Page+1)
+					}
+				}
+				p := &pageDTO{
+					PK:    pk,
+					SK:    pageKey(c.area, page),
+					Area:  string(c.area),
+					Page:  page,
+					Nodes: make(map[string]neighbourDTO),
+				}
+				target = &pageState{page: p, size: estimateSize(*p)}
+				all = append(all, target)
+			}
+			target.size += int64(len(neighbour) + neighbourOverhead)
+		}
+		target.page.Nodes[neighbour] = *c.value
+		target.dirty = true
+	}
+
+	writes := make([]write, 0)
+	for _, s := range all {
+		if !s.dirty {
+			continue
+		}
+		if len(s.page.Nodes) == 0 {
+			if s.exists {
+				writes = append(writes, write{page: *s.page, version: s.version, exists: true, delete: true})
+			}
+			continue
+		}
+		p := *s.page
+		p.Version = s.version + 1
+		p.Cause = cause
+		p.TTL = 0
+		for _, n := range p.Nodes {
+			p.TTL = max(p.TTL, n.TTL)
+		}
+		if strings.HasPrefix(pk, "DEMAND#") {
+			p.AK = r.areaKey(graph.Area(p.Area), pk)
+		}
+		writes = append(writes, write{page: p, version: s.version, exists: s.exists})
+	}
+	// Сначала записываем страницы, затем удаляем опустевшие: при сбое
+	// между ними ребро окажется в двух областях, но не потеряется
+	slices.SortStableFunc(writes, func(a, b write) int {
+		switch {
+		case a.delete == b.delete:
+			return 0
+		case b.delete:
+			return -1
+		default:
+			return 1
+		}
+	})
+	return writes
+}
+
+// pageWithRoom picks the first page of the area the neighbour fits in.
+func (r *Repository) pageWithRoom(all []*pageState, area graph.Area, neighbour string) *pageState {
+	for _, s := range all {
+		if graph.Area(s.page.Area) == area && s.size+int64(len(neighbour)+neighbourOverhead) <= int64(r.pageSize) {
+			return s
+		}
+	}
+	return nil
+}
+
+func (r *Repository) apply(ctx context.Context, writes []write) error {
+	for _, w := range writes {
+		if w.delete {
+			_, err := r.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+				TableName: aws.String(TableName),
+				Key: map[string]types.AttributeValue{
+					"pk": &types.AttributeValueMemberS{Value: w.page.PK},
+					"sk": &types.AttributeValueMemberS{Value: w.page.SK},
+				},
+				ConditionExpression: aws.String("version = :v"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":v": &types.AttributeValueMemberN{Value: fmt.Sprint(w.version)},
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("failed to delete page %s %s: %w", w.page.PK, w.page.SK, err)
+			}
+			continue
+		}
+
+		av, err := attributevalue.MarshalMap(w.page)
+		if err != nil {
+			return fmt.Errorf("failed to marshal page: %w", err)
+		}
+		input := &dynamodb.PutItemInput{
+			TableName:           aws.String(TableName),
+			Item:                av,
+			ConditionExpression: aws.String("attribute_not_exists(pk)"),
+		}
+		if w.exists {
+			input.ConditionExpression = aws.String("version = :v")
+			input.ExpressionAttributeValues = map[string]types.AttributeValue{
+				":v": &types.AttributeValueMemberN{Value: fmt.Sprint(w.version)},
+			}
+		}
+		if _, err = r.client.PutItem(ctx, input); err != nil {
+			return fmt.Errorf("failed to put page %s %s: %w", w.page.PK, w.page.SK, err)
+		}
+	}
+	return nil
+}
+
+// ReadDemandEdges retrieves all edges from the demand node.
+func (r *Repository) ReadDemandEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error) {
+	edges, err := r.readNode(ctx, node.Demand())
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(edges, func(a, b graph.Edge) int {
+		return strings.Compare(a.To.String(), b.To.String())
+	})
+	return edges, nil
+}
+
+// ReadTopDemandEdges retrieves up to n edges from the demand node
+// in descending score order. All pages of the node are read and sorted.
+func (r *Repository) ReadTopDemandEdges(ctx context.Context, node graph.Node, n int) ([]graph.Edge, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	edges, err := r.ReadDemandEdges(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(edges, func(a, b graph.Edge) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		default:
+			return 0
+		}
+	})
+	return edges[:min(n, len(edges))], nil
+}
+
+// ReadSupplyEdges retrieves all edges directed to the supply node.
+func (r *Repository) ReadSupplyEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error) {
+	edges, err := r.readNode(ctx, node.Supply())
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(edges, func(a, b graph.Edge) int {
+		return strings.Compare(a.From.String(), b.From.String())
+	})
+	return edges, nil
+}
+
+func (r *Repository) readNode(ctx context.Context, pk string) ([]graph.Edge, error) {
+	pages, err := r.readPages(ctx, pk)
+	if err != nil {
+		return nil, err
+	}
+	edges := make([]graph.Edge, 0)
+	for _, p := range pages {
+		edges = append(edges, p.edges()...)
+	}
+	return edges, nil
+}
+
+// readPages reads all pages of a node with a strongly consistent query,
+// the versions it returns are the ones conditional writes check.
+func (r *Repository) readPages(ctx context.Context, pk string) ([]pageDTO, error) {
+	var last map[string]types.AttributeValue
+	pages := make([]pageDTO, 0)
+	for {
+		out, err := r.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(TableName),
+			KeyConditionExpression: aws.String("pk = :pk"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk": &types.AttributeValueMemberS{Value: pk},
+			},
+			ConsistentRead:    aws.Bool(true),
+			ExclusiveStartKey: last,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query pages: %w", err)
+		}
+		page, err := unmarshalPages(out.Items)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			return pages, nil
+		}
+		last = out.LastEvaluatedKey
+	}
+}
+
+// ReadAreaEdges retrieves all edges associated with a specific area.
+// With a sharded area index all shards are queried in parallel and merged.
+func (r *Repository) ReadAreaEdges(ctx context.Context, area graph.Area) ([]graph.Edge, error) {
+	if r.areaShards <= 1 {
+		return r.readAreaKey(ctx, area.Area())
+	}
+
+	var (
+		wg      sync.WaitGroup
+		results = make([][]graph.Edge, r.areaShards)
+		errs    = make([]error, r.areaShards)
+	)
+	for shard := range r.areaShards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[shard], errs[shard] = r.readAreaKey(ctx, area.Shard(shard))
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	edges := make([]graph.Edge, 0)
+	for _, shardEdges := range results {
+		edges = append(edges, shardEdges...)
+	}
+	return edges, nil
+}
+
+func (r *Repository) readAreaKey(ctx context.Context, key string) ([]graph.Edge, error) {
+	var last map[string]types.AttributeValue
+	edges := make([]graph.Edge, 0)
+	for {
+		out, err := r.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(TableName),
+			IndexName:              aws.String("ak-gsi"),
+			KeyConditionExpression: aws.String("ak = :ak"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":ak": &types.AttributeValueMemberS{Value: key},
+			},
+			ExclusiveStartKey: last,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query edges by area: %w", err)
+		}
+		pages, err := unmarshalPages(out.Items)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pages {
+			edges = append(edges, p.edges()...)
+		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			return edges, nil
+		}
+		last = out.LastEvaluatedKey
+	}
+}
+
+// RemoveNodeEdges removes all edges associated with a specific node.
+func (r *Repository) RemoveNodeEdges(ctx context.Context, node graph.Node) error {
+	outEdges, err := r.ReadDemandEdges(ctx, node)
+	if err != nil {
+		return fmt.Errorf("failed to query node edges: %w", err)
+	}
+	inEdges, err := r.ReadSupplyEdges(ctx, node)
+	if err != nil {
+		return fmt.Errorf("failed to query node edges: %w", err)
+	}
+	if err = r.RemoveEdges(ctx, append(outEdges, inEdges...)...); err != nil {
+		return fmt.Errorf("failed to remove node edges: %w", err)
+	}
+	return nil
+}
+
+// RemoveDemandEdges удаляет все исходящие рёбра узла вместе с их
+// записями на страницах предложений.
+func (r *Repository) RemoveDemandEdges(ctx context.Context, node graph.Node) error {
+	edges, err := r.ReadDemandEdges(ctx, node)
+	if err != nil {
+		return fmt.Errorf("query out-edges: %w", err)
+	}
+	if err = r.RemoveEdges(ctx, edges...); err != nil {
+		return fmt.Errorf("remove out-edges: %w", err)
+	}
+	return nil
+}
+
+// areaKey returns the ak-gsi key of a demand page. All pages of a demand
+// in an area share the shard, so rewriting a page never moves it.
+func (r *Repository) areaKey(area graph.Area, pk string) string {
+	if r.areaShards <= 1 {
+		return area.Area()
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(pk))
+	return area.Shard(int(h.Sum32() % uint32(r.areaShards)))
+}
+
+// estimateSize approximates the DynamoDB item size of the page.
+func estimateSize(p pageDTO) int64 {
+	size := int64(pageOverhead + len(p.PK) + len(p.SK) + len(p.AK) + len(p.Area) + len(p.Cause))
+	for id := range p.Nodes {
+		size += int64(len(id) + neighbourOverhead)
+	}
+	return size
+}
+
+func unmarshalPages(items []map[string]types.AttributeValue) ([]pageDTO, error) {
+	pages := make([]pageDTO, 0, len(items))
+	for _, item := range items {
+		var dto pageDTO
+		if err := attributevalue.UnmarshalMap(item, &dto); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal page: %w", err)
+		}
+		pages = append(pages, dto)
+	}
+	return pages, nil
+}
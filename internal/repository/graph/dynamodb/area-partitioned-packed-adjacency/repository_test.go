@@ -0,0 +1,113 @@
+package area_partitioned_packed_adjacency
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/strategytest"
+)
+
+func TestRepository(t *testing.T) {
+	strategy, err := dynamodb.LookupStrategy(StrategyName)
+	require.NoError(t, err)
+	strategytest.Run(t, strategy)
+}
+
+func TestRepository_OverflowPages(t *testing.T) {
+	t.Run("Spill neighbours into overflow pages", func(t *testing.T) {
+		db, err := dynamodb.NewTestDatabase()
+		assert.NoError(t, err)
+
+		err = db.Migrate(context.Background())
+		assert.NoError(t, err)
+
+		defer db.Rollback(context.Background())
+
+		// Страница вмещает всего несколько соседей
+		repo := New(db.Client, WithPageSize(512))
+
+		edges := make([]graph.Edge, 0, 40)
+		for i := range 40 {
+			edges = append(edges, graph.Edge{
+				From:  "A",
+				To:    graph.Node("S" + strconv.Itoa(i)),
+				Area:  "Area1",
+				Score: graph.Score(i),
+				TTL:   24 * time.Hour,
+			})
+		}
+		err = repo.UpsertEdges(context.Background(), edges...)
+		assert.NoError(t, err)
+
+		pages, err := repo.readPages(context.Background(), graph.Node("A").Demand())
+		assert.NoError(t, err)
+		assert.Greater(t, len(pages), 1)
+		for _, p := range pages {
+			assert.LessOrEqual(t, estimateSize(p), int64(512))
+		}
+
+		retrievedEdges, err := repo.ReadAreaEdges(context.Background(), "Area1")
+		assert.NoError(t, err)
+		assert.Len(t, retrievedEdges, 40)
+
+		top, err := repo.ReadTopDemandEdges(context.Background(), "A", 3)
+		assert.NoError(t, err)
+		assert.Len(t, top, 3)
+		assert.Equal(t, graph.Node("S39"), top[0].To)
+
+		// Опустевшие страницы удаляются
+		err = repo.RemoveDemandEdges(context.Background(), "A")
+		assert.NoError(t, err)
+
+		pages, err = repo.readPages(context.Background(), graph.Node("A").Demand())
+		assert.NoError(t, err)
+		assert.Len(t, pages, 0)
+	})
+}
+
+func TestRepository_ConcurrentUpserts(t *testing.T) {
+	t.Run("Concurrent writers of one node keep every edge", func(t *testing.T) {
+		db, err := dynamodb.NewTestDatabase()
+		assert.NoError(t, err)
+
+		err = db.Migrate(context.Background())
+		assert.NoError(t, err)
+
+		defer db.Rollback(context.Background())
+
+		repo := New(db.Client)
+
+		const writers = 8
+		var wg sync.WaitGroup
+		errs := make([]error, writers)
+		for i := range writers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = repo.UpsertEdges(context.Background(), graph.Edge{
+					From:  "A",
+					To:    graph.Node("S" + strconv.Itoa(i)),
+					Area:  "Area1",
+					Score: graph.Score(i),
+					TTL:   24 * time.Hour,
+				})
+			}()
+		}
+		wg.Wait()
+		for _, err := range errs {
+			assert.NoError(t, err)
+		}
+
+		retrievedEdges, err := repo.ReadDemandEdges(context.Background(), "A")
+		assert.NoError(t, err)
+		assert.Len(t, retrievedEdges, writers)
+	})
+}
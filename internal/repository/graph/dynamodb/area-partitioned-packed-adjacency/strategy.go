@@ -0,0 +1,27 @@
+package area_partitioned_packed_adjacency
+
+import (
+	graphdb "github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/migrate"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// StrategyName is the name the strategy is registered under.
+const StrategyName = "area-partitioned-packed-adjacency"
+
+func init() {
+	graphdb.RegisterStrategy(graphdb.Strategy{
+		Name: StrategyName,
+		New: func(client *dynamodb.Client, opts graphdb.StrategyOptions) graphdb.GraphRepository {
+			r := New(client, WithAreaShards(opts.AreaShards))
+			r.rules = opts.Rules
+			return r
+		},
+		Migrations: func(opts graphdb.StrategyOptions) []graphdb.Migration {
+			return []graphdb.Migration{
+				&migrate.CreatePackedAreaTable{},
+			}
+		},
+	})
+}
@@ -0,0 +1,292 @@
+package dynamodb
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// CapacityKey is what consumed capacity is accounted by.
+// Index is empty for the base table.
+type CapacityKey struct {
+	Operation string `json:"operation"`
+	Table     string `json:"table"`
+	Index     string `json:"index,omitempty"`
+}
+
+// CapacityUsage is the capacity consumed under one key.
+type CapacityUsage struct {
+	CapacityKey
+	Calls int     `json:"calls"`
+	RCU   float64 `json:"rcu"`
+	WCU   float64 `json:"wcu"`
+}
+
+// CapacityMeter asks DynamoDB to return consumed capacity on every call
+// and sums it up. It also counts throttled attempts, including the ones
+// the SDK retried successfully.
+type CapacityMeter struct {
+	mu        sync.Mutex
+	usage     map[CapacityKey]*CapacityUsage
+	throttles map[string]int
+
+	metrics CapacityMetrics
+}
+
+// CapacityMetrics receives the capacity of every DynamoDB call, one
+// usage per table and index, and every throttled attempt. ctx is the
+// context of the call, so the cause of the write (see graph.WithCause)
+// can be read from it.
+type CapacityMetrics interface {
+	ObserveCapacity(ctx context.Context, usage CapacityUsage)
+	ObserveThrottle(ctx context.Context, operation string)
+}
+
+type CapacityMeterOption func(*CapacityMeter)
+
+// WithCapacityMetrics passes the capacity of every call on to metrics.
+// It must be safe for concurrent use.
+func WithCapacityMetrics(metrics CapacityMetrics) CapacityMeterOption {
+	return func(m *CapacityMeter) {
+		m.metrics = metrics
+	}
+}
+
+func NewCapacityMeter(opts ...CapacityMeterOption) *CapacityMeter {
+	m := &CapacityMeter{
+		usage:     make(map[CapacityKey]*CapacityUsage),
+		throttles: make(map[string]int),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// AddTo makes every DynamoDB client created from cfg report to the meter.
+func (m *CapacityMeter) AddTo(cfg *aws.Config) {
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		err := stack.Initialize.Add(middleware.InitializeMiddlewareFunc(
+			"ConsumedCapacity",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+				middleware.InitializeOutput, middleware.Metadata, error,
+			) {
+				requestCapacity(in.Parameters)
+				out, metadata, err := next.HandleInitialize(ctx, in)
+				if err == nil {
+					m.record(ctx, awsmiddleware.GetOperationName(ctx), consumedCapacity(out.Result))
+				}
+				return out, metadata, err
+			},
+		), middleware.After)
+		if err != nil {
+			return err
+		}
+		// После Retry, чтобы видеть каждую попытку
+		return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc(
+			"CountThrottles",
+			func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (
+				middleware.FinalizeOutput, middleware.Metadata, error,
+			) {
+				out, metadata, err := next.HandleFinalize(ctx, in)
+				if IsThrottle(err) {
+					m.throttled(ctx, awsmiddleware.GetOperationName(ctx))
+				}
+				return out, metadata, err
+			},
+		), "Retry", middleware.After)
+	})
+}
+
+// Usage returns the consumed capacity ordered by operation, table and index.
+func (m *CapacityMeter) Usage() []CapacityUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage := make([]CapacityUsage, 0, len(m.usage))
+	for _, u := range m.usage {
+		usage = append(usage, *u)
+	}
+	slices.SortFunc(usage, func(a, b CapacityUsage) int {
+		return cmp.Or(
+			cmp.Compare(a.Operation, b.Operation),
+			cmp.Compare(a.Table, b.Table),
+			cmp.Compare(a.Index, b.Index),
+		)
+	})
+	return usage
+}
+
+// Throttles returns the number of throttled attempts by operation.
+func (m *CapacityMeter) Throttles() map[string]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return maps.Clone(m.throttles)
+}
+
+func (m *CapacityMeter) throttled(ctx context.Context, operation string) {
+	m.mu.Lock()
+	m.throttles[operation]++
+	m.mu.Unlock()
+	if m.metrics != nil {
+		m.metrics.ObserveThrottle(ctx, operation)
+	}
+}
+
+// record adds the capacity one call consumed to the totals and passes
+// it on to the metrics and to the hooks of the call context.
+func (m *CapacityMeter) record(ctx context.Context, operation string, consumed []types.ConsumedCapacity) {
+	usage := callUsage(operation, consumed)
+	if len(usage) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	for _, u := range usage {
+		total, ok := m.usage[u.CapacityKey]
+		if !ok {
+			total = &CapacityUsage{CapacityKey: u.CapacityKey}
+			m.usage[u.CapacityKey] = total
+		}
+		total.Calls += u.Calls
+		total.RCU += u.RCU
+		total.WCU += u.WCU
+	}
+	m.mu.Unlock()
+
+	for _, u := range usage {
+		if m.metrics != nil {
+			m.metrics.ObserveCapacity(ctx, u)
+		}
+		for _, hook := range capacityHooks(ctx) {
+			hook(ctx, u)
+		}
+	}
+}
+
+// callUsage splits the capacity of one call by table and index.
+func callUsage(operation string, consumed []types.ConsumedCapacity) []CapacityUsage {
+	read := isRead(operation)
+	usage := make([]CapacityUsage, 0, len(consumed))
+	add := func(key CapacityKey, units, rcu, wcu *float64) {
+		u := CapacityUsage{CapacityKey: key, Calls: 1}
+		switch {
+		case rcu != nil || wcu != nil:
+			u.RCU = aws.ToFloat64(rcu)
+			u.WCU = aws.ToFloat64(wcu)
+		case read:
+			u.RCU = aws.ToFloat64(units)
+		default:
+			u.WCU = aws.ToFloat64(units)
+		}
+		usage = append(usage, u)
+	}
+	for _, c := range consumed {
+		table := aws.ToString(c.TableName)
+		if c.Table != nil {
+			add(CapacityKey{operation, table, ""}, c.Table.CapacityUnits, c.Table.ReadCapacityUnits, c.Table.WriteCapacityUnits)
+		} else {
+			add(CapacityKey{operation, table, ""}, c.CapacityUnits, c.ReadCapacityUnits, c.WriteCapacityUnits)
+		}
+		for index, ic := range c.GlobalSecondaryIndexes {
+			add(CapacityKey{operation, table, index}, ic.CapacityUnits, ic.ReadCapacityUnits, ic.WriteCapacityUnits)
+		}
+		for index, ic := range c.LocalSecondaryIndexes {
+			add(CapacityKey{operation, table, index}, ic.CapacityUnits, ic.ReadCapacityUnits, ic.WriteCapacityUnits)
+		}
+	}
+	return usage
+}
+
+// IsThrottle reports whether err is DynamoDB rejecting a request for capacity.
+func IsThrottle(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "ProvisionedThroughputExceededException", "ThrottlingException", "RequestLimitExceeded":
+		return true
+	}
+	return false
+}
+
+func isRead(operation string) bool {
+	switch operation {
+	case "GetItem", "BatchGetItem", "Query", "Scan", "TransactGetItems":
+		return true
+	}
+	return false
+}
+
+// requestCapacity sets ReturnConsumedCapacity unless the caller already did.
+func requestCapacity(params any) {
+	set := func(v *types.ReturnConsumedCapacity) {
+		if *v == "" {
+			*v = types.ReturnConsumedCapacityIndexes
+		}
+	}
+	switch p := params.(type) {
+	case *dynamodb.GetItemInput:
+		set(&p.ReturnConsumedCapacity)
+	case *dynamodb.BatchGetItemInput:
+		set(&p.ReturnConsumedCapacity)
+	case *dynamodb.QueryInput:
+		set(&p.ReturnConsumedCapacity)
+	case *dynamodb.ScanInput:
+		set(&p.ReturnConsumedCapacity)
+	case *dynamodb.TransactGetItemsInput:
+		set(&p.ReturnConsumedCapacity)
+	case *dynamodb.PutItemInput:
+		set(&p.ReturnConsumedCapacity)
+	case *dynamodb.UpdateItemInput:
+		set(&p.ReturnConsumedCapacity)
+	case *dynamodb.DeleteItemInput:
+		set(&p.ReturnConsumedCapacity)
+	case *dynamodb.BatchWriteItemInput:
+		set(&p.ReturnConsumedCapacity)
+	case *dynamodb.TransactWriteItemsInput:
+		set(&p.ReturnConsumedCapacity)
+	}
+}
+
+func consumedCapacity(result any) []types.ConsumedCapacity {
+	one := func(c *types.ConsumedCapacity) []types.ConsumedCapacity {
+		if c == nil {
+			return nil
+		}
+		return []types.ConsumedCapacity{*c}
+	}
+	switch r := result.(type) {
+	case *dynamodb.GetItemOutput:
+		return one(r.ConsumedCapacity)
+	case *dynamodb.BatchGetItemOutput:
+		return r.ConsumedCapacity
+	case *dynamodb.QueryOutput:
+		return one(r.ConsumedCapacity)
+	case *dynamodb.ScanOutput:
+		return one(r.ConsumedCapacity)
+	case *dynamodb.TransactGetItemsOutput:
+		return r.ConsumedCapacity
+	case *dynamodb.PutItemOutput:
+		return one(r.ConsumedCapacity)
+	case *dynamodb.UpdateItemOutput:
+		return one(r.ConsumedCapacity)
+	case *dynamodb.DeleteItemOutput:
+		return one(r.ConsumedCapacity)
+	case *dynamodb.BatchWriteItemOutput:
+		return r.ConsumedCapacity
+	case *dynamodb.TransactWriteItemsOutput:
+		return r.ConsumedCapacity
+	}
+	return nil
+}
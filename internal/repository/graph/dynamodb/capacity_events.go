@@ -0,0 +1,113 @@
+package dynamodb
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+)
+
+// CapacityHook is called with the capacity of every DynamoDB call made
+// with the context it was attached to.
+type CapacityHook func(ctx context.Context, usage CapacityUsage)
+
+type capacityHooksKey struct{}
+
+// WithCapacityHook attaches hook to ctx. Hooks add up: a hook attached
+// to a parent context is still called. The hook must be safe for
+// concurrent use, a repository call may run DynamoDB calls in parallel.
+// Hooks only see clients a CapacityMeter was added to.
+func WithCapacityHook(ctx context.Context, hook CapacityHook) context.Context {
+	hooks := capacityHooks(ctx)
+	return context.WithValue(ctx, capacityHooksKey{}, append(slices.Clip(hooks), hook))
+}
+
+func capacityHooks(ctx context.Context) []CapacityHook {
+	hooks, _ := ctx.Value(capacityHooksKey{}).([]CapacityHook)
+	return hooks
+}
+
+// EventUsage is the capacity events of one cause consumed.
+type EventUsage struct {
+	Cause  string  `json:"cause"`
+	Events int     `json:"events"`
+	Calls  int     `json:"calls"`
+	RCU    float64 `json:"rcu"`
+	WCU    float64 `json:"wcu"`
+}
+
+// PerEvent returns the mean capacity of one event.
+func (u EventUsage) PerEvent() (rcu, wcu float64) {
+	if u.Events == 0 {
+		return 0, 0
+	}
+	return u.RCU / float64(u.Events), u.WCU / float64(u.Events)
+}
+
+// EventCapacity attributes DynamoDB capacity to the events that caused
+// it, e.g. how much one supply.UseCase.Update costs. Calls are grouped by
+// the cause the use case put into the context, see graph.WithCause.
+type EventCapacity struct {
+	mu      sync.Mutex
+	byCause map[string]*EventUsage
+}
+
+func NewEventCapacity() *EventCapacity {
+	return &EventCapacity{byCause: make(map[string]*EventUsage)}
+}
+
+// Track returns the context to handle one event with. done records the
+// event under every cause its calls carried; calls without a cause are
+// recorded under "".
+func (e *EventCapacity) Track(ctx context.Context) (context.Context, func()) {
+	var (
+		mu    sync.Mutex
+		event = make(map[string]*EventUsage)
+	)
+	ctx = WithCapacityHook(ctx, func(ctx context.Context, usage CapacityUsage) {
+		cause := graph.CauseFromContext(ctx)
+		mu.Lock()
+		defer mu.Unlock()
+		u, ok := event[cause]
+		if !ok {
+			u = &EventUsage{Cause: cause}
+			event[cause] = u
+		}
+		u.Calls += usage.Calls
+		u.RCU += usage.RCU
+		u.WCU += usage.WCU
+	})
+	return ctx, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		for cause, u := range event {
+			total, ok := e.byCause[cause]
+			if !ok {
+				total = &EventUsage{Cause: cause}
+				e.byCause[cause] = total
+			}
+			total.Events++
+			total.Calls += u.Calls
+			total.RCU += u.RCU
+			total.WCU += u.WCU
+		}
+	}
+}
+
+// Usage returns the capacity by cause, ordered by cause.
+func (e *EventCapacity) Usage() []EventUsage {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	usage := make([]EventUsage, 0, len(e.byCause))
+	for _, u := range e.byCause {
+		usage = append(usage, *u)
+	}
+	slices.SortFunc(usage, func(a, b EventUsage) int {
+		return cmp.Compare(a.Cause, b.Cause)
+	})
+	return usage
+}
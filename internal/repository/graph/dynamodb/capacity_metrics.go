@@ -0,0 +1,74 @@
+package dynamodb
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/telemetry"
+)
+
+// otelCapacity reports consumed capacity and throttles as OpenTelemetry counters.
+type otelCapacity struct {
+	rcu       metric.Float64Counter
+	wcu       metric.Float64Counter
+	throttles metric.Int64Counter
+}
+
+// NewOtelCapacityMetrics returns CapacityMetrics that add the capacity of
+// every call to the graph.dynamodb.rcu and graph.dynamodb.wcu counters,
+// by operation, table, index and cause, and count throttled attempts in
+// graph.dynamodb.throttles. mp is the global provider when nil.
+func NewOtelCapacityMetrics(mp metric.MeterProvider) (CapacityMetrics, error) {
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	meter := mp.Meter(telemetry.ScopeName + "/dynamodb")
+	rcu, err := meter.Float64Counter("graph.dynamodb.rcu",
+		metric.WithUnit("{capacity_unit}"),
+		metric.WithDescription("Read capacity units consumed by DynamoDB calls."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	wcu, err := meter.Float64Counter("graph.dynamodb.wcu",
+		metric.WithUnit("{capacity_unit}"),
+		metric.WithDescription("Write capacity units consumed by DynamoDB calls."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	throttles, err := meter.Int64Counter("graph.dynamodb.throttles",
+		metric.WithUnit("{attempt}"),
+		metric.WithDescription("DynamoDB attempts rejected for capacity, including retried ones."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &otelCapacity{rcu: rcu, wcu: wcu, throttles: throttles}, nil
+}
+
+func (c *otelCapacity) ObserveCapacity(ctx context.Context, usage CapacityUsage) {
+	set := metric.WithAttributes(
+		attribute.String("db.operation.name", usage.Operation),
+		attribute.String("aws.dynamodb.table_names", usage.Table),
+		attribute.String("aws.dynamodb.index_name", usage.Index),
+		attribute.String("graph.cause", graph.CauseFromContext(ctx)),
+	)
+	if usage.RCU > 0 {
+		c.rcu.Add(ctx, usage.RCU, set)
+	}
+	if usage.WCU > 0 {
+		c.wcu.Add(ctx, usage.WCU, set)
+	}
+}
+
+func (c *otelCapacity) ObserveThrottle(ctx context.Context, operation string) {
+	c.throttles.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("db.operation.name", operation),
+		attribute.String("graph.cause", graph.CauseFromContext(ctx)),
+	))
+}
@@ -0,0 +1,116 @@
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapacityMeter(t *testing.T) {
+	t.Run("Account capacity by operation, table and index", func(t *testing.T) {
+		m := NewCapacityMeter()
+		m.record(context.Background(), "BatchWriteItem", []types.ConsumedCapacity{{
+			TableName:     aws.String("graph"),
+			CapacityUnits: aws.Float64(6),
+			Table:         &types.Capacity{CapacityUnits: aws.Float64(2)},
+			GlobalSecondaryIndexes: map[string]types.Capacity{
+				"sk-gsi": {CapacityUnits: aws.Float64(2)},
+				"ak-gsi": {CapacityUnits: aws.Float64(2)},
+			},
+		}})
+		m.record(context.Background(), "Query", []types.ConsumedCapacity{{
+			TableName:     aws.String("graph"),
+			CapacityUnits: aws.Float64(0.5),
+		}})
+		m.record(context.Background(), "Query", []types.ConsumedCapacity{{
+			TableName:     aws.String("graph"),
+			CapacityUnits: aws.Float64(1.5),
+		}})
+
+		assert.Equal(t, []CapacityUsage{
+			{CapacityKey: CapacityKey{"BatchWriteItem", "graph", ""}, Calls: 1, WCU: 2},
+			{CapacityKey: CapacityKey{"BatchWriteItem", "graph", "ak-gsi"}, Calls: 1, WCU: 2},
+			{CapacityKey: CapacityKey{"BatchWriteItem", "graph", "sk-gsi"}, Calls: 1, WCU: 2},
+			{CapacityKey: CapacityKey{"Query", "graph", ""}, Calls: 2, RCU: 2},
+		}, m.Usage())
+	})
+	t.Run("Recognise throttling errors", func(t *testing.T) {
+		throttled := &types.ProvisionedThroughputExceededException{Message: aws.String("slow down")}
+		assert.True(t, IsThrottle(fmt.Errorf("write: %w", throttled)))
+		assert.True(t, IsThrottle(&smithy.GenericAPIError{Code: "ThrottlingException"}))
+		assert.False(t, IsThrottle(&types.ResourceNotFoundException{}))
+		assert.False(t, IsThrottle(nil))
+	})
+	t.Run("Pass usage on to metrics and context hooks", func(t *testing.T) {
+		metrics := &recordingMetrics{}
+		m := NewCapacityMeter(WithCapacityMetrics(metrics))
+
+		var hooked []CapacityUsage
+		ctx := WithCapacityHook(context.Background(), func(_ context.Context, u CapacityUsage) {
+			hooked = append(hooked, u)
+		})
+		ctx = WithCapacityHook(ctx, func(_ context.Context, u CapacityUsage) {
+			hooked = append(hooked, u)
+		})
+		m.record(ctx, "Query", []types.ConsumedCapacity{{
+			TableName:     aws.String("graph"),
+			CapacityUnits: aws.Float64(0.5),
+		}})
+
+		m.throttled(ctx, "Query")
+
+		usage := CapacityUsage{CapacityKey: CapacityKey{"Query", "graph", ""}, Calls: 1, RCU: 0.5}
+		assert.Equal(t, []CapacityUsage{usage}, metrics.usage)
+		assert.Equal(t, []CapacityUsage{usage, usage}, hooked)
+		assert.Equal(t, []string{"Query"}, metrics.throttles)
+		assert.Equal(t, map[string]int{"Query": 1}, m.Throttles())
+	})
+}
+
+type recordingMetrics struct {
+	usage     []CapacityUsage
+	throttles []string
+}
+
+func (r *recordingMetrics) ObserveThrottle(_ context.Context, operation string) {
+	r.throttles = append(r.throttles, operation)
+}
+
+func (r *recordingMetrics) ObserveCapacity(_ context.Context, usage CapacityUsage) {
+	r.usage = append(r.usage, usage)
+}
+
+func TestEventCapacity(t *testing.T) {
+	t.Run("Attribute capacity to events by cause", func(t *testing.T) {
+		m := NewCapacityMeter()
+		events := NewEventCapacity()
+
+		for range 2 {
+			ctx, done := events.Track(context.Background())
+			ctx = graph.WithCause(ctx, "supply.UseCase.Update")
+			m.record(ctx, "Query", []types.ConsumedCapacity{{
+				TableName:     aws.String("graph"),
+				CapacityUnits: aws.Float64(0.5),
+			}})
+			m.record(ctx, "BatchWriteItem", []types.ConsumedCapacity{{
+				TableName:     aws.String("graph"),
+				CapacityUnits: aws.Float64(3),
+			}})
+			done()
+		}
+
+		usage := events.Usage()
+		assert.Equal(t, []EventUsage{
+			{Cause: "supply.UseCase.Update", Events: 2, Calls: 4, RCU: 1, WCU: 6},
+		}, usage)
+		rcu, wcu := usage[0].PerEvent()
+		assert.Equal(t, 0.5, rcu)
+		assert.Equal(t, 3.0, wcu)
+	})
+}
@@ -0,0 +1,545 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	maxTransactionAttempts = 8
+	reconcileConcurrency   = 16
+	// Индекс отстаёт от таблицы, расхождение по ключу из индекса
+	// перепроверяется после паузы
+	indexLag = time.Second
+)
+
+// EdgeCounters are the edge counters a strategy keeps next to its edges,
+// see Strategy.Counters: one item per area key (AREA#city or AREA#city#03
+// with sharding, the same key as in ak-gsi), per demand (DEMAND#d, its
+// out-degree) and per supply (SUPPLY#s, its in-degree). The strategy
+// changes them with the ADD updates of CounterDeltas in the transactions
+// that write the edges.
+type EdgeCounters struct {
+	client *dynamodb.Client
+	table  string
+}
+
+func NewEdgeCounters(client *dynamodb.Client, table string) *EdgeCounters {
+	return &EdgeCounters{client: client, table: table}
+}
+
+// counterDTO is one counter. Zero counters are kept until Reconcile
+// removes them.
+type counterDTO struct {
+	PK    string `dynamodbav:"pk"`
+	Edges int    `dynamodbav:"edges"`
+}
+
+// CounterDeltas are the counter changes of one transaction, by counter key.
+type CounterDeltas map[string]int
+
+func (d CounterDeltas) Add(key string, n int) {
+	d[key] += n
+}
+
+// Updates returns an ADD update of the counters table per changed counter.
+// A transaction cannot touch an item twice, so the changes are summed up
+// before.
+func (c *EdgeCounters) Updates(d CounterDeltas) []types.TransactWriteItem {
+	items := make([]types.TransactWriteItem, 0, len(d))
+	for _, key := range slices.Sorted(maps.Keys(d)) {
+		if d[key] == 0 {
+			continue
+		}
+		items = append(items, types.TransactWriteItem{
+			Update: &types.Update{
+				TableName: aws.String(c.table),
+				Key: map[string]types.AttributeValue{
+					"pk": &types.AttributeValueMemberS{Value: key},
+				},
+				UpdateExpression: aws.String("ADD edges :n"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":n": &types.AttributeValueMemberN{Value: strconv.Itoa(d[key])},
+				},
+			},
+		})
+	}
+	return items
+}
+
+// Size returns the number of edges, the sum of the area counters.
+func (c *EdgeCounters) Size(ctx context.Context) (int, error) {
+	size := 0
+	paginator := dynamodb.NewScanPaginator(c.client, &dynamodb.ScanInput{
+		TableName:        aws.String(c.table),
+		FilterExpression: aws.String("begins_with(pk, :area)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":area": &types.AttributeValueMemberS{Value: "AREA#"},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, err
+		}
+		var counters []counterDTO
+		if err = attributevalue.UnmarshalListOfMaps(out.Items, &counters); err != nil {
+			return 0, err
+		}
+		for _, counter := range counters {
+			size += counter.Edges
+		}
+	}
+	return size, nil
+}
+
+// AreaEdgeCount returns the number of edges of the area written with
+// shards area shards.
+func (c *EdgeCounters) AreaEdgeCount(ctx context.Context, area graph.Area, shards int) (int, error) {
+	keys := []string{area.Area()}
+	if shards > 1 {
+		keys = keys[:0]
+		for shard := range shards {
+			keys = append(keys, area.Shard(shard))
+		}
+	}
+	counts, err := c.Read(ctx, keys)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	return total, nil
+}
+
+// DemandDegree returns the number of edges from the demand node.
+func (c *EdgeCounters) DemandDegree(ctx context.Context, node graph.Node) (int, error) {
+	counts, err := c.Read(ctx, []string{node.Demand()})
+	return counts[node.Demand()], err
+}
+
+// SupplyDegree returns the number of edges to the supply node.
+func (c *EdgeCounters) SupplyDegree(ctx context.Context, node graph.Node) (int, error) {
+	counts, err := c.Read(ctx, []string{node.Supply()})
+	return counts[node.Supply()], err
+}
+
+// Read reads the counters of the keys with strongly consistent reads,
+// missing ones are zero.
+func (c *EdgeCounters) Read(ctx context.Context, keys []string) (map[string]int, error) {
+	counts := make(map[string]int, len(keys))
+	for chunk := range slices.Chunk(keys, 100) {
+		ka := types.KeysAndAttributes{ConsistentRead: aws.Bool(true)}
+		for _, key := range chunk {
+			ka.Keys = append(ka.Keys, map[string]types.AttributeValue{
+				"pk": &types.AttributeValueMemberS{Value: key},
+			})
+		}
+		request := map[string]types.KeysAndAttributes{c.table: ka}
+		for len(request) > 0 {
+			out, err := c.client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: request})
+			if err != nil {
+				return nil, fmt.Errorf("failed to read counters: %w", err)
+			}
+			for _, item := range out.Responses[c.table] {
+				var dto counterDTO
+				if err = attributevalue.UnmarshalMap(item, &dto); err != nil {
+					return nil, fmt.Errorf("failed to unmarshal counter: %w", err)
+				}
+				counts[dto.PK] = dto.Edges
+			}
+			request = out.UnprocessedKeys
+		}
+	}
+	return counts, nil
+}
+
+// edgeKeyDTO is the keys of an edge item: demand, supply and area key.
+type edgeKeyDTO struct {
+	PK string `dynamodbav:"pk"`
+	SK string `dynamodbav:"sk"`
+	AK string `dynamodbav:"ak"`
+}
+
+// StoredAreaKeys are the area keys of the stored edges by demand and
+// supply key, see ReadStoredAreaKeys.
+type StoredAreaKeys map[[2]string]string
+
+// Lookup returns the area key the edge is stored under.
+func (s StoredAreaKeys) Lookup(edge graph.Edge) (string, bool) {
+	ak, ok := s[[2]string{edge.Demand(), edge.Supply()}]
+	return ak, ok
+}
+
+// Condition holds the item of the edge to what was read: absent, or
+// present under the same area key.
+func (s StoredAreaKeys) Condition(edge graph.Edge) (*string, map[string]types.AttributeValue) {
+	ak, ok := s.Lookup(edge)
+	if !ok {
+		return aws.String("attribute_not_exists(pk)"), nil
+	}
+	return aws.String("ak = :stored_ak"), map[string]types.AttributeValue{
+		":stored_ak": &types.AttributeValueMemberS{Value: ak},
+	}
+}
+
+// ReadStoredAreaKeys reads the area keys of the edges stored in table as
+// pk = DEMAND#d, sk = SUPPLY#s with a strongly consistent batch read.
+func ReadStoredAreaKeys(ctx context.Context, client *dynamodb.Client, table string, edges []graph.Edge) (StoredAreaKeys, error) {
+	keys := make([]map[string]types.AttributeValue, 0, len(edges))
+	for _, edge := range edges {
+		keys = append(keys, map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: edge.Demand()},
+			"sk": &types.AttributeValueMemberS{Value: edge.Supply()},
+		})
+	}
+	request := map[string]types.KeysAndAttributes{
+		table: {
+			Keys:                 keys,
+			ConsistentRead:       aws.Bool(true),
+			ProjectionExpression: aws.String("pk, sk, ak"),
+		},
+	}
+	stored := make(StoredAreaKeys, len(edges))
+	for len(request) > 0 {
+		out, err := client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: request})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stored edges: %w", err)
+		}
+		for _, item := range out.Responses[table] {
+			var key edgeKeyDTO
+			if err = attributevalue.UnmarshalMap(item, &key); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal edge: %w", err)
+			}
+			stored[[2]string{key.PK, key.SK}] = key.AK
+		}
+		request = out.UnprocessedKeys
+	}
+	return stored, nil
+}
+
+// TransactPlan plans the transaction of a chunk of edges from the area
+// keys they are stored under.
+type TransactPlan func(chunk []graph.Edge, stored StoredAreaKeys) ([]types.TransactWriteItem, error)
+
+// TransactEdges writes the edges of table perTransaction at a time with
+// TransactWriteItems. Every transaction is planned from the stored area
+// keys and its items are conditioned on them, see StoredAreaKeys.Condition:
+// a concurrent writer cancels the transaction and the chunk is read and
+// planned again. The edges of a failed transaction are reported with
+// graph.WriteError.
+func TransactEdges(
+	ctx context.Context,
+	client *dynamodb.Client,
+	table string,
+	edges []graph.Edge,
+	perTransaction int,
+	plan TransactPlan,
+) error {
+	var failed []graph.EdgeError
+	for chunk := range slices.Chunk(edges, perTransaction) {
+		if err := transactChunk(ctx, client, table, chunk, plan); err != nil {
+			for _, edge := range chunk {
+				failed = append(failed, graph.EdgeError{Edge: edge, Err: err})
+			}
+		}
+	}
+	return graph.WriteError(len(edges), failed)
+}
+
+func transactChunk(ctx context.Context, client *dynamodb.Client, table string, chunk []graph.Edge, plan TransactPlan) error {
+	var err error
+	for attempt := range maxTransactionAttempts {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt*attempt) * 10 * time.Millisecond):
+			}
+		}
+
+		var stored StoredAreaKeys
+		stored, err = ReadStoredAreaKeys(ctx, client, table, chunk)
+		if err != nil {
+			return err
+		}
+		items, planErr := plan(chunk, stored)
+		if planErr != nil {
+			return planErr
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: items,
+		})
+		if !IsTransactionConflict(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to write %d edges after %d attempts: %w", len(chunk), maxTransactionAttempts, err)
+}
+
+// IsTransactionConflict reports whether a transaction was cancelled by a
+// failed condition or a concurrent transaction, so it is worth planning again.
+func IsTransactionConflict(err error) bool {
+	var canceled *types.TransactionCanceledException
+	if !errors.As(err, &canceled) {
+		return false
+	}
+	for _, reason := range canceled.CancellationReasons {
+		switch aws.ToString(reason.Code) {
+		case "ConditionalCheckFailed", "TransactionConflict":
+			return true
+		}
+	}
+	return false
+}
+
+// ReconcileStats tells what Reconcile did.
+type ReconcileStats struct {
+	Checked   int `json:"checked"`
+	Corrected int `json:"corrected"`
+	// Removed - counters of areas and nodes that have no edges anymore
+	Removed int `json:"removed"`
+	// Skipped - counters that were written while they were counted,
+	// the next run checks them again
+	Skipped int `json:"skipped"`
+}
+
+// CountFunc counts the stored edges of a counter key. indexed tells that
+// the count comes from a global secondary index, which may lag behind
+// writes already on the counter.
+type CountFunc func(ctx context.Context, key string) (n int, indexed bool, err error)
+
+// Reconcile recounts the existing counters and the keys of the edges
+// stored in edgeTable, some of which may lack a counter, and corrects the
+// ones that drifted, e.g. because TTL deleted edges. A mismatch counted
+// from an index is recounted after a pause before it is corrected.
+//
+// A correction is conditioned on the counter value read before counting,
+// so a concurrent write is never overwritten: the counter is skipped
+// instead. Reconcile is safe to run while the graph is written.
+func (c *EdgeCounters) Reconcile(ctx context.Context, edgeTable string, count CountFunc) (ReconcileStats, error) {
+	keys, err := c.keys(ctx, edgeTable)
+	if err != nil {
+		return ReconcileStats{}, err
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		stats ReconcileStats
+		errs  []error
+		queue = make(chan string)
+	)
+	for range reconcileConcurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range queue {
+				outcome, err := c.reconcileKey(ctx, key, count)
+				mu.Lock()
+				stats.Checked++
+				switch {
+				case err != nil:
+					errs = append(errs, fmt.Errorf("reconcile %s: %w", key, err))
+				case outcome == corrected:
+					stats.Corrected++
+				case outcome == removed:
+					stats.Removed++
+				case outcome == skipped:
+					stats.Skipped++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for key := range keys {
+		queue <- key
+	}
+	close(queue)
+	wg.Wait()
+	return stats, errors.Join(errs...)
+}
+
+type outcome int
+
+const (
+	unchanged outcome = iota
+	corrected
+	removed
+	skipped
+)
+
+func (c *EdgeCounters) reconcileKey(ctx context.Context, key string, count CountFunc) (outcome, error) {
+	seen, exists, err := c.readCounter(ctx, key)
+	if err != nil {
+		return unchanged, err
+	}
+	n, indexed, err := count(ctx, key)
+	if err != nil {
+		return unchanged, err
+	}
+	if n == seen {
+		if n == 0 && exists {
+			return c.removeCounter(ctx, key, seen)
+		}
+		return unchanged, nil
+	}
+
+	if indexed {
+		// Индекс мог не догнать запись, которая уже учтена в счётчике
+		select {
+		case <-ctx.Done():
+			return unchanged, ctx.Err()
+		case <-time.After(indexLag):
+		}
+		if n, _, err = count(ctx, key); err != nil {
+			return unchanged, err
+		}
+		if n == seen {
+			return unchanged, nil
+		}
+	}
+
+	if n == 0 {
+		return c.removeCounter(ctx, key, seen)
+	}
+	condition := aws.String("attribute_not_exists(pk)")
+	var values map[string]types.AttributeValue
+	if exists {
+		condition = aws.String("edges = :seen")
+		values = map[string]types.AttributeValue{
+			":seen": &types.AttributeValueMemberN{Value: strconv.Itoa(seen)},
+		}
+	}
+	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(c.table),
+		Item: map[string]types.AttributeValue{
+			"pk":    &types.AttributeValueMemberS{Value: key},
+			"edges": &types.AttributeValueMemberN{Value: strconv.Itoa(n)},
+		},
+		ConditionExpression:       condition,
+		ExpressionAttributeValues: values,
+	})
+	return conditioned(corrected, err)
+}
+
+func (c *EdgeCounters) removeCounter(ctx context.Context, key string, seen int) (outcome, error) {
+	_, err := c.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(c.table),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: key},
+		},
+		ConditionExpression: aws.String("edges = :seen"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":seen": &types.AttributeValueMemberN{Value: strconv.Itoa(seen)},
+		},
+	})
+	return conditioned(removed, err)
+}
+
+// conditioned turns a failed condition into a skip.
+func conditioned(done outcome, err error) (outcome, error) {
+	var conditionErr *types.ConditionalCheckFailedException
+	switch {
+	case errors.As(err, &conditionErr):
+		return skipped, nil
+	case err != nil:
+		return unchanged, err
+	default:
+		return done, nil
+	}
+}
+
+func (c *EdgeCounters) readCounter(ctx context.Context, key string) (int, bool, error) {
+	out, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(c.table),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: key},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read counter: %w", err)
+	}
+	if out.Item == nil {
+		return 0, false, nil
+	}
+	var dto counterDTO
+	if err = attributevalue.UnmarshalMap(out.Item, &dto); err != nil {
+		return 0, false, fmt.Errorf("failed to unmarshal counter: %w", err)
+	}
+	return dto.Edges, true, nil
+}
+
+// keys returns the keys of the existing counters and of the areas and
+// nodes of the edges stored in edgeTable as pk = DEMAND#d, sk = SUPPLY#s.
+func (c *EdgeCounters) keys(ctx context.Context, edgeTable string) (map[string]struct{}, error) {
+	keys := make(map[string]struct{})
+	paginator := dynamodb.NewScanPaginator(c.client, &dynamodb.ScanInput{
+		TableName:            aws.String(c.table),
+		ProjectionExpression: aws.String("pk"),
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan counters: %w", err)
+		}
+		var page []counterDTO
+		if err = attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal counter: %w", err)
+		}
+		for _, counter := range page {
+			keys[counter.PK] = struct{}{}
+		}
+	}
+
+	edges := dynamodb.NewScanPaginator(c.client, &dynamodb.ScanInput{
+		TableName:            aws.String(edgeTable),
+		ProjectionExpression: aws.String("pk, sk, ak"),
+		FilterExpression:     aws.String("begins_with(pk, :demand)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":demand": &types.AttributeValueMemberS{Value: "DEMAND#"},
+		},
+	})
+	for edges.HasMorePages() {
+		out, err := edges.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan edges: %w", err)
+		}
+		var page []edgeKeyDTO
+		if err = attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal edge: %w", err)
+		}
+		for _, edge := range page {
+			keys[edge.PK] = struct{}{}
+			keys[edge.SK] = struct{}{}
+			keys[edge.AK] = struct{}{}
+		}
+	}
+	return keys, nil
+}
+
+// IsAreaKey tells a counter key of an area from the keys of nodes.
+func IsAreaKey(key string) bool {
+	return strings.HasPrefix(key, "AREA#")
+}
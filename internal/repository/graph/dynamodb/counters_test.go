@@ -0,0 +1,27 @@
+package dynamodb
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEdgeCounters_Updates(t *testing.T) {
+	t.Run("Sum changes of one counter and skip zeros", func(t *testing.T) {
+		d := make(CounterDeltas)
+		d.Add("AREA#a", 1)
+		d.Add("AREA#b", 1)
+		d.Add("AREA#a", -1)
+		d.Add("DEMAND#d", 2)
+
+		updates := NewEdgeCounters(nil, "counters").Updates(d)
+		if assert.Len(t, updates, 2) {
+			assert.Equal(t, "AREA#b", updates[0].Update.Key["pk"].(*types.AttributeValueMemberS).Value)
+			assert.Equal(t, "1", updates[0].Update.ExpressionAttributeValues[":n"].(*types.AttributeValueMemberN).Value)
+			assert.Equal(t, "DEMAND#d", updates[1].Update.Key["pk"].(*types.AttributeValueMemberS).Value)
+			assert.Equal(t, "2", updates[1].Update.ExpressionAttributeValues[":n"].(*types.AttributeValueMemberN).Value)
+			assert.Equal(t, "counters", *updates[0].Update.TableName)
+		}
+	})
+}
@@ -2,22 +2,33 @@ package dynamodb
 
 import (
 	"context"
-	"log"
+	"errors"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
 	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
 )
 
 type DynamoDb struct {
 	Client        *dynamodb.Client
 	TaggingClient *resourcegroupstaggingapi.Client
+	StreamsClient *dynamodbstreams.Client
+
+	// AreaShards - число шардов ключа области, к которому миграции приводят данные
+	AreaShards int
+	// Strategies - стратегии хранения графа, чьи таблицы создают миграции;
+	// пусто - все зарегистрированные стратегии
+	Strategies []string
 }
 
 func NewDatabase(endpoint string, config aws.Config) (*DynamoDb, error) {
 
-	var client *dynamodb.Client
+	var (
+		client        *dynamodb.Client
+		streamsClient *dynamodbstreams.Client
+	)
 
 	if endpoint != "" {
 		// Создаём клиент с переопределённым endpoint для локального DynamoDB (Docker)
@@ -25,26 +36,39 @@ func NewDatabase(endpoint string, config aws.Config) (*DynamoDb, error) {
 		client = dynamodb.NewFromConfig(
 			config, func(o *dynamodb.Options) {
 				o.BaseEndpoint = aws.String(endpoint)
+			}, withErrorMapping,
+		)
+		// DynamoDB Local отдаёт Streams API на том же endpoint
+		streamsClient = dynamodbstreams.NewFromConfig(
+			config, func(o *dynamodbstreams.Options) {
+				o.BaseEndpoint = aws.String(endpoint)
 			},
 		)
 	} else {
-		client = dynamodb.NewFromConfig(config)
+		client = dynamodb.NewFromConfig(config, withErrorMapping)
+		streamsClient = dynamodbstreams.NewFromConfig(config)
 	}
 
 	if client == nil {
-		log.Fatal("Failed to create DynamoDB client")
+		return nil, errors.New("failed to create DynamoDB client")
 	}
 
 	taggingClient := resourcegroupstaggingapi.NewFromConfig(config)
 	if taggingClient == nil {
-		log.Fatal("Failed to create Resource Groups Tagging API client")
+		return nil, errors.New("failed to create Resource Groups Tagging API client")
 	}
 	return &DynamoDb{
 		Client:        client,
 		TaggingClient: taggingClient,
+		StreamsClient: streamsClient,
 	}, nil
 }
 
+// withErrorMapping makes the client return graph errors, see MapError.
+func withErrorMapping(o *dynamodb.Options) {
+	o.APIOptions = append(o.APIOptions, mapErrors)
+}
+
 func NewTestDatabase() (*DynamoDb, error) {
 	endpoint := "http://localhost:8000" // Локальный endpoint для DynamoDB
 	cfg, err := config.LoadDefaultConfig(context.Background())
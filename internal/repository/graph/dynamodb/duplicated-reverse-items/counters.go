@@ -0,0 +1,116 @@
+package duplicated_reverse_items
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	graphdb "github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// CountersTableName is the table of the edge counters, see graphdb.EdgeCounters.
+const CountersTableName = "graph_duplicated_reverse_items_counters_tbl"
+
+// Ребро занимает до 6 действий транзакции: два элемента, степени спроса
+// и предложения, старый и новый ключ области
+const edgesPerTransaction = 16
+
+// writeChunks writes the edges a transaction at a time together with the
+// counter changes they cause, see graphdb.TransactEdges.
+func (r *Repository) writeChunks(ctx context.Context, edges []graph.Edge, plan graphdb.TransactPlan) error {
+	return graphdb.TransactEdges(ctx, r.client, TableName, edges, edgesPerTransaction, plan)
+}
+
+// planUpsert puts both items of every edge. A new edge adds one to its
+// area and to the degrees of its nodes, an edge that moves to another area
+// key moves between the area counters.
+func (r *Repository) planUpsert(cause string) graphdb.TransactPlan {
+	return func(chunk []graph.Edge, stored graphdb.StoredAreaKeys) ([]types.TransactWriteItem, error) {
+		items := make([]types.TransactWriteItem, 0, 6*len(chunk))
+		counts := make(graphdb.CounterDeltas)
+		for _, edge := range chunk {
+			dtos := r.makeDTO(edge)
+			for i, dto := range dtos {
+				dto.Cause = cause
+				av, err := attributevalue.MarshalMap(dto)
+				if err != nil {
+					return nil, fmt.Errorf("failed to marshal edge: %w", err)
+				}
+				put := &types.Put{
+					TableName: aws.String(TableName),
+					Item:      av,
+				}
+				if i == 0 {
+					// Условие на прямой элемент: обратный пишется в той же транзакции
+					put.ConditionExpression, put.ExpressionAttributeValues = stored.Condition(edge)
+				}
+				items = append(items, types.TransactWriteItem{Put: put})
+			}
+
+			ak, ok := stored.Lookup(edge)
+			switch {
+			case !ok:
+				counts.Add(dtos[0].AK, 1)
+				counts.Add(edge.Demand(), 1)
+				counts.Add(edge.Supply(), 1)
+			case ak != dtos[0].AK:
+				counts.Add(ak, -1)
+				counts.Add(dtos[0].AK, 1)
+			}
+		}
+		return append(items, r.counters.Updates(counts)...), nil
+	}
+}
+
+// planRemove deletes both items of every stored edge and takes it off the
+// counters. Edges that are not stored are skipped.
+func (r *Repository) planRemove(chunk []graph.Edge, stored graphdb.StoredAreaKeys) ([]types.TransactWriteItem, error) {
+	items := make([]types.TransactWriteItem, 0, 5*len(chunk))
+	counts := make(graphdb.CounterDeltas)
+	for _, edge := range chunk {
+		ak, ok := stored.Lookup(edge)
+		if !ok {
+			continue
+		}
+		condition, values := stored.Condition(edge)
+		for i, key := range [][2]string{
+			{edge.Demand(), edge.Supply()},
+			{edge.Supply(), edge.Demand()},
+		} {
+			del := &types.Delete{
+				TableName: aws.String(TableName),
+				Key: map[string]types.AttributeValue{
+					"pk": &types.AttributeValueMemberS{Value: key[0]},
+					"sk": &types.AttributeValueMemberS{Value: key[1]},
+				},
+			}
+			if i == 0 {
+				del.ConditionExpression, del.ExpressionAttributeValues = condition, values
+			}
+			items = append(items, types.TransactWriteItem{Delete: del})
+		}
+		counts.Add(ak, -1)
+		counts.Add(edge.Demand(), -1)
+		counts.Add(edge.Supply(), -1)
+	}
+	return append(items, r.counters.Updates(counts)...), nil
+}
+
+// AreaEdgeCount returns the number of edges of the area from its counters.
+func (r *Repository) AreaEdgeCount(ctx context.Context, area graph.Area) (int, error) {
+	return r.counters.AreaEdgeCount(ctx, area, r.areaShards)
+}
+
+// DemandDegree returns the number of edges from the demand node.
+func (r *Repository) DemandDegree(ctx context.Context, node graph.Node) (int, error) {
+	return r.counters.DemandDegree(ctx, node)
+}
+
+// SupplyDegree returns the number of edges to the supply node.
+func (r *Repository) SupplyDegree(ctx context.Context, node graph.Node) (int, error) {
+	return r.counters.SupplyDegree(ctx, node)
+}
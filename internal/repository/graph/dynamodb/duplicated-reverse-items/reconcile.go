@@ -0,0 +1,49 @@
+package duplicated_reverse_items
+
+import (
+	"context"
+	"fmt"
+
+	graphdb "github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Reconcile recounts every counter by query and corrects the ones that
+// drifted, see graphdb.EdgeCounters.Reconcile. Node degrees are counted
+// with strongly consistent queries of the node partition, areas with ak-gsi.
+func (r *Repository) Reconcile(ctx context.Context) (graphdb.ReconcileStats, error) {
+	return r.counters.Reconcile(ctx, TableName, r.countEdges)
+}
+
+// countEdges counts the edges of a counter key: the items of a node
+// partition or of an area key in ak-gsi.
+func (r *Repository) countEdges(ctx context.Context, key string) (int, bool, error) {
+	in := &dynamodb.QueryInput{
+		TableName:              aws.String(TableName),
+		KeyConditionExpression: aws.String("pk = :key"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":key": &types.AttributeValueMemberS{Value: key},
+		},
+		ConsistentRead: aws.Bool(true),
+		Select:         types.SelectCount,
+	}
+	indexed := graphdb.IsAreaKey(key)
+	if indexed {
+		in.IndexName = aws.String("ak-gsi")
+		in.KeyConditionExpression = aws.String("ak = :key")
+		in.ConsistentRead = nil
+	}
+	count := 0
+	paginator := dynamodb.NewQueryPaginator(r.client, in)
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to count edges: %w", err)
+		}
+		count += int(out.Count)
+	}
+	return count, indexed, nil
+}
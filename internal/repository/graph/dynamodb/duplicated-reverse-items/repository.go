@@ -0,0 +1,312 @@
+package duplicated_reverse_items
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	graphdb "github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const TableName = "graph_duplicated_reverse_items_tbl"
+
+// edgeDTO is one of the two items of an edge. The forward item lives in
+// the demand partition and carries the area key, the reverse item lives
+// in the supply partition and has no area key, so ak-gsi sees every edge once.
+type edgeDTO struct {
+	PK    string  `dynamodbav:"pk"`              // DEMAND#{From} или SUPPLY#{To}
+	SK    string  `dynamodbav:"sk"`              // SUPPLY#{To} или DEMAND#{From}
+	AK    string  `dynamodbav:"ak,omitempty"`    // AREA#{AreaName} или AREA#{AreaName}#{Shard}
+	Area  string  `dynamodbav:"area"`            // область, для обратных элементов без ak
+	Score float64 `dynamodbav:"score"`           // score of the edge
+	TTL   int64   `dynamodbav:"ttl"`             // time to live (epoch time in seconds)
+	Cause string  `dynamodbav:"cause,omitempty"` // who wrote the edge, see graph.WithCause
+}
+
+func (dto edgeDTO) edge() graph.Edge {
+	demand, supply := dto.PK, dto.SK
+	if strings.HasPrefix(dto.PK, "SUPPLY#") {
+		demand, supply = supply, demand
+	}
+	return graph.Edge{
+		From:      graph.Node(strings.TrimPrefix(demand, "DEMAND#")),
+		To:        graph.Node(strings.TrimPrefix(supply, "SUPPLY#")),
+		Area:      graph.Area(dto.Area),
+		Score:     graph.Score(dto.Score),
+		ExpiresAt: time.Unix(dto.TTL, 0).UTC(),
+	}
+}
+
+// Repository stores every edge as two items written in one transaction:
+// DEMAND#d/SUPPLY#s and SUPPLY#s/DEMAND#d. Both directions are read with
+// strongly consistent base-table queries, at the price of double writes.
+//
+// The same transactions keep the edge counters of areas and nodes, see
+// CountersTableName. Edges deleted by TTL bypass them, Reconcile corrects
+// the drift.
+type Repository struct {
+	client     *dynamodb.Client
+	counters   *graphdb.EdgeCounters
+	areaShards int
+	rules      graph.Rules
+}
+
+type Option func(*Repository)
+
+// WithAreaShards spreads the area key of ak-gsi across n shards
+// (AREA#city#00 .. AREA#city#{n-1}) to avoid a hot partition per area.
+// n <= 1 keeps a single AREA#city key.
+func WithAreaShards(n int) Option {
+	return func(r *Repository) {
+		r.areaShards = n
+	}
+}
+
+func New(client *dynamodb.Client, opts ...Option) *Repository {
+	r := &Repository{
+		client:   client,
+		counters: graphdb.NewEdgeCounters(client, CountersTableName),
+		rules:    graph.DefaultRules(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Size returns the number of edges, the sum of the area counters.
+func (r *Repository) Size(ctx context.Context) (int, error) {
+	return r.counters.Size(ctx)
+}
+
+// UpsertEdges adds or updates edges in the graph. Both items of an edge
+// and the counters it changes are written atomically; a failed
+// transaction leaves its edges unchanged. Nothing is written when an edge
+// breaks the rules, see graphdb.StrategyOptions.
+func (r *Repository) UpsertEdges(ctx context.Context, edges ...graph.Edge) error {
+	if len(edges) == 0 {
+		return nil
+	}
+	if err := r.rules.Validate(edges); err != nil {
+		return err
+	}
+
+	return r.writeChunks(ctx, dedup(edges), r.planUpsert(graph.CauseFromContext(ctx)))
+}
+
+// ReadDemandEdges retrieves all edges from the demand node.
+func (r *Repository) ReadDemandEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error) {
+	return r.readPartition(ctx, node.Demand(), false)
+}
+
+// ReadTopDemandEdges retrieves up to n edges from the demand node
+// in descending score order.
+func (r *Repository) ReadTopDemandEdges(ctx context.Context, node graph.Node, n int) ([]graph.Edge, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	out, err := r.client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(TableName),
+		IndexName:              aws.String("score-lsi"),
+		KeyConditionExpression: aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: node.Demand()},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(int32(n)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top edges: %w", err)
+	}
+	return unmarshalEdges(out.Items)
+}
+
+// ReadSupplyEdges retrieves all edges directed to the supply node.
+// Unlike a GSI query the read is strongly consistent.
+func (r *Repository) ReadSupplyEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error) {
+	return r.readPartition(ctx, node.Supply(), true)
+}
+
+func (r *Repository) readPartition(ctx context.Context, pk string, consistent bool) ([]graph.Edge, error) {
+	var last map[string]types.AttributeValue
+	edges := make([]graph.Edge, 0)
+	for {
+		out, err := r.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(TableName),
+			KeyConditionExpression: aws.String("pk = :pk"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk": &types.AttributeValueMemberS{Value: pk},
+			},
+			ConsistentRead:    aws.Bool(consistent),
+			ExclusiveStartKey: last,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query edges: %w", err)
+		}
+		page, err := unmarshalEdges(out.Items)
+		if err != nil {
+			return nil, err
+		}
+		edges = append(edges, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			return edges, nil
+		}
+		last = out.LastEvaluatedKey
+	}
+}
+
+// ReadAreaEdges retrieves all edges associated with a specific area.
+// With a sharded area index all shards are queried in parallel and merged.
+func (r *Repository) ReadAreaEdges(ctx context.Context, area graph.Area) ([]graph.Edge, error) {
+	if r.areaShards <= 1 {
+		return r.readAreaKey(ctx, area.Area())
+	}
+
+	var (
+		wg      sync.WaitGroup
+		results = make([][]graph.Edge, r.areaShards)
+		errs    = make([]error, r.areaShards)
+	)
+	for shard := range r.areaShards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[shard], errs[shard] = r.readAreaKey(ctx, area.Shard(shard))
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	edges := make([]graph.Edge, 0)
+	for _, shardEdges := range results {
+		edges = append(edges, shardEdges...)
+	}
+	return edges, nil
+}
+
+func (r *Repository) readAreaKey(ctx context.Context, key string) ([]graph.Edge, error) {
+	var last map[string]types.AttributeValue
+	edges := make([]graph.Edge, 0)
+	for {
+		out, err := r.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(TableName),
+			IndexName:              aws.String("ak-gsi"),
+			KeyConditionExpression: aws.String("ak = :ak"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":ak": &types.AttributeValueMemberS{Value: key},
+			},
+			ExclusiveStartKey: last,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query edges by area: %w", err)
+		}
+		page, err := unmarshalEdges(out.Items)
+		if err != nil {
+			return nil, err
+		}
+		edges = append(edges, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			return edges, nil
+		}
+		last = out.LastEvaluatedKey
+	}
+}
+
+// RemoveEdges removes specific edges from the graph, both items of an
+// edge and its counter changes in one transaction.
+func (r *Repository) RemoveEdges(ctx context.Context, edges ...graph.Edge) error {
+	if len(edges) == 0 {
+		return nil
+	}
+	if err := graph.ValidateKeys(edges); err != nil {
+		return err
+	}
+
+	return r.writeChunks(ctx, dedup(edges), r.planRemove)
+}
+
+// RemoveNodeEdges removes all edges associated with a specific node.
+func (r *Repository) RemoveNodeEdges(ctx context.Context, node graph.Node) error {
+	outEdges, err := r.ReadDemandEdges(ctx, node)
+	if err != nil {
+		return fmt.Errorf("failed to query node edges: %w", err)
+	}
+	inEdges, err := r.ReadSupplyEdges(ctx, node)
+	if err != nil {
+		return fmt.Errorf("failed to query node edges: %w", err)
+	}
+	if err = r.RemoveEdges(ctx, append(outEdges, inEdges...)...); err != nil {
+		return fmt.Errorf("failed to remove node edges: %w", err)
+	}
+	return nil
+}
+
+// RemoveDemandEdges удаляет все исходящие рёбра узла вместе с их
+// обратными элементами в партициях предложений.
+func (r *Repository) RemoveDemandEdges(ctx context.Context, node graph.Node) error {
+	edges, err := r.ReadDemandEdges(ctx, node)
+	if err != nil {
+		return fmt.Errorf("query out-edges: %w", err)
+	}
+	if err = r.RemoveEdges(ctx, edges...); err != nil {
+		return fmt.Errorf("remove out-edges: %w", err)
+	}
+	return nil
+}
+
+// makeDTO returns the forward and the reverse item of the edge.
+func (r *Repository) makeDTO(edge graph.Edge) [2]edgeDTO {
+	forward := edgeDTO{
+		PK:    edge.Demand(),
+		SK:    edge.Supply(),
+		AK:    edge.AreaKey(r.areaShards),
+		Area:  string(edge.Area),
+		Score: edge.Score.Float64(),
+		TTL:   time.Now().UTC().Add(edge.TTL).Unix(),
+	}
+	reverse := forward
+	reverse.PK, reverse.SK, reverse.AK = forward.SK, forward.PK, ""
+	return [2]edgeDTO{forward, reverse}
+}
+
+func unmarshalEdges(items []map[string]types.AttributeValue) ([]graph.Edge, error) {
+	edges := make([]graph.Edge, 0, len(items))
+	for _, item := range items {
+		var dto edgeDTO
+		if err := attributevalue.UnmarshalMap(item, &dto); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal edge: %w", err)
+		}
+		edges = append(edges, dto.edge())
+	}
+	return edges, nil
+}
+
+// dedup keeps the last occurrence of every edge: a transaction
+// cannot touch the same item twice.
+func dedup(edges []graph.Edge) []graph.Edge {
+	index := make(map[string]int, len(edges))
+	out := make([]graph.Edge, 0, len(edges))
+	for _, e := range edges {
+		key := e.Demand() + "|" + e.Supply()
+		if i, ok := index[key]; ok {
+			out[i] = e
+			continue
+		}
+		index[key] = len(out)
+		out = append(out, e)
+	}
+	return out
+}
@@ -0,0 +1,16 @@
+package duplicated_reverse_items
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/strategytest"
+)
+
+func TestRepository(t *testing.T) {
+	strategy, err := dynamodb.LookupStrategy(StrategyName)
+	require.NoError(t, err)
+	strategytest.Run(t, strategy)
+}
@@ -0,0 +1,29 @@
+package duplicated_reverse_items
+
+import (
+	graphdb "github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/migrate"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// StrategyName is the name the strategy is registered under.
+const StrategyName = "duplicated-reverse-items"
+
+func init() {
+	graphdb.RegisterStrategy(graphdb.Strategy{
+		Name:     StrategyName,
+		Counters: true,
+		New: func(client *dynamodb.Client, opts graphdb.StrategyOptions) graphdb.GraphRepository {
+			r := New(client, WithAreaShards(opts.AreaShards))
+			r.rules = opts.Rules
+			return r
+		},
+		Migrations: func(opts graphdb.StrategyOptions) []graphdb.Migration {
+			return []graphdb.Migration{
+				&migrate.CreateDuplicatedReverseItemsTable{},
+				&migrate.CreateEdgeCountersTable{},
+			}
+		},
+	})
+}
@@ -0,0 +1,199 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+)
+
+const (
+	batchWriteSize     = 25 // Максимальный размер партии для BatchWriteItem
+	maxBatchAttempts   = 8
+	batchRetryInterval = 25 * time.Millisecond
+)
+
+// MapError wraps a DynamoDB error with the graph error of its kind, see
+// graph.ErrThrottled and others. Errors of other kinds are returned as is.
+func MapError(err error) error {
+	kind := errorKind(err)
+	if kind == nil || errors.Is(err, kind) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", kind, err)
+}
+
+func errorKind(err error) error {
+	if IsThrottle(err) {
+		return graph.ErrThrottled
+	}
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		// Транзакция отменяется целиком, причина - у отдельных действий
+		for _, reason := range canceled.CancellationReasons {
+			switch aws.ToString(reason.Code) {
+			case "ThrottlingError", "ProvisionedThroughputExceeded":
+				return graph.ErrThrottled
+			case "ConditionalCheckFailed", "TransactionConflict":
+				return graph.ErrConditionFailed
+			case "ValidationError":
+				if isInvalidItem(aws.ToString(reason.Message)) {
+					return graph.ErrInvalidEdge
+				}
+			}
+		}
+		return nil
+	}
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return nil
+	}
+	switch apiErr.ErrorCode() {
+	case "ResourceNotFoundException":
+		return graph.ErrTableNotFound
+	case "ConditionalCheckFailedException", "TransactionConflictException":
+		return graph.ErrConditionFailed
+	case "ValidationException":
+		if isInvalidItem(apiErr.ErrorMessage()) {
+			return graph.ErrInvalidEdge
+		}
+	}
+	return nil
+}
+
+// invalidItemMessages are the validation failures an item causes itself:
+// it is too large or its key attributes are missing, empty or mistyped.
+// Other failures, e.g. a broken expression, are bugs of the request.
+var invalidItemMessages = []string{
+	"item size has exceeded",
+	"item size to update has exceeded",
+	"missing the key",
+	"key attribute cannot contain an empty",
+	"provided key element does not match the schema",
+	"type mismatch for key",
+}
+
+func isInvalidItem(message string) bool {
+	message = strings.ToLower(message)
+	return slices.ContainsFunc(invalidItemMessages, func(m string) bool {
+		return strings.Contains(message, m)
+	})
+}
+
+// mapErrors wraps the errors of every call of the client, see MapError.
+func mapErrors(stack *middleware.Stack) error {
+	// Первым в Initialize: ошибка классифицируется после всех повторов
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc(
+		"MapErrors",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+			middleware.InitializeOutput, middleware.Metadata, error,
+		) {
+			out, metadata, err := next.HandleInitialize(ctx, in)
+			return out, metadata, MapError(err)
+		},
+	), middleware.Before)
+}
+
+// BatchWrite writes the requests of the edges with BatchWriteItem, 25 at a
+// time, and resends the items DynamoDB left unprocessed. edges[i] is the
+// edge of requests[i], requests are keyed by pk and sk. Edges that were
+// not written are reported with graph.WriteError.
+func BatchWrite(ctx context.Context, client *dynamodb.Client, table string, requests []types.WriteRequest, edges []graph.Edge) error {
+	var failed []graph.EdgeError
+	for start := 0; start < len(requests); start += batchWriteSize {
+		end := min(start+batchWriteSize, len(requests))
+		for _, i := range writeBatch(ctx, client, table, requests[start:end]) {
+			failed = append(failed, graph.EdgeError{Edge: edges[start+i.index], Err: i.err})
+		}
+	}
+	return graph.WriteError(len(requests), failed)
+}
+
+// WriteItems writes requests to a table that does not hold edges, e.g.
+// the edge history, with the same batching and resending as BatchWrite.
+func WriteItems(ctx context.Context, client *dynamodb.Client, table string, requests []types.WriteRequest) error {
+	var writeErr error
+	for start := 0; start < len(requests); start += batchWriteSize {
+		batch := requests[start:min(start+batchWriteSize, len(requests))]
+		if failed := writeBatch(ctx, client, table, batch); len(failed) > 0 {
+			writeErr = errors.Join(writeErr, fmt.Errorf(
+				"%d of %d items not written: %w", len(failed), len(batch), failed[0].err,
+			))
+		}
+	}
+	return writeErr
+}
+
+type failedRequest struct {
+	index int
+	err   error
+}
+
+// writeBatch writes one batch and returns the requests that failed.
+func writeBatch(ctx context.Context, client *dynamodb.Client, table string, batch []types.WriteRequest) []failedRequest {
+	index := make(map[[2]string]int, len(batch))
+	for i, request := range batch {
+		index[requestKey(request)] = i
+	}
+
+	pending := batch
+	for attempt := range maxBatchAttempts {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return failAll(index, pending, ctx.Err())
+			case <-time.After(time.Duration(attempt*attempt) * batchRetryInterval):
+			}
+		}
+		out, err := client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{table: pending},
+		})
+		if err != nil {
+			return failAll(index, pending, err)
+		}
+		pending = out.UnprocessedItems[table]
+		if len(pending) == 0 {
+			return nil
+		}
+	}
+	// Необработанные элементы - признак нехватки ёмкости
+	return failAll(index, pending, fmt.Errorf(
+		"%w: left unprocessed after %d attempts", graph.ErrThrottled, maxBatchAttempts,
+	))
+}
+
+func failAll(index map[[2]string]int, requests []types.WriteRequest, err error) []failedRequest {
+	failed := make([]failedRequest, 0, len(requests))
+	for _, request := range requests {
+		failed = append(failed, failedRequest{index: index[requestKey(request)], err: err})
+	}
+	return failed
+}
+
+// requestKey returns the pk and sk of a put or delete request.
+func requestKey(request types.WriteRequest) [2]string {
+	item := map[string]types.AttributeValue(nil)
+	switch {
+	case request.PutRequest != nil:
+		item = request.PutRequest.Item
+	case request.DeleteRequest != nil:
+		item = request.DeleteRequest.Key
+	}
+	var key [2]string
+	for i, name := range []string{"pk", "sk"} {
+		if s, ok := item[name].(*types.AttributeValueMemberS); ok {
+			key[i] = s.Value
+		}
+	}
+	return key
+}
@@ -0,0 +1,183 @@
+package dynamodb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapError(t *testing.T) {
+	t.Run("Map API errors to graph errors", func(t *testing.T) {
+		tooLarge := &smithy.GenericAPIError{Code: "ValidationException", Message: "Item size has exceeded the maximum allowed size"}
+		missingKey := &smithy.GenericAPIError{
+			Code:    "ValidationException",
+			Message: "One or more parameter values were invalid: Missing the key sk in the item",
+		}
+		for err, kind := range map[error]error{
+			&types.ProvisionedThroughputExceededException{}:      graph.ErrThrottled,
+			&smithy.GenericAPIError{Code: "ThrottlingException"}: graph.ErrThrottled,
+			&types.ResourceNotFoundException{}:                   graph.ErrTableNotFound,
+			&types.ConditionalCheckFailedException{}:             graph.ErrConditionFailed,
+			tooLarge:                                             graph.ErrInvalidEdge,
+			missingKey:                                           graph.ErrInvalidEdge,
+			&types.TransactionCanceledException{CancellationReasons: []types.CancellationReason{
+				{Code: aws.String("None")},
+				{Code: aws.String("ConditionalCheckFailed")},
+			}}: graph.ErrConditionFailed,
+			&types.TransactionCanceledException{CancellationReasons: []types.CancellationReason{
+				{Code: aws.String("ValidationError"), Message: aws.String("Item size to update has exceeded the maximum allowed size")},
+			}}: graph.ErrInvalidEdge,
+		} {
+			mapped := MapError(fmt.Errorf("call: %w", err))
+			assert.ErrorIs(t, mapped, kind)
+			assert.ErrorIs(t, mapped, err, "the API error stays in the chain")
+			assert.Equal(t, mapped, MapError(mapped), "mapping twice changes nothing")
+		}
+	})
+	t.Run("Keep other errors", func(t *testing.T) {
+		err := errors.New("connection reset")
+		assert.Equal(t, err, MapError(err))
+		for _, err := range []error{
+			&smithy.GenericAPIError{Code: "ValidationException", Message: "Invalid UpdateExpression: Syntax error"},
+			&smithy.GenericAPIError{Code: "ValidationException", Message: "ExpressionAttributeValues must not be empty"},
+			&types.TransactionCanceledException{CancellationReasons: []types.CancellationReason{
+				{Code: aws.String("ValidationError"), Message: aws.String("Invalid ConditionExpression")},
+			}},
+		} {
+			assert.Equal(t, err, MapError(err), "a broken request is not an invalid edge")
+		}
+		assert.Nil(t, MapError(nil))
+	})
+}
+
+func TestBatchWrite(t *testing.T) {
+	edges := make([]graph.Edge, 0, 30)
+	requests := make([]types.WriteRequest, 0, 30)
+	for i := range 30 {
+		edge := graph.Edge{From: graph.Node(fmt.Sprintf("d%02d", i)), To: "s"}
+		edges = append(edges, edge)
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: edge.Demand()},
+			"sk": &types.AttributeValueMemberS{Value: edge.Supply()},
+		}}})
+	}
+
+	t.Run("Resend unprocessed items", func(t *testing.T) {
+		calls := 0
+		client := stubClient(func(body []byte) (int, string) {
+			calls++
+			if calls == 1 {
+				// Первая партия: одно ребро не обработано
+				return 200, `{"UnprocessedItems":{"graph":[{"PutRequest":{"Item":` +
+					`{"pk":{"S":"DEMAND#d03"},"sk":{"S":"SUPPLY#s"}}}}]}}`
+			}
+			return 200, `{}`
+		})
+		assert.NoError(t, BatchWrite(t.Context(), client, "graph", requests, edges))
+		assert.Equal(t, 3, calls)
+	})
+	t.Run("Report the edges of a failed batch", func(t *testing.T) {
+		client := stubClient(func(body []byte) (int, string) {
+			var in struct {
+				RequestItems map[string][]json.RawMessage
+			}
+			_ = json.Unmarshal(body, &in)
+			if len(in.RequestItems["graph"]) < batchWriteSize {
+				return 400, `{"__type":"com.amazonaws.dynamodb.v20120810#ValidationException","message":"Item size has exceeded the maximum allowed size"}`
+			}
+			return 200, `{}`
+		})
+		err := BatchWrite(t.Context(), client, "graph", requests, edges)
+		assert.ErrorIs(t, err, graph.ErrPartialWrite)
+		assert.ErrorIs(t, err, graph.ErrInvalidEdge)
+		var partial *graph.PartialWriteError
+		if assert.ErrorAs(t, err, &partial) {
+			assert.Equal(t, 25, partial.Written)
+			if assert.Len(t, partial.Failed, 5) {
+				assert.Equal(t, edges[25], partial.Failed[0].Edge)
+			}
+		}
+	})
+	t.Run("Return the error itself when nothing was written", func(t *testing.T) {
+		client := stubClient(func([]byte) (int, string) {
+			return 400, `{"__type":"com.amazonaws.dynamodb.v20120810#ResourceNotFoundException","message":"no table"}`
+		})
+		err := BatchWrite(t.Context(), client, "graph", requests, edges)
+		assert.ErrorIs(t, err, graph.ErrTableNotFound)
+		assert.NotErrorIs(t, err, graph.ErrPartialWrite)
+	})
+}
+
+func TestWriteItems(t *testing.T) {
+	requests := make([]types.WriteRequest, 0, 30)
+	for i := range 30 {
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: map[string]types.AttributeValue{
+			"node": &types.AttributeValueMemberS{Value: fmt.Sprintf("DEMAND#d%02d", i)},
+		}}})
+	}
+
+	t.Run("Resend unprocessed items", func(t *testing.T) {
+		calls := 0
+		client := stubClient(func([]byte) (int, string) {
+			calls++
+			if calls == 1 {
+				return 200, `{"UnprocessedItems":{"history":[{"PutRequest":{"Item":{"node":{"S":"DEMAND#d03"}}}}]}}`
+			}
+			return 200, `{}`
+		})
+		assert.NoError(t, WriteItems(t.Context(), client, "history", requests))
+		assert.Equal(t, 3, calls)
+	})
+	t.Run("Report items left unprocessed", func(t *testing.T) {
+		client := stubClient(func([]byte) (int, string) {
+			return 200, `{"UnprocessedItems":{"history":[{"PutRequest":{"Item":{"node":{"S":"DEMAND#d03"}}}}]}}`
+		})
+		err := WriteItems(t.Context(), client, "history", requests[:1])
+		assert.ErrorIs(t, err, graph.ErrThrottled)
+		assert.ErrorContains(t, err, "1 of 1 items not written")
+	})
+}
+
+type stubTransport func(body []byte) (int, string)
+
+func (f stubTransport) Do(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	status, out := f(body)
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/x-amz-json-1.0"}},
+		Body:       io.NopCloser(strings.NewReader(out)),
+		Request:    req,
+	}, nil
+}
+
+// stubClient answers every call with respond, calls are serialized.
+func stubClient(respond func(body []byte) (int, string)) *dynamodb.Client {
+	var mu sync.Mutex
+	return dynamodb.New(dynamodb.Options{
+		Region:           "us-east-1",
+		BaseEndpoint:     aws.String("http://dynamodb.test"),
+		Credentials:      aws.AnonymousCredentials{},
+		RetryMaxAttempts: 1,
+		HTTPClient: stubTransport(func(body []byte) (int, string) {
+			mu.Lock()
+			defer mu.Unlock()
+			return respond(body)
+		}),
+	}, withErrorMapping)
+}
@@ -0,0 +1,227 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	graphdb "github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	TableName = "graph_edge_history_tbl"
+
+	// Фиксированная ширина, чтобы ключи сортировались по времени
+	timeLayout = "2006-01-02T15:04:05.000000000Z"
+)
+
+type Change string
+
+const (
+	ChangeAdded   Change = "added"
+	ChangeUpdated Change = "updated"
+	ChangeRemoved Change = "removed"
+)
+
+// Entry is one change of an edge. Old values are empty for added edges,
+// new values are empty for removed ones.
+type Entry struct {
+	From, To graph.Node
+	At       time.Time
+	Change   Change
+	OldScore *graph.Score
+	NewScore *graph.Score
+	OldArea  graph.Area
+	NewArea  graph.Area
+	// Cause - use case или graph.CauseTTL. Удаление не пишет атрибутов, поэтому
+	// у удалений без TTL причина пустая
+	Cause string
+}
+
+type entryDTO struct {
+	PK       string   `dynamodbav:"node"` // DEMAND#{Node} или SUPPLY#{Node}
+	SK       string   `dynamodbav:"at"`   // {Time}#{EventID}
+	From     string   `dynamodbav:"from"`
+	To       string   `dynamodbav:"to"`
+	Change   string   `dynamodbav:"change"`
+	OldScore *float64 `dynamodbav:"old_score,omitempty"`
+	NewScore *float64 `dynamodbav:"new_score,omitempty"`
+	OldArea  string   `dynamodbav:"old_area,omitempty"`
+	NewArea  string   `dynamodbav:"new_area,omitempty"`
+	Cause    string   `dynamodbav:"cause,omitempty"`
+	TTL      int64    `dynamodbav:"ttl"` // retention (epoch time in seconds)
+}
+
+// Log is the append-only history of edge changes. It is filled from the
+// change feed: Log implements the stream consumer handler.
+type Log struct {
+	client    *dynamodb.Client
+	retention time.Duration
+}
+
+// New creates the audit log. Entries are kept for retention.
+func New(client *dynamodb.Client, retention time.Duration) *Log {
+	return &Log{client: client, retention: retention}
+}
+
+// Handle records every event under both the demand and the supply node.
+// Keys include the event id, so redelivered events overwrite their entries.
+func (l *Log) Handle(ctx context.Context, events []graph.EdgeEvent) error {
+	requests := make([]types.WriteRequest, 0, 2*len(events))
+	for _, event := range events {
+		id, entry, ok := toEntry(event)
+		if !ok {
+			continue
+		}
+		for _, node := range []string{entry.From.Demand(), entry.To.Supply()} {
+			av, err := attributevalue.MarshalMap(l.makeDTO(node, id, entry))
+			if err != nil {
+				return fmt.Errorf("failed to marshal history entry: %w", err)
+			}
+			requests = append(requests, types.WriteRequest{
+				PutRequest: &types.PutRequest{Item: av},
+			})
+		}
+	}
+
+	return graphdb.WriteItems(ctx, l.client, TableName, requests)
+}
+
+// History returns the changes of the node's edges between from and to,
+// both as a demand and as a supply, ordered by time.
+func (l *Log) History(ctx context.Context, node graph.Node, from, to time.Time) ([]Entry, error) {
+	entries := make([]Entry, 0)
+	for _, pk := range []string{node.Demand(), node.Supply()} {
+		var last map[string]types.AttributeValue
+		for {
+			out, err := l.client.Query(ctx, &dynamodb.QueryInput{
+				TableName:              aws.String(TableName),
+				KeyConditionExpression: aws.String("#node = :node AND #at BETWEEN :from AND :to"),
+				ExpressionAttributeNames: map[string]string{
+					"#node": "node",
+					"#at":   "at",
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":node": &types.AttributeValueMemberS{Value: pk},
+					":from": &types.AttributeValueMemberS{Value: from.UTC().Format(timeLayout)},
+					// "~" больше любого символа id события
+					":to": &types.AttributeValueMemberS{Value: to.UTC().Format(timeLayout) + "~"},
+				},
+				ExclusiveStartKey: last,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to query history: %w", err)
+			}
+			for _, item := range out.Items {
+				var dto entryDTO
+				if err = attributevalue.UnmarshalMap(item, &dto); err != nil {
+					return nil, fmt.Errorf("failed to unmarshal history entry: %w", err)
+				}
+				entries = append(entries, dto.entry())
+			}
+			if len(out.LastEvaluatedKey) == 0 {
+				break
+			}
+			last = out.LastEvaluatedKey
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b Entry) int {
+		return a.At.Compare(b.At)
+	})
+	return entries, nil
+}
+
+func toEntry(event graph.EdgeEvent) (string, Entry, bool) {
+	switch e := event.(type) {
+	case graph.EdgeAdded:
+		return e.ID, Entry{
+			From:     e.Edge.From,
+			To:       e.Edge.To,
+			At:       e.At,
+			Change:   ChangeAdded,
+			NewScore: &e.Edge.Score,
+			NewArea:  e.Edge.Area,
+			Cause:    e.Cause,
+		}, true
+	case graph.EdgeUpdated:
+		return e.ID, Entry{
+			From:     e.New.From,
+			To:       e.New.To,
+			At:       e.At,
+			Change:   ChangeUpdated,
+			OldScore: &e.Old.Score,
+			NewScore: &e.New.Score,
+			OldArea:  e.Old.Area,
+			NewArea:  e.New.Area,
+			Cause:    e.Cause,
+		}, true
+	case graph.EdgeRemoved:
+		return e.ID, Entry{
+			From:     e.Edge.From,
+			To:       e.Edge.To,
+			At:       e.At,
+			Change:   ChangeRemoved,
+			OldScore: &e.Edge.Score,
+			OldArea:  e.Edge.Area,
+			Cause:    e.Cause,
+		}, true
+	default:
+		return "", Entry{}, false
+	}
+}
+
+func (l *Log) makeDTO(node, id string, e Entry) entryDTO {
+	at := e.At.UTC()
+	return entryDTO{
+		PK:       node,
+		SK:       at.Format(timeLayout) + "#" + id,
+		From:     e.From.String(),
+		To:       e.To.String(),
+		Change:   string(e.Change),
+		OldScore: scorePtr(e.OldScore),
+		NewScore: scorePtr(e.NewScore),
+		OldArea:  string(e.OldArea),
+		NewArea:  string(e.NewArea),
+		Cause:    e.Cause,
+		TTL:      at.Add(l.retention).Unix(),
+	}
+}
+
+func (dto entryDTO) entry() Entry {
+	at, _, _ := strings.Cut(dto.SK, "#")
+	t, _ := time.Parse(timeLayout, at)
+	e := Entry{
+		From:    graph.Node(dto.From),
+		To:      graph.Node(dto.To),
+		At:      t,
+		Change:  Change(dto.Change),
+		OldArea: graph.Area(dto.OldArea),
+		NewArea: graph.Area(dto.NewArea),
+		Cause:   dto.Cause,
+	}
+	if dto.OldScore != nil {
+		old := graph.Score(*dto.OldScore)
+		e.OldScore = &old
+	}
+	if dto.NewScore != nil {
+		score := graph.Score(*dto.NewScore)
+		e.NewScore = &score
+	}
+	return e
+}
+
+func scorePtr(s *graph.Score) *float64 {
+	if s == nil {
+		return nil
+	}
+	f := s.Float64()
+	return &f
+}
@@ -0,0 +1,104 @@
+package history
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+)
+
+func score(s graph.Score) *graph.Score {
+	return &s
+}
+
+func TestLog_History(t *testing.T) {
+	t.Run("Record edge changes per node", func(t *testing.T) {
+		db, err := dynamodb.NewTestDatabase()
+		assert.NoError(t, err)
+
+		err = db.Migrate(context.Background())
+		assert.NoError(t, err)
+
+		defer db.Rollback(context.Background())
+
+		log := New(db.Client, 24*time.Hour)
+
+		start := time.Date(2025, 4, 9, 12, 0, 0, 0, time.UTC)
+		events := []graph.EdgeEvent{
+			graph.EdgeAdded{
+				ID:    "1",
+				Edge:  graph.Edge{From: "A", To: "B", Area: "Area1", Score: 10},
+				At:    start,
+				Cause: "demand.UseCase.Update",
+			},
+			graph.EdgeUpdated{
+				ID:    "2",
+				Old:   graph.Edge{From: "A", To: "B", Area: "Area1", Score: 10},
+				New:   graph.Edge{From: "A", To: "B", Area: "Area2", Score: 20},
+				At:    start.Add(time.Minute),
+				Cause: "supply.UseCase.Update",
+			},
+			graph.EdgeAdded{
+				ID:   "3",
+				Edge: graph.Edge{From: "C", To: "B", Area: "Area1", Score: 5},
+				At:   start.Add(2 * time.Minute),
+			},
+			graph.EdgeRemoved{
+				ID:      "4",
+				Edge:    graph.Edge{From: "A", To: "B", Area: "Area2", Score: 20},
+				At:      start.Add(time.Hour),
+				Cause:   graph.CauseTTL,
+				Expired: true,
+			},
+		}
+		err = log.Handle(context.Background(), events)
+		assert.NoError(t, err)
+
+		// Повторная доставка не дублирует записи
+		err = log.Handle(context.Background(), events[:1])
+		assert.NoError(t, err)
+
+		entries, err := log.History(context.Background(), "A", start, start.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, []Entry{
+			{
+				From:     "A",
+				To:       "B",
+				At:       start,
+				Change:   ChangeAdded,
+				NewScore: score(10),
+				NewArea:  "Area1",
+				Cause:    "demand.UseCase.Update",
+			},
+			{
+				From:     "A",
+				To:       "B",
+				At:       start.Add(time.Minute),
+				Change:   ChangeUpdated,
+				OldScore: score(10),
+				NewScore: score(20),
+				OldArea:  "Area1",
+				NewArea:  "Area2",
+				Cause:    "supply.UseCase.Update",
+			},
+			{
+				From:     "A",
+				To:       "B",
+				At:       start.Add(time.Hour),
+				Change:   ChangeRemoved,
+				OldScore: score(20),
+				OldArea:  "Area2",
+				Cause:    graph.CauseTTL,
+			},
+		}, entries)
+
+		entries, err = log.History(context.Background(), "B", start.Add(time.Minute), start.Add(30*time.Minute))
+		assert.NoError(t, err)
+		assert.Len(t, entries, 2)
+		assert.Equal(t, graph.Node("C"), entries[1].From)
+	})
+}
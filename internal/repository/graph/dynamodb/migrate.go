@@ -3,6 +3,7 @@ package dynamodb
 import (
 	"context"
 	"fmt"
+	"slices"
 
 	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/migrate"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -15,9 +16,50 @@ type Migration interface {
 	TableName() string
 }
 
+// sharedMigrations create the tables every strategy relies on.
+func sharedMigrations() []Migration {
+	return []Migration{
+		&migrate.CreateStreamCheckpointsTable{},
+		&migrate.CreateEdgeHistoryTable{},
+		&migrate.CreateAreaSnapshotsTable{},
+	}
+}
+
+// migrations returns the shared migrations followed by the ones of the
+// chosen strategies, e.g. both ends of a dual-write migration. Without
+// strategies the tables of every registered strategy are created, which
+// is what tests of a strategy package need.
+func (d *DynamoDb) migrations() ([]Migration, error) {
+	migrations, err := d.strategyMigrations()
+	if err != nil {
+		return nil, err
+	}
+	return append(sharedMigrations(), migrations...), nil
+}
+
+// strategyMigrations returns the migrations of the chosen strategies only.
+func (d *DynamoDb) strategyMigrations() ([]Migration, error) {
+	names := d.Strategies
+	if len(names) == 0 {
+		names = Strategies()
+	}
+
+	opts := StrategyOptions{AreaShards: d.AreaShards}
+	var migrations []Migration
+	for _, name := range names {
+		strategy, err := LookupStrategy(name)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, strategy.Migrations(opts)...)
+	}
+	return migrations, nil
+}
+
 func (d *DynamoDb) Migrate(ctx context.Context) error {
-	migrations := []Migration{
-		&migrate.CreateAdjacencyListsTableWithGSI{},
+	migrations, err := d.migrations()
+	if err != nil {
+		return err
 	}
 	for _, migration := range migrations {
 		if err := migration.Up(ctx, d.Client); err != nil {
@@ -28,11 +70,27 @@ func (d *DynamoDb) Migrate(ctx context.Context) error {
 }
 
 func (d *DynamoDb) Rollback(ctx context.Context) error {
-	migrations := []Migration{
-		&migrate.CreateAdjacencyListsTableWithGSI{},
+	migrations, err := d.migrations()
+	if err != nil {
+		return err
 	}
-	for _, migration := range migrations {
-		if err := migration.Down(ctx, d.Client); err != nil {
+	return rollback(ctx, d.Client, migrations)
+}
+
+// RollbackStrategies reverts the migrations of the chosen strategies and
+// keeps the shared tables, e.g. the edge history, other strategies use.
+func (d *DynamoDb) RollbackStrategies(ctx context.Context) error {
+	migrations, err := d.strategyMigrations()
+	if err != nil {
+		return err
+	}
+	return rollback(ctx, d.Client, migrations)
+}
+
+func rollback(ctx context.Context, client *dynamodb.Client, migrations []Migration) error {
+	// Откатываем в обратном порядке
+	for _, migration := range slices.Backward(migrations) {
+		if err := migration.Down(ctx, client); err != nil {
 			return fmt.Errorf("could not revert migration %s: %w", migration.Version(), err)
 		}
 	}
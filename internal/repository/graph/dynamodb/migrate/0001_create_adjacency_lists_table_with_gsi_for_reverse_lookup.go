@@ -33,9 +33,13 @@ func (m *CreateAdjacencyListsTableWithGSI) Up(ctx context.Context, client *dynam
 				AttributeType: types.ScalarAttributeTypeS,
 			},
 			{
-				AttributeName: aws.String("ak"), // Доп. Sort Key для LSI
+				AttributeName: aws.String("ak"), // Ключ области для ak-gsi
 				AttributeType: types.ScalarAttributeTypeS,
 			},
+			{
+				AttributeName: aws.String("score"), // Вес ребра для score-lsi
+				AttributeType: types.ScalarAttributeTypeN,
+			},
 		},
 		// Define the key schema for the table
 		KeySchema: []types.KeySchemaElement{
@@ -48,6 +52,26 @@ func (m *CreateAdjacencyListsTableWithGSI) Up(ctx context.Context, client *dynam
 				KeyType:       types.KeyTypeRange,
 			},
 		},
+		// LSI можно объявить только при создании таблицы,
+		// см. AddScoreIndexForTopDemandEdges
+		LocalSecondaryIndexes: []types.LocalSecondaryIndex{
+			{
+				IndexName: aws.String("score-lsi"),
+				KeySchema: []types.KeySchemaElement{
+					{
+						AttributeName: aws.String("pk"),
+						KeyType:       types.KeyTypeHash,
+					},
+					{
+						AttributeName: aws.String("score"),
+						KeyType:       types.KeyTypeRange,
+					},
+				},
+				Projection: &types.Projection{
+					ProjectionType: types.ProjectionTypeAll,
+				},
+			},
+		},
 		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{
 			// GSI для поиска по sk (обратный поиск)
 			{
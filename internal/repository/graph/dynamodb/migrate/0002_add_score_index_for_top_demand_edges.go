@@ -0,0 +1,49 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// AddScoreIndexForTopDemandEdges gives every demand partition a score-sorted view.
+//
+// The view is score-lsi, an LSI with pk as the hash key and the numeric
+// score as the range key, so top edge reads are strongly consistent. An LSI
+// can only be declared when a table is created, so CreateAdjacencyListsTableWithGSI
+// declares it. This migration checks that the table has it: a table created
+// before cannot get one and has to be rebuilt, e.g. exported, dropped,
+// migrated and imported back.
+type AddScoreIndexForTopDemandEdges struct{}
+
+const scoreIndexName = "score-lsi"
+
+func (m *AddScoreIndexForTopDemandEdges) Version() string {
+	return "20250406000000_graph_based_on_gsi_score_index"
+}
+
+func (m *AddScoreIndexForTopDemandEdges) TableName() string {
+	return "graph_based_on_gsi_tbl"
+}
+
+func (m *AddScoreIndexForTopDemandEdges) Up(ctx context.Context, client *dynamodb.Client) error {
+	out, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(m.TableName()),
+	})
+	if err != nil {
+		return err
+	}
+	for _, lsi := range out.Table.LocalSecondaryIndexes {
+		if aws.ToString(lsi.IndexName) == scoreIndexName {
+			return nil
+		}
+	}
+	return fmt.Errorf("table %s has no %s, it was created without it and has to be rebuilt", m.TableName(), scoreIndexName)
+}
+
+// Down does nothing: the index is deleted with the table.
+func (m *AddScoreIndexForTopDemandEdges) Down(ctx context.Context, client *dynamodb.Client) error {
+	return nil
+}
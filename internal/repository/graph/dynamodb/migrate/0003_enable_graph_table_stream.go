@@ -0,0 +1,53 @@
+package migrate
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// EnableGraphTableStream turns on DynamoDB Streams with old and new images,
+// which the change-feed consumer turns into edge events.
+type EnableGraphTableStream struct{}
+
+func (m *EnableGraphTableStream) Version() string {
+	return "20250408000000_graph_based_on_gsi_stream"
+}
+
+func (m *EnableGraphTableStream) TableName() string {
+	return "graph_based_on_gsi_tbl"
+}
+
+func (m *EnableGraphTableStream) Up(ctx context.Context, client *dynamodb.Client) error {
+	_, err := client.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+		TableName: aws.String(m.TableName()),
+		StreamSpecification: &types.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: types.StreamViewTypeNewAndOldImages,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return dynamodb.NewTableExistsWaiter(client).Wait(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(m.TableName()),
+	}, 5*time.Minute)
+}
+
+func (m *EnableGraphTableStream) Down(ctx context.Context, client *dynamodb.Client) error {
+	_, err := client.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+		TableName: aws.String(m.TableName()),
+		StreamSpecification: &types.StreamSpecification{
+			StreamEnabled: aws.Bool(false),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return dynamodb.NewTableExistsWaiter(client).Wait(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(m.TableName()),
+	}, 5*time.Minute)
+}
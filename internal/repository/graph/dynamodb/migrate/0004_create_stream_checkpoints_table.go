@@ -0,0 +1,67 @@
+package migrate
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// CreateStreamCheckpointsTable stores the last processed sequence number
+// of every stream shard per consumer.
+type CreateStreamCheckpointsTable struct{}
+
+func (m *CreateStreamCheckpointsTable) Version() string {
+	return "20250408000001_stream_checkpoints_table"
+}
+
+func (m *CreateStreamCheckpointsTable) TableName() string {
+	return "graph_stream_checkpoints_tbl"
+}
+
+func (m *CreateStreamCheckpointsTable) Up(ctx context.Context, client *dynamodb.Client) error {
+	_, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		BillingMode: types.BillingModePayPerRequest,
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("consumer"), // Имя потребителя
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("shard"), // Идентификатор шарда
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("consumer"),
+				KeyType:       types.KeyTypeHash,
+			},
+			{
+				AttributeName: aws.String("shard"),
+				KeyType:       types.KeyTypeRange,
+			},
+		},
+		TableName: aws.String(m.TableName()),
+	})
+	if err != nil {
+		return err
+	}
+	return dynamodb.NewTableExistsWaiter(client).Wait(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(m.TableName()),
+	}, 5*time.Minute)
+}
+
+func (m *CreateStreamCheckpointsTable) Down(ctx context.Context, client *dynamodb.Client) error {
+	_, err := client.DeleteTable(ctx, &dynamodb.DeleteTableInput{
+		TableName: aws.String(m.TableName()),
+	})
+	if err != nil {
+		return err
+	}
+	return dynamodb.NewTableNotExistsWaiter(client).Wait(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(m.TableName()),
+	}, 5*time.Minute)
+}
@@ -0,0 +1,78 @@
+package migrate
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// CreateEdgeHistoryTable creates the append-only audit log of edge changes.
+// Entries expire through TTL after the retention period.
+type CreateEdgeHistoryTable struct{}
+
+func (m *CreateEdgeHistoryTable) Version() string {
+	return "20250409000000_edge_history_table"
+}
+
+func (m *CreateEdgeHistoryTable) TableName() string {
+	return "graph_edge_history_tbl"
+}
+
+func (m *CreateEdgeHistoryTable) Up(ctx context.Context, client *dynamodb.Client) error {
+	_, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		BillingMode: types.BillingModePayPerRequest,
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("node"), // DEMAND#{Node} или SUPPLY#{Node}
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("at"), // {Time}#{EventID}
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("node"),
+				KeyType:       types.KeyTypeHash,
+			},
+			{
+				AttributeName: aws.String("at"),
+				KeyType:       types.KeyTypeRange,
+			},
+		},
+		TableName: aws.String(m.TableName()),
+	})
+	if err != nil {
+		return err
+	}
+	err = dynamodb.NewTableExistsWaiter(client).Wait(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(m.TableName()),
+	}, 5*time.Minute)
+	if err != nil {
+		return err
+	}
+	_, err = client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(m.TableName()),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String("ttl"),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	return err
+}
+
+func (m *CreateEdgeHistoryTable) Down(ctx context.Context, client *dynamodb.Client) error {
+	_, err := client.DeleteTable(ctx, &dynamodb.DeleteTableInput{
+		TableName: aws.String(m.TableName()),
+	})
+	if err != nil {
+		return err
+	}
+	return dynamodb.NewTableNotExistsWaiter(client).Wait(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(m.TableName()),
+	}, 5*time.Minute)
+}
@@ -0,0 +1,78 @@
+package migrate
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// CreateAreaSnapshotsTable stores compressed snapshots of area graphs taken on ticks.
+// Snapshots expire through TTL after the retention period.
+type CreateAreaSnapshotsTable struct{}
+
+func (m *CreateAreaSnapshotsTable) Version() string {
+	return "20250410000000_area_snapshots_table"
+}
+
+func (m *CreateAreaSnapshotsTable) TableName() string {
+	return "graph_area_snapshots_tbl"
+}
+
+func (m *CreateAreaSnapshotsTable) Up(ctx context.Context, client *dynamodb.Client) error {
+	_, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		BillingMode: types.BillingModePayPerRequest,
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("area"), // Область
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("tick"), // {Time}#{Part}
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("area"),
+				KeyType:       types.KeyTypeHash,
+			},
+			{
+				AttributeName: aws.String("tick"),
+				KeyType:       types.KeyTypeRange,
+			},
+		},
+		TableName: aws.String(m.TableName()),
+	})
+	if err != nil {
+		return err
+	}
+	err = dynamodb.NewTableExistsWaiter(client).Wait(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(m.TableName()),
+	}, 5*time.Minute)
+	if err != nil {
+		return err
+	}
+	_, err = client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(m.TableName()),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String("ttl"),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	return err
+}
+
+func (m *CreateAreaSnapshotsTable) Down(ctx context.Context, client *dynamodb.Client) error {
+	_, err := client.DeleteTable(ctx, &dynamodb.DeleteTableInput{
+		TableName: aws.String(m.TableName()),
+	})
+	if err != nil {
+		return err
+	}
+	return dynamodb.NewTableNotExistsWaiter(client).Wait(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(m.TableName()),
+	}, 5*time.Minute)
+}
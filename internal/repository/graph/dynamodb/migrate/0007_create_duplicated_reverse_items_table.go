@@ -0,0 +1,121 @@
+package migrate
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// CreateDuplicatedReverseItemsTable creates the table of the strategy that
+// stores every edge twice: under the demand and under the supply partition.
+// Reverse lookups are base-table queries, so no sk-gsi is needed.
+type CreateDuplicatedReverseItemsTable struct{}
+
+func (m *CreateDuplicatedReverseItemsTable) Version() string {
+	return "20250413000000_duplicated_reverse_items_table"
+}
+
+func (m *CreateDuplicatedReverseItemsTable) TableName() string {
+	return "graph_duplicated_reverse_items_tbl"
+}
+
+func (m *CreateDuplicatedReverseItemsTable) Up(ctx context.Context, client *dynamodb.Client) error {
+	_, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		BillingMode: types.BillingModePayPerRequest,
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("pk"), // DEMAND#{Node} или SUPPLY#{Node}
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("sk"), // SUPPLY#{Node} или DEMAND#{Node}
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("ak"), // Ключ области, только у прямых элементов
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("score"), // Вес ребра для score-lsi
+				AttributeType: types.ScalarAttributeTypeN,
+			},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("pk"),
+				KeyType:       types.KeyTypeHash,
+			},
+			{
+				AttributeName: aws.String("sk"),
+				KeyType:       types.KeyTypeRange,
+			},
+		},
+		// Таблица новая, поэтому сортировку по весу можно сделать LSI
+		LocalSecondaryIndexes: []types.LocalSecondaryIndex{
+			{
+				IndexName: aws.String("score-lsi"),
+				KeySchema: []types.KeySchemaElement{
+					{
+						AttributeName: aws.String("pk"),
+						KeyType:       types.KeyTypeHash,
+					},
+					{
+						AttributeName: aws.String("score"),
+						KeyType:       types.KeyTypeRange,
+					},
+				},
+				Projection: &types.Projection{
+					ProjectionType: types.ProjectionTypeAll,
+				},
+			},
+		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{
+			// Разреженный индекс: обратные элементы без ak в него не попадают
+			{
+				IndexName: aws.String("ak-gsi"),
+				KeySchema: []types.KeySchemaElement{
+					{
+						AttributeName: aws.String("ak"),
+						KeyType:       types.KeyTypeHash,
+					},
+				},
+				Projection: &types.Projection{
+					ProjectionType: types.ProjectionTypeAll,
+				},
+			},
+		},
+		TableName: aws.String(m.TableName()),
+	})
+	if err != nil {
+		return err
+	}
+	err = dynamodb.NewTableExistsWaiter(client).Wait(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(m.TableName()),
+	}, 5*time.Minute)
+	if err != nil {
+		return err
+	}
+	_, err = client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(m.TableName()),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String("ttl"),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	return err
+}
+
+func (m *CreateDuplicatedReverseItemsTable) Down(ctx context.Context, client *dynamodb.Client) error {
+	_, err := client.DeleteTable(ctx, &dynamodb.DeleteTableInput{
+		TableName: aws.String(m.TableName()),
+	})
+	if err != nil {
+		return err
+	}
+	return dynamodb.NewTableNotExistsWaiter(client).Wait(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(m.TableName()),
+	}, 5*time.Minute)
+}
@@ -0,0 +1,46 @@
+package dynamodb
+
+import (
+	"context"
+	"maps"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// OperationCounter counts API calls by operation name, e.g. BatchWriteItem.
+// Retries of a call are not counted again.
+type OperationCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func NewOperationCounter() *OperationCounter {
+	return &OperationCounter{counts: make(map[string]int)}
+}
+
+// AddTo makes every client created from cfg report its calls to the counter.
+func (c *OperationCounter) AddTo(cfg *aws.Config) {
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc(
+			"CountOperations",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+				middleware.InitializeOutput, middleware.Metadata, error,
+			) {
+				c.mu.Lock()
+				c.counts[awsmiddleware.GetOperationName(ctx)]++
+				c.mu.Unlock()
+				return next.HandleInitialize(ctx, in)
+			},
+		), middleware.After)
+	})
+}
+
+// Counts returns a copy of the counts.
+func (c *OperationCounter) Counts() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.counts)
+}
@@ -0,0 +1,258 @@
+package snapshot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	TableName = "graph_area_snapshots_tbl"
+
+	// Размер одной части снимка, с запасом до лимита элемента в 400 KB
+	partSize = 350 * 1024
+
+	// Фиксированная ширина, чтобы ключи сортировались по времени
+	timeLayout = "2006-01-02T15:04:05.000000000Z"
+)
+
+// partDTO is one part of a gzip-compressed snapshot. Large areas do not
+// fit into a single item, so the blob is split over consecutive sort keys.
+type partDTO struct {
+	Area  string `dynamodbav:"area"`
+	Tick  string `dynamodbav:"tick"` // {Time}#{Part}
+	Parts int    `dynamodbav:"parts"`
+	Blob  []byte `dynamodbav:"blob"`
+	TTL   int64  `dynamodbav:"ttl"` // retention (epoch time in seconds)
+}
+
+type snapshotJSON struct {
+	Area       string            `json:"area"`
+	Tick       time.Time         `json:"tick"`
+	Edges      []edgeJSON        `json:"edges"`
+	Matches    map[string]string `json:"matches"`
+	MatchError string            `json:"match_error,omitempty"`
+}
+
+type edgeJSON struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Score     float64   `json:"score"`
+	Area      string    `json:"area"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// Store keeps area snapshots as compressed blobs keyed by area and tick.
+type Store struct {
+	client    *dynamodb.Client
+	retention time.Duration
+}
+
+// New creates the snapshot store. Snapshots are kept for retention.
+func New(client *dynamodb.Client, retention time.Duration) *Store {
+	return &Store{client: client, retention: retention}
+}
+
+// Save writes the snapshot. Saving the same area and tick again overwrites it.
+func (s *Store) Save(ctx context.Context, snapshot graph.Snapshot) error {
+	blob, err := encode(snapshot)
+	if err != nil {
+		return err
+	}
+	tick := snapshot.Tick.UTC()
+	parts := slices.Collect(slices.Chunk(blob, partSize))
+	for i, part := range parts {
+		av, err := attributevalue.MarshalMap(partDTO{
+			Area:  string(snapshot.Area),
+			Tick:  partKey(tick, i),
+			Parts: len(parts),
+			Blob:  part,
+			TTL:   tick.Add(s.retention).Unix(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal snapshot: %w", err)
+		}
+		if _, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(TableName),
+			Item:      av,
+		}); err != nil {
+			return fmt.Errorf("failed to put snapshot part %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Load reads the snapshot of the area taken at tick.
+func (s *Store) Load(ctx context.Context, area graph.Area, tick time.Time) (graph.Snapshot, error) {
+	prefix := tick.UTC().Format(timeLayout) + "#"
+	items, err := s.query(ctx, area, "begins_with(#tick, :prefix)", map[string]types.AttributeValue{
+		":prefix": &types.AttributeValueMemberS{Value: prefix},
+	}, false)
+	if err != nil {
+		return graph.Snapshot{}, err
+	}
+	if len(items) == 0 {
+		return graph.Snapshot{}, fmt.Errorf("no snapshot of %s at %s", area, tick.UTC().Format(time.RFC3339Nano))
+	}
+	if items[0].Parts != len(items) {
+		return graph.Snapshot{}, fmt.Errorf("snapshot of %s at %s is incomplete: %d of %d parts",
+			area, tick.UTC().Format(time.RFC3339Nano), len(items), items[0].Parts)
+	}
+	var blob []byte
+	for _, item := range items {
+		blob = append(blob, item.Blob...)
+	}
+	return decode(blob)
+}
+
+// Ticks lists the ticks of the area that have a snapshot between from and to.
+func (s *Store) Ticks(ctx context.Context, area graph.Area, from, to time.Time) ([]time.Time, error) {
+	items, err := s.query(ctx, area, "#tick BETWEEN :from AND :to", map[string]types.AttributeValue{
+		":from": &types.AttributeValueMemberS{Value: from.UTC().Format(timeLayout)},
+		// "~" больше любого номера части
+		":to": &types.AttributeValueMemberS{Value: to.UTC().Format(timeLayout) + "~"},
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+	ticks := make([]time.Time, 0, len(items))
+	for _, item := range items {
+		at, part, _ := strings.Cut(item.Tick, "#")
+		if part != partKeySuffix(0) {
+			continue
+		}
+		t, err := time.Parse(timeLayout, at)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snapshot key %q: %w", item.Tick, err)
+		}
+		ticks = append(ticks, t)
+	}
+	return ticks, nil
+}
+
+func (s *Store) query(
+	ctx context.Context,
+	area graph.Area,
+	condition string,
+	values map[string]types.AttributeValue,
+	keysOnly bool,
+) ([]partDTO, error) {
+	values[":area"] = &types.AttributeValueMemberS{Value: string(area)}
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(TableName),
+		KeyConditionExpression: aws.String("#area = :area AND " + condition),
+		ExpressionAttributeNames: map[string]string{
+			"#area": "area",
+			"#tick": "tick",
+		},
+		ExpressionAttributeValues: values,
+	}
+	if keysOnly {
+		// Для списка тиков блобы не нужны
+		input.ProjectionExpression = aws.String("#area, #tick")
+	}
+
+	items := make([]partDTO, 0)
+	for {
+		out, err := s.client.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query snapshots: %w", err)
+		}
+		for _, item := range out.Items {
+			var dto partDTO
+			if err = attributevalue.UnmarshalMap(item, &dto); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal snapshot: %w", err)
+			}
+			items = append(items, dto)
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			return items, nil
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+func partKey(tick time.Time, part int) string {
+	return tick.Format(timeLayout) + "#" + partKeySuffix(part)
+}
+
+func partKeySuffix(part int) string {
+	return fmt.Sprintf("%03d", part)
+}
+
+func encode(snapshot graph.Snapshot) ([]byte, error) {
+	dto := snapshotJSON{
+		Area:       string(snapshot.Area),
+		Tick:       snapshot.Tick.UTC(),
+		Edges:      make([]edgeJSON, 0, len(snapshot.Edges)),
+		Matches:    make(map[string]string, len(snapshot.Matches)),
+		MatchError: snapshot.MatchError,
+	}
+	for _, e := range snapshot.Edges {
+		dto.Edges = append(dto.Edges, edgeJSON{
+			From:      e.From.String(),
+			To:        e.To.String(),
+			Score:     e.Score.Float64(),
+			Area:      string(e.Area),
+			ExpiresAt: e.ExpiresAt,
+		})
+	}
+	for node, partner := range snapshot.Matches {
+		dto.Matches[node.String()] = partner.String()
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(dto); err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress snapshot: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func decode(blob []byte) (graph.Snapshot, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(blob))
+	if err != nil {
+		return graph.Snapshot{}, fmt.Errorf("failed to decompress snapshot: %w", err)
+	}
+	defer zr.Close()
+
+	var dto snapshotJSON
+	if err = json.NewDecoder(zr).Decode(&dto); err != nil {
+		return graph.Snapshot{}, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	snapshot := graph.Snapshot{
+		Area:       graph.Area(dto.Area),
+		Tick:       dto.Tick,
+		Edges:      make([]graph.Edge, 0, len(dto.Edges)),
+		Matches:    make(graph.Matching, len(dto.Matches)),
+		MatchError: dto.MatchError,
+	}
+	for _, e := range dto.Edges {
+		snapshot.Edges = append(snapshot.Edges, graph.Edge{
+			From:      graph.Node(e.From),
+			To:        graph.Node(e.To),
+			Score:     graph.Score(e.Score),
+			Area:      graph.Area(e.Area),
+			ExpiresAt: e.ExpiresAt,
+		})
+	}
+	for node, partner := range dto.Matches {
+		snapshot.Matches[graph.Node(node)] = graph.Node(partner)
+	}
+	return snapshot, nil
+}
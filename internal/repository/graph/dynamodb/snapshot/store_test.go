@@ -0,0 +1,71 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+)
+
+func TestStore_Load(t *testing.T) {
+	t.Run("Save and load area snapshots", func(t *testing.T) {
+		db, err := dynamodb.NewTestDatabase()
+		assert.NoError(t, err)
+
+		err = db.Migrate(context.Background())
+		assert.NoError(t, err)
+
+		defer db.Rollback(context.Background())
+
+		store := New(db.Client, 24*time.Hour)
+
+		tick := time.Date(2025, 4, 10, 12, 0, 0, 0, time.UTC)
+		small := graph.Snapshot{
+			Area: "Area1",
+			Tick: tick,
+			Edges: []graph.Edge{
+				{From: "A", To: "B", Area: "Area1", Score: 10, ExpiresAt: tick.Add(time.Hour)},
+				{From: "C", To: "B", Area: "Area1", Score: 5},
+			},
+			Matches: graph.Matching{"A": "B", "B": "A"},
+		}
+		assert.NoError(t, store.Save(context.Background(), small))
+
+		// Большая область не помещается в один элемент и делится на части
+		large := graph.Snapshot{
+			Area:       "Area1",
+			Tick:       tick.Add(time.Second),
+			Matches:    graph.Matching{},
+			MatchError: "matcher failed",
+		}
+		for i := range 40000 {
+			large.Edges = append(large.Edges, graph.Edge{
+				From:  graph.Node(fmt.Sprintf("demand-%x", i*7919)),
+				To:    graph.Node(fmt.Sprintf("supply-%x", i*104729)),
+				Area:  "Area1",
+				Score: graph.Score(i),
+			})
+		}
+		assert.NoError(t, store.Save(context.Background(), large))
+
+		loaded, err := store.Load(context.Background(), "Area1", small.Tick)
+		assert.NoError(t, err)
+		assert.Equal(t, small, loaded)
+
+		loaded, err = store.Load(context.Background(), "Area1", large.Tick)
+		assert.NoError(t, err)
+		assert.Equal(t, large, loaded)
+
+		ticks, err := store.Ticks(context.Background(), "Area1", tick, tick.Add(time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, []time.Time{small.Tick, large.Tick}, ticks)
+
+		_, err = store.Load(context.Background(), "Area2", tick)
+		assert.Error(t, err)
+	})
+}
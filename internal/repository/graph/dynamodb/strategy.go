@@ -0,0 +1,98 @@
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// GraphRepository is what every storage strategy of the graph implements.
+// A write that stored only some of its edges returns a
+// *graph.PartialWriteError. Clients made by NewDatabase wrap DynamoDB
+// errors with the graph errors of their kind, e.g. graph.ErrThrottled.
+// Reads a strategy serves from a global secondary index, e.g. the supply
+// edges of the adjacency lists, are eventually consistent.
+type GraphRepository interface {
+	Size(ctx context.Context) (int, error)
+	UpsertEdges(ctx context.Context, edges ...graph.Edge) error
+	RemoveEdges(ctx context.Context, edges ...graph.Edge) error
+	ReadDemandEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error)
+	ReadTopDemandEdges(ctx context.Context, node graph.Node, n int) ([]graph.Edge, error)
+	ReadSupplyEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error)
+	ReadAreaEdges(ctx context.Context, area graph.Area) ([]graph.Edge, error)
+	RemoveNodeEdges(ctx context.Context, node graph.Node) error
+	RemoveDemandEdges(ctx context.Context, node graph.Node) error
+}
+
+// StrategyOptions are the settings shared by all strategies.
+type StrategyOptions struct {
+	// AreaShards - число шардов ключа области, 0 или 1 - без шардирования
+	AreaShards int
+	// PreviousAreaShards - число шардов, с которым записаны ключи области до
+	// смены AreaShards, пока ShardAreaKeys списков смежности их не переписал:
+	// 1 - без шардирования, 0 - раскладка не меняется
+	PreviousAreaShards int
+	// Rules - границы записываемых рёбер, нулевое значение - graph.DefaultRules.
+	// Стратегия получает их уже заполненными, см. RegisterStrategy
+	Rules graph.Rules
+}
+
+// Strategy is a way to lay the graph out in DynamoDB: the repository
+// and the migrations that create its tables.
+type Strategy struct {
+	Name       string
+	New        func(client *dynamodb.Client, opts StrategyOptions) GraphRepository
+	Migrations func(opts StrategyOptions) []Migration
+	// Counters - стратегия ведёт счётчики рёбер по областям и узлам в тех же
+	// транзакциях, что и рёбра, и её Size точен. Без них Size приблизителен
+	Counters bool
+}
+
+var (
+	strategiesMu sync.RWMutex
+	strategies   = make(map[string]Strategy)
+)
+
+// RegisterStrategy makes a strategy available by name. Strategy packages
+// call it from init, so a binary offers the strategies it imports.
+// It panics if the name is registered twice. The repositories of the
+// strategy get the options with zero Rules replaced by graph.DefaultRules.
+func RegisterStrategy(s Strategy) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	if _, ok := strategies[s.Name]; ok {
+		panic(fmt.Sprintf("dynamodb: strategy %q registered twice", s.Name))
+	}
+	if newRepository := s.New; newRepository != nil {
+		s.New = func(client *dynamodb.Client, opts StrategyOptions) GraphRepository {
+			if opts.Rules == (graph.Rules{}) {
+				opts.Rules = graph.DefaultRules()
+			}
+			return newRepository(client, opts)
+		}
+	}
+	strategies[s.Name] = s
+}
+
+// LookupStrategy returns the strategy registered under name.
+func LookupStrategy(name string) (Strategy, error) {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	s, ok := strategies[name]
+	if !ok {
+		return Strategy{}, fmt.Errorf("unknown storage strategy %q, registered: %v", name, slices.Sorted(maps.Keys(strategies)))
+	}
+	return s, nil
+}
+
+// Strategies returns the names of the registered strategies in order.
+func Strategies() []string {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	return slices.Sorted(maps.Keys(strategies))
+}
@@ -0,0 +1,82 @@
+package dynamodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+)
+
+// shardsMigration records the options the migrations were built with.
+type shardsMigration struct {
+	Migration
+	shards int
+}
+
+func TestStrategyRegistry(t *testing.T) {
+	var got StrategyOptions
+	RegisterStrategy(Strategy{
+		Name: "test-strategy",
+		New: func(_ *dynamodb.Client, opts StrategyOptions) GraphRepository {
+			got = opts
+			return nil
+		},
+		Migrations: func(opts StrategyOptions) []Migration {
+			return []Migration{&shardsMigration{shards: opts.AreaShards}}
+		},
+	})
+	defer func() {
+		strategiesMu.Lock()
+		delete(strategies, "test-strategy")
+		strategiesMu.Unlock()
+	}()
+
+	t.Run("Look up a registered strategy", func(t *testing.T) {
+		s, err := LookupStrategy("test-strategy")
+		assert.NoError(t, err)
+		assert.Equal(t, "test-strategy", s.Name)
+		assert.Contains(t, Strategies(), "test-strategy")
+	})
+
+	t.Run("Fill in the default edge rules", func(t *testing.T) {
+		s, err := LookupStrategy("test-strategy")
+		assert.NoError(t, err)
+
+		s.New(nil, StrategyOptions{AreaShards: 4})
+		assert.Equal(t, StrategyOptions{AreaShards: 4, Rules: graph.DefaultRules()}, got)
+
+		rules := graph.Rules{MaxScore: 1, MaxTTL: time.Hour}
+		s.New(nil, StrategyOptions{Rules: rules})
+		assert.Equal(t, rules, got.Rules)
+	})
+
+	t.Run("Unknown strategy", func(t *testing.T) {
+		_, err := LookupStrategy("missing")
+		assert.ErrorContains(t, err, `unknown storage strategy "missing"`)
+	})
+
+	t.Run("Register twice", func(t *testing.T) {
+		assert.Panics(t, func() {
+			RegisterStrategy(Strategy{Name: "test-strategy"})
+		})
+	})
+
+	t.Run("Migrate only the chosen strategy", func(t *testing.T) {
+		db := &DynamoDb{Strategies: []string{"test-strategy"}, AreaShards: 4}
+		migrations, err := db.migrations()
+		assert.NoError(t, err)
+		assert.Len(t, migrations, len(sharedMigrations())+1)
+		assert.Equal(t, &shardsMigration{shards: 4}, migrations[len(migrations)-1])
+
+		own, err := db.strategyMigrations()
+		assert.NoError(t, err)
+		assert.Equal(t, []Migration{&shardsMigration{shards: 4}}, own, "shared tables are not rolled back with the strategy")
+
+		db.Strategies = []string{"missing"}
+		_, err = db.migrations()
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,415 @@
+// Package strategytest checks that a storage strategy of the graph
+// behaves like the others. Strategy packages call Run from their tests,
+// it needs DynamoDB Local like the rest of the repository tests.
+package strategytest
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	graphdb "github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+)
+
+// Run runs the conformance tests against the repositories the strategy
+// builds. Every test migrates the tables of the strategy and drops them
+// when it ends.
+func Run(t *testing.T, strategy graphdb.Strategy) {
+	t.Run("UpsertEdges", func(t *testing.T) { testUpsertEdges(t, strategy) })
+	t.Run("UpdateEdges", func(t *testing.T) { testUpdateEdges(t, strategy) })
+	t.Run("ReadDemandEdges", func(t *testing.T) { testReadDemandEdges(t, strategy) })
+	t.Run("ReadTopDemandEdges", func(t *testing.T) { testReadTopDemandEdges(t, strategy) })
+	t.Run("ReadSupplyEdges", func(t *testing.T) { testReadSupplyEdges(t, strategy) })
+	t.Run("ReadAreaEdges", func(t *testing.T) { testReadAreaEdges(t, strategy) })
+	t.Run("ReadShardedAreaEdges", func(t *testing.T) { testReadShardedAreaEdges(t, strategy) })
+	t.Run("RemoveEdges", func(t *testing.T) { testRemoveEdges(t, strategy) })
+	t.Run("RemoveNodeEdges", func(t *testing.T) { testRemoveNodeEdges(t, strategy) })
+	t.Run("RemoveDemandEdges", func(t *testing.T) { testRemoveDemandEdges(t, strategy) })
+}
+
+// Open migrates the tables of the strategy and builds its repository.
+// The tables are dropped when the test ends.
+func Open(t *testing.T, strategy graphdb.Strategy, opts graphdb.StrategyOptions) graphdb.GraphRepository {
+	t.Helper()
+	db, err := graphdb.NewTestDatabase()
+	require.NoError(t, err)
+	db.Strategies = []string{strategy.Name}
+	db.AreaShards = opts.AreaShards
+	require.NoError(t, db.Migrate(context.Background()))
+	t.Cleanup(func() { db.Rollback(context.Background()) })
+	return strategy.New(db.Client, opts)
+}
+
+// size returns the number of edges the repository reports.
+func size(t *testing.T, repo graphdb.GraphRepository) int {
+	t.Helper()
+	n, err := repo.Size(context.Background())
+	require.NoError(t, err)
+	return n
+}
+
+// MakeEdges returns n edges of a chain spread over three areas.
+func MakeEdges(n int) []graph.Edge {
+	edges := make([]graph.Edge, n)
+	for i := 0; i < n; i++ {
+		edges[i] = graph.Edge{
+			From:  graph.Node(strconv.Itoa(i)),
+			To:    graph.Node(strconv.Itoa(i + 1)),
+			Area:  graph.Area(strconv.Itoa(i % 3)),
+			Score: graph.Score(float64(i * 10)),
+			TTL:   24 * time.Hour,
+		}
+	}
+	return edges
+}
+
+// WithoutExpiry drops the stored expiry, which depends on the write time.
+func WithoutExpiry(edges []graph.Edge) []graph.Edge {
+	out := make([]graph.Edge, 0, len(edges))
+	for _, e := range edges {
+		e.ExpiresAt = time.Time{}
+		out = append(out, e)
+	}
+	return out
+}
+
+// SortEdges orders edges by their demand and then supply node.
+func SortEdges(edges []graph.Edge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+}
+
+func testUpsertEdges(t *testing.T, strategy graphdb.Strategy) {
+	testCases := []struct {
+		name         string
+		edges        []graph.Edge
+		expectedSize int
+	}{
+		{
+			name: "Insert single edge",
+			edges: []graph.Edge{
+				{From: "A", To: "B", Area: "Area1", Score: 10, TTL: 24 * time.Hour},
+			},
+			expectedSize: 1,
+		},
+		{
+			name: "Insert multiple edges",
+			edges: []graph.Edge{
+				{From: "B", To: "C", Area: "Area2", Score: 20, TTL: 24 * time.Hour},
+				{From: "C", To: "B", Area: "Area2", Score: 20, TTL: 24 * time.Hour},
+				{From: "A", To: "D", Area: "Area2", Score: 15, TTL: 24 * time.Hour},
+				{From: "D", To: "E", Area: "Area2", Score: 25, TTL: time.Hour},
+				{From: "E", To: "F", Area: "Area2", Score: 30, TTL: 24 * time.Hour},
+				{From: "F", To: "G", Area: "Area2", Score: 35, TTL: 24 * time.Hour},
+			},
+			expectedSize: 6,
+		},
+		{
+			name: "Insert duplicate edges",
+			edges: []graph.Edge{
+				{From: "A", To: "B", Area: "Area1", Score: 10, TTL: 24 * time.Hour},
+				{From: "A", To: "B", Area: "Area1", Score: 15, TTL: 24 * time.Hour}, // Updated score
+			},
+			expectedSize: 1,
+		},
+		{
+			name:         "Insert more than 25 edges",
+			edges:        MakeEdges(30),
+			expectedSize: 30,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := Open(t, strategy, graphdb.StrategyOptions{})
+
+			err := repo.UpsertEdges(context.Background(), tc.edges...)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tc.expectedSize, size(t, repo))
+		})
+	}
+
+	t.Run("Reject invalid edges", func(t *testing.T) {
+		repo := Open(t, strategy, graphdb.StrategyOptions{
+			Rules: graph.Rules{MinScore: 0, MaxScore: 100, MinTTL: time.Minute, MaxTTL: 24 * time.Hour},
+		})
+		valid := graph.Edge{From: "A", To: "B", Area: "Area1", Score: 10, TTL: time.Hour}
+		expired := graph.Edge{From: "A", To: "C", Area: "Area1", Score: 10}
+
+		err := repo.UpsertEdges(context.Background(), valid, expired)
+		assert.ErrorIs(t, err, graph.ErrInvalidEdge)
+		var invalid *graph.ValidationError
+		if assert.ErrorAs(t, err, &invalid) && assert.Len(t, invalid.Invalid, 1) {
+			assert.Equal(t, expired, invalid.Invalid[0].Edge)
+		}
+		assert.Equal(t, 0, size(t, repo), "nothing is written")
+	})
+}
+
+func testUpdateEdges(t *testing.T, strategy graphdb.Strategy) {
+	t.Run("Update existing edge", func(t *testing.T) {
+		repo := Open(t, strategy, graphdb.StrategyOptions{})
+
+		err := repo.UpsertEdges(context.Background(),
+			graph.Edge{From: "A", To: "B", Area: "Area1", Score: 10, TTL: 24 * time.Hour})
+		assert.NoError(t, err)
+
+		// Update the edge with a new score
+		err = repo.UpsertEdges(context.Background(),
+			graph.Edge{From: "A", To: "B", Area: "Area1", Score: 20, TTL: 24 * time.Hour})
+		assert.NoError(t, err)
+
+		assert.Equal(t, 1, size(t, repo))
+
+		edges, err := repo.ReadDemandEdges(context.Background(), "A")
+		assert.NoError(t, err)
+		require.Len(t, edges, 1)
+		assert.Equal(t, graph.Score(20), edges[0].Score)
+	})
+	t.Run("Update existing edge with diff area", func(t *testing.T) {
+		repo := Open(t, strategy, graphdb.StrategyOptions{})
+
+		err := repo.UpsertEdges(context.Background(),
+			graph.Edge{From: "A", To: "B", Area: "Area1", Score: 10, TTL: 24 * time.Hour})
+		assert.NoError(t, err)
+
+		// Update the edge with a different area
+		err = repo.UpsertEdges(context.Background(),
+			graph.Edge{From: "A", To: "B", Area: "Area2", Score: 10, TTL: 24 * time.Hour})
+		assert.NoError(t, err)
+
+		assert.Equal(t, 1, size(t, repo))
+
+		edges, err := repo.ReadDemandEdges(context.Background(), "A")
+		assert.NoError(t, err)
+		require.Len(t, edges, 1)
+		assert.Equal(t, graph.Area("Area2"), edges[0].Area)
+	})
+}
+
+func testReadDemandEdges(t *testing.T, strategy graphdb.Strategy) {
+	repo := Open(t, strategy, graphdb.StrategyOptions{})
+
+	edges := []graph.Edge{
+		{From: "A", To: "B", Area: "Area1", Score: 67.77868, TTL: 24 * time.Hour},
+		{From: "B", To: "C", Area: "Area1", Score: 20, TTL: 24 * time.Hour},
+		{From: "C", To: "D", Area: "Area1", Score: 0.4556456, TTL: 24 * time.Hour},
+		{From: "A", To: "С", Area: "Area1", Score: 45.54656, TTL: 24 * time.Hour},
+		{From: "A", To: "G", Area: "Area1", Score: 344, TTL: 24 * time.Hour},
+	}
+	expected := []graph.Edge{
+		{From: "A", To: "B", Area: "Area1", Score: 67.77868},
+		{From: "A", To: "G", Area: "Area1", Score: 344},
+		{From: "A", To: "С", Area: "Area1", Score: 45.54656},
+	}
+
+	err := repo.UpsertEdges(context.Background(), edges...)
+	assert.NoError(t, err)
+
+	retrievedEdges, err := repo.ReadDemandEdges(context.Background(), "A")
+	assert.NoError(t, err)
+	SortEdges(retrievedEdges)
+	assert.EqualValues(t, expected, WithoutExpiry(retrievedEdges))
+	for _, e := range retrievedEdges {
+		assert.WithinDuration(t, time.Now().Add(24*time.Hour), e.ExpiresAt, time.Minute)
+	}
+}
+
+func testReadTopDemandEdges(t *testing.T, strategy graphdb.Strategy) {
+	repo := Open(t, strategy, graphdb.StrategyOptions{})
+
+	edges := []graph.Edge{
+		{From: "A", To: "B", Area: "Area1", Score: 67.77868, TTL: 24 * time.Hour},
+		{From: "A", To: "C", Area: "Area1", Score: 0.4556456, TTL: 24 * time.Hour},
+		{From: "A", To: "D", Area: "Area1", Score: 344, TTL: 24 * time.Hour},
+		{From: "E", To: "B", Area: "Area1", Score: 1000, TTL: 24 * time.Hour},
+	}
+	expected := []graph.Edge{
+		{From: "A", To: "D", Area: "Area1", Score: 344},
+		{From: "A", To: "B", Area: "Area1", Score: 67.77868},
+	}
+
+	err := repo.UpsertEdges(context.Background(), edges...)
+	assert.NoError(t, err)
+
+	retrievedEdges, err := repo.ReadTopDemandEdges(context.Background(), "A", 2)
+	assert.NoError(t, err)
+	assert.EqualValues(t, expected, WithoutExpiry(retrievedEdges))
+}
+
+func testReadSupplyEdges(t *testing.T, strategy graphdb.Strategy) {
+	repo := Open(t, strategy, graphdb.StrategyOptions{})
+
+	edges := []graph.Edge{
+		{From: "A", To: "B", Area: "Area1", Score: 67.77868, TTL: 24 * time.Hour},
+		{From: "B", To: "C", Area: "Area1", Score: 20, TTL: 24 * time.Hour},
+		{From: "C", To: "D", Area: "Area1", Score: 0.4556456, TTL: 24 * time.Hour},
+		{From: "E", To: "B", Area: "Area1", Score: 45.54656, TTL: 24 * time.Hour},
+	}
+	expected := []graph.Edge{
+		{From: "A", To: "B", Area: "Area1", Score: 67.77868},
+		{From: "E", To: "B", Area: "Area1", Score: 45.54656},
+	}
+
+	err := repo.UpsertEdges(context.Background(), edges...)
+	assert.NoError(t, err)
+
+	retrievedEdges, err := repo.ReadSupplyEdges(context.Background(), "B")
+	assert.NoError(t, err)
+	SortEdges(retrievedEdges)
+	assert.EqualValues(t, expected, WithoutExpiry(retrievedEdges))
+}
+
+func testReadAreaEdges(t *testing.T, strategy graphdb.Strategy) {
+	repo := Open(t, strategy, graphdb.StrategyOptions{})
+
+	edges := []graph.Edge{
+		{From: "A", To: "B", Area: "Area1", Score: 67.77868, TTL: 24 * time.Hour},
+		{From: "ttt", To: "ggg", Area: "Area2", Score: 0.4556456, TTL: 24 * time.Hour},
+		{From: "C", To: "B", Area: "Area1", Score: 25, TTL: 24 * time.Hour},
+	}
+	expected := []graph.Edge{
+		{From: "A", To: "B", Area: "Area1", Score: 67.77868},
+		{From: "C", To: "B", Area: "Area1", Score: 25},
+	}
+
+	err := repo.UpsertEdges(context.Background(), edges...)
+	assert.NoError(t, err)
+
+	retrievedEdges, err := repo.ReadAreaEdges(context.Background(), "Area1")
+	assert.NoError(t, err)
+	SortEdges(retrievedEdges)
+	assert.EqualValues(t, expected, WithoutExpiry(retrievedEdges))
+}
+
+func testReadShardedAreaEdges(t *testing.T, strategy graphdb.Strategy) {
+	repo := Open(t, strategy, graphdb.StrategyOptions{AreaShards: 4})
+
+	edges := []graph.Edge{
+		{From: "A", To: "B", Area: "Area1", Score: 67.77868, TTL: 24 * time.Hour},
+		{From: "ttt", To: "ggg", Area: "Area2", Score: 0.4556456, TTL: 24 * time.Hour},
+		{From: "C", To: "B", Area: "Area1", Score: 25, TTL: 24 * time.Hour},
+		{From: "C", To: "D", Area: "Area1", Score: 12, TTL: 24 * time.Hour},
+	}
+	expected := []graph.Edge{
+		{From: "A", To: "B", Area: "Area1", Score: 67.77868},
+		{From: "C", To: "B", Area: "Area1", Score: 25},
+		{From: "C", To: "D", Area: "Area1", Score: 12},
+	}
+
+	err := repo.UpsertEdges(context.Background(), edges...)
+	assert.NoError(t, err)
+
+	retrievedEdges, err := repo.ReadAreaEdges(context.Background(), "Area1")
+	assert.NoError(t, err)
+	SortEdges(retrievedEdges)
+	assert.EqualValues(t, expected, WithoutExpiry(retrievedEdges))
+}
+
+func testRemoveEdges(t *testing.T, strategy graphdb.Strategy) {
+	repo := Open(t, strategy, graphdb.StrategyOptions{})
+
+	edges := []graph.Edge{
+		{From: "A", To: "B", Area: "Area1", Score: 67.77868, TTL: 24 * time.Hour},
+		{From: "B", To: "C", Area: "Area1", Score: 20, TTL: 24 * time.Hour},
+		{From: "C", To: "D", Area: "Area1", Score: 0.4556456, TTL: 24 * time.Hour},
+	}
+	remove := []graph.Edge{
+		{From: "A", To: "B", Area: "Area1"},
+		{From: "R", To: "Q", Area: "Area1"}, // Non-existing edge
+	}
+
+	err := repo.UpsertEdges(context.Background(), edges...)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, size(t, repo))
+
+	err = repo.RemoveEdges(context.Background(), remove...)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, size(t, repo))
+
+	retrievedEdges, err := repo.ReadDemandEdges(context.Background(), "A")
+	assert.NoError(t, err)
+	assert.Len(t, retrievedEdges, 0)
+
+	retrievedEdges, err = repo.ReadDemandEdges(context.Background(), "B")
+	assert.NoError(t, err)
+	require.Len(t, retrievedEdges, 1)
+	assert.Equal(t, graph.Node("C"), retrievedEdges[0].To)
+}
+
+func testRemoveNodeEdges(t *testing.T, strategy graphdb.Strategy) {
+	repo := Open(t, strategy, graphdb.StrategyOptions{})
+
+	edges := []graph.Edge{
+		{From: "A", To: "B", Area: "Area1", Score: 67.77868, TTL: 24 * time.Hour},
+		{From: "B", To: "C", Area: "Area1", Score: 20, TTL: 24 * time.Hour},
+		{From: "C", To: "D", Area: "Area1", Score: 0.4556456, TTL: 24 * time.Hour},
+		{From: "E", To: "B", Area: "Area1", Score: 45.54656, TTL: 24 * time.Hour},
+	}
+
+	err := repo.UpsertEdges(context.Background(), edges...)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, size(t, repo))
+
+	// Remove all edges associated with node "B"
+	err = repo.RemoveNodeEdges(context.Background(), "B")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, size(t, repo))
+
+	retrievedEdges, err := repo.ReadDemandEdges(context.Background(), "B")
+	assert.NoError(t, err)
+	assert.Len(t, retrievedEdges, 0)
+
+	retrievedEdges, err = repo.ReadDemandEdges(context.Background(), "A")
+	assert.NoError(t, err)
+	assert.Len(t, retrievedEdges, 0)
+
+	retrievedEdges, err = repo.ReadDemandEdges(context.Background(), "C")
+	assert.NoError(t, err)
+	require.Len(t, retrievedEdges, 1)
+	assert.Equal(t, graph.Node("D"), retrievedEdges[0].To)
+}
+
+func testRemoveDemandEdges(t *testing.T, strategy graphdb.Strategy) {
+	repo := Open(t, strategy, graphdb.StrategyOptions{})
+
+	edges := []graph.Edge{
+		{From: "O1", To: "D1", Area: "Area1", Score: 67.77868, TTL: 24 * time.Hour},
+		{From: "O1", To: "D2", Area: "Area1", Score: 20, TTL: 24 * time.Hour},
+		{From: "O2", To: "D1", Area: "Area1", Score: 0.4556456, TTL: 24 * time.Hour},
+		{From: "O2", To: "D5", Area: "Area1", Score: 45.54656, TTL: 24 * time.Hour},
+		{From: "O3", To: "D5", Area: "Area1", Score: 45.54656, TTL: 24 * time.Hour},
+		{From: "O3", To: "D6", Area: "Area1", Score: 45.54656, TTL: 24 * time.Hour},
+	}
+
+	err := repo.UpsertEdges(context.Background(), edges...)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, size(t, repo))
+
+	// Remove all edges associated with node "O2"
+	err = repo.RemoveDemandEdges(context.Background(), "O2")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, size(t, repo))
+
+	retrievedEdges, err := repo.ReadDemandEdges(context.Background(), "O2")
+	assert.NoError(t, err)
+	assert.Len(t, retrievedEdges, 0)
+
+	retrievedEdges, err = repo.ReadDemandEdges(context.Background(), "O1")
+	assert.NoError(t, err)
+	assert.Len(t, retrievedEdges, 2)
+
+	retrievedEdges, err = repo.ReadDemandEdges(context.Background(), "O3")
+	assert.NoError(t, err)
+	assert.Len(t, retrievedEdges, 2)
+}
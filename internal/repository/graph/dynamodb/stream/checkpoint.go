@@ -0,0 +1,76 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const CheckpointsTableName = "graph_stream_checkpoints_tbl"
+
+// Checkpoint is the position of a consumer in one stream shard.
+type Checkpoint struct {
+	Consumer       string `dynamodbav:"consumer"`
+	Shard          string `dynamodbav:"shard"`
+	SequenceNumber string `dynamodbav:"seq,omitempty"` // последняя обработанная запись
+	Closed         bool   `dynamodbav:"closed"`        // шард закрыт и прочитан до конца
+}
+
+// Checkpoints keeps consumer checkpoints in DynamoDB.
+type Checkpoints struct {
+	client *dynamodb.Client
+}
+
+func NewCheckpoints(client *dynamodb.Client) *Checkpoints {
+	return &Checkpoints{client: client}
+}
+
+// Load returns all checkpoints of the consumer keyed by shard id.
+func (c *Checkpoints) Load(ctx context.Context, consumer string) (map[string]Checkpoint, error) {
+	checkpoints := make(map[string]Checkpoint)
+
+	var last map[string]types.AttributeValue
+	for {
+		out, err := c.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(CheckpointsTableName),
+			KeyConditionExpression: aws.String("consumer = :consumer"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":consumer": &types.AttributeValueMemberS{Value: consumer},
+			},
+			ConsistentRead:    aws.Bool(true),
+			ExclusiveStartKey: last,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query checkpoints: %w", err)
+		}
+		for _, item := range out.Items {
+			var cp Checkpoint
+			if err = attributevalue.UnmarshalMap(item, &cp); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal checkpoint: %w", err)
+			}
+			checkpoints[cp.Shard] = cp
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			return checkpoints, nil
+		}
+		last = out.LastEvaluatedKey
+	}
+}
+
+func (c *Checkpoints) Save(ctx context.Context, cp Checkpoint) error {
+	item, err := attributevalue.MarshalMap(cp)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	if _, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(CheckpointsTableName),
+		Item:      item,
+	}); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
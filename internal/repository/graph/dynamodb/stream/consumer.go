@@ -0,0 +1,309 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/adjacency-lists-with-gsi-for-reverse-lookup"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+// Handler receives the edge events of one GetRecords page in shard order.
+// If it fails the checkpoint is not moved and the page is delivered again,
+// so handlers must tolerate duplicates.
+type Handler interface {
+	Handle(ctx context.Context, events []graph.EdgeEvent) error
+}
+
+type HandlerFunc func(ctx context.Context, events []graph.EdgeEvent) error
+
+func (f HandlerFunc) Handle(ctx context.Context, events []graph.EdgeEvent) error {
+	return f(ctx, events)
+}
+
+// Handlers passes every page to each handler in turn and stops at the first
+// error, so one consumer can feed several readers of the same feed.
+type Handlers []Handler
+
+func (h Handlers) Handle(ctx context.Context, events []graph.EdgeEvent) error {
+	for _, handler := range h {
+		if err := handler.Handle(ctx, events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Consumer reads the change feed of the graph table and passes edge events
+// to a handler. Shards are read parent first, the position in every shard
+// is checkpointed in DynamoDB under the consumer name.
+type Consumer struct {
+	name         string
+	table        string
+	streams      *dynamodbstreams.Client
+	client       *dynamodb.Client
+	checkpoints  *Checkpoints
+	handler      Handler
+	pollInterval time.Duration
+	batchSize    int32
+	areaShards   int
+	// Раскладка ключей области до смены числа шардов, 0 - не меняется
+	previousAreaShards int
+
+	streamArn string
+	iterators map[string]string // shard id -> следующий итератор
+}
+
+type Option func(*Consumer)
+
+// WithTable reads the stream of another table with the same item layout.
+func WithTable(table string) Option {
+	return func(c *Consumer) {
+		c.table = table
+	}
+}
+
+func WithPollInterval(d time.Duration) Option {
+	return func(c *Consumer) {
+		c.pollInterval = d
+	}
+}
+
+// WithAreaShards sets the number of shards the area keys of the table are
+// split into, see graph.Edge.AreaKey.
+func WithAreaShards(n int) Option {
+	return func(c *Consumer) {
+		c.areaShards = n
+	}
+}
+
+// WithPreviousAreaShards sets the shard count the area keys had before
+// they started moving to the one of WithAreaShards, 1 for unsharded keys.
+func WithPreviousAreaShards(n int) Option {
+	return func(c *Consumer) {
+		c.previousAreaShards = n
+	}
+}
+
+// WithBatchSize limits the number of records per GetRecords call.
+func WithBatchSize(n int32) Option {
+	return func(c *Consumer) {
+		c.batchSize = n
+	}
+}
+
+func New(
+	name string,
+	streams *dynamodbstreams.Client,
+	client *dynamodb.Client,
+	handler Handler,
+	opts ...Option,
+) *Consumer {
+	c := &Consumer{
+		name:         name,
+		table:        adjacency_lists_with_gsi_for_reverse_lookup.TableName,
+		streams:      streams,
+		client:       client,
+		checkpoints:  NewCheckpoints(client),
+		handler:      handler,
+		pollInterval: time.Second,
+		batchSize:    1000,
+		iterators:    make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Run polls the stream until ctx is done or the handler fails.
+func (c *Consumer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+	for {
+		if err := c.Poll(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll reads every shard that is ready up to its current end.
+// A child shard becomes ready once its parent is read to the end.
+func (c *Consumer) Poll(ctx context.Context) error {
+	if c.streamArn == "" {
+		out, err := c.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+			TableName: aws.String(c.table),
+		})
+		if err != nil {
+			return fmt.Errorf("describe table %s: %w", c.table, err)
+		}
+		if out.Table.LatestStreamArn == nil {
+			return fmt.Errorf("table %s has no stream", c.table)
+		}
+		c.streamArn = aws.ToString(out.Table.LatestStreamArn)
+	}
+
+	shards, err := c.listShards(ctx)
+	if err != nil {
+		return err
+	}
+	checkpoints, err := c.checkpoints.Load(ctx, c.name)
+	if err != nil {
+		return err
+	}
+
+	listed := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		listed[aws.ToString(shard.ShardId)] = true
+	}
+
+	// Повторяем проход, пока закрываются шарды: за родителем сразу читаем потомков
+	for progress := true; progress; {
+		progress = false
+		for _, shard := range shards {
+			id := aws.ToString(shard.ShardId)
+			cp := checkpoints[id]
+			if cp.Closed {
+				continue
+			}
+			// Родителя, которого уже нет в потоке, считаем прочитанным
+			if parent := aws.ToString(shard.ParentShardId); parent != "" && listed[parent] && !checkpoints[parent].Closed {
+				continue
+			}
+			cp.Consumer, cp.Shard = c.name, id
+			closed, err := c.readShard(ctx, &cp)
+			checkpoints[id] = cp
+			if err != nil {
+				return fmt.Errorf("shard %s: %w", id, err)
+			}
+			progress = progress || closed
+		}
+	}
+	return nil
+}
+
+func (c *Consumer) listShards(ctx context.Context) ([]types.Shard, error) {
+	var (
+		shards []types.Shard
+		last   *string
+	)
+	for {
+		out, err := c.streams.DescribeStream(ctx, &dynamodbstreams.DescribeStreamInput{
+			StreamArn:             aws.String(c.streamArn),
+			ExclusiveStartShardId: last,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("describe stream: %w", err)
+		}
+		shards = append(shards, out.StreamDescription.Shards...)
+		if out.StreamDescription.LastEvaluatedShardId == nil {
+			return shards, nil
+		}
+		last = out.StreamDescription.LastEvaluatedShardId
+	}
+}
+
+// readShard delivers the records of the shard up to its current end and
+// reports whether the shard is closed and fully read.
+func (c *Consumer) readShard(ctx context.Context, cp *Checkpoint) (bool, error) {
+	iterator, ok := c.iterators[cp.Shard]
+	if !ok {
+		var err error
+		if iterator, err = c.shardIterator(ctx, cp); err != nil {
+			return false, err
+		}
+	}
+
+	for {
+		if iterator == "" {
+			// Закрытый шард без записей после контрольной точки
+			cp.Closed = true
+			return true, c.checkpoints.Save(ctx, *cp)
+		}
+		out, err := c.streams.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{
+			ShardIterator: aws.String(iterator),
+			Limit:         aws.Int32(c.batchSize),
+		})
+		var expired *types.ExpiredIteratorException
+		if errors.As(err, &expired) {
+			// Итератор живёт 15 минут, берём новый от контрольной точки
+			delete(c.iterators, cp.Shard)
+			if iterator, err = c.shardIterator(ctx, cp); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if err != nil {
+			delete(c.iterators, cp.Shard)
+			return false, fmt.Errorf("get records: %w", err)
+		}
+
+		if len(out.Records) > 0 {
+			events := make([]graph.EdgeEvent, 0, len(out.Records))
+			for _, record := range out.Records {
+				if event, ok := decodeRecord(record, c.areaShards, c.previousAreaShards); ok {
+					events = append(events, event)
+				}
+			}
+			if len(events) > 0 {
+				if err = c.handler.Handle(ctx, events); err != nil {
+					// Следующий опрос перечитает страницу от контрольной точки
+					delete(c.iterators, cp.Shard)
+					return false, fmt.Errorf("handle events: %w", err)
+				}
+			}
+			cp.SequenceNumber = aws.ToString(out.Records[len(out.Records)-1].Dynamodb.SequenceNumber)
+		}
+
+		next := aws.ToString(out.NextShardIterator)
+		if next == "" {
+			delete(c.iterators, cp.Shard)
+			cp.Closed = true
+			return true, c.checkpoints.Save(ctx, *cp)
+		}
+		c.iterators[cp.Shard] = next
+		if len(out.Records) == 0 {
+			return false, nil
+		}
+		if err = c.checkpoints.Save(ctx, *cp); err != nil {
+			return false, err
+		}
+		iterator = next
+	}
+}
+
+func (c *Consumer) shardIterator(ctx context.Context, cp *Checkpoint) (string, error) {
+	input := &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         aws.String(c.streamArn),
+		ShardId:           aws.String(cp.Shard),
+		ShardIteratorType: types.ShardIteratorTypeTrimHorizon,
+	}
+	if cp.SequenceNumber != "" {
+		input.ShardIteratorType = types.ShardIteratorTypeAfterSequenceNumber
+		input.SequenceNumber = aws.String(cp.SequenceNumber)
+	}
+	out, err := c.streams.GetShardIterator(ctx, input)
+	var trimmed *types.TrimmedDataAccessException
+	if errors.As(err, &trimmed) && cp.SequenceNumber != "" {
+		// Записи после контрольной точки уже удалены из потока (24 часа)
+		input.ShardIteratorType = types.ShardIteratorTypeTrimHorizon
+		input.SequenceNumber = nil
+		out, err = c.streams.GetShardIterator(ctx, input)
+	}
+	if err != nil {
+		return "", fmt.Errorf("get shard iterator: %w", err)
+	}
+	return aws.ToString(out.ShardIterator), nil
+}
@@ -0,0 +1,184 @@
+package stream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/dynamodb/adjacency-lists-with-gsi-for-reverse-lookup"
+)
+
+type recordingHandler struct {
+	events []graph.EdgeEvent
+}
+
+func (h *recordingHandler) Handle(_ context.Context, events []graph.EdgeEvent) error {
+	h.events = append(h.events, events...)
+	return nil
+}
+
+// withoutTime drops the fields that differ between runs.
+func withoutTime(events []graph.EdgeEvent) []graph.EdgeEvent {
+	out := make([]graph.EdgeEvent, 0, len(events))
+	for _, event := range events {
+		switch e := event.(type) {
+		case graph.EdgeAdded:
+			e.ID, e.At, e.Edge.ExpiresAt = "", time.Time{}, time.Time{}
+			out = append(out, e)
+		case graph.EdgeUpdated:
+			e.ID, e.At, e.Old.ExpiresAt, e.New.ExpiresAt = "", time.Time{}, time.Time{}, time.Time{}
+			out = append(out, e)
+		case graph.EdgeRemoved:
+			e.ID, e.At, e.Edge.ExpiresAt = "", time.Time{}, time.Time{}
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func TestConsumer_Poll(t *testing.T) {
+	t.Run("Turn stream records into edge events", func(t *testing.T) {
+		db, err := dynamodb.NewTestDatabase()
+		assert.NoError(t, err)
+
+		err = db.Migrate(context.Background())
+		assert.NoError(t, err)
+
+		defer db.Rollback(context.Background())
+
+		repo := adjacency_lists_with_gsi_for_reverse_lookup.New(db.Client)
+		handler := &recordingHandler{}
+		consumer := New("test", db.StreamsClient, db.Client, handler)
+
+		err = repo.UpsertEdges(context.Background(),
+			graph.Edge{From: "A", To: "B", Area: "Area1", Score: 10, TTL: time.Hour},
+		)
+		assert.NoError(t, err)
+		err = repo.UpsertEdges(graph.WithCause(context.Background(), "test"),
+			graph.Edge{From: "A", To: "B", Area: "Area1", Score: 20, TTL: time.Hour},
+		)
+		assert.NoError(t, err)
+		err = repo.RemoveEdges(context.Background(), graph.Edge{From: "A", To: "B"})
+		assert.NoError(t, err)
+
+		err = consumer.Poll(context.Background())
+		assert.NoError(t, err)
+
+		expected := []graph.EdgeEvent{
+			graph.EdgeAdded{
+				Edge: graph.Edge{From: "A", To: "B", Area: "Area1", Score: 10},
+			},
+			graph.EdgeUpdated{
+				Old:   graph.Edge{From: "A", To: "B", Area: "Area1", Score: 10},
+				New:   graph.Edge{From: "A", To: "B", Area: "Area1", Score: 20},
+				Cause: "test",
+			},
+			graph.EdgeRemoved{
+				Edge: graph.Edge{From: "A", To: "B", Area: "Area1", Score: 20},
+			},
+		}
+		assert.Equal(t, expected, withoutTime(handler.events))
+
+		// Новый потребитель с тем же именем продолжает от контрольной точки
+		resumed := &recordingHandler{}
+		err = New("test", db.StreamsClient, db.Client, resumed).Poll(context.Background())
+		assert.NoError(t, err)
+		assert.Empty(t, resumed.events)
+
+		err = repo.UpsertEdges(context.Background(),
+			graph.Edge{From: "C", To: "D", Area: "Area2", Score: 5, TTL: time.Hour},
+		)
+		assert.NoError(t, err)
+
+		err = consumer.Poll(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, handler.events, 4)
+	})
+}
+
+func TestDecodeRecord_TTLDeletion(t *testing.T) {
+	record := types.Record{
+		EventName: types.OperationTypeRemove,
+		Dynamodb: &types.StreamRecord{
+			OldImage: map[string]types.AttributeValue{
+				"pk":    &types.AttributeValueMemberS{Value: "DEMAND#A"},
+				"sk":    &types.AttributeValueMemberS{Value: "SUPPLY#B"},
+				"ak":    &types.AttributeValueMemberS{Value: "AREA#Area1#03"},
+				"score": &types.AttributeValueMemberN{Value: "10"},
+				"ttl":   &types.AttributeValueMemberN{Value: "1700000000"},
+			},
+		},
+		UserIdentity: &types.Identity{
+			Type:        aws.String("Service"),
+			PrincipalId: aws.String("dynamodb.amazonaws.com"),
+		},
+	}
+
+	event, ok := decodeRecord(record, 4, 0)
+	assert.True(t, ok)
+	assert.Equal(t, graph.EdgeRemoved{
+		Edge: graph.Edge{
+			From:      "A",
+			To:        "B",
+			Area:      "Area1",
+			Score:     10,
+			ExpiresAt: time.Unix(1700000000, 0).UTC(),
+		},
+		Cause:   graph.CauseTTL,
+		Expired: true,
+	}, event)
+
+	record.UserIdentity = nil
+	event, ok = decodeRecord(record, 4, 0)
+	assert.True(t, ok)
+	assert.False(t, event.(graph.EdgeRemoved).Expired)
+}
+
+func TestDecodeRecord_AreaKeysOnTheMove(t *testing.T) {
+	edge := graph.Edge{From: "A", To: "B", Area: "zone#12"}
+	for _, shards := range []int{0, 4} {
+		event, ok := decodeRecord(types.Record{
+			EventName: types.OperationTypeInsert,
+			Dynamodb: &types.StreamRecord{
+				NewImage: map[string]types.AttributeValue{
+					"pk": &types.AttributeValueMemberS{Value: edge.Demand()},
+					"sk": &types.AttributeValueMemberS{Value: edge.Supply()},
+					"ak": &types.AttributeValueMemberS{Value: edge.AreaKey(shards)},
+				},
+			},
+		}, 4, 1)
+		require.True(t, ok)
+		assert.Equal(t, edge.Area, event.(graph.EdgeAdded).Edge.Area, "key in %d shards", shards)
+	}
+}
+
+func TestHandlers_Handle(t *testing.T) {
+	events := []graph.EdgeEvent{graph.EdgeAdded{Edge: graph.Edge{From: "A", To: "B", Area: "Area1"}}}
+
+	t.Run("Pass the page to every handler", func(t *testing.T) {
+		first, second := &recordingHandler{}, &recordingHandler{}
+
+		err := Handlers{first, second}.Handle(context.Background(), events)
+		require.NoError(t, err)
+
+		assert.Equal(t, events, first.events)
+		assert.Equal(t, events, second.events)
+	})
+	t.Run("Stop at the first error", func(t *testing.T) {
+		failed := HandlerFunc(func(context.Context, []graph.EdgeEvent) error {
+			return assert.AnError
+		})
+		next := &recordingHandler{}
+
+		err := Handlers{failed, next}.Handle(context.Background(), events)
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.Empty(t, next.events)
+	})
+}
@@ -0,0 +1,119 @@
+package stream
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+// Удаления по TTL DynamoDB помечает служебной учётной записью
+const (
+	ttlIdentityType      = "Service"
+	ttlIdentityPrincipal = "dynamodb.amazonaws.com"
+)
+
+// decodeRecord turns a stream record of the graph table into an edge event,
+// area keys are parsed in the layout of areaShards shards or, while the
+// keys move from another count, of previousAreaShards shards.
+// Records of items that are not edges are skipped.
+func decodeRecord(record types.Record, areaShards, previousAreaShards int) (graph.EdgeEvent, bool) {
+	if record.Dynamodb == nil {
+		return nil, false
+	}
+	var (
+		id = aws.ToString(record.EventID)
+		at = aws.ToTime(record.Dynamodb.ApproximateCreationDateTime)
+	)
+
+	switch record.EventName {
+	case types.OperationTypeInsert:
+		edge, ok := decodeEdge(record.Dynamodb.NewImage, areaShards, previousAreaShards)
+		if !ok {
+			return nil, false
+		}
+		return graph.EdgeAdded{
+			ID:    id,
+			Edge:  edge,
+			At:    at,
+			Cause: stringAttr(record.Dynamodb.NewImage, "cause"),
+		}, true
+	case types.OperationTypeModify:
+		newEdge, ok := decodeEdge(record.Dynamodb.NewImage, areaShards, previousAreaShards)
+		if !ok {
+			return nil, false
+		}
+		oldEdge, _ := decodeEdge(record.Dynamodb.OldImage, areaShards, previousAreaShards)
+		return graph.EdgeUpdated{
+			ID:    id,
+			Old:   oldEdge,
+			New:   newEdge,
+			At:    at,
+			Cause: stringAttr(record.Dynamodb.NewImage, "cause"),
+		}, true
+	case types.OperationTypeRemove:
+		edge, ok := decodeEdge(record.Dynamodb.OldImage, areaShards, previousAreaShards)
+		if !ok {
+			// Без старого образа восстанавливаем ребро по ключу
+			if edge, ok = decodeEdge(record.Dynamodb.Keys, areaShards, previousAreaShards); !ok {
+				return nil, false
+			}
+		}
+		event := graph.EdgeRemoved{ID: id, Edge: edge, At: at}
+		if isTTLDeletion(record.UserIdentity) {
+			event.Expired, event.Cause = true, graph.CauseTTL
+		}
+		return event, true
+	default:
+		return nil, false
+	}
+}
+
+func isTTLDeletion(identity *types.Identity) bool {
+	return identity != nil &&
+		aws.ToString(identity.Type) == ttlIdentityType &&
+		aws.ToString(identity.PrincipalId) == ttlIdentityPrincipal
+}
+
+func decodeEdge(image map[string]types.AttributeValue, areaShards, previousAreaShards int) (graph.Edge, bool) {
+	pk, sk := stringAttr(image, "pk"), stringAttr(image, "sk")
+	if !strings.HasPrefix(pk, "DEMAND#") || !strings.HasPrefix(sk, "SUPPLY#") {
+		return graph.Edge{}, false
+	}
+	edge := graph.Edge{
+		From: graph.Node(strings.TrimPrefix(pk, "DEMAND#")),
+		To:   graph.Node(strings.TrimPrefix(sk, "SUPPLY#")),
+	}
+	if ak := stringAttr(image, "ak"); ak != "" {
+		if previousAreaShards == 0 {
+			edge.Area = graph.ParseAreaKey(ak, areaShards)
+		} else {
+			edge.Area = edge.StoredArea(ak, areaShards, previousAreaShards)
+		}
+	}
+	if score, err := strconv.ParseFloat(numberAttr(image, "score"), 64); err == nil {
+		edge.Score = graph.Score(score)
+	}
+	if ttl, err := strconv.ParseInt(numberAttr(image, "ttl"), 10, 64); err == nil {
+		edge.ExpiresAt = time.Unix(ttl, 0).UTC()
+	}
+	return edge, true
+}
+
+func stringAttr(image map[string]types.AttributeValue, name string) string {
+	if v, ok := image[name].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+func numberAttr(image map[string]types.AttributeValue, name string) string {
+	if v, ok := image[name].(*types.AttributeValueMemberN); ok {
+		return v.Value
+	}
+	return ""
+}
@@ -0,0 +1,226 @@
+package dynamodb
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/telemetry"
+)
+
+// Атрибуты спанов, которых нет в semconv
+const (
+	requestItemsKey     = attribute.Key("graph.dynamodb.request_items")
+	unprocessedItemsKey = attribute.Key("graph.dynamodb.unprocessed_items")
+	continuedPageKey    = attribute.Key("graph.dynamodb.page.continued")
+	lastPageKey         = attribute.Key("graph.dynamodb.page.last")
+	rcuKey              = attribute.Key("graph.dynamodb.rcu")
+	wcuKey              = attribute.Key("graph.dynamodb.wcu")
+)
+
+// Tracing starts a span for every DynamoDB call, as a child of the span
+// in the call context. The span carries the tables and index of the call,
+// the number of items sent and returned and, for Query and Scan, whether
+// the call read the first or the last page. A paginated read is one span
+// per page. Capacity is set when a CapacityMeter is added to the same config.
+type Tracing struct {
+	tracer trace.Tracer
+}
+
+type TracingOption func(*Tracing)
+
+// WithTracerProvider sets the provider spans are started with, the global
+// one by default.
+func WithTracerProvider(tp trace.TracerProvider) TracingOption {
+	return func(t *Tracing) {
+		t.tracer = tp.Tracer(telemetry.ScopeName + "/dynamodb")
+	}
+}
+
+func NewTracing(opts ...TracingOption) *Tracing {
+	t := &Tracing{}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.tracer == nil {
+		t.tracer = otel.Tracer(telemetry.ScopeName + "/dynamodb")
+	}
+	return t
+}
+
+// AddTo makes every DynamoDB client created from cfg trace its calls.
+func (t *Tracing) AddTo(cfg *aws.Config) {
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		// Первым в Initialize: спан покрывает все повторы вызова
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc(
+			"Tracing",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+				out middleware.InitializeOutput, metadata middleware.Metadata, err error,
+			) {
+				operation := awsmiddleware.GetOperationName(ctx)
+				ctx, span := t.tracer.Start(ctx, "DynamoDB."+operation,
+					trace.WithSpanKind(trace.SpanKindClient),
+					trace.WithAttributes(requestAttributes(operation, in.Parameters)...),
+				)
+				defer func() { telemetry.End(span, err) }()
+
+				out, metadata, err = next.HandleInitialize(ctx, in)
+				if err == nil {
+					span.SetAttributes(responseAttributes(operation, out.Result)...)
+				}
+				return out, metadata, err
+			},
+		), middleware.Before)
+	})
+}
+
+func requestAttributes(operation string, params any) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.DBSystemNameAWSDynamoDB,
+		semconv.DBOperationName(operation),
+	}
+	table := func(name *string) {
+		attrs = append(attrs, semconv.AWSDynamoDBTableNames(aws.ToString(name)))
+	}
+	index := func(name *string) {
+		if name != nil {
+			attrs = append(attrs, semconv.AWSDynamoDBIndexName(*name))
+		}
+	}
+	switch p := params.(type) {
+	case *dynamodb.GetItemInput:
+		table(p.TableName)
+	case *dynamodb.PutItemInput:
+		table(p.TableName)
+		attrs = append(attrs, requestItemsKey.Int(1))
+	case *dynamodb.UpdateItemInput:
+		table(p.TableName)
+		attrs = append(attrs, requestItemsKey.Int(1))
+	case *dynamodb.DeleteItemInput:
+		table(p.TableName)
+		attrs = append(attrs, requestItemsKey.Int(1))
+	case *dynamodb.QueryInput:
+		table(p.TableName)
+		index(p.IndexName)
+		attrs = append(attrs, continuedPageKey.Bool(p.ExclusiveStartKey != nil))
+	case *dynamodb.ScanInput:
+		table(p.TableName)
+		index(p.IndexName)
+		attrs = append(attrs, continuedPageKey.Bool(p.ExclusiveStartKey != nil))
+	case *dynamodb.BatchGetItemInput:
+		items := 0
+		for _, keys := range p.RequestItems {
+			items += len(keys.Keys)
+		}
+		attrs = append(attrs,
+			semconv.AWSDynamoDBTableNames(slices.Sorted(maps.Keys(p.RequestItems))...),
+			requestItemsKey.Int(items),
+		)
+	case *dynamodb.BatchWriteItemInput:
+		items := 0
+		for _, requests := range p.RequestItems {
+			items += len(requests)
+		}
+		attrs = append(attrs,
+			semconv.AWSDynamoDBTableNames(slices.Sorted(maps.Keys(p.RequestItems))...),
+			requestItemsKey.Int(items),
+		)
+	case *dynamodb.TransactWriteItemsInput:
+		attrs = append(attrs,
+			semconv.AWSDynamoDBTableNames(transactTables(p.TransactItems)...),
+			requestItemsKey.Int(len(p.TransactItems)),
+		)
+	case *dynamodb.TransactGetItemsInput:
+		tables := make(map[string]struct{})
+		for _, item := range p.TransactItems {
+			if item.Get != nil {
+				tables[aws.ToString(item.Get.TableName)] = struct{}{}
+			}
+		}
+		attrs = append(attrs,
+			semconv.AWSDynamoDBTableNames(slices.Sorted(maps.Keys(tables))...),
+			requestItemsKey.Int(len(p.TransactItems)),
+		)
+	}
+	return attrs
+}
+
+func transactTables(items []types.TransactWriteItem) []string {
+	tables := make(map[string]struct{})
+	for _, item := range items {
+		switch {
+		case item.Put != nil:
+			tables[aws.ToString(item.Put.TableName)] = struct{}{}
+		case item.Update != nil:
+			tables[aws.ToString(item.Update.TableName)] = struct{}{}
+		case item.Delete != nil:
+			tables[aws.ToString(item.Delete.TableName)] = struct{}{}
+		case item.ConditionCheck != nil:
+			tables[aws.ToString(item.ConditionCheck.TableName)] = struct{}{}
+		}
+	}
+	return slices.Sorted(maps.Keys(tables))
+}
+
+func responseAttributes(operation string, result any) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	switch r := result.(type) {
+	case *dynamodb.QueryOutput:
+		attrs = append(attrs,
+			semconv.AWSDynamoDBCount(int(r.Count)),
+			semconv.AWSDynamoDBScannedCount(int(r.ScannedCount)),
+			lastPageKey.Bool(len(r.LastEvaluatedKey) == 0),
+		)
+	case *dynamodb.ScanOutput:
+		attrs = append(attrs,
+			semconv.AWSDynamoDBCount(int(r.Count)),
+			semconv.AWSDynamoDBScannedCount(int(r.ScannedCount)),
+			lastPageKey.Bool(len(r.LastEvaluatedKey) == 0),
+		)
+	case *dynamodb.GetItemOutput:
+		count := 0
+		if r.Item != nil {
+			count = 1
+		}
+		attrs = append(attrs, semconv.AWSDynamoDBCount(count))
+	case *dynamodb.BatchGetItemOutput:
+		count, unprocessed := 0, 0
+		for _, items := range r.Responses {
+			count += len(items)
+		}
+		for _, keys := range r.UnprocessedKeys {
+			unprocessed += len(keys.Keys)
+		}
+		attrs = append(attrs, semconv.AWSDynamoDBCount(count), unprocessedItemsKey.Int(unprocessed))
+	case *dynamodb.BatchWriteItemOutput:
+		unprocessed := 0
+		for _, requests := range r.UnprocessedItems {
+			unprocessed += len(requests)
+		}
+		attrs = append(attrs, unprocessedItemsKey.Int(unprocessed))
+	}
+
+	if consumed := consumedCapacity(result); len(consumed) > 0 {
+		var rcu, wcu float64
+		for _, u := range callUsage(operation, consumed) {
+			if u.Index != "" {
+				// Индексы уже входят в ёмкость таблицы
+				continue
+			}
+			rcu += u.RCU
+			wcu += u.WCU
+		}
+		attrs = append(attrs, rcuKey.Float64(rcu), wcuKey.Float64(wcu))
+	}
+	return attrs
+}
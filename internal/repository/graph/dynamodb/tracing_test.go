@@ -0,0 +1,60 @@
+package dynamodb
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestTracingAttributes(t *testing.T) {
+	t.Run("Describe a query page", func(t *testing.T) {
+		attrs := attribute.NewSet(requestAttributes("Query", &dynamodb.QueryInput{
+			TableName:         aws.String("graph"),
+			IndexName:         aws.String("sk-gsi"),
+			ExclusiveStartKey: map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "x"}},
+		})...)
+		table, _ := attrs.Value("aws.dynamodb.table_names")
+		index, _ := attrs.Value("aws.dynamodb.index_name")
+		continued, _ := attrs.Value(continuedPageKey)
+		assert.Equal(t, []string{"graph"}, table.AsStringSlice())
+		assert.Equal(t, "sk-gsi", index.AsString())
+		assert.True(t, continued.AsBool())
+
+		attrs = attribute.NewSet(responseAttributes("Query", &dynamodb.QueryOutput{
+			Count:        3,
+			ScannedCount: 5,
+			ConsumedCapacity: &types.ConsumedCapacity{
+				TableName:     aws.String("graph"),
+				CapacityUnits: aws.Float64(1.5),
+			},
+		})...)
+		count, _ := attrs.Value("aws.dynamodb.count")
+		last, _ := attrs.Value(lastPageKey)
+		rcu, _ := attrs.Value(rcuKey)
+		assert.Equal(t, int64(3), count.AsInt64())
+		assert.True(t, last.AsBool())
+		assert.Equal(t, 1.5, rcu.AsFloat64())
+	})
+	t.Run("Count the items of a batch", func(t *testing.T) {
+		attrs := attribute.NewSet(requestAttributes("BatchWriteItem", &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{
+				"graph":   {{}, {}},
+				"reverse": {{}},
+			},
+		})...)
+		tables, _ := attrs.Value("aws.dynamodb.table_names")
+		items, _ := attrs.Value(requestItemsKey)
+		assert.Equal(t, []string{"graph", "reverse"}, tables.AsStringSlice())
+		assert.Equal(t, int64(3), items.AsInt64())
+
+		attrs = attribute.NewSet(responseAttributes("BatchWriteItem", &dynamodb.BatchWriteItemOutput{
+			UnprocessedItems: map[string][]types.WriteRequest{"graph": {{}}},
+		})...)
+		unprocessed, _ := attrs.Value(unprocessedItemsKey)
+		assert.Equal(t, int64(1), unprocessed.AsInt64())
+	})
+}
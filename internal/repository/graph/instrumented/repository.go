@@ -0,0 +1,203 @@
+package instrumented
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/logging"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/telemetry"
+)
+
+type graphRepository interface {
+	Size(ctx context.Context) (int, error)
+	UpsertEdges(ctx context.Context, edges ...graph.Edge) error
+	RemoveEdges(ctx context.Context, edges ...graph.Edge) error
+	ReadDemandEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error)
+	ReadTopDemandEdges(ctx context.Context, node graph.Node, n int) ([]graph.Edge, error)
+	ReadSupplyEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error)
+	ReadAreaEdges(ctx context.Context, area graph.Area) ([]graph.Edge, error)
+	RemoveNodeEdges(ctx context.Context, node graph.Node) error
+	RemoveDemandEdges(ctx context.Context, node graph.Node) error
+}
+
+const (
+	operationKey = attribute.Key("graph.operation")
+	causeKey     = attribute.Key("graph.cause")
+	errorKey     = attribute.Key("error")
+)
+
+// Repository traces and logs every call of the wrapped repository and
+// counts the edges it wrote, removed and read. Counters carry the operation and the
+// cause of the call (see graph.WithCause), so the edges of every use case
+// can be told apart.
+type Repository struct {
+	repo   graphRepository
+	tracer trace.Tracer
+
+	written  metric.Int64Counter
+	removed  metric.Int64Counter
+	read     metric.Int64Counter
+	batch    metric.Int64Histogram
+	duration metric.Float64Histogram
+}
+
+type options struct {
+	tp trace.TracerProvider
+	mp metric.MeterProvider
+}
+
+type Option func(*options)
+
+// WithTracerProvider sets the provider spans are started with, the global
+// one by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tp = tp
+	}
+}
+
+// WithMeterProvider sets the provider metrics are reported to, the global
+// one by default.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(o *options) {
+		o.mp = mp
+	}
+}
+
+func New(repo graphRepository, opts ...Option) (*Repository, error) {
+	o := options{tp: otel.GetTracerProvider(), mp: otel.GetMeterProvider()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	scope := telemetry.ScopeName + "/repository"
+	meter := o.mp.Meter(scope)
+	r := &Repository{repo: repo, tracer: o.tp.Tracer(scope)}
+
+	var err error
+	if r.written, err = meter.Int64Counter("graph.edges.written",
+		metric.WithUnit("{edge}"),
+		metric.WithDescription("Edges upserted into the graph."),
+	); err != nil {
+		return nil, err
+	}
+	if r.removed, err = meter.Int64Counter("graph.edges.removed",
+		metric.WithUnit("{edge}"),
+		metric.WithDescription("Edges removed from the graph by edge."),
+	); err != nil {
+		return nil, err
+	}
+	if r.read, err = meter.Int64Counter("graph.edges.read",
+		metric.WithUnit("{edge}"),
+		metric.WithDescription("Edges returned by graph reads."),
+	); err != nil {
+		return nil, err
+	}
+	if r.batch, err = meter.Int64Histogram("graph.edges.per_call",
+		metric.WithUnit("{edge}"),
+		metric.WithDescription("Edges written, removed or read by one repository call."),
+		metric.WithExplicitBucketBoundaries(0, 1, 5, 10, 25, 50, 100, 250, 500, 1000),
+	); err != nil {
+		return nil, err
+	}
+	if r.duration, err = meter.Float64Histogram("graph.repository.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of repository calls."),
+	); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Repository) Size(ctx context.Context) (int, error) {
+	return r.repo.Size(ctx)
+}
+
+func (r *Repository) UpsertEdges(ctx context.Context, edges ...graph.Edge) (err error) {
+	ctx, done := r.start(ctx, "UpsertEdges", attribute.Int("graph.edges", len(edges)))
+	defer func() { done(r.written, len(edges), err) }()
+	return r.repo.UpsertEdges(ctx, edges...)
+}
+
+func (r *Repository) RemoveEdges(ctx context.Context, edges ...graph.Edge) (err error) {
+	ctx, done := r.start(ctx, "RemoveEdges", attribute.Int("graph.edges", len(edges)))
+	defer func() { done(r.removed, len(edges), err) }()
+	return r.repo.RemoveEdges(ctx, edges...)
+}
+
+func (r *Repository) ReadDemandEdges(ctx context.Context, node graph.Node) (edges []graph.Edge, err error) {
+	ctx, done := r.start(ctx, "ReadDemandEdges", attribute.String("graph.node", node.String()))
+	defer func() { done(r.read, len(edges), err) }()
+	return r.repo.ReadDemandEdges(ctx, node)
+}
+
+func (r *Repository) ReadTopDemandEdges(ctx context.Context, node graph.Node, n int) (edges []graph.Edge, err error) {
+	ctx, done := r.start(ctx, "ReadTopDemandEdges",
+		attribute.String("graph.node", node.String()),
+		attribute.Int("graph.limit", n),
+	)
+	defer func() { done(r.read, len(edges), err) }()
+	return r.repo.ReadTopDemandEdges(ctx, node, n)
+}
+
+func (r *Repository) ReadSupplyEdges(ctx context.Context, node graph.Node) (edges []graph.Edge, err error) {
+	ctx, done := r.start(ctx, "ReadSupplyEdges", attribute.String("graph.node", node.String()))
+	defer func() { done(r.read, len(edges), err) }()
+	return r.repo.ReadSupplyEdges(ctx, node)
+}
+
+func (r *Repository) ReadAreaEdges(ctx context.Context, area graph.Area) (edges []graph.Edge, err error) {
+	ctx, done := r.start(ctx, "ReadAreaEdges", attribute.String("graph.area", string(area)))
+	defer func() { done(r.read, len(edges), err) }()
+	return r.repo.ReadAreaEdges(ctx, area)
+}
+
+// RemoveNodeEdges and RemoveDemandEdges do not tell how many edges they
+// removed, so only their duration is recorded.
+func (r *Repository) RemoveNodeEdges(ctx context.Context, node graph.Node) (err error) {
+	ctx, done := r.start(ctx, "RemoveNodeEdges", attribute.String("graph.node", node.String()))
+	defer func() { done(nil, 0, err) }()
+	return r.repo.RemoveNodeEdges(ctx, node)
+}
+
+func (r *Repository) RemoveDemandEdges(ctx context.Context, node graph.Node) (err error) {
+	ctx, done := r.start(ctx, "RemoveDemandEdges", attribute.String("graph.node", node.String()))
+	defer func() { done(nil, 0, err) }()
+	return r.repo.RemoveDemandEdges(ctx, node)
+}
+
+// start opens the span of a call. done ends it and records the edges the
+// call handled on counter, when it is not nil.
+func (r *Repository) start(ctx context.Context, operation string, attrs ...attribute.KeyValue) (
+	context.Context, func(counter metric.Int64Counter, edges int, err error),
+) {
+	start := time.Now()
+	ctx, span := r.tracer.Start(ctx, "graph.Repository."+operation, trace.WithAttributes(attrs...))
+	return ctx, func(counter metric.Int64Counter, edges int, err error) {
+		set := metric.WithAttributes(
+			operationKey.String(operation),
+			causeKey.String(graph.CauseFromContext(ctx)),
+		)
+		if err == nil && counter != nil {
+			counter.Add(ctx, int64(edges), set)
+			r.batch.Record(ctx, int64(edges), set)
+			span.SetAttributes(attribute.Int("graph.edges.handled", edges))
+		}
+		r.duration.Record(ctx, time.Since(start).Seconds(), set,
+			metric.WithAttributes(errorKey.Bool(err != nil)),
+		)
+		telemetry.End(span, err)
+		// operation в контексте - операция use case, вызов репозитория логируем отдельно
+		logging.Done(ctx, "graph repository call", err,
+			slog.String("call", operation),
+			slog.Int("edges", edges),
+			slog.Duration("duration", time.Since(start)),
+		)
+	}
+}
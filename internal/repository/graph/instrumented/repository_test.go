@@ -0,0 +1,74 @@
+package instrumented
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/memory"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/telemetry"
+)
+
+func TestRepository(t *testing.T) {
+	ctx := graph.WithCause(context.Background(), "supply.UseCase.Update")
+	tel, err := telemetry.New(telemetry.ExporterMemory)
+	assert.NoError(t, err)
+	repo, err := New(memory.New(),
+		WithTracerProvider(tel.TracerProvider),
+		WithMeterProvider(tel.MeterProvider),
+	)
+	assert.NoError(t, err)
+
+	edges := []graph.Edge{
+		{From: "d1", To: "s1", Score: 0.5, Area: "a", TTL: time.Hour},
+		{From: "d2", To: "s1", Score: 0.7, Area: "a", TTL: time.Hour},
+		{From: "d2", To: "s2", Score: 0.1, Area: "a", TTL: time.Hour},
+	}
+	assert.NoError(t, repo.UpsertEdges(ctx, edges...))
+	read, err := repo.ReadSupplyEdges(ctx, "s1")
+	assert.NoError(t, err)
+	assert.Len(t, read, 2)
+	assert.NoError(t, repo.RemoveEdges(ctx, edges[0]))
+	assert.NoError(t, repo.RemoveDemandEdges(ctx, "d2"))
+
+	t.Run("Trace every call", func(t *testing.T) {
+		var names []string
+		for _, span := range tel.Spans() {
+			names = append(names, span.Name)
+		}
+		assert.Equal(t, []string{
+			"graph.Repository.UpsertEdges",
+			"graph.Repository.ReadSupplyEdges",
+			"graph.Repository.RemoveEdges",
+			"graph.Repository.RemoveDemandEdges",
+		}, names)
+	})
+	t.Run("Count edges by operation and cause", func(t *testing.T) {
+		rm, err := tel.Metrics(ctx)
+		assert.NoError(t, err)
+		counts := make(map[string]int64)
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				sum, ok := m.Data.(metricdata.Sum[int64])
+				if !ok {
+					continue
+				}
+				for _, dp := range sum.DataPoints {
+					cause, _ := dp.Attributes.Value(attribute.Key("graph.cause"))
+					assert.Equal(t, "supply.UseCase.Update", cause.AsString())
+					counts[m.Name] += dp.Value
+				}
+			}
+		}
+		assert.Equal(t, map[string]int64{
+			"graph.edges.written": 3,
+			"graph.edges.read":    2,
+			"graph.edges.removed": 1,
+		}, counts)
+	})
+}
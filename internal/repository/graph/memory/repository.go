@@ -0,0 +1,163 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+)
+
+// Repository keeps the graph in process memory. It implements the same
+// methods as the DynamoDB repositories and is meant for tests and offline
+// runs. Expired edges are dropped on read, as if TTL deleted them at once.
+// Writes are validated with graph.DefaultRules, like in DynamoDB.
+type Repository struct {
+	now   func() time.Time
+	rules graph.Rules
+
+	mu    sync.RWMutex
+	edges map[[2]graph.Node]graph.Edge
+}
+
+type Option func(*Repository)
+
+// WithClock sets the clock edge expiry is computed with,
+// e.g. the virtual clock of a simulation.
+func WithClock(now func() time.Time) Option {
+	return func(r *Repository) {
+		r.now = now
+	}
+}
+
+func New(opts ...Option) *Repository {
+	r := &Repository{
+		now:   time.Now,
+		rules: graph.DefaultRules(),
+		edges: make(map[[2]graph.Node]graph.Edge),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (r *Repository) Size(_ context.Context) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.edges), nil
+}
+
+// UpsertEdges adds or updates edges in the graph. Nothing is written
+// when an edge breaks the rules.
+func (r *Repository) UpsertEdges(_ context.Context, edges ...graph.Edge) error {
+	if err := r.rules.Validate(edges); err != nil {
+		return err
+	}
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range edges {
+		e.ExpiresAt = now.Add(e.TTL).Truncate(time.Second)
+		e.TTL = 0
+		r.edges[key(e)] = e
+	}
+	return nil
+}
+
+// RemoveEdges removes edges from the graph.
+func (r *Repository) RemoveEdges(_ context.Context, edges ...graph.Edge) error {
+	if err := graph.ValidateKeys(edges); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range edges {
+		delete(r.edges, key(e))
+	}
+	return nil
+}
+
+// ReadDemandEdges retrieves all edges from the demand node.
+func (r *Repository) ReadDemandEdges(_ context.Context, node graph.Node) ([]graph.Edge, error) {
+	return r.read(func(e graph.Edge) bool { return e.From == node }), nil
+}
+
+// ReadTopDemandEdges returns the n highest scored edges of the demand node.
+func (r *Repository) ReadTopDemandEdges(ctx context.Context, node graph.Node, n int) ([]graph.Edge, error) {
+	edges, _ := r.ReadDemandEdges(ctx, node)
+	slices.SortStableFunc(edges, func(a, b graph.Edge) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	if n > 0 && len(edges) > n {
+		edges = edges[:n]
+	}
+	return edges, nil
+}
+
+// ReadSupplyEdges retrieves all edges to the supply node.
+func (r *Repository) ReadSupplyEdges(_ context.Context, node graph.Node) ([]graph.Edge, error) {
+	return r.read(func(e graph.Edge) bool { return e.To == node }), nil
+}
+
+// ReadAreaEdges retrieves all edges of the area.
+func (r *Repository) ReadAreaEdges(_ context.Context, area graph.Area) ([]graph.Edge, error) {
+	return r.read(func(e graph.Edge) bool { return e.Area == area }), nil
+}
+
+// RemoveNodeEdges removes all edges associated with a specific node.
+func (r *Repository) RemoveNodeEdges(_ context.Context, node graph.Node) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k := range r.edges {
+		if k[0] == node || k[1] == node {
+			delete(r.edges, k)
+		}
+	}
+	return nil
+}
+
+// RemoveDemandEdges removes all edges from the demand node.
+func (r *Repository) RemoveDemandEdges(_ context.Context, node graph.Node) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k := range r.edges {
+		if k[0] == node {
+			delete(r.edges, k)
+		}
+	}
+	return nil
+}
+
+// read returns the live edges matching the filter ordered by key,
+// the way DynamoDB returns items of a partition.
+func (r *Repository) read(match func(graph.Edge) bool) []graph.Edge {
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	edges := make([]graph.Edge, 0)
+	for k, e := range r.edges {
+		if !e.ExpiresAt.After(now) {
+			delete(r.edges, k)
+			continue
+		}
+		if match(e) {
+			edges = append(edges, e)
+		}
+	}
+	slices.SortFunc(edges, func(a, b graph.Edge) int {
+		if c := cmp.Compare(a.From, b.From); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.To, b.To)
+	})
+	return edges
+}
+
+func key(e graph.Edge) [2]graph.Node {
+	return [2]graph.Node{e.From, e.To}
+}
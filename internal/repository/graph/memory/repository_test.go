@@ -0,0 +1,57 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+)
+
+func TestRepository(t *testing.T) {
+	t.Run("Read edges by demand, supply and area", func(t *testing.T) {
+		now := time.Date(2025, 4, 11, 12, 0, 0, 0, time.UTC)
+		repo := New(WithClock(func() time.Time { return now }))
+
+		err := repo.UpsertEdges(context.Background(),
+			graph.Edge{From: "A", To: "X", Area: "Area1", Score: 1, TTL: time.Hour},
+			graph.Edge{From: "A", To: "Y", Area: "Area1", Score: 3, TTL: time.Hour},
+			graph.Edge{From: "B", To: "X", Area: "Area2", Score: 2, TTL: time.Minute},
+		)
+		assert.NoError(t, err)
+		assertSize(t, 3, repo)
+
+		edges, err := repo.ReadTopDemandEdges(context.Background(), "A", 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []graph.Edge{
+			{From: "A", To: "Y", Area: "Area1", Score: 3, ExpiresAt: now.Add(time.Hour)},
+		}, edges)
+
+		edges, err = repo.ReadSupplyEdges(context.Background(), "X")
+		assert.NoError(t, err)
+		assert.Len(t, edges, 2)
+
+		// Ребро B->X истекло
+		now = now.Add(2 * time.Minute)
+		edges, err = repo.ReadSupplyEdges(context.Background(), "X")
+		assert.NoError(t, err)
+		assert.Len(t, edges, 1)
+		assertSize(t, 2, repo)
+
+		assert.NoError(t, repo.RemoveNodeEdges(context.Background(), "X"))
+		edges, err = repo.ReadAreaEdges(context.Background(), "Area1")
+		assert.NoError(t, err)
+		assert.Equal(t, []graph.Edge{
+			{From: "A", To: "Y", Area: "Area1", Score: 3, ExpiresAt: now.Add(-2 * time.Minute).Add(time.Hour)},
+		}, edges)
+	})
+}
+
+func assertSize(t *testing.T, expected int, repo *Repository) {
+	t.Helper()
+	size, err := repo.Size(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, expected, size)
+}
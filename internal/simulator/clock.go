@@ -0,0 +1,29 @@
+package simulator
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the virtual time of a simulation. Pass Clock.Now to the
+// backends that compute expiry, e.g. memory.WithClock.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,159 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+)
+
+type stats struct {
+	demands, supplies  int
+	matched, abandoned int
+	ticks              int
+	timeToMatch        []time.Duration
+	edges              []int
+}
+
+// Report is the outcome of a simulation run.
+type Report struct {
+	Demands   int     `json:"demands"`
+	Supplies  int     `json:"supplies"`
+	Matched   int     `json:"matched"`
+	Abandoned int     `json:"abandoned"`
+	MatchRate float64 `json:"match_rate"`
+
+	TimeToMatch Durations `json:"time_to_match"`
+
+	Ticks     int     `json:"ticks"`
+	MeanEdges float64 `json:"mean_edges"`
+	MaxEdges  int     `json:"max_edges"`
+
+	// Operations counts repository calls by method
+	Operations map[string]int `json:"operations"`
+	// DynamoDB counts API calls when the backend is DynamoDB
+	DynamoDB map[string]int `json:"dynamodb,omitempty"`
+}
+
+type Durations struct {
+	Mean, P50, P95, Max time.Duration
+}
+
+// MarshalJSON writes durations as strings like "1m30s".
+func (d Durations) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"mean": d.Mean.String(),
+		"p50":  d.P50.String(),
+		"p95":  d.P95.String(),
+		"max":  d.Max.String(),
+	})
+}
+
+func (s *Simulator) report() Report {
+	r := Report{
+		Demands:     s.stats.demands,
+		Supplies:    s.stats.supplies,
+		Matched:     s.stats.matched,
+		Abandoned:   s.stats.abandoned,
+		Ticks:       s.stats.ticks,
+		TimeToMatch: durations(s.stats.timeToMatch),
+		Operations:  s.repo.Counts(),
+	}
+	if r.Demands > 0 {
+		r.MatchRate = float64(r.Matched) / float64(r.Demands)
+	}
+	total := 0
+	for _, n := range s.stats.edges {
+		total += n
+		r.MaxEdges = max(r.MaxEdges, n)
+	}
+	if len(s.stats.edges) > 0 {
+		r.MeanEdges = float64(total) / float64(len(s.stats.edges))
+	}
+	return r
+}
+
+func durations(values []time.Duration) Durations {
+	if len(values) == 0 {
+		return Durations{}
+	}
+	sorted := slices.Sorted(slices.Values(values))
+	var total time.Duration
+	for _, v := range sorted {
+		total += v
+	}
+	return Durations{
+		Mean: total / time.Duration(len(sorted)),
+		P50:  sorted[len(sorted)*50/100],
+		P95:  sorted[len(sorted)*95/100],
+		Max:  sorted[len(sorted)-1],
+	}
+}
+
+// countingRepository counts the repository calls the use cases make.
+type countingRepository struct {
+	graphRepository
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (r *countingRepository) count(method string) {
+	r.mu.Lock()
+	r.counts[method]++
+	r.mu.Unlock()
+}
+
+func (r *countingRepository) Counts() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return maps.Clone(r.counts)
+}
+
+func (r *countingRepository) UpsertEdges(ctx context.Context, edges ...graph.Edge) error {
+	r.count("UpsertEdges")
+	return r.graphRepository.UpsertEdges(ctx, edges...)
+}
+
+func (r *countingRepository) RemoveEdges(ctx context.Context, edges ...graph.Edge) error {
+	r.count("RemoveEdges")
+	return r.graphRepository.RemoveEdges(ctx, edges...)
+}
+
+func (r *countingRepository) ReadSupplyEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error) {
+	r.count("ReadSupplyEdges")
+	return r.graphRepository.ReadSupplyEdges(ctx, node)
+}
+
+func (r *countingRepository) ReadAreaEdges(ctx context.Context, area graph.Area) ([]graph.Edge, error) {
+	r.count("ReadAreaEdges")
+	return r.graphRepository.ReadAreaEdges(ctx, area)
+}
+
+func (r *countingRepository) RemoveNodeEdges(ctx context.Context, node graph.Node) error {
+	r.count("RemoveNodeEdges")
+	return r.graphRepository.RemoveNodeEdges(ctx, node)
+}
+
+// recordingMatcher keeps the last matching and graph size for the report.
+type recordingMatcher struct {
+	matchMaker
+
+	last  graph.Matching
+	edges int
+}
+
+func (m *recordingMatcher) Match(g map[graph.Node][]graph.Node) (graph.Matching, error) {
+	edges := 0
+	for _, neighbours := range g {
+		edges += len(neighbours)
+	}
+	m.edges = edges / 2
+	matches, err := m.matchMaker.Match(g)
+	m.last = matches
+	return matches, err
+}
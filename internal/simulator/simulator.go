@@ -0,0 +1,286 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/usecase/buffer"
+	demandUseCase "github.com/ashabykov/graph-building-in-dynamodb/internal/usecase/demand"
+	supplyUseCase "github.com/ashabykov/graph-building-in-dynamodb/internal/usecase/supply"
+)
+
+// area is the area the use cases put every edge into for now.
+const area = graph.Area("area")
+
+type graphRepository interface {
+	UpsertEdges(ctx context.Context, edges ...graph.Edge) error
+	RemoveEdges(ctx context.Context, edges ...graph.Edge) error
+	ReadSupplyEdges(ctx context.Context, node graph.Node) ([]graph.Edge, error)
+	ReadAreaEdges(ctx context.Context, area graph.Area) ([]graph.Edge, error)
+	RemoveNodeEdges(ctx context.Context, node graph.Node) error
+}
+
+type matchMaker interface {
+	Match(g map[graph.Node][]graph.Node) (graph.Matching, error)
+}
+
+type Config struct {
+	// Simulated time, the run itself goes as fast as the backend allows
+	Duration time.Duration
+	// Clock resolution
+	Step time.Duration
+	// How often the area is ticked
+	TickInterval time.Duration
+
+	// Arrivals per second
+	DemandRate float64
+	SupplyRate float64
+
+	// Region: a circle around Lat/Lon
+	Lat, Lon        float64
+	RadiusKm        float64
+	Spatial         Spatial
+	Hotspots        int
+	HotspotSpreadKm float64
+
+	// Supplies drive at SpeedKmh and report their position every UpdateInterval
+	SpeedKmh       float64
+	UpdateInterval time.Duration
+	// Supplies leave after Shift, a matched supply is back after Trip
+	Shift time.Duration
+	Trip  time.Duration
+
+	// Demands see supplies within MatchRadiusKm and leave unmatched after Patience
+	MatchRadiusKm float64
+	Patience      time.Duration
+
+	Seed uint64
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Duration:        time.Hour,
+		Step:            time.Second,
+		TickInterval:    5 * time.Second,
+		DemandRate:      0.5,
+		SupplyRate:      0.1,
+		Lat:             43.238,
+		Lon:             76.945,
+		RadiusKm:        10,
+		Spatial:         SpatialUniform,
+		Hotspots:        3,
+		HotspotSpreadKm: 1.5,
+		SpeedKmh:        30,
+		UpdateInterval:  30 * time.Second,
+		Shift:           4 * time.Hour,
+		Trip:            20 * time.Minute,
+		MatchRadiusKm:   3,
+		Patience:        5 * time.Minute,
+		Seed:            1,
+	}
+}
+
+// Simulator drives synthetic demand and supply through the real use cases
+// on a virtual clock and measures how well they get matched.
+type Simulator struct {
+	cfg   Config
+	clock *Clock
+	rnd   *rand.Rand
+	world *world
+
+	repo    *countingRepository
+	demands *demandUseCase.UseCase
+	supply  *supplyUseCase.UseCase
+	ticks   *buffer.UseCase
+	matcher *recordingMatcher
+
+	nextID int
+	stats  stats
+}
+
+// New creates a simulator over repo. The clock must be the one repo
+// computes edge expiry with, when it has one. It should not start before
+// the wall clock: the tick use case drops edges expired by time.Now.
+func New(cfg Config, clock *Clock, repo graphRepository, matchMaker matchMaker) *Simulator {
+	rnd := rand.New(rand.NewPCG(cfg.Seed, cfg.Seed))
+	w := newWorld(cfg, rnd)
+	counting := &countingRepository{graphRepository: repo, counts: make(map[string]int)}
+	matcher := &recordingMatcher{matchMaker: matchMaker}
+	return &Simulator{
+		cfg:     cfg,
+		clock:   clock,
+		rnd:     rnd,
+		world:   w,
+		repo:    counting,
+		demands: demandUseCase.New(supplyReader{w}, counting),
+		supply:  supplyUseCase.New(demandReader{w}, counting),
+		ticks:   buffer.New(counting, matcher, 0),
+		matcher: matcher,
+	}
+}
+
+// Run simulates cfg.Duration and reports the results.
+func (s *Simulator) Run(ctx context.Context) (Report, error) {
+	end := s.clock.Now().Add(s.cfg.Duration)
+	nextTick := s.clock.Now().Add(s.cfg.TickInterval)
+	for s.clock.Now().Before(end) {
+		if err := ctx.Err(); err != nil {
+			return s.report(), err
+		}
+		s.clock.Advance(s.cfg.Step)
+		now := s.clock.Now()
+
+		if err := s.arrive(ctx, now); err != nil {
+			return s.report(), err
+		}
+		if err := s.drive(ctx, now); err != nil {
+			return s.report(), err
+		}
+		if err := s.leave(ctx, now); err != nil {
+			return s.report(), err
+		}
+		if !now.Before(nextTick) {
+			nextTick = nextTick.Add(s.cfg.TickInterval)
+			if err := s.tick(ctx, now); err != nil {
+				return s.report(), err
+			}
+		}
+	}
+	return s.report(), nil
+}
+
+func (s *Simulator) arrive(ctx context.Context, now time.Time) error {
+	for range s.poisson(s.cfg.DemandRate * s.cfg.Step.Seconds()) {
+		d := &agent{id: s.newID("d"), pos: s.world.place(), arrived: now, leaveAt: now.Add(s.cfg.Patience)}
+		s.world.demands[d.id] = d
+		s.stats.demands++
+		if err := s.demands.Update(ctx, s.world.demand(d)); err != nil {
+			return fmt.Errorf("demand %s: %w", d.id, err)
+		}
+	}
+	for range s.poisson(s.cfg.SupplyRate * s.cfg.Step.Seconds()) {
+		a := &agent{
+			id:       s.newID("s"),
+			pos:      s.world.place(),
+			heading:  2 * math.Pi * s.rnd.Float64(),
+			arrived:  now,
+			leaveAt:  now.Add(s.cfg.Shift),
+			updateAt: now,
+		}
+		s.world.supplies[a.id] = a
+		s.stats.supplies++
+	}
+
+	// Водители, закончившие поездку, снова на линии
+	busy := s.world.busy[:0]
+	for _, a := range s.world.busy {
+		switch {
+		case now.Before(a.updateAt):
+			busy = append(busy, a)
+		case now.Before(a.leaveAt):
+			s.world.supplies[a.id] = a
+		}
+	}
+	s.world.busy = busy
+	return nil
+}
+
+// drive moves supplies and sends the position updates that are due.
+func (s *Simulator) drive(ctx context.Context, now time.Time) error {
+	for _, id := range slices.Sorted(maps.Keys(s.world.supplies)) {
+		a := s.world.supplies[id]
+		s.world.move(a, s.cfg.Step)
+		if now.Before(a.updateAt) {
+			continue
+		}
+		a.updateAt = now.Add(s.cfg.UpdateInterval)
+		if err := s.supply.Update(ctx, s.world.supply(a)); err != nil {
+			return fmt.Errorf("supply %s: %w", a.id, err)
+		}
+	}
+	return nil
+}
+
+// leave removes demands that ran out of patience and supplies whose shift
+// is over, together with their edges.
+func (s *Simulator) leave(ctx context.Context, now time.Time) error {
+	for _, id := range slices.Sorted(maps.Keys(s.world.demands)) {
+		if now.Before(s.world.demands[id].leaveAt) {
+			continue
+		}
+		delete(s.world.demands, id)
+		s.stats.abandoned++
+		if err := s.repo.RemoveNodeEdges(ctx, graph.Node(id)); err != nil {
+			return fmt.Errorf("demand %s: %w", id, err)
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(s.world.supplies)) {
+		if now.Before(s.world.supplies[id].leaveAt) {
+			continue
+		}
+		delete(s.world.supplies, id)
+		if err := s.repo.RemoveNodeEdges(ctx, graph.Node(id)); err != nil {
+			return fmt.Errorf("supply %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// tick runs the tick use case and takes the matched pairs off the market.
+func (s *Simulator) tick(ctx context.Context, now time.Time) error {
+	s.matcher.last, s.matcher.edges = nil, 0
+	if err := s.ticks.Tick(area); err != nil {
+		return fmt.Errorf("tick: %w", err)
+	}
+	s.stats.ticks++
+	s.stats.edges = append(s.stats.edges, s.matcher.edges)
+
+	for _, node := range slices.Sorted(maps.Keys(s.matcher.last)) {
+		d, ok := s.world.demands[node.String()]
+		if !ok {
+			continue
+		}
+		partner := s.matcher.last[node]
+		sup, ok := s.world.supplies[partner.String()]
+		if !ok {
+			continue
+		}
+		delete(s.world.demands, d.id)
+		s.stats.matched++
+		s.stats.timeToMatch = append(s.stats.timeToMatch, now.Sub(d.arrived))
+
+		// Водитель уезжает на заказ и возвращается в точке назначения
+		delete(s.world.supplies, sup.id)
+		sup.pos = s.world.place()
+		sup.updateAt = now.Add(s.cfg.Trip)
+		s.world.busy = append(s.world.busy, sup)
+
+		for _, n := range []graph.Node{node, partner} {
+			if err := s.repo.RemoveNodeEdges(ctx, n); err != nil {
+				return fmt.Errorf("matched %s: %w", n, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Simulator) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s-%d", prefix, s.nextID)
+}
+
+// poisson draws the number of arrivals for the mean lambda.
+func (s *Simulator) poisson(lambda float64) int {
+	limit, n, p := math.Exp(-lambda), 0, s.rnd.Float64()
+	for p > limit {
+		n++
+		p *= s.rnd.Float64()
+	}
+	return n
+}
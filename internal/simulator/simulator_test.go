@@ -0,0 +1,50 @@
+package simulator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/matching"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/memory"
+)
+
+func TestSimulator_Run(t *testing.T) {
+	for _, spatial := range []Spatial{SpatialUniform, SpatialHotspots} {
+		t.Run("Match demand on the in-memory backend, "+string(spatial), func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Duration = 30 * time.Minute
+			cfg.Spatial = spatial
+
+			clock := NewClock(time.Now())
+			repo := memory.New(memory.WithClock(clock.Now))
+			report, err := New(cfg, clock, repo, matching.NewGreedy()).Run(context.Background())
+			assert.NoError(t, err)
+
+			assert.Positive(t, report.Demands)
+			assert.Positive(t, report.Matched)
+			assert.LessOrEqual(t, report.Matched+report.Abandoned, report.Demands)
+			assert.InDelta(t, float64(report.Matched)/float64(report.Demands), report.MatchRate, 1e-9)
+			assert.LessOrEqual(t, report.TimeToMatch.Max, cfg.Patience)
+			assert.Equal(t, int(cfg.Duration/cfg.TickInterval), report.Ticks)
+			assert.Positive(t, report.MaxEdges)
+			assert.Equal(t, report.Ticks, report.Operations["ReadAreaEdges"])
+			assert.Positive(t, report.Operations["UpsertEdges"])
+		})
+	}
+	t.Run("Same seed gives the same run", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Duration = 10 * time.Minute
+
+		run := func() Report {
+			clock := NewClock(time.Now())
+			report, err := New(cfg, clock, memory.New(memory.WithClock(clock.Now)), matching.NewGreedy()).
+				Run(context.Background())
+			assert.NoError(t, err)
+			return report
+		}
+		assert.Equal(t, run(), run())
+	})
+}
@@ -0,0 +1,155 @@
+package simulator
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/demand"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/supply"
+)
+
+const kmPerDegree = 111.32
+
+// Spatial is how new demands and supplies are placed in the region.
+type Spatial string
+
+const (
+	// SpatialUniform spreads agents evenly over the region
+	SpatialUniform Spatial = "uniform"
+	// SpatialHotspots puts agents around a few random centres
+	SpatialHotspots Spatial = "hotspots"
+)
+
+type point struct {
+	x, y float64 // км от центра региона
+}
+
+func (p point) distance(q point) float64 {
+	return math.Hypot(p.x-q.x, p.y-q.y)
+}
+
+type agent struct {
+	id       string
+	pos      point
+	heading  float64
+	arrived  time.Time
+	leaveAt  time.Time
+	updateAt time.Time
+}
+
+// world holds the agents of the simulation and answers the proximity
+// queries the use cases make through their readers.
+type world struct {
+	cfg      Config
+	rnd      *rand.Rand
+	hotspots []point
+
+	demands  map[string]*agent
+	supplies map[string]*agent
+	// busy - supplies on a trip, they are back at updateAt
+	busy []*agent
+}
+
+func newWorld(cfg Config, rnd *rand.Rand) *world {
+	w := &world{
+		cfg:      cfg,
+		rnd:      rnd,
+		demands:  make(map[string]*agent),
+		supplies: make(map[string]*agent),
+	}
+	if cfg.Spatial == SpatialHotspots {
+		for range max(cfg.Hotspots, 1) {
+			w.hotspots = append(w.hotspots, w.uniform())
+		}
+	}
+	return w
+}
+
+// place picks the position of a new agent.
+func (w *world) place() point {
+	if len(w.hotspots) == 0 {
+		return w.uniform()
+	}
+	c := w.hotspots[w.rnd.IntN(len(w.hotspots))]
+	return w.clamp(point{
+		x: c.x + w.rnd.NormFloat64()*w.cfg.HotspotSpreadKm,
+		y: c.y + w.rnd.NormFloat64()*w.cfg.HotspotSpreadKm,
+	})
+}
+
+func (w *world) uniform() point {
+	r := w.cfg.RadiusKm * math.Sqrt(w.rnd.Float64())
+	a := 2 * math.Pi * w.rnd.Float64()
+	return point{x: r * math.Cos(a), y: r * math.Sin(a)}
+}
+
+func (w *world) clamp(p point) point {
+	if d := math.Hypot(p.x, p.y); d > w.cfg.RadiusKm {
+		p.x, p.y = p.x*w.cfg.RadiusKm/d, p.y*w.cfg.RadiusKm/d
+	}
+	return p
+}
+
+// move drives a supply for dt: a random walk that turns back at the border.
+func (w *world) move(a *agent, dt time.Duration) {
+	a.heading += w.rnd.NormFloat64() * 0.5
+	step := w.cfg.SpeedKmh * dt.Hours()
+	next := point{x: a.pos.x + step*math.Cos(a.heading), y: a.pos.y + step*math.Sin(a.heading)}
+	if math.Hypot(next.x, next.y) > w.cfg.RadiusKm {
+		a.heading = math.Atan2(-a.pos.y, -a.pos.x)
+		next = w.clamp(next)
+	}
+	a.pos = next
+}
+
+func (w *world) latLon(p point) (float64, float64) {
+	lat := w.cfg.Lat + p.y/kmPerDegree
+	lon := w.cfg.Lon + p.x/(kmPerDegree*math.Cos(w.cfg.Lat*math.Pi/180))
+	return lat, lon
+}
+
+func (w *world) demand(a *agent) demand.Demand {
+	lat, lon := w.latLon(a.pos)
+	return demand.Demand{ID: a.id, Lat: lat, Lon: lon}
+}
+
+func (w *world) supply(a *agent) supply.Supply {
+	lat, lon := w.latLon(a.pos)
+	return supply.Supply{ID: a.id, Lat: lat, Lon: lon}
+}
+
+// supplyReader finds free supplies near a demand for demand.UseCase.
+type supplyReader struct{ *world }
+
+func (r supplyReader) FindBy(_ context.Context, event demand.Demand) ([]supply.Supply, error) {
+	d, ok := r.demands[event.ID]
+	if !ok {
+		return nil, nil
+	}
+	found := make([]supply.Supply, 0)
+	for _, s := range r.supplies {
+		if s.pos.distance(d.pos) <= r.cfg.MatchRadiusKm {
+			found = append(found, r.supply(s))
+		}
+	}
+	return found, nil
+}
+
+// demandReader finds waiting demands near a supply for supply.UseCase.
+type demandReader struct{ *world }
+
+func (r demandReader) FindBy(_ context.Context, contractor supply.Supply) ([]demand.Demand, error) {
+	s, ok := r.supplies[contractor.ID]
+	if !ok {
+		return nil, nil
+	}
+	found := make([]demand.Demand, 0)
+	for _, d := range r.demands {
+		if d.pos.distance(s.pos) <= r.cfg.MatchRadiusKm {
+			found = append(found, r.demand(d))
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,225 @@
+// Package telemetry sets up the OpenTelemetry trace and metric providers
+// the service reports to. Instrumented code takes the global providers,
+// so it does not depend on which exporter is configured.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+// ScopeName is the instrumentation scope of the code in this module.
+const ScopeName = "github.com/ashabykov/graph-building-in-dynamodb"
+
+// Exporter is where spans and metrics go.
+type Exporter string
+
+const (
+	// ExporterNone drops everything, it is the default.
+	ExporterNone Exporter = "none"
+	// ExporterStdout writes spans and metrics as JSON lines, for local runs.
+	ExporterStdout Exporter = "stdout"
+	// ExporterMemory keeps spans and metrics in memory, for tests and
+	// tools that read them back, see Telemetry.Spans and Telemetry.Metrics.
+	ExporterMemory Exporter = "memory"
+	// ExporterPrometheus serves metrics for scraping, see Telemetry.Handler.
+	// Spans are dropped.
+	ExporterPrometheus Exporter = "prometheus"
+)
+
+func ParseExporter(s string) (Exporter, error) {
+	switch e := Exporter(s); e {
+	case "":
+		return ExporterNone, nil
+	case ExporterNone, ExporterStdout, ExporterMemory, ExporterPrometheus:
+		return e, nil
+	default:
+		return "", fmt.Errorf("unknown telemetry exporter %q", s)
+	}
+}
+
+// Telemetry holds the providers of one exporter.
+type Telemetry struct {
+	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
+
+	spans    *tracetest.InMemoryExporter
+	reader   *sdkmetric.ManualReader
+	registry *prometheus.Registry
+	shutdown []func(context.Context) error
+}
+
+type options struct {
+	out            io.Writer
+	metricInterval time.Duration
+	serviceName    string
+}
+
+type Option func(*options)
+
+// WithWriter sets where the stdout exporter writes, os.Stdout by default.
+func WithWriter(w io.Writer) Option {
+	return func(o *options) {
+		o.out = w
+	}
+}
+
+// WithMetricInterval sets how often the stdout exporter writes metrics.
+func WithMetricInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.metricInterval = d
+	}
+}
+
+func WithServiceName(name string) Option {
+	return func(o *options) {
+		o.serviceName = name
+	}
+}
+
+// New creates the providers of the exporter. They are not installed
+// globally, see Install.
+func New(exporter Exporter, opts ...Option) (*Telemetry, error) {
+	o := options{metricInterval: time.Minute, serviceName: "graph"}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	switch exporter {
+	case ExporterNone, "":
+		return &Telemetry{
+			TracerProvider: tracenoop.NewTracerProvider(),
+			MeterProvider:  noop.NewMeterProvider(),
+		}, nil
+	case ExporterStdout, ExporterMemory, ExporterPrometheus:
+	default:
+		return nil, fmt.Errorf("unknown telemetry exporter %q", exporter)
+	}
+
+	res := resource.NewSchemaless(semconv.ServiceName(o.serviceName))
+	t := &Telemetry{}
+	var (
+		spanOpt   sdktrace.TracerProviderOption
+		metricOpt sdkmetric.Option
+	)
+	switch exporter {
+	case ExporterMemory:
+		t.spans = tracetest.NewInMemoryExporter()
+		t.reader = sdkmetric.NewManualReader()
+		// Синхронный экспорт, чтобы спаны были видны сразу после End
+		spanOpt = sdktrace.WithSyncer(t.spans)
+		metricOpt = sdkmetric.WithReader(t.reader)
+	case ExporterPrometheus:
+		t.registry = prometheus.NewRegistry()
+		reader, err := otelprometheus.New(otelprometheus.WithRegisterer(t.registry))
+		if err != nil {
+			return nil, err
+		}
+		metricOpt = sdkmetric.WithReader(reader)
+	default:
+		traceOpts := []stdouttrace.Option{}
+		metricOpts := []stdoutmetric.Option{}
+		if o.out != nil {
+			traceOpts = append(traceOpts, stdouttrace.WithWriter(o.out))
+			metricOpts = append(metricOpts, stdoutmetric.WithWriter(o.out))
+		}
+		spanExporter, err := stdouttrace.New(traceOpts...)
+		if err != nil {
+			return nil, err
+		}
+		metricExporter, err := stdoutmetric.New(metricOpts...)
+		if err != nil {
+			return nil, err
+		}
+		spanOpt = sdktrace.WithBatcher(spanExporter)
+		metricOpt = sdkmetric.WithReader(sdkmetric.NewPeriodicReader(
+			metricExporter,
+			sdkmetric.WithInterval(o.metricInterval),
+		))
+	}
+
+	mp := sdkmetric.NewMeterProvider(metricOpt, sdkmetric.WithResource(res))
+	t.MeterProvider = mp
+	t.shutdown = append(t.shutdown, mp.Shutdown)
+	if spanOpt == nil {
+		t.TracerProvider = tracenoop.NewTracerProvider()
+		return t, nil
+	}
+	tp := sdktrace.NewTracerProvider(spanOpt, sdktrace.WithResource(res))
+	t.TracerProvider = tp
+	t.shutdown = append(t.shutdown, tp.Shutdown)
+	return t, nil
+}
+
+// Install makes the providers the global ones.
+func (t *Telemetry) Install() {
+	otel.SetTracerProvider(t.TracerProvider)
+	otel.SetMeterProvider(t.MeterProvider)
+}
+
+// Shutdown flushes what is left to the exporter.
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	var err error
+	for _, shutdown := range t.shutdown {
+		err = errors.Join(err, shutdown(ctx))
+	}
+	return err
+}
+
+// Spans returns the ended spans of the memory exporter.
+func (t *Telemetry) Spans() tracetest.SpanStubs {
+	if t.spans == nil {
+		return nil
+	}
+	return t.spans.GetSpans()
+}
+
+// Metrics collects the current metrics of the memory exporter.
+func (t *Telemetry) Metrics(ctx context.Context) (metricdata.ResourceMetrics, error) {
+	var rm metricdata.ResourceMetrics
+	if t.reader == nil {
+		return rm, errors.New("metrics are kept in memory only by the memory exporter")
+	}
+	err := t.reader.Collect(ctx, &rm)
+	return rm, err
+}
+
+// Handler serves the metrics of the prometheus exporter in the text format.
+// Other exporters serve 404.
+func (t *Telemetry) Handler() http.Handler {
+	if t.registry == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(t.registry, promhttp.HandlerOpts{})
+}
+
+// End ends the span, marking it failed when err is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,91 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestTelemetry(t *testing.T) {
+	t.Run("Parse exporters", func(t *testing.T) {
+		e, err := ParseExporter("")
+		assert.NoError(t, err)
+		assert.Equal(t, ExporterNone, e)
+
+		e, err = ParseExporter("stdout")
+		assert.NoError(t, err)
+		assert.Equal(t, ExporterStdout, e)
+
+		_, err = ParseExporter("jaeger")
+		assert.Error(t, err)
+	})
+	t.Run("Keep spans and metrics in memory", func(t *testing.T) {
+		ctx := context.Background()
+		tel, err := New(ExporterMemory)
+		assert.NoError(t, err)
+
+		_, span := tel.TracerProvider.Tracer("test").Start(ctx, "ok")
+		End(span, nil)
+		_, span = tel.TracerProvider.Tracer("test").Start(ctx, "failed")
+		End(span, errors.New("boom"))
+
+		counter, err := tel.MeterProvider.Meter("test").Int64Counter("calls")
+		assert.NoError(t, err)
+		counter.Add(ctx, 3)
+
+		spans := tel.Spans()
+		if assert.Len(t, spans, 2) {
+			assert.Equal(t, "ok", spans[0].Name)
+			assert.Equal(t, codes.Unset, spans[0].Status.Code)
+			assert.Equal(t, "failed", spans[1].Name)
+			assert.Equal(t, codes.Error, spans[1].Status.Code)
+		}
+
+		rm, err := tel.Metrics(ctx)
+		assert.NoError(t, err)
+		if assert.Len(t, rm.ScopeMetrics, 1) && assert.Len(t, rm.ScopeMetrics[0].Metrics, 1) {
+			sum := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Sum[int64])
+			assert.Equal(t, int64(3), sum.DataPoints[0].Value)
+		}
+		assert.NoError(t, tel.Shutdown(ctx))
+	})
+	t.Run("Write spans to stdout exporter on shutdown", func(t *testing.T) {
+		var buf bytes.Buffer
+		tel, err := New(ExporterStdout, WithWriter(&buf))
+		assert.NoError(t, err)
+
+		_, span := tel.TracerProvider.Tracer("test").Start(context.Background(), "tick")
+		End(span, nil)
+		assert.NoError(t, tel.Shutdown(context.Background()))
+		assert.Contains(t, buf.String(), `"Name":"tick"`)
+	})
+	t.Run("Serve metrics for prometheus", func(t *testing.T) {
+		tel, err := New(ExporterPrometheus)
+		assert.NoError(t, err)
+		gauge, err := tel.MeterProvider.Meter("test").Int64Gauge("graph.area.edges")
+		assert.NoError(t, err)
+		gauge.Record(context.Background(), 42)
+
+		rec := httptest.NewRecorder()
+		tel.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "graph_area_edges")
+		assert.Contains(t, rec.Body.String(), " 42")
+		assert.Empty(t, tel.Spans())
+	})
+	t.Run("Drop everything without an exporter", func(t *testing.T) {
+		tel, err := New(ExporterNone)
+		assert.NoError(t, err)
+		assert.Empty(t, tel.Spans())
+		_, err = tel.Metrics(context.Background())
+		assert.Error(t, err)
+		assert.NoError(t, tel.Shutdown(context.Background()))
+	})
+}
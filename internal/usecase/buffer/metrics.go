@@ -0,0 +1,152 @@
+package buffer
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/telemetry"
+)
+
+// health is the shape of the graph of one area at a tick.
+type health struct {
+	edges             int
+	demands, supplies int
+	// Степени: исходящая у спроса, входящая у предложения
+	maxDemandDegree, maxSupplyDegree int
+	unmatchedDemands                 int
+	unmatchedSupplies                int
+}
+
+func measure(edges []graph.Edge, matches graph.Matching) health {
+	demands := make(map[graph.Node]int)
+	supplies := make(map[graph.Node]int)
+	for _, e := range edges {
+		demands[e.From]++
+		supplies[e.To]++
+	}
+	h := health{edges: len(edges), demands: len(demands), supplies: len(supplies)}
+	for node, degree := range demands {
+		h.maxDemandDegree = max(h.maxDemandDegree, degree)
+		if _, ok := matches[node]; !ok {
+			h.unmatchedDemands++
+		}
+	}
+	for node, degree := range supplies {
+		h.maxSupplyDegree = max(h.maxSupplyDegree, degree)
+		if _, ok := matches[node]; !ok {
+			h.unmatchedSupplies++
+		}
+	}
+	return h
+}
+
+func (h health) meanDemandDegree() float64 {
+	if h.demands == 0 {
+		return 0
+	}
+	return float64(h.edges) / float64(h.demands)
+}
+
+func (h health) meanSupplyDegree() float64 {
+	if h.supplies == 0 {
+		return 0
+	}
+	return float64(h.edges) / float64(h.supplies)
+}
+
+var (
+	demandRole = attribute.String("graph.role", "demand")
+	supplyRole = attribute.String("graph.role", "supply")
+)
+
+// tickMetrics are the graph health gauges the ticks keep up to date,
+// every gauge holds the value of the last tick of the area.
+type tickMetrics struct {
+	edges        metric.Int64Gauge
+	nodes        metric.Int64Gauge
+	meanDegree   metric.Float64Gauge
+	maxDegree    metric.Int64Gauge
+	unmatched    metric.Int64Gauge
+	matcherNodes metric.Int64Gauge
+	duration     metric.Float64Histogram
+}
+
+// newTickMetrics creates the instruments. The names are fixed, so errors
+// are not expected; they go to the otel error handler.
+func newTickMetrics(mp metric.MeterProvider) *tickMetrics {
+	meter := mp.Meter(telemetry.ScopeName + "/usecase/buffer")
+	m := &tickMetrics{}
+	var err error
+	if m.edges, err = meter.Int64Gauge("graph.area.edges",
+		metric.WithUnit("{edge}"),
+		metric.WithDescription("Edges of the area at the last tick."),
+	); err != nil {
+		otel.Handle(err)
+	}
+	if m.nodes, err = meter.Int64Gauge("graph.area.nodes",
+		metric.WithUnit("{node}"),
+		metric.WithDescription("Demands and supplies of the area at the last tick."),
+	); err != nil {
+		otel.Handle(err)
+	}
+	if m.meanDegree, err = meter.Float64Gauge("graph.area.degree.mean",
+		metric.WithUnit("{edge}"),
+		metric.WithDescription("Mean out-degree of demands and in-degree of supplies at the last tick."),
+	); err != nil {
+		otel.Handle(err)
+	}
+	if m.maxDegree, err = meter.Int64Gauge("graph.area.degree.max",
+		metric.WithUnit("{edge}"),
+		metric.WithDescription("Max out-degree of demands and in-degree of supplies at the last tick."),
+	); err != nil {
+		otel.Handle(err)
+	}
+	if m.unmatched, err = meter.Int64Gauge("graph.area.unmatched_nodes",
+		metric.WithUnit("{node}"),
+		metric.WithDescription("Nodes with edges the last tick left unmatched."),
+	); err != nil {
+		otel.Handle(err)
+	}
+	if m.matcherNodes, err = meter.Int64Gauge("graph.matcher.nodes",
+		metric.WithUnit("{node}"),
+		metric.WithDescription("Nodes handed to the matcher at the last tick."),
+	); err != nil {
+		otel.Handle(err)
+	}
+	if m.duration, err = meter.Float64Histogram("graph.tick.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of ticks, reading the area included."),
+	); err != nil {
+		otel.Handle(err)
+	}
+	return m
+}
+
+func (m *tickMetrics) observe(ctx context.Context, area graph.Area, h health) {
+	inArea := attribute.String("graph.area", string(area))
+	demand := metric.WithAttributes(inArea, demandRole)
+	supply := metric.WithAttributes(inArea, supplyRole)
+
+	m.edges.Record(ctx, int64(h.edges), metric.WithAttributes(inArea))
+	m.matcherNodes.Record(ctx, int64(h.demands+h.supplies), metric.WithAttributes(inArea))
+	m.nodes.Record(ctx, int64(h.demands), demand)
+	m.nodes.Record(ctx, int64(h.supplies), supply)
+	m.meanDegree.Record(ctx, h.meanDemandDegree(), demand)
+	m.meanDegree.Record(ctx, h.meanSupplyDegree(), supply)
+	m.maxDegree.Record(ctx, int64(h.maxDemandDegree), demand)
+	m.maxDegree.Record(ctx, int64(h.maxSupplyDegree), supply)
+	m.unmatched.Record(ctx, int64(h.unmatchedDemands), demand)
+	m.unmatched.Record(ctx, int64(h.unmatchedSupplies), supply)
+}
+
+func (m *tickMetrics) tick(ctx context.Context, area graph.Area, d time.Duration, err error) {
+	m.duration.Record(ctx, d.Seconds(), metric.WithAttributes(
+		attribute.String("graph.area", string(area)),
+		attribute.Bool("error", err != nil),
+	))
+}
@@ -2,35 +2,275 @@ package buffer
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/logging"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/telemetry"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 )
 
+var tracer = otel.Tracer(telemetry.ScopeName + "/usecase/buffer")
+
 type graphBuilder interface {
 	ReadAreaEdges(ctx context.Context, area graph.Area) ([]graph.Edge, error)
 }
 
 type matchMaker interface {
-	Match(g map[graph.Node][]graph.Node) error
+	Match(g map[graph.Node][]graph.Node) (graph.Matching, error)
+}
+
+type snapshotStore interface {
+	Save(ctx context.Context, snapshot graph.Snapshot) error
 }
 
 type UseCase struct {
-	graphBuilder graphBuilder
-	matchMaker   matchMaker
+	graphBuilder   graphBuilder
+	matchMaker     matchMaker
+	resyncInterval time.Duration
+	snapshots      snapshotStore
+	metrics        *tickMetrics
+
+	mu    sync.Mutex
+	areas map[graph.Area]*areaGraph
+}
+
+// areaGraph is the in-process copy of the edges of one area.
+type areaGraph struct {
+	edges    map[[2]graph.Node]graph.Edge
+	loadedAt time.Time
+
+	// pending collects events that arrive while the area is being re-read,
+	// they are replayed on top of the fresh copy.
+	loading bool
+	pending []graph.EdgeEvent
+}
+
+type Option func(*UseCase)
+
+// WithSnapshots saves the graph and the match result of every tick,
+// so matching can be replayed later.
+func WithSnapshots(store snapshotStore) Option {
+	return func(uc *UseCase) {
+		uc.snapshots = store
+	}
+}
+
+// WithMeterProvider sets the provider the graph health gauges are
+// reported to, the global one by default.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(uc *UseCase) {
+		uc.metrics = newTickMetrics(mp)
+	}
 }
 
-func (uc *UseCase) Tick(area graph.Area) error {
-	edges, err := uc.graphBuilder.ReadAreaEdges(context.Background(), area)
+// New creates the tick use case. Areas are read in full on the first tick
+// and then every resyncInterval, in between they follow edge change events
+// passed to Handle. resyncInterval <= 0 re-reads the area on every tick.
+func New(graphBuilder graphBuilder, matchMaker matchMaker, resyncInterval time.Duration, opts ...Option) *UseCase {
+	uc := &UseCase{
+		graphBuilder:   graphBuilder,
+		matchMaker:     matchMaker,
+		resyncInterval: resyncInterval,
+		areas:          make(map[graph.Area]*areaGraph),
+	}
+	for _, opt := range opts {
+		opt(uc)
+	}
+	if uc.metrics == nil {
+		uc.metrics = newTickMetrics(otel.GetMeterProvider())
+	}
+	return uc
+}
+
+// Tick hands the matcher the current graph of the area and updates the
+// graph health gauges of the area.
+// Ticks of the same area must not run concurrently.
+func (uc *UseCase) Tick(area graph.Area) (err error) {
+	ctx := logging.With(logging.WithRequestID(context.Background()),
+		logging.KeyOperation, "buffer.UseCase.Tick",
+		logging.KeyArea, string(area),
+	)
+	ctx, span := tracer.Start(ctx, "buffer.UseCase.Tick")
+	defer func() { telemetry.End(span, err) }()
+	span.SetAttributes(attribute.String("graph.area", string(area)))
+	now := time.Now()
+	var edgeCount, matched int
+	defer func() {
+		uc.metrics.tick(ctx, area, time.Since(now), err)
+		logging.Done(ctx, "area ticked", err,
+			"edges", edgeCount,
+			"matched_nodes", matched,
+			"duration", time.Since(now),
+		)
+	}()
+
+	edges, err := uc.areaEdges(ctx, area)
 	if err != nil {
-		return nil
+		return err
 	}
+	span.SetAttributes(attribute.Int("graph.edges", len(edges)))
+	edgeCount = len(edges)
 	if len(edges) == 0 {
+		uc.metrics.observe(ctx, area, health{})
 		return nil
 	}
+	matches, matchErr := uc.matchMaker.Match(adjacency(edges))
+	span.SetAttributes(attribute.Int("graph.matched_nodes", len(matches)))
+	matched = len(matches)
+	uc.metrics.observe(ctx, area, measure(edges, matches))
+	if uc.snapshots == nil {
+		return matchErr
+	}
+
+	// Снимок сохраняем и при ошибке матчинга: он нужен для разбора инцидентов
+	snapshot := graph.Snapshot{
+		Area:    area,
+		Tick:    now,
+		Edges:   edges,
+		Matches: matches,
+	}
+	if matchErr != nil {
+		snapshot.MatchError = matchErr.Error()
+	}
+	if err = uc.snapshots.Save(ctx, snapshot); err != nil {
+		return errors.Join(matchErr, fmt.Errorf("failed to save snapshot of %s: %w", area, err))
+	}
+	return matchErr
+}
+
+// Replay runs the matcher against the graph of a snapshot,
+// the same way Tick ran the matcher that produced it.
+func Replay(snapshot graph.Snapshot, matchMaker matchMaker) (graph.Matching, error) {
+	return matchMaker.Match(adjacency(snapshot.Edges))
+}
+
+// adjacency builds the undirected graph the matcher works on.
+func adjacency(edges []graph.Edge) map[graph.Node][]graph.Node {
 	G := make(map[graph.Node][]graph.Node)
 	for _, e := range edges {
 		G[e.From] = append(G[e.From], e.To)
 		G[e.To] = append(G[e.To], e.From)
 	}
-	return uc.matchMaker.Match(G)
+	return G
+}
+
+// Handle applies edge change events to the areas kept in memory.
+// Events of areas that were never ticked are dropped: the first tick reads them in full.
+func (uc *UseCase) Handle(_ context.Context, events []graph.EdgeEvent) error {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	for _, event := range events {
+		for _, area := range eventAreas(event) {
+			state, ok := uc.areas[area]
+			if !ok {
+				continue
+			}
+			if state.loading {
+				state.pending = append(state.pending, event)
+			}
+			state.apply(area, event)
+		}
+	}
+	return nil
+}
+
+// areaEdges returns the current edges of the area, re-reading it when
+// it is not loaded yet or the resync interval has passed.
+func (uc *UseCase) areaEdges(ctx context.Context, area graph.Area) ([]graph.Edge, error) {
+	now := time.Now()
+
+	uc.mu.Lock()
+	state, ok := uc.areas[area]
+	if ok && uc.resyncInterval > 0 && now.Sub(state.loadedAt) < uc.resyncInterval {
+		edges := state.current(now)
+		uc.mu.Unlock()
+		return edges, nil
+	}
+	if !ok {
+		state = &areaGraph{edges: make(map[[2]graph.Node]graph.Edge)}
+		uc.areas[area] = state
+	}
+	state.loading, state.pending = true, nil
+	uc.mu.Unlock()
+
+	// Читаем область без блокировки, события на это время копятся в pending
+	edges, err := uc.graphBuilder.ReadAreaEdges(ctx, area)
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	pending := state.pending
+	state.loading, state.pending = false, nil
+	if err != nil {
+		if !ok {
+			delete(uc.areas, area)
+		}
+		return nil, err
+	}
+
+	state.edges = make(map[[2]graph.Node]graph.Edge, len(edges))
+	for _, e := range edges {
+		state.edges[edgeKey(e)] = e
+	}
+	for _, event := range pending {
+		state.apply(area, event)
+	}
+	state.loadedAt = now
+	return state.current(now), nil
+}
+
+// current returns the edges that have not expired yet. DynamoDB deletes
+// expired items lazily, so they may still be in the copy or in a fresh read.
+func (g *areaGraph) current(now time.Time) []graph.Edge {
+	edges := make([]graph.Edge, 0, len(g.edges))
+	for _, e := range g.edges {
+		if !e.ExpiresAt.IsZero() && !e.ExpiresAt.After(now) {
+			continue
+		}
+		edges = append(edges, e)
+	}
+	return edges
+}
+
+func (g *areaGraph) apply(area graph.Area, event graph.EdgeEvent) {
+	switch e := event.(type) {
+	case graph.EdgeAdded:
+		g.edges[edgeKey(e.Edge)] = e.Edge
+	case graph.EdgeUpdated:
+		if e.New.Area == area {
+			g.edges[edgeKey(e.New)] = e.New
+		} else {
+			// Ребро переехало в другую область
+			delete(g.edges, edgeKey(e.Old))
+		}
+	case graph.EdgeRemoved:
+		delete(g.edges, edgeKey(e.Edge))
+	}
+}
+
+func eventAreas(event graph.EdgeEvent) []graph.Area {
+	switch e := event.(type) {
+	case graph.EdgeAdded:
+		return []graph.Area{e.Edge.Area}
+	case graph.EdgeUpdated:
+		if e.Old.Area != e.New.Area {
+			return []graph.Area{e.Old.Area, e.New.Area}
+		}
+		return []graph.Area{e.New.Area}
+	case graph.EdgeRemoved:
+		return []graph.Area{e.Edge.Area}
+	default:
+		return nil
+	}
+}
+
+func edgeKey(e graph.Edge) [2]graph.Node {
+	return [2]graph.Node{e.From, e.To}
 }
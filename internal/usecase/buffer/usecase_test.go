@@ -0,0 +1,195 @@
+package buffer
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/telemetry"
+)
+
+type fakeGraph struct {
+	edges []graph.Edge
+	reads int
+}
+
+func (f *fakeGraph) ReadAreaEdges(_ context.Context, _ graph.Area) ([]graph.Edge, error) {
+	f.reads++
+	return f.edges, nil
+}
+
+type lastMatch struct {
+	g   map[graph.Node][]graph.Node
+	err error
+}
+
+// Match pairs every node with its smallest neighbour, which is enough
+// to tell matchings of different graphs apart.
+func (m *lastMatch) Match(g map[graph.Node][]graph.Node) (graph.Matching, error) {
+	m.g = g
+	matches := make(graph.Matching)
+	for node := range g {
+		matches[node] = neighbours(g, node)[0]
+	}
+	return matches, m.err
+}
+
+type fakeSnapshots struct {
+	saved []graph.Snapshot
+}
+
+func (f *fakeSnapshots) Save(_ context.Context, snapshot graph.Snapshot) error {
+	f.saved = append(f.saved, snapshot)
+	return nil
+}
+
+type fixedMatch graph.Matching
+
+func (m fixedMatch) Match(map[graph.Node][]graph.Node) (graph.Matching, error) {
+	return graph.Matching(m), nil
+}
+
+func neighbours(g map[graph.Node][]graph.Node, node graph.Node) []graph.Node {
+	out := append([]graph.Node(nil), g[node]...)
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+func TestUseCase_Tick(t *testing.T) {
+	t.Run("Follow change events between resyncs", func(t *testing.T) {
+		store := &fakeGraph{edges: []graph.Edge{
+			{From: "A", To: "B", Area: "Area1"},
+		}}
+		matcher := &lastMatch{}
+		uc := New(store, matcher, time.Hour)
+
+		// События до первого тика не нужны: область ещё не загружена
+		err := uc.Handle(context.Background(), []graph.EdgeEvent{
+			graph.EdgeAdded{Edge: graph.Edge{From: "X", To: "Y", Area: "Area1"}},
+		})
+		assert.NoError(t, err)
+
+		assert.NoError(t, uc.Tick("Area1"))
+		assert.Equal(t, 1, store.reads)
+		assert.Equal(t, []graph.Node{"B"}, neighbours(matcher.g, "A"))
+
+		err = uc.Handle(context.Background(), []graph.EdgeEvent{
+			graph.EdgeAdded{Edge: graph.Edge{From: "A", To: "C", Area: "Area1"}},
+			graph.EdgeRemoved{Edge: graph.Edge{From: "A", To: "B", Area: "Area1"}},
+			graph.EdgeAdded{Edge: graph.Edge{From: "D", To: "E", Area: "Area2"}},
+			graph.EdgeUpdated{
+				Old: graph.Edge{From: "F", To: "G", Area: "Area2"},
+				New: graph.Edge{From: "F", To: "G", Area: "Area1"},
+			},
+			graph.EdgeAdded{Edge: graph.Edge{
+				From: "H", To: "I", Area: "Area1", ExpiresAt: time.Now().Add(-time.Minute),
+			}},
+		})
+		assert.NoError(t, err)
+
+		assert.NoError(t, uc.Tick("Area1"))
+		assert.Equal(t, 1, store.reads)
+		assert.Equal(t, []graph.Node{"C"}, neighbours(matcher.g, "A"))
+		assert.Equal(t, []graph.Node{"G"}, neighbours(matcher.g, "F"))
+		assert.NotContains(t, matcher.g, graph.Node("D"))
+		assert.NotContains(t, matcher.g, graph.Node("H"))
+	})
+	t.Run("Re-read area after resync interval", func(t *testing.T) {
+		store := &fakeGraph{edges: []graph.Edge{
+			{From: "A", To: "B", Area: "Area1"},
+		}}
+		matcher := &lastMatch{}
+		uc := New(store, matcher, 0)
+
+		assert.NoError(t, uc.Tick("Area1"))
+		store.edges = []graph.Edge{{From: "A", To: "C", Area: "Area1"}}
+		assert.NoError(t, uc.Tick("Area1"))
+
+		assert.Equal(t, 2, store.reads)
+		assert.Equal(t, []graph.Node{"C"}, neighbours(matcher.g, "A"))
+	})
+	t.Run("Save snapshot of every tick", func(t *testing.T) {
+		store := &fakeGraph{edges: []graph.Edge{
+			{From: "A", To: "B", Area: "Area1", Score: 1},
+		}}
+		matcher := &lastMatch{}
+		snapshots := &fakeSnapshots{}
+		uc := New(store, matcher, 0, WithSnapshots(snapshots))
+
+		assert.NoError(t, uc.Tick("Area1"))
+
+		matcher.err = errors.New("matcher failed")
+		assert.ErrorIs(t, uc.Tick("Area1"), matcher.err)
+
+		assert.Len(t, snapshots.saved, 2)
+		snapshot := snapshots.saved[0]
+		assert.Equal(t, graph.Area("Area1"), snapshot.Area)
+		assert.Equal(t, store.edges, snapshot.Edges)
+		assert.Equal(t, graph.Matching{"A": "B", "B": "A"}, snapshot.Matches)
+		assert.Empty(t, snapshot.MatchError)
+		assert.Equal(t, "matcher failed", snapshots.saved[1].MatchError)
+
+		matches, err := Replay(snapshot, &lastMatch{})
+		assert.NoError(t, err)
+		assert.Empty(t, snapshot.Matches.Diff(matches))
+	})
+	t.Run("Report graph health of the area", func(t *testing.T) {
+		tel, err := telemetry.New(telemetry.ExporterMemory)
+		assert.NoError(t, err)
+		store := &fakeGraph{edges: []graph.Edge{
+			{From: "A", To: "X", Area: "Area1"},
+			{From: "A", To: "Y", Area: "Area1"},
+			{From: "B", To: "X", Area: "Area1"},
+		}}
+		uc := New(store, fixedMatch{"A": "X", "X": "A"}, 0, WithMeterProvider(tel.MeterProvider))
+		assert.NoError(t, uc.Tick("Area1"))
+
+		rm, err := tel.Metrics(context.Background())
+		assert.NoError(t, err)
+		gauges := make(map[string]float64)
+		ticks := uint64(0)
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				switch data := m.Data.(type) {
+				case metricdata.Gauge[int64]:
+					for _, dp := range data.DataPoints {
+						gauges[m.Name+role(dp.Attributes)] = float64(dp.Value)
+					}
+				case metricdata.Gauge[float64]:
+					for _, dp := range data.DataPoints {
+						gauges[m.Name+role(dp.Attributes)] = dp.Value
+					}
+				case metricdata.Histogram[float64]:
+					ticks += data.DataPoints[0].Count
+				}
+			}
+		}
+		assert.Equal(t, map[string]float64{
+			"graph.area.edges":                  3,
+			"graph.matcher.nodes":               4,
+			"graph.area.nodes/demand":           2,
+			"graph.area.nodes/supply":           2,
+			"graph.area.degree.mean/demand":     1.5,
+			"graph.area.degree.mean/supply":     1.5,
+			"graph.area.degree.max/demand":      2,
+			"graph.area.degree.max/supply":      2,
+			"graph.area.unmatched_nodes/demand": 1,
+			"graph.area.unmatched_nodes/supply": 1,
+		}, gauges)
+		assert.Equal(t, uint64(1), ticks)
+	})
+}
+
+func role(attrs attribute.Set) string {
+	if v, ok := attrs.Value("graph.role"); ok {
+		return "/" + v.AsString()
+	}
+	return ""
+}
@@ -7,8 +7,15 @@ import (
 	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/demand"
 	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
 	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/supply"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/logging"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/telemetry"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+var tracer = otel.Tracer(telemetry.ScopeName + "/usecase/demand")
+
 type supplyReader interface {
 	FindBy(ctx context.Context, event demand.Demand) ([]supply.Supply, error)
 }
@@ -22,8 +29,26 @@ type UseCase struct {
 	graphBuilder graphBuilder
 }
 
+func New(supplyReader supplyReader, graphBuilder graphBuilder) *UseCase {
+	return &UseCase{
+		supplyReader: supplyReader,
+		graphBuilder: graphBuilder,
+	}
+}
+
 // Update обновляет ребра графа на основе нового события из топика заказов.
-func (uc *UseCase) Update(ctx context.Context, order demand.Demand) error {
+func (uc *UseCase) Update(ctx context.Context, order demand.Demand) (err error) {
+	ctx = graph.WithCause(ctx, "demand.UseCase.Update")
+	ctx = logging.With(logging.WithRequestID(ctx),
+		logging.KeyOperation, "demand.UseCase.Update",
+		logging.KeyNode, order.ID,
+	)
+	ctx, span := tracer.Start(ctx, "demand.UseCase.Update")
+	defer func() { telemetry.End(span, err) }()
+	edgeCount := 0
+	defer func() { logging.Done(ctx, "demand updated", err, "edges", edgeCount) }()
+	span.SetAttributes(attribute.String("demand.id", order.ID))
+
 	contractors, err := uc.supplyReader.FindBy(ctx, order)
 	if err != nil {
 		return err
@@ -36,6 +61,7 @@ func (uc *UseCase) Update(ctx context.Context, order demand.Demand) error {
 		area  = graph.Area("area")     // TODO: set area
 		ttl   = 15 * time.Minute       // TODO: make TTL configurable
 	)
+	ctx = logging.With(ctx, logging.KeyArea, string(area))
 	edges := make([]graph.Edge, 0, len(contractors))
 	for _, contractor := range contractors {
 		edges = append(edges, graph.Edge{
@@ -46,5 +72,7 @@ func (uc *UseCase) Update(ctx context.Context, order demand.Demand) error {
 			TTL:   ttl,
 		})
 	}
+	span.SetAttributes(attribute.Int("graph.edges", len(edges)))
+	edgeCount = len(edges)
 	return uc.graphBuilder.UpsertEdges(ctx, edges...)
 }
@@ -3,13 +3,21 @@ package supply
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/demand"
 	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
 	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/supply"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/logging"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/telemetry"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+var tracer = otel.Tracer(telemetry.ScopeName + "/usecase/supply")
+
 type demandReader interface {
 	FindBy(ctx context.Context, contractor supply.Supply) ([]demand.Demand, error)
 }
@@ -25,8 +33,28 @@ type UseCase struct {
 	graphBuilder graphBuilder
 }
 
+func New(demandReader demandReader, graphBuilder graphBuilder) *UseCase {
+	return &UseCase{
+		demandReader: demandReader,
+		graphBuilder: graphBuilder,
+	}
+}
+
 // Update обновляет ребра графа на основе нового события из топика водителей.
-func (uc *UseCase) Update(ctx context.Context, user supply.Supply) error {
+func (uc *UseCase) Update(ctx context.Context, user supply.Supply) (err error) {
+	ctx = graph.WithCause(ctx, "supply.UseCase.Update")
+	ctx = logging.With(logging.WithRequestID(ctx),
+		logging.KeyOperation, "supply.UseCase.Update",
+		logging.KeyNode, user.ID,
+	)
+	ctx, span := tracer.Start(ctx, "supply.UseCase.Update")
+	defer func() { telemetry.End(span, err) }()
+	var oldCount, newCount int
+	defer func() {
+		logging.Done(ctx, "supply updated", err, "old_edges", oldCount, "new_edges", newCount)
+	}()
+	span.SetAttributes(attribute.String("supply.id", user.ID))
+
 	orders, err := uc.demandReader.FindBy(ctx, user)
 	if err != nil {
 		return err
@@ -40,7 +68,10 @@ func (uc *UseCase) Update(ctx context.Context, user supply.Supply) error {
 		return err
 	}
 
-	var errr error
+	var (
+		errr    error
+		applied bool
+	)
 
 	// Remove old edges that are not in the current orders
 	if len(oldEdges) > 0 {
@@ -49,7 +80,7 @@ func (uc *UseCase) Update(ctx context.Context, user supply.Supply) error {
 			newOrders[order.ID] = struct{}{}
 		}
 
-		toRem := make([]graph.Edge, len(oldEdges))
+		toRem := make([]graph.Edge, 0, len(oldEdges))
 		for _, e := range oldEdges {
 			if _, ok := newOrders[e.From.String()]; !ok {
 				toRem = append(toRem, e)
@@ -57,6 +88,8 @@ func (uc *UseCase) Update(ctx context.Context, user supply.Supply) error {
 		}
 		if err = uc.graphBuilder.RemoveEdges(ctx, toRem...); err != nil {
 			errr = errors.Join(errr, err)
+		} else {
+			applied = len(toRem) > 0
 		}
 	}
 
@@ -66,6 +99,7 @@ func (uc *UseCase) Update(ctx context.Context, user supply.Supply) error {
 		ttl   = 15 * time.Minute       // TODO: make TTL configurable
 	)
 
+	ctx = logging.With(ctx, logging.KeyArea, string(area))
 	addEdges := make([]graph.Edge, 0, len(orders))
 	for _, order := range orders {
 		addEdges = append(addEdges, graph.Edge{
@@ -78,6 +112,17 @@ func (uc *UseCase) Update(ctx context.Context, user supply.Supply) error {
 	}
 	if err = uc.graphBuilder.UpsertEdges(ctx, addEdges...); err != nil {
 		errr = errors.Join(errr, err)
+	} else {
+		applied = true
+	}
+	span.SetAttributes(
+		attribute.Int("graph.edges.old", len(oldEdges)),
+		attribute.Int("graph.edges.new", len(addEdges)),
+	)
+	oldCount, newCount = len(oldEdges), len(addEdges)
+	if errr != nil && applied {
+		// Часть изменений уже записана: повтор события допишет остальные
+		return fmt.Errorf("%w: %w", graph.ErrPartialWrite, errr)
 	}
 	return errr
 }
@@ -0,0 +1,77 @@
+package supply
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/demand"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/graph"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/domain/supply"
+	"github.com/ashabykov/graph-building-in-dynamodb/internal/repository/graph/memory"
+)
+
+type fixedDemands []demand.Demand
+
+func (f *fixedDemands) FindBy(context.Context, supply.Supply) ([]demand.Demand, error) {
+	return *f, nil
+}
+
+func TestUseCase_Update(t *testing.T) {
+	t.Run("Edges of demands out of reach are removed", func(t *testing.T) {
+		// Репозиторий в памяти проверяет рёбра, как и DynamoDB
+		repo := memory.New()
+		demands := &fixedDemands{{ID: "d1"}, {ID: "d2"}}
+		uc := New(demands, repo)
+
+		assert.NoError(t, uc.Update(context.Background(), supply.Supply{ID: "s1"}))
+		edges, err := repo.ReadSupplyEdges(context.Background(), "s1")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []graph.Node{"d1", "d2"}, demandNodes(edges))
+
+		*demands = fixedDemands{{ID: "d2"}, {ID: "d3"}}
+		assert.NoError(t, uc.Update(context.Background(), supply.Supply{ID: "s1"}))
+		edges, err = repo.ReadSupplyEdges(context.Background(), "s1")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []graph.Node{"d2", "d3"}, demandNodes(edges))
+	})
+
+	t.Run("Unchanged demands remove nothing", func(t *testing.T) {
+		repo := memory.New()
+		demands := &fixedDemands{{ID: "d1"}}
+		uc := New(demands, repo)
+
+		assert.NoError(t, uc.Update(context.Background(), supply.Supply{ID: "s1"}))
+		assert.NoError(t, uc.Update(context.Background(), supply.Supply{ID: "s1"}))
+		size, err := repo.Size(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, size)
+	})
+
+	t.Run("A rejected upsert after a removal is a partial write", func(t *testing.T) {
+		repo := memory.New()
+		demands := &fixedDemands{{ID: "d1"}}
+		assert.NoError(t, New(demands, repo).Update(context.Background(), supply.Supply{ID: "s1"}))
+
+		*demands = fixedDemands{{ID: "d2"}}
+		err := New(demands, rejectingUpserts{repo}).Update(context.Background(), supply.Supply{ID: "s1"})
+		assert.ErrorIs(t, err, graph.ErrPartialWrite)
+		assert.ErrorIs(t, err, graph.ErrInvalidEdge)
+	})
+}
+
+// rejectingUpserts removes edges but rejects every upsert.
+type rejectingUpserts struct{ *memory.Repository }
+
+func (r rejectingUpserts) UpsertEdges(context.Context, ...graph.Edge) error {
+	return &graph.ValidationError{}
+}
+
+func demandNodes(edges []graph.Edge) []graph.Node {
+	nodes := make([]graph.Node, 0, len(edges))
+	for _, e := range edges {
+		nodes = append(nodes, e.From)
+	}
+	return nodes
+}